@@ -0,0 +1,143 @@
+package crawl
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AnomalyThresholds tune what Anomalies considers unusual.
+type AnomalyThresholds struct {
+	// Depth is the number of path segments directories are grouped by.
+	Depth int
+	// MinPages is the number of pages a directory needs before it is
+	// flagged, as mixes in small directories are rarely meaningful.
+	MinPages int
+	// MaxContentTypes is the number of distinct content types a directory
+	// may serve before it is flagged.
+	MaxContentTypes int
+	// OddTypeRate flags content types served for less than this fraction
+	// of a directory's pages, e.g. a text/plain page amongst HTML ones.
+	OddTypeRate float64
+	// NotFoundRate flags directories where more than this fraction of
+	// pages are 404s.
+	NotFoundRate float64
+}
+
+// DefaultAnomalyThresholds are reasonable thresholds for most sites.
+var DefaultAnomalyThresholds = AnomalyThresholds{
+	Depth:           1,
+	MinPages:        5,
+	MaxContentTypes: 3,
+	OddTypeRate:     0.2,
+	NotFoundRate:    0.5,
+}
+
+// Directory is the mix of responses served from a path directory.
+type Directory struct {
+	// Path is the directory's first Depth segments, e.g. /uploads.
+	Path  string
+	Pages int
+	// ContentTypes and StatusCodes count the pages served with each.
+	// Pages without a Content-Type are counted under "".
+	ContentTypes map[string]int
+	StatusCodes  map[int]int
+	// Problems are the reasons the directory was flagged, if any.
+	Problems []string
+}
+
+// Anomalies groups the results of a crawl by directory, and flags those
+// serving an unusual mix of content types or status codes, which can reveal
+// misconfigured servers, e.g. source files served as text/plain from an
+// uploads directory. Pages that failed without a response are ignored.
+// Flagged directories are sorted first, then by number of pages, largest
+// first.
+func Anomalies(results []Result, t AnomalyThresholds) []Directory {
+	dirs := make(map[string]*Directory)
+	for _, r := range results {
+		if r.StatusCode == 0 {
+			continue
+		}
+		path := directoryOfURL(r.URL, t.Depth)
+		d := dirs[path]
+		if d == nil {
+			d = &Directory{Path: path, ContentTypes: make(map[string]int), StatusCodes: make(map[int]int)}
+			dirs[path] = d
+		}
+		d.Pages++
+		d.StatusCodes[r.StatusCode]++
+		// Error pages are often served as HTML whatever the directory
+		// holds, so only successful responses tell us its content.
+		if r.StatusCode < 400 {
+			d.ContentTypes[r.ContentType]++
+		}
+	}
+
+	report := make([]Directory, 0, len(dirs))
+	for _, d := range dirs {
+		d.Problems = t.problems(d)
+		report = append(report, *d)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if (len(report[i].Problems) > 0) != (len(report[j].Problems) > 0) {
+			return len(report[i].Problems) > 0
+		}
+		if report[i].Pages != report[j].Pages {
+			return report[i].Pages > report[j].Pages
+		}
+		return report[i].Path < report[j].Path
+	})
+	return report
+}
+
+// problems returns the reasons a directory is unusual.
+func (t AnomalyThresholds) problems(d *Directory) []string {
+	if d.Pages < t.MinPages {
+		return nil
+	}
+	var problems []string
+	if n := len(d.ContentTypes); n > t.MaxContentTypes {
+		problems = append(problems, fmt.Sprintf("serves %d content types", n))
+	}
+
+	ok, common := 0, ""
+	for ct, n := range d.ContentTypes {
+		ok += n
+		if n > d.ContentTypes[common] || (n == d.ContentTypes[common] && ct < common) {
+			common = ct
+		}
+	}
+	for ct, n := range d.ContentTypes {
+		if float64(n) < t.OddTypeRate*float64(ok) {
+			problems = append(problems, fmt.Sprintf("serves %d of %d pages as %s, unlike the rest (mostly %s)", n, ok, typeName(ct), typeName(common)))
+		}
+	}
+
+	if n := d.StatusCodes[404]; float64(n) > t.NotFoundRate*float64(d.Pages) {
+		problems = append(problems, fmt.Sprintf("%d of %d pages are 404s", n, d.Pages))
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func typeName(ct string) string {
+	if ct == "" {
+		return "no content type"
+	}
+	return ct
+}
+
+// directoryOfURL returns the directory a URL's page is in, as its first
+// depth path segments, decoded and lowercased like sections.
+func directoryOfURL(addr string, depth int) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "/"
+	}
+	dir := u.Path
+	if i := strings.LastIndexByte(dir, '/'); i >= 0 {
+		dir = dir[:i+1]
+	}
+	return sectionOfPath(dir, depth)
+}
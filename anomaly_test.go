@@ -0,0 +1,60 @@
+package crawl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnomalies(t *testing.T) {
+	var results []Result
+	add := func(n int, path string, status int, ct string) {
+		for i := 0; i < n; i++ {
+			results = append(results, Result{URL: fmt.Sprintf("https://monzo.com%s%d", path, i), StatusCode: status, ContentType: ct})
+		}
+	}
+	add(8, "/uploads/", 200, "image/png")
+	add(1, "/uploads/shell.php", 200, "text/plain")
+	add(6, "/blog/", 200, "text/html")
+	add(1, "/blog/missing", 404, "text/html")
+	add(2, "/old/", 404, "text/html")
+	add(1, "/old/", 200, "text/html")
+	add(2, "/tiny/", 200, "application/octet-stream")
+	results = append(results, Result{URL: "https://monzo.com/blog/down", Err: errors.New("connection refused")})
+
+	th := DefaultAnomalyThresholds
+	th.MinPages = 3
+	want := []Directory{
+		{
+			Path:         "/uploads",
+			Pages:        9,
+			ContentTypes: map[string]int{"image/png": 8, "text/plain": 1},
+			StatusCodes:  map[int]int{200: 9},
+			Problems:     []string{"serves 1 of 9 pages as text/plain, unlike the rest (mostly image/png)"},
+		},
+		{
+			Path:         "/old",
+			Pages:        3,
+			ContentTypes: map[string]int{"text/html": 1},
+			StatusCodes:  map[int]int{200: 1, 404: 2},
+			Problems:     []string{"2 of 3 pages are 404s"},
+		},
+		{
+			Path:         "/blog",
+			Pages:        7,
+			ContentTypes: map[string]int{"text/html": 6},
+			StatusCodes:  map[int]int{200: 6, 404: 1},
+		},
+		{
+			Path:         "/tiny",
+			Pages:        2,
+			ContentTypes: map[string]int{"application/octet-stream": 2},
+			StatusCodes:  map[int]int{200: 2},
+		},
+	}
+	if diff := cmp.Diff(want, Anomalies(results, th)); diff != "" {
+		t.Errorf("Anomalies() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,128 @@
+package crawl
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestAPI checks the package's exported API against testdata/api.golden, so
+// that changes to it are deliberate. Removing or changing a symbol breaks
+// users; adding one is compatible, but must be recorded with -update.
+func TestAPI(t *testing.T) {
+	got := exportedAPI(t, ".")
+	golden := filepath.Join("testdata", "api.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(strings.Join(got, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	b, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+
+	gotSet := make(map[string]bool, len(got))
+	for _, s := range got {
+		gotSet[s] = true
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, s := range want {
+		wantSet[s] = true
+		if !gotSet[s] {
+			t.Errorf("incompatible API change: %s was removed or changed", s)
+		}
+	}
+	for _, s := range got {
+		if !wantSet[s] {
+			t.Errorf("compatible API change: %s was added; run with -update to accept it", s)
+		}
+	}
+}
+
+// exportedAPI returns a line describing each exported symbol of the package
+// in dir: its functions and methods with their signatures, its types and
+// the exported fields of its structs, and its constants and variables.
+func exportedAPI(t *testing.T, dir string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("failed to parse package: %v", err)
+	}
+	format := func(n ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+
+	var api []string
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if !d.Name.IsExported() {
+						continue
+					}
+					name := d.Name.Name
+					if d.Recv != nil {
+						recv := d.Recv.List[0].Type
+						if star, ok := recv.(*ast.StarExpr); ok {
+							recv = star.X
+						}
+						if !ast.IsExported(format(recv)) {
+							continue
+						}
+						name = format(d.Recv.List[0].Type) + "." + name
+					}
+					api = append(api, "func "+name+strings.TrimPrefix(format(d.Type), "func"))
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch s := spec.(type) {
+						case *ast.TypeSpec:
+							if !s.Name.IsExported() {
+								continue
+							}
+							st, ok := s.Type.(*ast.StructType)
+							if !ok {
+								api = append(api, "type "+s.Name.Name+" "+format(s.Type))
+								continue
+							}
+							api = append(api, "type "+s.Name.Name+" struct")
+							for _, field := range st.Fields.List {
+								for _, n := range field.Names {
+									if n.IsExported() {
+										api = append(api, "field "+s.Name.Name+"."+n.Name+" "+format(field.Type))
+									}
+								}
+								if len(field.Names) == 0 {
+									api = append(api, "embedded "+s.Name.Name+" "+format(field.Type))
+								}
+							}
+						case *ast.ValueSpec:
+							for _, n := range s.Names {
+								if n.IsExported() {
+									api = append(api, d.Tok.String()+" "+n.Name)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(api)
+	return api
+}
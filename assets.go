@@ -0,0 +1,22 @@
+package crawl
+
+// Asset is a URL a page references other than by a link to follow, such as
+// a stylesheet, frame or image, collected from the attributes configured
+// with WithAssets.
+type Asset struct {
+	// URL is the attribute's raw value, as a link's href is kept.
+	URL string
+	// Tag is the name of the element it was found on, e.g. "iframe".
+	Tag string
+}
+
+// DefaultAssetAttributes are the attributes, by element name, of the
+// references a browser loads along with a page, or navigates to from it,
+// besides its anchors. Images and scripts aren't included, as there are
+// usually many; add {"img": {"src"}, "script": {"src"}} to collect them.
+var DefaultAssetAttributes = map[string][]string{
+	"link":   {"href"},
+	"area":   {"href"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+}
@@ -0,0 +1,191 @@
+package crawl
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// breadcrumbsFromJSONLD returns the names in the first BreadcrumbList found
+// in a JSON-LD script, in position order, or nil if there is none.
+func breadcrumbsFromJSONLD(script string) []string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(script), &v); err != nil {
+		return nil
+	}
+	list := findBreadcrumbList(v)
+	if list == nil {
+		return nil
+	}
+	elems, _ := list["itemListElement"].([]interface{})
+
+	type crumb struct {
+		pos  float64
+		name string
+	}
+	var crumbs []crumb
+	for i, e := range elems {
+		item, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		c := crumb{pos: float64(i), name: jsonString(item["name"])}
+		switch p := item["position"].(type) {
+		case float64:
+			c.pos = p
+		case string:
+			json.Unmarshal([]byte(p), &c.pos)
+		}
+		if c.name == "" {
+			switch it := item["item"].(type) {
+			case map[string]interface{}:
+				c.name = jsonString(it["name"])
+				if c.name == "" {
+					c.name = jsonString(it["@id"])
+				}
+			case string:
+				c.name = it
+			}
+		}
+		crumbs = append(crumbs, c)
+	}
+	sort.SliceStable(crumbs, func(i, j int) bool { return crumbs[i].pos < crumbs[j].pos })
+
+	names := make([]string, 0, len(crumbs))
+	for _, c := range crumbs {
+		names = append(names, strings.Join(strings.Fields(c.name), " "))
+	}
+	return names
+}
+
+// findBreadcrumbList searches JSON-LD for a BreadcrumbList, including in
+// arrays and @graph.
+func findBreadcrumbList(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			if l := findBreadcrumbList(e); l != nil {
+				return l
+			}
+		}
+	case map[string]interface{}:
+		switch t := v["@type"].(type) {
+		case string:
+			if t == "BreadcrumbList" {
+				return v
+			}
+		case []interface{}:
+			for _, tt := range t {
+				if tt == "BreadcrumbList" {
+					return v
+				}
+			}
+		}
+		return findBreadcrumbList(v["@graph"])
+	}
+	return nil
+}
+
+func jsonString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// isBreadcrumbNav returns whether n is breadcrumb navigation, marked up as
+// <nav aria-label="breadcrumb">.
+func isBreadcrumbNav(n *html.Node) bool {
+	label, _ := attr(n, "aria-label")
+	return n.Data == "nav" && strings.Contains(strings.ToLower(label), "breadcrumb")
+}
+
+// breadcrumbsFromNav returns the trail in breadcrumb navigation: the text of
+// each list item or, if it has no list, each link.
+func breadcrumbsFromNav(nav *html.Node) []string {
+	var items, links []string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "li":
+				items = append(items, strings.Join(strings.Fields(text(n)), " "))
+				return
+			case "a":
+				links = append(links, strings.Join(strings.Fields(text(n)), " "))
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(nav)
+	if len(items) > 0 {
+		return items
+	}
+	return links
+}
+
+// BreadcrumbMismatch is a page whose breadcrumb trail implies a different
+// depth in the site to the one it was found at.
+type BreadcrumbMismatch struct {
+	URL         string
+	Breadcrumbs []string
+	// BreadcrumbDepth is the number of crumbs above the page, and
+	// CrawlDepth the number of links followed to reach it.
+	BreadcrumbDepth int
+	CrawlDepth      int
+}
+
+// BreadcrumbReport compares the hierarchy pages declare with their
+// breadcrumbs against the link graph.
+type BreadcrumbReport struct {
+	// With and Without count the successfully fetched pages with and
+	// without breadcrumbs.
+	With, Without int
+	// Mismatches are sorted by the size of the difference, largest first.
+	Mismatches []BreadcrumbMismatch
+}
+
+// NewBreadcrumbReport builds a BreadcrumbReport from the results of a crawl
+// run WithBreadcrumbs, flagging pages whose breadcrumb and crawl depths
+// differ by more than threshold. A trail's first crumb is taken to be the
+// starting page, so a trail of Home > Docs > Page has depth 2.
+func NewBreadcrumbReport(results []Result, threshold int) BreadcrumbReport {
+	var r BreadcrumbReport
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		if len(res.Breadcrumbs) == 0 {
+			r.Without++
+			continue
+		}
+		r.With++
+		m := BreadcrumbMismatch{
+			URL:             res.URL,
+			Breadcrumbs:     res.Breadcrumbs,
+			BreadcrumbDepth: len(res.Breadcrumbs) - 1,
+			CrawlDepth:      res.Depth,
+		}
+		if abs(m.BreadcrumbDepth-m.CrawlDepth) > threshold {
+			r.Mismatches = append(r.Mismatches, m)
+		}
+	}
+	sort.Slice(r.Mismatches, func(i, j int) bool {
+		a, b := r.Mismatches[i], r.Mismatches[j]
+		if da, db := abs(a.BreadcrumbDepth-a.CrawlDepth), abs(b.BreadcrumbDepth-b.CrawlDepth); da != db {
+			return da > db
+		}
+		return a.URL < b.URL
+	})
+	return r
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
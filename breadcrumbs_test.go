@@ -0,0 +1,82 @@
+package crawl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBreadcrumbs(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "json-ld",
+			body: `<script type="application/ld+json">{
+				"@context": "https://schema.org",
+				"@graph": [
+					{"@type": "WebPage", "name": "Ignored"},
+					{"@type": "BreadcrumbList", "itemListElement": [
+						{"@type": "ListItem", "position": 3, "name": "Cards"},
+						{"@type": "ListItem", "position": 1, "item": {"@id": "https://monzo.com/", "name": "Home"}},
+						{"@type": "ListItem", "position": "2", "name": " Help \n centre "}
+					]}
+				]
+			}</script>`,
+			want: []string{"Home", "Help centre", "Cards"},
+		},
+		{
+			name: "nav list",
+			body: `<nav aria-label="Breadcrumb"><ol><li><a href="/">Home</a></li><li><a href="/help">Help</a></li><li>Cards</li></ol></nav>`,
+			want: []string{"Home", "Help", "Cards"},
+		},
+		{
+			name: "nav links",
+			body: `<nav aria-label="breadcrumbs"><a href="/">Home</a> &gt; <a href="/help">Help</a></nav>`,
+			want: []string{"Home", "Help"},
+		},
+		{
+			name: "json-ld preferred",
+			body: `<nav aria-label="breadcrumb"><a href="/">Markup</a></nav>
+				<script type="application/ld+json">{"@type": "BreadcrumbList", "itemListElement": [{"position": 1, "name": "JSON"}]}</script>`,
+			want: []string{"JSON"},
+		},
+		{
+			name: "other nav",
+			body: `<nav aria-label="main"><ol><li>Home</li></ol></nav><script type="application/ld+json">not json</script>`,
+		},
+	}
+	for _, tc := range cases {
+		s, err := scrape([]byte(tc.body), nil, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: scrape erred when not expected: %v", tc.name, err)
+		}
+		if diff := cmp.Diff(tc.want, s.breadcrumbs); diff != "" {
+			t.Errorf("%s: breadcrumbs mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestBreadcrumbReport(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com", Breadcrumbs: []string{"Home"}},
+		{URL: "https://monzo.com/help", Depth: 1, Breadcrumbs: []string{"Home", "Help"}},
+		{URL: "https://monzo.com/help/cards", Depth: 4, Breadcrumbs: []string{"Home", "Help", "Cards"}},
+		{URL: "https://monzo.com/legal", Depth: 1, Breadcrumbs: []string{"Home", "About", "Legal", "Terms", "Cookies"}},
+		{URL: "https://monzo.com/blog", Depth: 1},
+	}
+
+	want := BreadcrumbReport{
+		With:    4,
+		Without: 1,
+		Mismatches: []BreadcrumbMismatch{
+			{URL: "https://monzo.com/legal", Breadcrumbs: []string{"Home", "About", "Legal", "Terms", "Cookies"}, BreadcrumbDepth: 4, CrawlDepth: 1},
+			{URL: "https://monzo.com/help/cards", Breadcrumbs: []string{"Home", "Help", "Cards"}, BreadcrumbDepth: 2, CrawlDepth: 4},
+		},
+	}
+	if diff := cmp.Diff(want, NewBreadcrumbReport(results, 1)); diff != "" {
+		t.Errorf("NewBreadcrumbReport() mismatch (-want +got):\n%s", diff)
+	}
+}
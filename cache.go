@@ -0,0 +1,262 @@
+package crawl
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CacheHeaders are the response headers CacheReport needs captured, with
+// WithHeaderCapture.
+var CacheHeaders = []string{"Cache-Control", "Expires", "Vary"}
+
+// CachePolicy is a combination of caching headers a page was served with,
+// normalized so that equivalent headers compare equal.
+type CachePolicy struct {
+	// CacheControl are the Cache-Control directives, lowercased and
+	// sorted, e.g. "max-age=300, public".
+	CacheControl string `json:",omitempty"`
+	// Expires is set if the page had an Expires header. Its value is a
+	// date, which differs from page to page, so isn't kept.
+	Expires bool `json:",omitempty"`
+	// Vary are the header names in Vary, lowercased and sorted.
+	Vary string `json:",omitempty"`
+}
+
+func (p CachePolicy) String() string {
+	var parts []string
+	if p.CacheControl != "" {
+		parts = append(parts, "Cache-Control: "+p.CacheControl)
+	}
+	if p.Expires {
+		parts = append(parts, "Expires")
+	}
+	if p.Vary != "" {
+		parts = append(parts, "Vary: "+p.Vary)
+	}
+	if len(parts) == 0 {
+		return "no caching headers"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// MaxAge returns the number of seconds shared caches, such as CDNs, may
+// serve a page without revalidating it: its s-maxage directive, or else its
+// max-age. It returns false if it has neither.
+func (p CachePolicy) MaxAge() (int64, bool) {
+	var maxAge int64 = -1
+	for _, d := range parseCacheControl(p.CacheControl) {
+		n, err := strconv.ParseInt(d.value, 10, 64)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch d.name {
+		case "s-maxage":
+			return n, true
+		case "max-age":
+			if maxAge < 0 {
+				maxAge = n
+			}
+		}
+	}
+	return maxAge, maxAge >= 0
+}
+
+// PolicyCount is the number of pages served with a CachePolicy.
+type PolicyCount struct {
+	Policy CachePolicy
+	Pages  int
+}
+
+// CacheGroup is the distribution of the cache policies of a group of pages:
+// their page group, if set with WithURLTemplates, or else their section.
+type CacheGroup struct {
+	Group string
+	Pages int
+	// Policies are sorted by number of pages, most first. More than one
+	// means the group's pages are cached inconsistently.
+	Policies []PolicyCount
+}
+
+// CacheHostilePage is a page whose caching headers keep it out of CDN
+// caches.
+type CacheHostilePage struct {
+	URL    string
+	Reason string
+}
+
+// CacheReport analyzes the consistency of the caching headers of a crawl's
+// pages, captured with WithHeaderCapture(CacheHeaders...). Only successful
+// (200) responses are considered.
+type CacheReport struct {
+	// Policies are the distinct combinations of caching headers, by
+	// number of pages, most first.
+	Policies []PolicyCount
+	// Groups are the groups of pages, those with the most distinct
+	// policies first.
+	Groups []CacheGroup
+	// Hostile are the pages served with no caching headers, or with
+	// Vary: *, which no cache can reuse, sorted by URL.
+	Hostile []CacheHostilePage `json:",omitempty"`
+}
+
+// NewCacheReport builds a CacheReport from the results of a crawl. Pages
+// without a PageGroup are grouped by the first depth segments of their
+// paths, as by SectionSummary.
+func NewCacheReport(results []Result, depth int) CacheReport {
+	var report CacheReport
+	policies := make(map[CachePolicy]int)
+	groups := make(map[string]map[CachePolicy]int)
+	for _, r := range results {
+		if r.StatusCode != http.StatusOK {
+			continue
+		}
+		p := cachePolicy(r.Headers)
+		policies[p]++
+		group := r.PageGroup
+		if group == "" {
+			group = sectionOf(r.URL, depth)
+		}
+		if groups[group] == nil {
+			groups[group] = make(map[CachePolicy]int)
+		}
+		groups[group][p]++
+		switch {
+		case p.CacheControl == "" && !p.Expires:
+			report.Hostile = append(report.Hostile, CacheHostilePage{URL: r.URL, Reason: "no caching headers"})
+		case p.Vary == "*":
+			report.Hostile = append(report.Hostile, CacheHostilePage{URL: r.URL, Reason: "Vary: *"})
+		}
+	}
+
+	report.Policies = policyCounts(policies)
+	for name, counts := range groups {
+		g := CacheGroup{Group: name, Policies: policyCounts(counts)}
+		for _, pc := range g.Policies {
+			g.Pages += pc.Pages
+		}
+		report.Groups = append(report.Groups, g)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if len(a.Policies) != len(b.Policies) {
+			return len(a.Policies) > len(b.Policies)
+		}
+		if a.Pages != b.Pages {
+			return a.Pages > b.Pages
+		}
+		return a.Group < b.Group
+	})
+	sort.Slice(report.Hostile, func(i, j int) bool { return report.Hostile[i].URL < report.Hostile[j].URL })
+	return report
+}
+
+// policyCounts returns the counts of policies, most pages first.
+func policyCounts(m map[CachePolicy]int) []PolicyCount {
+	counts := make([]PolicyCount, 0, len(m))
+	for p, n := range m {
+		counts = append(counts, PolicyCount{Policy: p, Pages: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Pages != counts[j].Pages {
+			return counts[i].Pages > counts[j].Pages
+		}
+		return counts[i].Policy.String() < counts[j].Policy.String()
+	})
+	return counts
+}
+
+// cachePolicy returns the normalized policy of a response's headers.
+func cachePolicy(h http.Header) CachePolicy {
+	var p CachePolicy
+	if values := h["Cache-Control"]; len(values) > 0 {
+		directives := parseCacheControl(strings.Join(values, ","))
+		sort.SliceStable(directives, func(i, j int) bool { return directives[i].name < directives[j].name })
+		parts := make([]string, len(directives))
+		for i, d := range directives {
+			parts[i] = d.String()
+		}
+		p.CacheControl = strings.Join(parts, ", ")
+	}
+	p.Expires = len(h["Expires"]) > 0
+	if values := h["Vary"]; len(values) > 0 {
+		seen := make(map[string]bool)
+		var names []string
+		for _, v := range values {
+			for _, name := range strings.Split(v, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name != "" && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		if seen["*"] {
+			names = []string{"*"}
+		}
+		p.Vary = strings.Join(names, ", ")
+	}
+	return p
+}
+
+// cacheDirective is a Cache-Control directive, with its value unquoted.
+type cacheDirective struct {
+	name  string
+	value string
+	// quoted is set if the value was a quoted string, e.g. the field
+	// names of no-cache="Set-Cookie".
+	quoted bool
+}
+
+func (d cacheDirective) String() string {
+	switch {
+	case d.quoted:
+		return d.name + "=" + strconv.Quote(d.value)
+	case d.value != "":
+		return d.name + "=" + d.value
+	}
+	return d.name
+}
+
+// parseCacheControl splits a Cache-Control header into its directives, as
+// RFC 7234 section 5.2 tokenizes it: comma separated, each a name and an
+// optional value, which may be a quoted string containing commas. Names
+// are case insensitive, so are lowercased. Empty elements are skipped.
+func parseCacheControl(v string) []cacheDirective {
+	var directives []cacheDirective
+	for len(v) > 0 {
+		var element string
+		element, v = nextCacheElement(v)
+		d := cacheDirective{name: element}
+		if i := strings.IndexByte(element, '='); i >= 0 {
+			d.name, d.value = element[:i], strings.TrimSpace(element[i+1:])
+			if unquoted, err := strconv.Unquote(d.value); err == nil && strings.HasPrefix(d.value, `"`) {
+				d.value, d.quoted = unquoted, true
+			}
+		}
+		d.name = strings.ToLower(strings.TrimSpace(d.name))
+		if d.name != "" {
+			directives = append(directives, d)
+		}
+	}
+	return directives
+}
+
+// nextCacheElement returns the first comma separated element of v, not
+// splitting quoted strings, and the rest of v after its comma.
+func nextCacheElement(v string) (element, rest string) {
+	quoted := false
+	for i := 0; i < len(v); i++ {
+		switch {
+		case quoted && v[i] == '\\':
+			i++
+		case v[i] == '"':
+			quoted = !quoted
+		case v[i] == ',' && !quoted:
+			return v[:i], v[i+1:]
+		}
+	}
+	return v, ""
+}
@@ -0,0 +1,109 @@
+package crawl
+
+import (
+	"net/http"
+	"testing"
+
+	"crawl/crawltest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCachePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		header http.Header
+		want   CachePolicy
+	}{
+		{nil, CachePolicy{}},
+		// Directives are case insensitive, and their order doesn't matter.
+		{http.Header{"Cache-Control": {"Public, MAX-AGE=300"}}, CachePolicy{CacheControl: "max-age=300, public"}},
+		{http.Header{"Cache-Control": {"public", "max-age=300"}}, CachePolicy{CacheControl: "max-age=300, public"}},
+		// Quoted values may contain commas, and are kept quoted.
+		{http.Header{"Cache-Control": {`private="Set-Cookie, X-User", no-store`}}, CachePolicy{CacheControl: `no-store, private="Set-Cookie, X-User"`}},
+		{http.Header{"Cache-Control": {" , no-cache,,"}}, CachePolicy{CacheControl: "no-cache"}},
+		// Expires is a date, so only its presence is kept.
+		{http.Header{"Expires": {"Thu, 01 Dec 1994 16:00:00 GMT"}}, CachePolicy{Expires: true}},
+		{http.Header{"Vary": {"Accept-Encoding, cookie", "Cookie"}}, CachePolicy{Vary: "accept-encoding, cookie"}},
+		{http.Header{"Vary": {"Accept-Encoding, *"}}, CachePolicy{Vary: "*"}},
+	} {
+		if got := cachePolicy(tc.header); got != tc.want {
+			t.Errorf("cachePolicy(%v) = %+v, want %+v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestCachePolicyMaxAge(t *testing.T) {
+	for cc, want := range map[string]int64{
+		"max-age=300, public":               300,
+		"max-age=300, s-maxage=3600":        3600,
+		`max-age="60"`:                      60,
+		"no-store":                          -1,
+		"max-age=soon":                      -1,
+		"max-age=-1, s-maxage=x, max-age=5": 5,
+	} {
+		got, ok := CachePolicy{CacheControl: cc}.MaxAge()
+		if !ok {
+			got = -1
+		}
+		if got != want {
+			t.Errorf("MaxAge() of %q = %d, %v, want %d", cc, got, ok, want)
+		}
+	}
+}
+
+func TestCacheReport(t *testing.T) {
+	cached := http.Header{"Cache-Control": {"public, max-age=300"}}
+	results := []Result{
+		{URL: "https://monzo.com/blog/a", StatusCode: 200, Headers: cached},
+		{URL: "https://monzo.com/blog/b", StatusCode: 200, Headers: http.Header{"Cache-Control": {"max-age=300,PUBLIC"}}},
+		{URL: "https://monzo.com/blog/c", StatusCode: 200},
+		{URL: "https://monzo.com/help/a", StatusCode: 200, Headers: cached},
+		{URL: "https://monzo.com/help/b", StatusCode: 200, Headers: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}},
+		{URL: "https://monzo.com/product/1", StatusCode: 200, PageGroup: "/product/{id}", Headers: cached},
+		// Only successful responses are considered.
+		{URL: "https://monzo.com/blog/missing", StatusCode: 404},
+	}
+	public := CachePolicy{CacheControl: "max-age=300, public"}
+	varyAll := CachePolicy{CacheControl: "max-age=60", Vary: "*"}
+	want := CacheReport{
+		Policies: []PolicyCount{{public, 4}, {varyAll, 1}, {CachePolicy{}, 1}},
+		Groups: []CacheGroup{
+			{Group: "/blog", Pages: 3, Policies: []PolicyCount{{public, 2}, {CachePolicy{}, 1}}},
+			{Group: "/help", Pages: 2, Policies: []PolicyCount{{public, 1}, {varyAll, 1}}},
+			{Group: "/product/{id}", Pages: 1, Policies: []PolicyCount{{public, 1}}},
+		},
+		Hostile: []CacheHostilePage{
+			{URL: "https://monzo.com/blog/c", Reason: "no caching headers"},
+			{URL: "https://monzo.com/help/b", Reason: "Vary: *"},
+		},
+	}
+	if diff := cmp.Diff(want, NewCacheReport(results, 1)); diff != "" {
+		t.Errorf("NewCacheReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeaderCapture(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com/", crawltest.Response{Header: http.Header{
+		"Content-Type":  {"text/html"},
+		"Cache-Control": {"no-cache"},
+		"Set-Cookie":    {"session=1"},
+	}})
+	got, err := NewCrawler(1, WithTransportMiddleware(site.Wrap), WithHeaderCapture("cache-control", "Vary")).Crawl("https://monzo.com")
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Crawl() = %v, %v, want one result", got, err)
+	}
+	if diff := cmp.Diff(http.Header{"Cache-Control": {"no-cache"}}, got[0].Headers); diff != "" {
+		t.Errorf("Headers mismatch (-want +got):\n%s", diff)
+	}
+
+	// Each use adds to the headers captured.
+	c := NewCrawler(1, WithHeaderCapture("Set-Cookie", "vary"), WithHeaderCapture(CacheHeaders...))
+	if diff := cmp.Diff([]string{"Set-Cookie", "Vary", "Cache-Control", "Expires"}, c.Config().CaptureHeaders); diff != "" {
+		t.Errorf("CaptureHeaders mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := NewCrawler(1, WithHeaderCapture("")).err; err == nil {
+		t.Errorf("WithHeaderCapture(\"\") accepted, want an error")
+	}
+}
@@ -0,0 +1,258 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// LinkCheck is the outcome of checking a link found on the pages given to
+// CheckPages.
+type LinkCheck struct {
+	// URL is the link, resolved and normalized as the crawl would.
+	URL string
+	// External is set for links off the site of the page they were found
+	// on, which are checked with a HEAD request rather than a GET.
+	External bool `json:",omitempty"`
+	// StatusCode is that of the response, or 0 if there was none.
+	StatusCode int `json:",omitempty"`
+	// Err is why the link is broken, or "" if it isn't.
+	Err string `json:",omitempty"`
+	// Disallowed is set if the link wasn't checked because robots.txt
+	// disallows it. It isn't counted as broken.
+	Disallowed bool `json:",omitempty"`
+	// AccessControlled is set if StatusCode was accepted with
+	// WithAcceptableStatuses. It isn't counted as broken.
+	AccessControlled bool `json:",omitempty"`
+	// Pages are the checked pages linking to it, sorted.
+	Pages []string
+}
+
+// Broken reports whether the link is broken.
+func (l LinkCheck) Broken() bool {
+	return l.Err != "" && !l.Disallowed
+}
+
+// CheckReport is the outcome of CheckPages.
+type CheckReport struct {
+	// Pages are the results of fetching the pages checked, in the order
+	// given.
+	Pages []Result
+	// Links are the links found on them, sorted by URL.
+	Links []LinkCheck
+}
+
+// Broken returns the pages that couldn't be fetched, as LinkChecks without
+// any linking Pages, then the broken links found on the rest.
+func (r CheckReport) Broken() []LinkCheck {
+	var broken []LinkCheck
+	for _, p := range r.Pages {
+		if p.Err != nil && !errors.Is(p.Err, ErrDisallowed) {
+			broken = append(broken, LinkCheck{URL: p.URL, StatusCode: p.StatusCode, Err: p.Err.Error()})
+		}
+	}
+	for _, l := range r.Links {
+		if l.Broken() {
+			broken = append(broken, l)
+		}
+	}
+	return broken
+}
+
+// CheckPages fetches just the given pages, e.g. those changed by an edit to
+// a site, and checks every link on them, without crawling any further.
+// Links on the site of the page they are found on, or an allowed host, are
+// fetched with a GET, as the crawl would, and others with a HEAD. Each
+// distinct link is checked once, and pages linking to one another aren't
+// fetched twice. The checks are made by as many fetchers as the crawler
+// has. As with Crawl, it returns ErrCrawlerBusy if the crawler is already
+// running a crawl or check.
+func (c Crawler) CheckPages(ctx context.Context, pages []string) (CheckReport, error) {
+	if c.err != nil {
+		return CheckReport{}, c.err
+	}
+	free, err := c.reserve()
+	if err != nil {
+		return CheckReport{}, err
+	}
+	defer free()
+	c.counters.reset(c.clock.Now())
+	c.robots.reset()
+	c.delays.reset()
+
+	report := CheckReport{Pages: make([]Result, len(pages))}
+	fetched := make(map[string]*Result, len(pages))
+	c.parallel(len(pages), func(i int) {
+		r, err := c.guardedFetch(ctx, pages[i])
+		r.URL, r.Err = pages[i], err
+		report.Pages[i] = r
+	})
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	for i := range report.Pages {
+		if u, err := url.Parse(pages[i]); err == nil {
+			fetched[c.visitKey(normalize(u))] = &report.Pages[i]
+		}
+	}
+
+	// Collect the distinct links, by the key they are deduplicated with:
+	// the visit key for internal links, and the URL for external ones.
+	links := make(map[string]*LinkCheck)
+	var keys []string
+	for i := range report.Pages {
+		page := &report.Pages[i]
+		root, err := url.Parse(page.URL)
+		if err != nil {
+			continue
+		}
+		base, err := url.Parse(page.base())
+		if err != nil {
+			continue
+		}
+		for _, l := range c.followedLinks(*page) {
+			st := linkState{root: root, base: base, page: page.URL, href: l}
+			_, internal := c.filterLink(&st, nil)
+			if st.invalid != nil {
+				page.InvalidLinks = append(page.InvalidLinks, *st.invalid)
+			}
+			if st.link == nil || st.link.Scheme != "http" && st.link.Scheme != "https" {
+				continue
+			}
+			key := st.link.String()
+			if internal {
+				key = c.visitKey(st.link)
+			}
+			lc, ok := links[key]
+			if !ok {
+				lc = &LinkCheck{URL: st.link.String(), External: !internal}
+				links[key] = lc
+				keys = append(keys, key)
+			}
+			if n := len(lc.Pages); n == 0 || lc.Pages[n-1] != page.URL {
+				lc.Pages = append(lc.Pages, page.URL)
+			}
+		}
+	}
+
+	c.parallel(len(keys), func(i int) {
+		lc := links[keys[i]]
+		if p, ok := fetched[keys[i]]; ok && !lc.External {
+			lc.StatusCode = p.StatusCode
+			if p.Err != nil {
+				lc.Err, lc.Disallowed = p.Err.Error(), errors.Is(p.Err, ErrDisallowed)
+			}
+			return
+		}
+		c.checkLink(ctx, lc)
+	})
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	for _, key := range keys {
+		lc := links[key]
+		sort.Strings(lc.Pages)
+		report.Links = append(report.Links, *lc)
+	}
+	sort.Slice(report.Links, func(i, j int) bool { return report.Links[i].URL < report.Links[j].URL })
+	return report, nil
+}
+
+// checkLink checks a link for CheckPages, recording the outcome in lc.
+func (c Crawler) checkLink(ctx context.Context, lc *LinkCheck) {
+	var status int
+	var err error
+	if lc.External {
+		status, err = c.headHTTP(withPurpose(ctx, PurposeExternalCheck), lc.URL)
+	} else if err = c.checkRobots(ctx, lc.URL); err == nil {
+		var p *Page
+		p, err = c.getHTTP(ctx, lc.URL)
+		if p != nil {
+			status = p.StatusCode
+		}
+	}
+	lc.StatusCode = status
+	if c.acceptsStatus(lc.URL, err) {
+		lc.AccessControlled = true
+		return
+	}
+	if err != nil {
+		lc.Err, lc.Disallowed = err.Error(), errors.Is(err, ErrDisallowed)
+	}
+}
+
+// headHTTP makes a HEAD request, returning the response's status, and an
+// error if it isn't a success. Servers that don't support HEAD are asked
+// with a GET instead.
+func (c Crawler) headHTTP(ctx context.Context, addr string) (status int, err error) {
+	if err := c.delays.wait(ctx, c.clock, hostname(addr)); err != nil {
+		return 0, fmt.Errorf("headHTTP(%s) waiting to make request: %w", addr, err)
+	}
+	start := c.clock.Now()
+	defer func() {
+		c.counters.recordRequest(purposeOf(ctx), c.since(start), err != nil)
+	}()
+
+	if d := c.timeoutFor(addr); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, addr, nil)
+	if err != nil {
+		return 0, fmt.Errorf("headHTTP(%s) invalid request: %w", addr, err)
+	}
+	c.decorate(req)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("headHTTP(%s) failed HEAD request: %w", addr, &NetworkError{classifyNetError(err)})
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		p, err := c.getHTTP(ctx, addr)
+		if p == nil {
+			return 0, err
+		}
+		return p.StatusCode, err
+	}
+	if c.noFollow && isRedirect(res.StatusCode) {
+		return res.StatusCode, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("headHTTP(%s) %w", addr, &HTTPError{StatusCode: res.StatusCode, Status: res.Status})
+	}
+	return res.StatusCode, nil
+}
+
+// parallel calls fn with each index from 0 to n-1, from as many goroutines
+// at once as the crawler has fetchers, returning once all calls have.
+func (c Crawler) parallel(n int, fn func(i int)) {
+	workers := c.numFetchers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
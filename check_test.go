@@ -0,0 +1,101 @@
+package crawl
+
+import (
+	"context"
+	"crawl/crawltest"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckPages(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/a", "/b", "/c", "/missing", "https://other.com/ok", "https://other.com/gone", "mailto:help@monzo.com")
+	site.Page("https://monzo.com/b", "/a", "/c")
+	site.Page("https://monzo.com/c", "/d")
+	site.Page("https://other.com/ok")
+	site.Handle("https://other.com/gone", crawltest.Response{Status: http.StatusGone})
+
+	c := NewCrawler(2, WithTransportMiddleware(site.Wrap))
+	report, err := c.CheckPages(context.Background(), []string{"https://monzo.com/a", "https://monzo.com/b", "https://monzo.com/changed"})
+	if err != nil {
+		t.Fatalf("CheckPages erred when not expected: %v", err)
+	}
+
+	a, b := "https://monzo.com/a", "https://monzo.com/b"
+	want := []LinkCheck{
+		{URL: "https://monzo.com/a", StatusCode: 200, Pages: []string{b}},
+		{URL: "https://monzo.com/b", StatusCode: 200, Pages: []string{a}},
+		{URL: "https://monzo.com/c", StatusCode: 200, Pages: []string{a, b}},
+		{URL: "https://monzo.com/missing", StatusCode: 404, Err: "getHTTP(https://monzo.com/missing) got bad HTTP reponse code (404): 404 Not Found", Pages: []string{a}},
+		{URL: "https://other.com/gone", External: true, StatusCode: 410, Err: "headHTTP(https://other.com/gone) got bad HTTP reponse code (410): 410 Gone", Pages: []string{a}},
+		{URL: "https://other.com/ok", External: true, StatusCode: 200, Pages: []string{a}},
+	}
+	if diff := cmp.Diff(want, report.Links); diff != "" {
+		t.Errorf("CheckPages() Links mismatch (-want +got):\n%s", diff)
+	}
+
+	var broken []string
+	for _, l := range report.Broken() {
+		broken = append(broken, l.URL)
+	}
+	wantBroken := []string{"https://monzo.com/changed", "https://monzo.com/missing", "https://other.com/gone"}
+	if diff := cmp.Diff(wantBroken, broken); diff != "" {
+		t.Errorf("Broken() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Each page is fetched once, and no further.
+	for _, u := range []string{a, b, "https://monzo.com/c"} {
+		if n := site.Calls(u); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", u, n)
+		}
+	}
+	if n := site.Calls("https://monzo.com/d"); n != 0 {
+		t.Errorf("/d fetched %d times, want 0", n)
+	}
+	if n := c.Stats().Requests[PurposeExternalCheck.String()].Requests; n != 2 {
+		t.Errorf("%d external checks made, want 2", n)
+	}
+}
+
+func TestWithLinkCheck(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/a", "/missing", "https://other.com/ok", "https://other.com/gone", "https://nohead.com/")
+	site.Page("https://monzo.com/a", "/", "/missing", "/logo.png", "https://other.com/gone", "mailto:help@monzo.com")
+	site.Handle("https://monzo.com/logo.png", crawltest.Response{Header: http.Header{"Content-Type": {"image/png"}}})
+	site.Page("https://other.com/ok")
+	site.Handle("https://other.com/gone", crawltest.Response{Status: http.StatusGone})
+	// The HEAD request isn't allowed, so a GET is made instead.
+	site.Handle("https://nohead.com/", crawltest.Response{Status: http.StatusMethodNotAllowed}, crawltest.Response{})
+
+	c := NewCrawler(2, WithTransportMiddleware(site.Wrap), WithLinkCheck(true))
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	home, a := "https://monzo.com/", "https://monzo.com/a"
+	want := []LinkCheck{
+		{URL: "https://monzo.com/", StatusCode: 200, Pages: []string{a}},
+		{URL: "https://monzo.com/a", StatusCode: 200, Pages: []string{home}},
+		{URL: "https://monzo.com/logo.png", StatusCode: 200, Pages: []string{a}},
+		{URL: "https://monzo.com/missing", StatusCode: 404, Err: "fetchHTTP(https://monzo.com/missing) get: getHTTP(https://monzo.com/missing) got bad HTTP reponse code (404): 404 Not Found", Pages: []string{home, a}},
+		{URL: "https://nohead.com/", External: true, StatusCode: 200, Pages: []string{home}},
+		{URL: "https://other.com/gone", External: true, StatusCode: 410, Err: "headHTTP(https://other.com/gone) got bad HTTP reponse code (410): 410 Gone", Pages: []string{home, a}},
+		{URL: "https://other.com/ok", External: true, StatusCode: 200, Pages: []string{home}},
+	}
+	if diff := cmp.Diff(want, c.CheckedLinks()); diff != "" {
+		t.Errorf("CheckedLinks() mismatch (-want +got):\n%s", diff)
+	}
+	// Each external link is checked once, however many pages link to it.
+	if n := site.Calls("https://other.com/gone"); n != 1 {
+		t.Errorf("https://other.com/gone requested %d times, want 1", n)
+	}
+	if n := site.Calls("https://nohead.com/"); n != 2 {
+		t.Errorf("https://nohead.com/ requested %d times, want 2", n)
+	}
+
+	if links := NewCrawler(1, WithTransportMiddleware(site.Wrap)).CheckedLinks(); links != nil {
+		t.Errorf("CheckedLinks() without WithLinkCheck = %v, want none", links)
+	}
+}
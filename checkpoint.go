@@ -0,0 +1,120 @@
+package crawl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the document written by WithProgressFile, as evidence that
+// a long crawl is still alive and making progress.
+type Checkpoint struct {
+	// Time is when it was written, by the crawler's clock. A checkpoint
+	// that stops being rewritten means the crawl is stuck, or gone.
+	Time    time.Time
+	Root    string `json:",omitempty"`
+	Fetched int64
+	Errors  int64
+	Queued  int64
+	// InFlight is the number of pages being fetched.
+	InFlight int64
+	// Rate is the number of pages fetched per second since the last
+	// checkpoint, or since the crawl started for the first.
+	Rate float64
+	// Done is set on the last checkpoint, written once the crawl is over.
+	Done bool `json:",omitempty"`
+}
+
+// checkpointFile is where WithProgressFile writes checkpoints, and how
+// often.
+type checkpointFile struct {
+	path  string
+	every time.Duration
+}
+
+// startCheckpoints starts writing checkpoints to the file set with
+// WithProgressFile, if any, every interval, and returns a func writing the
+// last one and stopping. They are written from their own goroutine, so a
+// slow disk never holds up the crawl, and replaced atomically, so readers
+// never see a partial one. Failures to write them are logged, but don't
+// stop the crawl.
+func (c Crawler) startCheckpoints() (stop func()) {
+	if c.checkpoints == nil {
+		return func() {}
+	}
+	path, every := c.checkpoints.path, c.checkpoints.every
+	last, lastFetched := c.clock.Now(), int64(0)
+	write := func(done bool) {
+		s, now := c.Stats(), c.clock.Now()
+		cp := Checkpoint{
+			Time:     now,
+			Root:     s.Root,
+			Fetched:  s.Fetched,
+			Errors:   s.Errors,
+			Queued:   s.Queued,
+			InFlight: s.InFlight,
+			Done:     done,
+		}
+		if d := now.Sub(last); d > 0 {
+			cp.Rate = float64(s.Fetched-lastFetched) / d.Seconds()
+		}
+		last, lastFetched = now, s.Fetched
+		if err := writeCheckpoint(path, cp); err != nil {
+			log.Println(err)
+		}
+	}
+
+	quit, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			timer, stopTimer := c.clock.NewTimer(every)
+			select {
+			case <-timer:
+				write(false)
+			case <-quit:
+				stopTimer()
+				write(true)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-stopped
+	}
+}
+
+// writeCheckpoint replaces the file at path with cp, as JSON, by writing it
+// to a temporary file alongside it and renaming that over it. The file is
+// readable by all, as a file created with os.Create would be, rather than
+// only by its owner, as temporary files are.
+func writeCheckpoint(path string, cp Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("writeCheckpoint(%s): %w", path, err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writeCheckpoint(%s): %w", path, err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writeCheckpoint(%s): %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package crawl
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the crawler's source of time, so that time-dependent behaviour
+// can be tested without waiting. Its methods only use standard types, so
+// fakes (e.g. crawltest.Clock) needn't import this package.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a channel that receives the time once d has passed,
+	// and a func that stops the timer, as for time.NewTimer.
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// realClock is the Clock used by default, telling the real time.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// since returns the time elapsed on the crawler's clock since t.
+func (c Crawler) since(t time.Time) time.Duration {
+	return c.clock.Now().Sub(t)
+}
+
+// sleep waits for d to pass on clk, returning early with the context's error
+// if it is done first.
+func sleep(ctx context.Context, clk Clock, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer, stop := clk.NewTimer(d)
+	select {
+	case <-timer:
+		return nil
+	case <-ctx.Done():
+		stop()
+		return ctx.Err()
+	}
+}
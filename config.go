@@ -0,0 +1,272 @@
+package crawl
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Config is the effective configuration of a Crawler, after defaults and
+// adjustments (e.g. clamping to the file limit) are applied, in a form that
+// can be saved alongside its results. It must never hold secrets: anything
+// sensitive is to be redacted.
+type Config struct {
+	NumFetchers int
+	UserAgent   string
+	// HostHeaders are the headers sent to each host pattern, with the
+	// values of all but the User-Agent redacted.
+	HostHeaders    map[string]map[string]string `json:",omitempty"`
+	MaxIdleConns   int
+	MaxSockets     int  `json:",omitempty"`
+	DNSPrefetch    bool `json:",omitempty"`
+	FileLimitClamp bool
+	StrictHTML     bool
+	// FailFastOnPanic is set if panics in fetching pages aren't
+	// recovered.
+	FailFastOnPanic bool `json:",omitempty"`
+	// StrictContentType is set if pages are only scraped if served as
+	// HTML.
+	StrictContentType bool `json:",omitempty"`
+	// SkipNonHTML is set if only the bodies of pages that may be HTML are
+	// read and scraped.
+	SkipNonHTML bool `json:",omitempty"`
+	// HostAliases maps each alias to the host it is an alias of.
+	HostAliases    map[string]string `json:",omitempty"`
+	CoalesceWWW    bool
+	CanonicalHost  bool
+	LiteralScope   bool
+	IgnoreRobots   bool
+	ExtraLinkAttrs map[string][]string `json:",omitempty"`
+	AssetAttrs     map[string][]string `json:",omitempty"`
+	CaptureHeaders []string            `json:",omitempty"`
+	// Seeds is the number of URLs set with WithSeeds.
+	Seeds            int `json:",omitempty"`
+	SpeculativeLinks bool
+	MaxLinksPerPage  int `json:",omitempty"`
+	// MaxBodySize is the limit on the bytes of a body read, and
+	// TruncateBodies set if longer bodies are truncated, rather than
+	// failing.
+	MaxBodySize    int64
+	TruncateBodies bool `json:",omitempty"`
+	// LinkSpill is the threshold set with WithLinkSpill, if any.
+	LinkSpill *int `json:",omitempty"`
+	// MaxDepth is nil if the crawl's depth is unlimited.
+	MaxDepth     *int `json:",omitempty"`
+	MaxPages     int  `json:",omitempty"`
+	Breadcrumbs  bool
+	CheckLinks   bool     `json:",omitempty"`
+	AllowedHosts []string `json:",omitempty"`
+	// IncludeSubdomains is set if every host under the starting URL's
+	// registrable domain is crawled.
+	IncludeSubdomains bool `json:",omitempty"`
+	// Exclusions are the names of the exclusion rules in effect.
+	Exclusions []string `json:",omitempty"`
+	// ExcludePatterns are the patterns set with WithExcludePatterns.
+	ExcludePatterns []string `json:",omitempty"`
+	// IncludePatterns are the patterns set with WithIncludePatterns.
+	IncludePatterns []string `json:",omitempty"`
+	// PageGroups is set if pages are grouped by URLTemplates, the
+	// templates set with WithURLTemplates.
+	PageGroups   bool     `json:",omitempty"`
+	URLTemplates []string `json:",omitempty"`
+	// ExcludedLinks and ExcludedLinkPages are the limits set with
+	// WithExcludedLinks, if any.
+	ExcludedLinks     int `json:",omitempty"`
+	ExcludedLinkPages int `json:",omitempty"`
+	DirectoryIndex    bool
+	IndexDocuments    []string          `json:",omitempty"`
+	TimeoutOverrides  []TimeoutOverride `json:",omitempty"`
+	RequestTimeout    time.Duration     `json:",omitempty"`
+	Delay             time.Duration     `json:",omitempty"`
+	AbortErrorRate    float64           `json:",omitempty"`
+	AbortMinSamples   int               `json:",omitempty"`
+	MaxRedirects      int
+	// NoFollowRedirects is set if redirects aren't followed, as with
+	// WithFollowRedirects(false).
+	NoFollowRedirects bool `json:",omitempty"`
+	// MaxAttempts and RetryBackoff are as set with WithRetries.
+	MaxAttempts    int           `json:",omitempty"`
+	RetryBackoff   time.Duration `json:",omitempty"`
+	RedirectBudget int64         `json:",omitempty"`
+	// CrawlWindow is the time of day crawling is allowed in, e.g.
+	// "22:00-06:00 Europe/London".
+	CrawlWindow string `json:",omitempty"`
+	// SessionDetection is set if session rules are inferred, and
+	// SessionRules are those given, not inferred.
+	SessionDetection *SessionThresholds `json:",omitempty"`
+	SessionRules     []SessionRule      `json:",omitempty"`
+	// TransportMiddleware is the number of transport wrappers, which
+	// can't be described further.
+	TransportMiddleware int `json:",omitempty"`
+	// ResultFilters is the number of filters set with WithResultFilter,
+	// which can't be described further.
+	ResultFilters int `json:",omitempty"`
+	// AcceptableStatuses is the number of funcs set with
+	// WithAcceptableStatuses, which can't be described further.
+	AcceptableStatuses int `json:",omitempty"`
+	// HTTPClient is set if the client was given with WithHTTPClient, which
+	// can't be described further, and Timeout is the client's time limit
+	// on requests, or 0 for none.
+	HTTPClient bool          `json:",omitempty"`
+	Timeout    time.Duration `json:",omitempty"`
+}
+
+// TimeoutOverride is a timeout for URLs matching a pattern, as configured
+// with WithTimeoutOverride.
+type TimeoutOverride struct {
+	Pattern string
+	Timeout time.Duration
+}
+
+// performanceSettings are the Config fields that only affect how fast a
+// crawl runs, not what it finds.
+var performanceSettings = map[string]bool{
+	"NumFetchers":    true,
+	"MaxIdleConns":   true,
+	"MaxSockets":     true,
+	"DNSPrefetch":    true,
+	"Delay":          true,
+	"FileLimitClamp": true,
+	"CrawlWindow":    true,
+}
+
+// Config returns the crawler's effective configuration.
+func (c Crawler) Config() Config {
+	cfg := Config{
+		NumFetchers:         c.numFetchers,
+		UserAgent:           c.userAgent,
+		HostHeaders:         c.redactedHeaders(),
+		MaxIdleConns:        c.maxIdleConns,
+		MaxSockets:          c.maxSockets,
+		DNSPrefetch:         c.dns.enabled,
+		FileLimitClamp:      c.clampToFileLimit,
+		StrictHTML:          c.strictHTML,
+		FailFastOnPanic:     c.failFastOnPanic,
+		StrictContentType:   c.strictContentType,
+		SkipNonHTML:         c.skipNonHTML,
+		HostAliases:         c.hostAliases,
+		CoalesceWWW:         c.coalesceWWW,
+		CanonicalHost:       c.canonicalHost,
+		LiteralScope:        c.literalScope,
+		IgnoreRobots:        c.robots.ignore,
+		ExtraLinkAttrs:      c.extraLinkAttrs,
+		AssetAttrs:          c.assetAttrs,
+		CaptureHeaders:      c.captureHeaders,
+		Seeds:               len(c.seeds),
+		SpeculativeLinks:    c.followSpec,
+		MaxLinksPerPage:     c.maxLinksPerPage,
+		MaxBodySize:         c.maxBodySize,
+		TruncateBodies:      c.truncateBodies,
+		MaxPages:            c.maxPages,
+		Breadcrumbs:         c.breadcrumbs,
+		CheckLinks:          c.linkCheck,
+		AllowedHosts:        c.allowedHosts,
+		IncludeSubdomains:   c.subdomains,
+		Exclusions:          exclusionNames(c.exclusions),
+		ExcludedLinks:       c.excludedTargets,
+		ExcludedLinkPages:   c.excludedPages,
+		DirectoryIndex:      c.dirIndex,
+		IndexDocuments:      c.indexDocuments,
+		AbortErrorRate:      c.abortErrorRate,
+		RequestTimeout:      c.effectiveRequestTimeout(),
+		Delay:               c.delays.delay,
+		AbortMinSamples:     c.abortMinSamples,
+		MaxRedirects:        c.maxRedirects,
+		NoFollowRedirects:   c.noFollow,
+		MaxAttempts:         c.retries.attempts,
+		RetryBackoff:        c.retries.backoff,
+		CrawlWindow:         c.window.String(),
+		RedirectBudget:      c.redirectBudget,
+		TransportMiddleware: len(c.transportWrappers),
+		ResultFilters:       len(c.resultFilters),
+		AcceptableStatuses:  len(c.acceptStatuses),
+		HTTPClient:          c.httpClient != nil,
+	}
+	if c.client != nil {
+		cfg.Timeout = c.client.Timeout
+	}
+	if c.spill != nil {
+		t := c.spillThreshold
+		cfg.LinkSpill = &t
+	}
+	if c.maxDepth >= 0 {
+		d := c.maxDepth
+		cfg.MaxDepth = &d
+	}
+	if c.sessions != nil {
+		if c.sessions.enabled {
+			t := c.sessions.thresholds
+			cfg.SessionDetection = &t
+		}
+		cfg.SessionRules = c.sessions.pinned
+	}
+	for _, p := range c.excludePatterns {
+		cfg.ExcludePatterns = append(cfg.ExcludePatterns, p.String())
+	}
+	for _, p := range c.includePatterns {
+		cfg.IncludePatterns = append(cfg.IncludePatterns, p.String())
+	}
+	cfg.PageGroups = c.pageGroups
+	for _, t := range c.urlTemplates {
+		cfg.URLTemplates = append(cfg.URLTemplates, t.raw)
+	}
+	for _, o := range c.timeoutOverrides {
+		cfg.TimeoutOverrides = append(cfg.TimeoutOverrides, TimeoutOverride{o.pattern.String(), o.timeout})
+	}
+	return cfg
+}
+
+// Differences lists the settings that differ between two configurations in
+// ways that change what a crawl finds, so that comparing their results may
+// be misleading. Settings that only affect performance are ignored.
+func (cfg Config) Differences(other Config) []string {
+	a, b := cfg.fields(), other.fields()
+	var diffs []string
+	for name, v := range a {
+		if performanceSettings[name] || reflect.DeepEqual(v, b[name]) {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %s != %s", name, jsonValue(v), jsonValue(b[name])))
+	}
+	for name, v := range b {
+		if _, ok := a[name]; !ok && !performanceSettings[name] {
+			diffs = append(diffs, fmt.Sprintf("%s: %s != %s", name, jsonValue(nil), jsonValue(v)))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// fields returns the configuration's non-empty settings by name, as they
+// are serialized.
+func (cfg Config) fields() map[string]interface{} {
+	j, _ := json.Marshal(cfg)
+	var m map[string]interface{}
+	json.Unmarshal(j, &m)
+	return m
+}
+
+func jsonValue(v interface{}) string {
+	if v == nil {
+		return "unset"
+	}
+	j, _ := json.Marshal(v)
+	return string(j)
+}
+
+// CrawlReport is a self-describing record of a crawl: its results, and the
+// configuration that produced them.
+type CrawlReport struct {
+	// Seed is the starting URL, and Root the URL the crawl was scoped to,
+	// if it redirected elsewhere.
+	Seed   string `json:"seed,omitempty"`
+	Root   string `json:"root,omitempty"`
+	Config Config `json:"config"`
+	// Summary aggregates the results, as Crawler.Summary does.
+	Summary *Summary `json:"summary,omitempty"`
+	// Workers is how the crawl's fetchers spent their time, as in Stats.
+	Workers *WorkerStats `json:"workers,omitempty"`
+	Results []Result     `json:"results"`
+}
@@ -0,0 +1,66 @@
+package crawl
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig(t *testing.T) {
+	c := NewCrawler(10,
+		WithCoalesceWWW(true),
+		WithAllowedHosts("monzo.co.uk"),
+		WithTimeoutOverride(regexp.MustCompile(`/reports/`), time.Minute),
+	)
+	cfg := c.Config()
+	want := Config{
+		NumFetchers:      10,
+		UserAgent:        DefaultUserAgent,
+		MaxIdleConns:     defaultMaxIdleConns,
+		CoalesceWWW:      true,
+		MaxRedirects:     defaultMaxRedirects,
+		MaxBodySize:      DefaultMaxBodySize,
+		AllowedHosts:     []string{"monzo.co.uk"},
+		TimeoutOverrides: []TimeoutOverride{{Pattern: "/reports/", Timeout: time.Minute}},
+		RequestTimeout:   defaultTimeout,
+	}
+	// The file limit may have lowered the concurrency.
+	want.NumFetchers, want.MaxIdleConns = cfg.NumFetchers, cfg.MaxIdleConns
+	if diff := cmp.Diff(want, cfg); diff != "" {
+		t.Errorf("Config() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Configs survive a round trip through a report.
+	j, err := json.Marshal(CrawlReport{Config: cfg})
+	if err != nil {
+		t.Fatalf("marshalling CrawlReport erred: %v", err)
+	}
+	var report CrawlReport
+	if err := json.Unmarshal(j, &report); err != nil {
+		t.Fatalf("unmarshalling CrawlReport erred: %v", err)
+	}
+	if diff := cmp.Diff(cfg, report.Config); diff != "" {
+		t.Errorf("Config round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConfigDifferences(t *testing.T) {
+	a := NewCrawler(10, WithCoalesceWWW(true), WithAllowedHosts("monzo.co.uk")).Config()
+	b := NewCrawler(20, WithMaxSockets(5), WithAllowedHosts("monzo.co.uk")).Config()
+	c := NewCrawler(20, WithCoalesceWWW(true), WithAllowedHosts("monzo.co.uk"), WithDirectoryIndex("index.html")).Config()
+
+	if diffs := a.Differences(a); len(diffs) != 0 {
+		t.Errorf("Differences() with itself = %v, want none", diffs)
+	}
+	want := []string{"CoalesceWWW: true != false"}
+	if diff := cmp.Diff(want, a.Differences(b)); diff != "" {
+		t.Errorf("Differences() mismatch (-want +got):\n%s", diff)
+	}
+	want = []string{"DirectoryIndex: false != true", `IndexDocuments: unset != ["index.html"]`}
+	if diff := cmp.Diff(want, a.Differences(c)); diff != "" {
+		t.Errorf("Differences() mismatch (-want +got):\n%s", diff)
+	}
+}
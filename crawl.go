@@ -2,39 +2,153 @@ package crawl
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"runtime/debug"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/html"
 )
 
+// scraped is what scrape finds in an HTML document.
+type scraped struct {
+	links []string
+	// base is the href of the document's first <base> element with one,
+	// which links are relative to instead of the document's URL.
+	base        string
+	speculative []string
+	assets      []Asset
+	title       string
+	meta        map[string]string
+	rels        Relations
+	breadcrumbs []string
+	// truncated is set if links stopped at the limit given to scrape.
+	truncated bool
+	// fallback is set if the document couldn't be parsed, and its links
+	// were extracted by scanning its raw markup instead.
+	fallback bool
+}
+
+// parseHTML parses a document, as a variable so tests can make it fail.
+var parseHTML = html.Parse
+
 // scrape attempts to find all the links in the provided HTML document.
-// Passing invalid HTML may result in an error, but may also return invalid
-// results, depending on how the HTML parser interprets the input.
-func scrape(body []byte) ([]string, error) {
+// Passing invalid HTML may return invalid results, depending on how the HTML
+// parser interprets the input. If the parser rejects it altogether, links are
+// recovered by scanning the raw markup, and s.fallback is set; an error is
+// only returned if there are none.
+// Any attributes listed by element name in extra are returned separately as
+// speculative links: they may hold URLs, but aren't standard navigation.
+// Those listed in assets are returned as assets, tagged with their element.
+// If maxLinks is positive, no more than that many links are collected, and
+// s.truncated is set if there were more.
+// Documents embedded with <iframe srcdoc> are scraped too.
+// The href of the first <base> element is returned in s.base, unresolved, as
+// links must be resolved against it instead of the document's URL.
+// While walking the document, we also pick up its title, <meta> values, the
+// relations declared by its <link> elements and its breadcrumb trail, from
+// JSON-LD in preference to markup.
+func scrape(body []byte, extra, assets map[string][]string, maxLinks int) (scraped, error) {
+	var s scraped
 
 	// Scrape the links from that url
-	doc, err := html.Parse(bytes.NewReader(body))
+	doc, err := parseHTML(bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse body as HTML: %w", err)
+		s.links = fallbackLinks(body)
+		if maxLinks > 0 && len(s.links) > maxLinks {
+			s.links, s.truncated = s.links[:maxLinks], true
+		}
+		if s.links == nil {
+			return s, fmt.Errorf("failed to parse body as HTML: %w", err)
+		}
+		s.fallback = true
+		return s, nil
 	}
 
-	var links []string
-	// TODO: We should really check for a <base> element.
-	// If present, we'll need a way to include that with the results.
-	// Currently, resolving these hrefs is not handled by the scraper,
-	// think about whether it should be.
+	titled, based := false, false
+	// Title and meta values are only taken from the page itself, not from
+	// any embedded documents.
+	embedded := 0
+	var navCrumbs []string
 	var f func(*html.Node)
 	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, a := range n.Attr {
-				if a.Key == "href" {
-					links = append(links, a.Val)
-					break
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "a":
+				if href, ok := attr(n, "href"); ok {
+					if maxLinks > 0 && len(s.links) == maxLinks {
+						s.truncated = true
+					} else {
+						s.links = append(s.links, href)
+					}
+				}
+			case "base":
+				// Only the first <base> with an href counts.
+				if href, ok := attr(n, "href"); ok && !based && embedded == 0 {
+					s.base, based = strings.TrimSpace(href), true
+				}
+			case "title":
+				if !titled && embedded == 0 {
+					s.title = strings.Join(strings.Fields(text(n)), " ")
+					titled = true
+				}
+			case "meta":
+				name, ok := attr(n, "name")
+				if !ok {
+					name, ok = attr(n, "property")
+				}
+				if content, hasContent := attr(n, "content"); ok && hasContent && embedded == 0 {
+					if s.meta == nil {
+						s.meta = make(map[string]string)
+					}
+					s.meta[strings.ToLower(name)] = content
+				}
+			case "link":
+				rel, hasRel := attr(n, "rel")
+				href, hasHref := attr(n, "href")
+				if hasRel && hasHref && embedded == 0 {
+					for _, r := range strings.Fields(rel) {
+						s.rels.add(r, href, false)
+					}
+				}
+			case "script":
+				if t, _ := attr(n, "type"); strings.EqualFold(strings.TrimSpace(t), "application/ld+json") && s.breadcrumbs == nil && embedded == 0 {
+					s.breadcrumbs = breadcrumbsFromJSONLD(text(n))
+				}
+			case "nav":
+				if navCrumbs == nil && embedded == 0 && isBreadcrumbNav(n) {
+					navCrumbs = breadcrumbsFromNav(n)
+				}
+			case "iframe":
+				if srcdoc, ok := attr(n, "srcdoc"); ok {
+					// The embedded document shares its parent's URL for
+					// resolving links, so its links are as good as ours.
+					if doc, err := html.Parse(strings.NewReader(srcdoc)); err == nil {
+						embedded++
+						f(doc)
+						embedded--
+					}
+				}
+			}
+			for _, key := range extra[n.Data] {
+				if v, ok := attr(n, key); ok && v != "" {
+					s.speculative = append(s.speculative, v)
+				}
+			}
+			for _, key := range assets[n.Data] {
+				if v, ok := attr(n, key); ok && v != "" {
+					s.assets = append(s.assets, Asset{URL: v, Tag: n.Data})
 				}
 			}
 		}
@@ -43,71 +157,491 @@ func scrape(body []byte) ([]string, error) {
 		}
 	}
 	f(doc)
+	if s.breadcrumbs == nil {
+		s.breadcrumbs = navCrumbs
+	}
 
-	return links, nil
+	return s, nil
 }
 
-func getHTTP(addr string) ([]byte, error) {
-	res, err := http.Get(addr)
-	if err != nil {
-		return nil, fmt.Errorf("getHTTP(%s) failed GET request: %w", addr, err)
+// attr returns the value of the first attribute of n with the given key.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// text returns the text content of n and its descendants.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("getHTTP(%s) got bad HTTP reponse code (%d): %s", addr, res.StatusCode, res.Status)
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(text(c))
 	}
-	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+	return sb.String()
 }
 
-func fetchHTTP(addr string) ([]string, error) {
+// fetchHTTP fetches and scrapes a page, returning what was learned about
+// it. The URL and Err fields of the returned Result are left for the
+// caller to fill in.
+func (c Crawler) fetchHTTP(ctx context.Context, addr string) (Result, error) {
+	r := Result{Timeout: c.timeoutFor(addr)}
 
-	body, err := getHTTP(addr)
+	if err := c.checkRobots(ctx, addr); err != nil {
+		return r, fmt.Errorf("fetchHTTP(%s): %w", addr, err)
+	}
+	p, attempts, err := c.getWithRetries(ctx, addr)
+	if attempts > 1 {
+		r.Attempts = attempts
+	}
+	if p != nil {
+		r.StatusCode, r.ContentType, r.Redirects = p.StatusCode, p.ContentType(), p.Redirects
+		r.RedirectChain = p.RedirectChain
+		if p.FinalURL != addr {
+			r.FinalURL = p.FinalURL
+		}
+		r.TLS, r.Proto, r.ContentEncoding = p.TLS, p.Proto, p.ContentEncoding
+		r.BytesOnWire, r.BytesDecoded = p.BytesOnWire, p.BytesDecoded
+		r.BodyTruncated, r.ResumedFrom = p.BodyTruncated, p.ResumedFrom
+		r.Duration = p.Duration
+		r.Location = p.Location
+		r.Headers = c.capturedHeaders(p.Header)
+	}
+	if c.acceptsStatus(addr, err) {
+		r.AccessControlled = true
+		return r, nil
+	}
+	if err != nil && attempts > 1 {
+		return r, fmt.Errorf("fetchHTTP(%s) get, after %d attempts: %w", addr, attempts, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("fetchHTTP(%s) get: %w", addr, err)
+		return r, fmt.Errorf("fetchHTTP(%s) get: %w", addr, err)
+	}
+	// An unfollowed redirect's body isn't read.
+	if r.Location != "" {
+		return r, nil
 	}
 
-	links, err := scrape(body)
+	// With WithSkipNonHTML, only HTML is scraped, but any page's Link
+	// headers are followed.
+	scrape, misdeclared := c.scrapes(p)
+	if !scrape {
+		r.Relations = mergeRelations(Relations{}, p.Header)
+		return r, nil
+	}
+	r.MisdeclaredContentType = misdeclared
+	r.Base = p.Base()
+	r.Title = p.Title()
+	r.Links, err = p.Links()
 	if err != nil {
-		return nil, fmt.Errorf("fetchHTTP(%s) scrape: %w", addr, err)
+		return r, fmt.Errorf("fetchHTTP(%s) scrape: %w", addr, &ScrapeError{err})
+	}
+	r.Speculative = p.Speculative()
+	r.Assets = p.Assets()
+	r.FallbackExtraction = p.FallbackExtraction()
+	r.LinksTruncated = p.LinksTruncated()
+	r.Relations = p.Relations()
+	if c.breadcrumbs {
+		r.Breadcrumbs = p.Breadcrumbs()
+	}
+
+	if c.strictHTML {
+		r.Warnings = lint(p.Body)
 	}
+	c.observeSession(addr, p.Body)
 
-	return links, nil
+	return r, nil
 
 }
 
+// resolve resolves a raw href value against the URL of the page it was
+// found on. The fragment is dropped, as it never refers to a distinct page.
+func resolve(base *url.URL, href string) (*url.URL, error) {
+	link, err := base.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	link.Fragment = ""
+	return link, nil
+}
+
+// normalize returns a copy of a resolved link reduced to the form we use
+// to decide whether two links point to the same page: canonicalized, and
+// without its query.
+func normalize(link *url.URL) *url.URL {
+	n := canonicalize(link)
+	n.RawQuery = ""
+	n.ForceQuery = false
+	return n
+}
+
+// defaultPorts are the ports implied by each scheme.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// canonicalize returns a copy of an absolute URL in the canonical form of
+// RFC 3986 section 6.2.2, so that equivalent URLs are equal: its scheme and
+// host lowercased, without the scheme's default port, with a root path if
+// it had none, with percent-encoded unreserved characters decoded, and
+// without dot segments. Its fragment is dropped, as it doesn't identify a
+// different page.
+func canonicalize(u *url.URL) *url.URL {
+	n := *u
+	n.Fragment = ""
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); port != "" && port == defaultPorts[n.Scheme] {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	if n.Opaque != "" {
+		return &n
+	}
+	if n.Path == "" && n.Host != "" {
+		n.Path, n.RawPath = "/", ""
+	}
+	if p := decodeUnreserved(n.EscapedPath()); p != n.EscapedPath() {
+		if path, err := url.PathUnescape(p); err == nil {
+			n.Path, n.RawPath = path, p
+		}
+	}
+	if strings.Contains(n.Path, ".") {
+		// Resolving an empty reference removes the dot segments.
+		query, force := n.RawQuery, n.ForceQuery
+		n = *n.ResolveReference(&url.URL{})
+		n.RawQuery, n.ForceQuery = query, force
+	}
+	return &n
+}
+
+// decodeUnreserved decodes the percent-encoded unreserved characters in an
+// escaped path, which mean the same encoded or not.
+func decodeUnreserved(p string) string {
+	if !strings.Contains(p, "%") {
+		return p
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) {
+			if v, err := strconv.ParseUint(p[i+1:i+3], 16, 8); err == nil && isUnreserved(byte(v)) {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
 // Result is the results from a single page/URL.
 type Result struct {
-	URL   string
+	URL string
+	// FinalURL is the URL the page was served from, after following
+	// redirects, if it differs from URL. Its links are relative to it.
+	FinalURL string `json:",omitempty"`
+	// Base is the URL set by the page's <base> element, if it has one,
+	// which its links are relative to instead.
+	Base string `json:",omitempty"`
+	// Title is the text of the page's first <title>, with whitespace
+	// collapsed, or "" if it has none, or wasn't scraped, e.g. as it
+	// isn't HTML and WithSkipNonHTML is set.
+	Title string `json:",omitempty"`
 	Links []string
 	Err   error
+	// Speculative links are those found in the attributes configured with
+	// WithExtraLinkAttributes.
+	Speculative []string `json:",omitempty"`
+	// Assets are the URLs collected from the attributes configured with
+	// WithAssets. They are only recorded, never crawled.
+	Assets []Asset `json:",omitempty"`
+	// Relations are left out of JSON if the page declares none.
+	Relations Relations
+	// TLS describes the connection the page was fetched over, or is nil if
+	// TLS wasn't used.
+	TLS *TLSInfo `json:",omitempty"`
+	// StatusCode is the HTTP status of the response, or 0 if there was
+	// none.
+	StatusCode int `json:",omitempty"`
+	// AccessControlled is set if StatusCode was accepted with
+	// WithAcceptableStatuses, e.g. a 401 for a page behind a login, so the
+	// page isn't counted as broken.
+	AccessControlled bool `json:",omitempty"`
+	// ContentType is the media type of the response, without parameters,
+	// e.g. "text/html".
+	ContentType string `json:",omitempty"`
+	// Proto, ContentEncoding, BytesOnWire and BytesDecoded are as for
+	// Page.
+	Proto           string `json:",omitempty"`
+	ContentEncoding string `json:",omitempty"`
+	BytesOnWire     int64  `json:",omitempty"`
+	BytesDecoded    int64  `json:",omitempty"`
+	// BodyTruncated is set if the page's body was longer than the limit
+	// set with WithMaxBodySize, and only the first part was scraped.
+	BodyTruncated bool `json:",omitempty"`
+	// ResumedFrom is as for Page: the offset the page's body was resumed
+	// from after a retry.
+	ResumedFrom int64 `json:",omitempty"`
+	// Duration is as for Page: the time taken to fetch the page, from
+	// request to reading its body, of the last attempt if it was retried.
+	// It doesn't include waiting for robots.txt or politeness delays. The
+	// size of the body read is BytesDecoded.
+	Duration time.Duration `json:",omitempty"`
+	// PageGroup is the template the page's URL matched, or its
+	// generalized path, if enabled with WithURLTemplates, e.g.
+	// /product/{id}.
+	PageGroup string `json:",omitempty"`
+	// Headers are the response headers named with WithHeaderCapture that
+	// the page was served with.
+	Headers http.Header `json:",omitempty"`
+	// Redirects is the number of redirects followed to fetch the page,
+	// and RedirectChain the URLs redirected from, starting with URL.
+	Redirects     int      `json:",omitempty"`
+	RedirectChain []string `json:",omitempty"`
+	// Location is where the page redirects to, if it is a redirect that
+	// wasn't followed, as set with WithFollowRedirects. It is crawled as
+	// one of the page's links, but isn't among its Links.
+	Location string `json:",omitempty"`
+	// Attempts is the number of requests made for the page, if it was
+	// retried, as enabled with WithRetries.
+	Attempts int `json:",omitempty"`
+	// Depth is the number of links followed from the starting URL to reach
+	// the page.
+	Depth int `json:",omitempty"`
+	// Discovered is the order the page's URL was found in by the crawl,
+	// from 0 for the starting URL.
+	Discovered int `json:",omitempty"`
+	// Breadcrumbs are the page's breadcrumb trail, if enabled with
+	// WithBreadcrumbs.
+	Breadcrumbs []string `json:",omitempty"`
+	// Timeout is the timeout that applied to fetching the page, or 0 if
+	// there was none.
+	Timeout time.Duration `json:",omitempty"`
+	// OutboundInternal and OutboundExternal are the number of distinct
+	// pages the page links to on and off the crawled site, and Inbound the
+	// number of crawled pages linking to it. Links are deduplicated as the
+	// crawl deduplicates them, and links from a page to itself aren't
+	// counted.
+	OutboundInternal int `json:",omitempty"`
+	OutboundExternal int `json:",omitempty"`
+	Inbound          int `json:",omitempty"`
+	// Referrers are the crawled pages linking to it, sorted, so a broken
+	// page can be traced back to the links to fix. Like Inbound, they need
+	// the whole crawl, so are only set by Crawl and CrawlContext.
+	Referrers []string `json:",omitempty"`
+	// LinksTruncated is set if the page had more links than the limit set
+	// with WithMaxLinksPerPage, so only the first were followed.
+	LinksTruncated bool `json:",omitempty"`
+	// LinksSpilled is set if the page had more links than the threshold
+	// set with WithLinkSpill, so they were all passed to its sink, and
+	// only the first are kept in Links. LinkCount is then the number of
+	// links the page had. The pages it links to only count it in their
+	// Inbound and Referrers if linked to by the links kept.
+	LinksSpilled bool `json:",omitempty"`
+	LinkCount    int  `json:",omitempty"`
+	// LinkTargets are the outcomes of the page's internal links, in the
+	// order of its Links, if enabled with WithLinkTargets.
+	LinkTargets []LinkTarget `json:",omitempty"`
+	// MisdeclaredContentType is set if the page was served as plain text
+	// or binary data, but was scraped as HTML, as browsers would render it,
+	// because its content sniffs as HTML. See WithStrictContentType.
+	MisdeclaredContentType bool `json:",omitempty"`
+	// FallbackExtraction is set if the page couldn't be parsed as HTML,
+	// and its links were found by scanning its raw markup instead, so may
+	// be incomplete or include links a browser wouldn't see.
+	FallbackExtraction bool `json:",omitempty"`
+	// InvalidLinks are the links on the page that could not be parsed.
+	InvalidLinks []InvalidLink `json:",omitempty"`
+	// Warnings are only recorded if enabled with WithStrictHTML, or if
+	// fetching the page panicked, with the panic's stack.
+	Warnings []Warning `json:",omitempty"`
 }
 
 // Crawler is our means of managing configuration for a crawl instance.
 type Crawler struct {
-	numFetchers int
-	fetch       func(string) ([]string, error)
+	numFetchers       int
+	userAgent         string
+	hostHeaders       []hostHeaders
+	maxIdleConns      int
+	maxSockets        int
+	clampToFileLimit  bool
+	strictHTML        bool
+	failFastOnPanic   bool
+	strictContentType bool
+	skipNonHTML       bool
+	hostAliases       map[string]string
+	coalesceWWW       bool
+	canonicalHost     bool
+	literalScope      bool
+	extraLinkAttrs    map[string][]string
+	assetAttrs        map[string][]string
+	captureHeaders    []string
+	maxLinksPerPage   int
+	maxBodySize       int64
+	pageGroups        bool
+	urlTemplates      []urlTemplate
+	truncateBodies    bool
+	spillThreshold    int
+	spill             func(Result)
+	maxDepth          int
+	maxPages          int
+	followSpec        bool
+	breadcrumbs       bool
+	linkTargets       bool
+	linkCheck         bool
+	allowedHosts      []string
+	allowedSites      map[string]bool
+	subdomains        bool
+	safeExclusions    bool
+	disabledRules     []string
+	exclusions        []ExclusionRule
+	excludePatterns   []*regexp.Regexp
+	includePatterns   []*regexp.Regexp
+	excludedTargets   int
+	excludedPages     int
+	seeds             []string
+	acceptStatuses    []func(int, *url.URL) bool
+	dirIndex          bool
+	indexDocuments    []string
+	timeoutOverrides  []timeoutOverride
+	requestTimeout    time.Duration
+	abortErrorRate    float64
+	abortMinSamples   int
+	maxRedirects      int
+	noFollow          bool
+	retries           retryPolicy
+	redirectBudget    int64
+	resultOrder       func([]Result)
+	resultFilters     []func(Result) bool
+	onProgress        func(Stats)
+	progressEvery     time.Duration
+	checkpoints       *checkpointFile
+	window            *crawlWindow
+	transportWrappers []func(http.RoundTripper) http.RoundTripper
+	httpClient        *http.Client
+	// err is the first problem found with the options given to NewCrawler.
+	err      error
+	clock    Clock
+	client   *http.Client
+	fetch    func(context.Context, string) (Result, error)
+	counters *counters
+	// collector summarizes the results of the crawl as they are produced.
+	collector *Collector
+	frontier  *frontier
+	sessions  *sessionDetector
+	robots    *robotsCache
+	flights   *flightGroup
+	dns       *dnsCache
+	delays    *hostDelays
+	// busy is set while a crawl or CheckPages call is running, as they
+	// share the state above.
+	busy *int32
 }
 
-// NewCrawler creates a Crawler with the given configuration (currently
-// this is just the number of concurrent fetchers to run). The crawler's
+// NewCrawler creates a Crawler with the given number of concurrent fetchers
+// to run, and any further configuration given as options. The crawler's
 // fetcher is only configurable internally by this package, for testing
 // purposes.
-func NewCrawler(numFetchers int) Crawler {
-	return Crawler{
-		numFetchers: numFetchers,
-		fetch:       fetchHTTP,
+func NewCrawler(numFetchers int, opts ...Option) Crawler {
+	c := Crawler{
+		numFetchers:  numFetchers,
+		maxIdleConns: defaultMaxIdleConns,
+		userAgent:    DefaultUserAgent,
+		counters:     &counters{},
+		collector:    NewCollector(DefaultSummaryTop),
+		frontier:     &frontier{},
+		sessions:     &sessionDetector{},
+		robots:       &robotsCache{},
+		flights:      &flightGroup{},
+		dns:          newDNSCache(),
+		delays:       &hostDelays{},
+		busy:         new(int32),
+		clock:        realClock{},
+		maxRedirects: defaultMaxRedirects,
+		maxBodySize:  DefaultMaxBodySize,
+		maxDepth:     -1,
+	}
+	for _, opt := range opts {
+		opt(&c)
 	}
+	c.checkFileLimit()
+	c.allowedSites = make(map[string]bool, len(c.allowedHosts))
+	for _, h := range c.allowedHosts {
+		c.allowedSites[c.siteOf(withoutDefaultPort(h))] = true
+	}
+	c.buildExclusions()
+	for i, r := range c.sessions.pinned {
+		c.sessions.pinned[i].Host = c.siteOf(r.Host)
+	}
+	c.client = c.newClient()
+	c.fetch = c.fetchHTTP
+	return c
+}
+
+// checkErrorRate returns an *ErrorRateError if the crawl has failed too many
+// pages, as configured with WithErrorRateAbort.
+func (c Crawler) checkErrorRate() error {
+	if c.abortMinSamples == 0 {
+		return nil
+	}
+	s := c.Stats()
+	if s.Fetched < int64(c.abortMinSamples) || s.ErrorRate() <= c.abortErrorRate {
+		return nil
+	}
+	return &ErrorRateError{Stats: s, Threshold: c.abortErrorRate}
 }
 
 // startFetcher is used to start a fetcher. This is intended to be used
 // as a concurrent worker. It is not of much help otherwise.
-func (c Crawler) startFetcher(urls <-chan string, out chan<- Result) {
-	// Fetch urls from the channel until closed.
-	for u := range urls {
-		r := Result{URL: u}
-		r.Links, r.Err = c.fetch(r.URL)
+func (c Crawler) startFetcher(ctx context.Context, urls <-chan queuedURL, out chan<- Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+	// Fetch urls from the channel until closed, timing each phase for
+	// Stats.Workers.
+	w := &c.counters.workers
+	last := c.clock.Now()
+	for q := range urls {
+		last = w.record(&w.idle, last, c.clock.Now())
+		c.frontier.start(q, last)
+		fctx := ctx
+		if q.scope != "" {
+			fctx = withRedirectScope(ctx, q.scope)
+		}
+		r, err := c.flights.do(q.key, func() (Result, error) {
+			return c.guardedFetch(fctx, q.url)
+		})
+		r.URL, r.Err = q.url, err
+		last = w.record(&w.fetching, last, c.clock.Now())
 		out <- r
+		last = w.record(&w.blocked, last, c.clock.Now())
+	}
+	w.record(&w.idle, last, c.clock.Now())
+}
+
+// guardedFetch fetches a page, recovering from any panic in doing so, so
+// one malformed page can't take down a whole crawl. The page's Result then
+// has an Err wrapping a *PanicError, and a Warning with the stack, and the
+// panic is counted in Stats.Panics. With WithFailFastOnPanic, panics aren't
+// recovered.
+func (c Crawler) guardedFetch(ctx context.Context, addr string) (r Result, err error) {
+	if !c.failFastOnPanic {
+		defer func() {
+			if v := recover(); v != nil {
+				stack := debug.Stack()
+				atomic.AddInt64(&c.counters.panics, 1)
+				r = Result{Warnings: []Warning{{Msg: fmt.Sprintf("panic: %v\n%s", v, stack)}}}
+				err = fmt.Errorf("fetch(%s): %w", addr, &PanicError{Value: v, Stack: stack})
+			}
+		}()
 	}
+	return c.fetch(ctx, addr)
 }
 
 // Crawl orchestrates the crawling of all same-subdomain links, beginning at
@@ -116,65 +650,253 @@ func (c Crawler) startFetcher(urls <-chan string, out chan<- Result) {
 // to be high enough that we do not spend too much time blocked on network IO,
 // but low enough that we don't assault the receiving HTTP servers and/or
 // overflow our own stack.
-// The results will be returned sorted by URL.
+// The results will be returned sorted by URL, or as set with
+// WithResultOrder. If the crawl is aborted, e.g.
+// by WithErrorRateAbort, the results fetched so far are returned along with
+// the error. A Crawler runs one crawl at a time: starting another before it
+// is over returns ErrCrawlerBusy.
 func (c Crawler) Crawl(addr string) ([]Result, error) {
+	return c.CrawlContext(context.Background(), addr)
+}
+
+// CrawlContext is Crawl, stopping early if ctx is cancelled. No more URLs are
+// fetched once it is, and requests in flight are aborted; once they have
+// finished, the results fetched before the cancellation are returned along
+// with ctx.Err().
+func (c Crawler) CrawlContext(ctx context.Context, addr string) ([]Result, error) {
+	end, err := c.begin(addr)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	root, err := c.crawl(ctx, addr, end, func(r Result) { results = append(results, r) })
+	c.countLinks(root, results)
+	c.sortResults(results)
+	if c.linkTargets {
+		c.annotateLinks(root, results)
+	}
+	return results, err
+}
+
+// CrawlStream is Crawl, sending each result on the returned channel as soon
+// as its page is fetched, rather than returning them all at the end, so
+// big crawls needn't be held in memory. Results arrive in the order their
+// fetches complete, and without the link counts, such as Inbound, that
+// need the whole crawl. The channel is closed once the crawl is finished,
+// or if it can't be started, in which case the error is returned too. It
+// must be read until closed, or the crawl is held up.
+func (c Crawler) CrawlStream(addr string) (<-chan Result, error) {
+	return c.CrawlStreamContext(context.Background(), addr)
+}
 
-	root, err := url.Parse(addr)
+// CrawlStreamContext is CrawlStream, stopping early if ctx is cancelled, as
+// for CrawlContext. Once ctx is cancelled, the channel needn't be read any
+// further: the crawl stops sending results, and closes it. A crawl aborted by WithErrorRateAbort ends the stream
+// early too, with Stats.Aborted set.
+func (c Crawler) CrawlStreamContext(ctx context.Context, addr string) (<-chan Result, error) {
+	out := make(chan Result)
+	end, err := c.begin(addr)
 	if err != nil {
+		close(out)
+		return out, err
+	}
+	go func() {
+		defer close(out)
+		c.crawl(ctx, addr, end, func(r Result) {
+			// Once cancelled, the consumer may have stopped reading.
+			select {
+			case out <- r:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return out, nil
+}
+
+// ErrCrawlerBusy is returned when a crawl is started by a Crawler that is
+// already running one. Crawls by the same Crawler share its Stats and
+// Snapshot, so can't run at once; use a Crawler for each.
+var ErrCrawlerBusy = errors.New("crawler is already running a crawl")
+
+// begin reserves the crawler for a crawl from addr, returning the func to
+// call once it is over, or why it can't be started.
+func (c Crawler) begin(addr string) (end func(), err error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if _, err := url.Parse(addr); err != nil {
 		return nil, fmt.Errorf("invalid starting URL %s: %w", addr, err)
 	}
+	return c.reserve()
+}
+
+// reserve reserves the crawler for a crawl or CheckPages call, returning
+// the func that frees it again, or ErrCrawlerBusy if it is already
+// reserved.
+func (c Crawler) reserve() (free func(), err error) {
+	if !atomic.CompareAndSwapInt32(c.busy, 0, 1) {
+		return nil, ErrCrawlerBusy
+	}
+	return func() { atomic.StoreInt32(c.busy, 0) }, nil
+}
+
+// crawl runs a crawl reserved with begin, passing each result to emit as
+// it is fetched, and calling end once its fetchers are done. It returns the
+// root the crawl was scoped to, for counting links.
+func (c Crawler) crawl(ctx context.Context, addr string, end func(), emit func(Result)) (*url.URL, error) {
+	// The fetchers left running by an aborted crawl end it instead.
+	defer func() {
+		if end != nil {
+			end()
+		}
+	}()
+	// Start from the canonical form of the URL, as links are compared in,
+	// so that it isn't fetched again when linked to.
+	seed, _ := url.Parse(addr)
+	root := canonicalize(seed)
+	addr = root.String()
+	sink := emit
+	emit = func(r Result) {
+		if !c.retains(r) {
+			atomic.AddInt64(&c.counters.filtered, 1)
+			return
+		}
+		c.collector.Add(r)
+		sink(r)
+	}
 
-	tofetch := make(chan string)
+	tofetch := make(chan queuedURL)
 	fetched := make(chan Result)
+	var fetchers sync.WaitGroup
 
 	// Start a fixed number of fetchers. This will help us limit our
 	// footprint on the servers we crawl. It is also just prudent
 	// to control our own outlay of resources.
+	fetchers.Add(c.numFetchers)
 	for i := 0; i < c.numFetchers; i++ {
-		go c.startFetcher(tofetch, fetched)
+		go c.startFetcher(ctx, tofetch, fetched, &fetchers)
 	}
 
-	// Work queue - URLs to be crawled.
-	// Start crawling at the given URL
-	work := []string{addr}
+	c.counters.reset(c.clock.Now())
+	c.collector.reset()
+	c.frontier.reset()
+	c.sessions.reset()
+	c.robots.reset()
+	c.dns.reset()
+	c.delays.reset()
+	atomic.StoreInt64(&c.flights.coalesced, 0)
+	c.counters.setRoot(addr)
+	defer c.startCheckpoints()()
 
+	// Work queue - URLs to be crawled, held in the frontier so Snapshot can
+	// see it. Start crawling at the given URL
+	f := c.frontier
+	f.push(queuedURL{url: addr, host: root.Host, key: c.visitKey(root)})
+
+	// URLs are marked as visited as soon as they are added to the work queue,
+	// so the queue never holds duplicates.
 	// TODO: This could be map[string]struct{} to save a bit of space, but the semantics of bool is apt.
-	visited := make(map[string]bool)
+	visited := map[string]bool{c.visitKey(root): true}
+	// The order URLs were discovered in, by URL.
+	discovered := map[string]int{addr: 0}
+	// Seeds are queued once the starting URL has been fetched, so they are
+	// scoped to wherever it redirected to.
+	seeded := false
+	queueSeeds := func() {
+		if !seeded {
+			seeded = true
+			c.queueSeeds(root, f, visited, discovered)
+		}
+	}
 
 	// We need to keep track of whether there is any fetching in progress, in order to know
 	// when we are actually finished.
 	fetching := 0
+	// The number of URLs handed to fetchers, for WithMaxPages.
+	dispatched := 0
+
+	updateCounts := func() {
+		atomic.StoreInt64(&c.counters.queued, int64(len(f.work)))
+		atomic.StoreInt64(&c.counters.discovered, int64(len(visited)))
+		atomic.StoreInt64(&c.counters.inFlight, int64(fetching))
+	}
+	// Progress is reported from this goroutine, so never concurrently: on
+	// a timer, or after each result, and once the crawl is over.
+	var progress <-chan time.Time
+	stopProgress := func() bool { return false }
+	if c.onProgress != nil && c.progressEvery > 0 {
+		progress, stopProgress = c.clock.NewTimer(c.progressEvery)
+	}
+	defer func() {
+		stopProgress()
+		if c.onProgress != nil {
+			updateCounts()
+			c.onProgress(c.Stats())
+		}
+	}()
 
-	var results []Result
 	for {
+		updateCounts()
+
 		// If we currently have no urls to fetch, we have to be sure we aren't sending
 		// the empty next var to the fetchers. We can do this by using a nil channel variable.
 		// This nil channel will block forever, so the select case sending on it will never
 		// match. On any iteration where we do have urls/work to send, we can swap out this
 		// channel with the actual fetchers channel, thus allowing the next url to be sent.
-		var sendWork chan<- string
-		var next string
-		if len(work) > 0 {
-			sendWork = tofetch
-			next = work[0]
-			// In case any duplicates slip through to the work queue, don't fetch the again.
-			if visited[next] {
-				work = work[1:]
-				continue
+		var sendWork chan<- queuedURL
+		var next queuedURL
+		// Outside the crawl window, if there is one, hold on to the queue
+		// until it opens, while letting any fetches in progress finish.
+		var resume <-chan time.Time
+		stopResume := func() bool { return false }
+		limited := c.maxPages > 0 && dispatched >= c.maxPages
+		if len(f.work) > 0 && !limited {
+			if wait := c.window.wait(c.clock.Now()); wait > 0 {
+				c.counters.pause(c.clock.Now())
+				resume, stopResume = c.clock.NewTimer(wait)
+			} else {
+				c.counters.resume(c.clock.Now())
+				sendWork = tofetch
+				next = f.work[0]
 			}
 		} else if fetching == 0 {
-			// The queue is empty and no fetching is on progress. We are done crawling.
+			// The queue is empty, or we've fetched as many pages as we
+			// may, and no fetching is on progress. We are done crawling.
 			// Signal to the fetchers that we are finished with them.
+			if len(f.work) > 0 {
+				atomic.StoreInt64(&c.counters.truncated, 1)
+			}
 			close(tofetch)
+			// Wait for the idle fetchers to exit, so their time is
+			// accounted for in Stats.
+			fetchers.Wait()
 			break
 		}
 
+		fetchedPage := false
 		select {
+		// Once cancelled, stop handing out work, and wait for the fetchers
+		// to finish, so none are left behind. Their requests are aborted,
+		// so their results are incomplete, and are dropped.
+		case <-ctx.Done():
+			stopResume()
+			c.counters.resume(c.clock.Now())
+			close(tofetch)
+			for ; fetching > 0; fetching-- {
+				f.done((<-fetched).URL)
+			}
+			fetchers.Wait()
+			return root, ctx.Err()
 		// If we have a url to crawl and a fetcher is available, send the url to them.
 		case sendWork <- next:
-			visited[next] = true
-			work = work[1:]
+			f.dispatch()
 			fetching++
+			dispatched++
+		// The crawl window has opened.
+		case <-resume:
+		case <-progress:
+			c.onProgress(c.Stats())
+			progress, stopProgress = c.clock.NewTimer(c.progressEvery)
 		// If we have no url to crawl or there are no fetchers available,
 		// process results coming back from the fetchers. This will unblock
 		// any fetchers blocked on sending results back.
@@ -183,58 +905,370 @@ func (c Crawler) Crawl(addr string) ([]Result, error) {
 		// be sure that we aren't holding any of that back due to processing delays.
 		case page := <-fetched:
 			fetching--
+			fetchedPage = true
+			if ctx.Err() != nil {
+				// Cancelled, so the page may be incomplete. Drop it, and
+				// finish up in the case above.
+				f.done(page.URL)
+				break
+			}
+			depth := f.done(page.URL)
+			page.Depth, page.Discovered = depth, discovered[page.URL]
+			page.PageGroup = c.pageGroup(page.URL)
+			if c.linkCheck {
+				c.counters.links.fetched(c, page)
+			}
+			if errors.Is(page.Err, ErrDisallowed) {
+				atomic.AddInt64(&c.counters.disallowed, 1)
+				if page.URL == addr {
+					queueSeeds()
+				}
+				emit(page)
+				break
+			}
+			atomic.AddInt64(&c.counters.fetched, 1)
+			c.counters.transfer.record(page)
+			if page.Err != nil {
+				atomic.AddInt64(&c.counters.errors, 1)
+			}
+			if page.AccessControlled {
+				atomic.AddInt64(&c.counters.accessControlled, 1)
+			}
+			switch ClassifyStatus(page.StatusCode) {
+			case ClassGone:
+				atomic.AddInt64(&c.counters.gone, 1)
+			case ClassLegalBlock:
+				atomic.AddInt64(&c.counters.legalBlocks, 1)
+			}
+			if err := c.checkErrorRate(); err != nil {
+				atomic.StoreInt64(&c.counters.aborted, 1)
+				emit(page)
+				close(tofetch)
+				// Let the fetchers still busy finish, without waiting
+				// for them.
+				go func(n int, end func()) {
+					for ; n > 0; n-- {
+						f.done((<-fetched).URL)
+					}
+					fetchers.Wait()
+					end()
+				}(fetching, end)
+				end = nil
+				return root, err
+			}
 
-			base, err := url.Parse(page.URL)
+			base, err := url.Parse(page.base())
 			if err != nil {
 				log.Println(err)
+				if page.URL == addr {
+					queueSeeds()
+				}
 				// Don't continue processing links from an unparseable URL.
 				break
 			}
+			// If the starting URL redirected to another site, e.g. from
+			// http://example.com to https://www.example.com, scope the
+			// crawl to where it went, or nothing would be in scope.
+			if final, err := url.Parse(page.FinalURL); err == nil && page.FinalURL != "" && page.URL == addr && !c.literalScope && c.siteOf(final.Host) != c.siteOf(root.Host) {
+				log.Printf("starting URL %s redirected to %s: crawling %s instead of %s", addr, final, final.Host, root.Host)
+				root = final
+				visited[c.visitKey(root)] = true
+				c.counters.setRoot(root.String())
+			}
+			if page.URL == addr {
+				queueSeeds()
+			}
+			// The pages a redirect led through and to were fetched
+			// with it, so links straight to them aren't fetched again.
+			for _, addr := range append(page.RedirectChain, page.FinalURL) {
+				if u, err := url.Parse(addr); err == nil && addr != "" {
+					if ok, _ := c.inScope(root.Host, u.Host); ok {
+						visited[c.visitKey(normalize(u))] = true
+					}
+				}
+			}
 			// Process each link found on this page.
-			for _, l := range page.Links {
-
-				// Resolve link
-				// We need to resolve the links, they are still just raw href values.
-				// TODO: Should really consider the possibility that the page
-				// was using <base> tag to resolve links
-				link, err := base.Parse(l)
-				if err != nil {
-					log.Println(err)
-					// Don't further process this bad/unparseable link.
+			for _, l := range c.followedLinks(page) {
+
+				// Resolve and filter link
+				// We need to resolve the links, they are still just raw
+				// href values, relative to the page's base.
+				st := linkState{root: root, base: base, page: page.URL, href: l}
+				d, ok := c.filterLink(&st, nil)
+				c.counters.exclusions.record(&st, page.URL, c.excludedTargets, c.excludedPages)
+				if c.linkCheck && (ok || d.Step == stepScope) {
+					c.counters.links.refer(c, &st, ok, page.URL)
+				}
+				if st.invalid != nil {
+					page.InvalidLinks = append(page.InvalidLinks, *st.invalid)
+					atomic.AddInt64(&c.counters.invalidLinks, 1)
+				}
+				if !ok {
 					continue
 				}
-
-				// Filter link
-				// Clear the fragment and query for more accurate comparison.
-				link.Fragment = ""
-				link.RawQuery = ""
-				l = link.String()
+				link := st.link
 
 				// TODO: query requirements to see if results should
 				// be resolved URLS or not.
-				// If yes, use this: page.Links[i] = l
+				// If yes, use this: page.Links[i] = link.String()
 
-				// We only want to enqueue non-duplicate, same-host URLS
-				if link.Host != root.Host {
+				// Links beyond the maximum depth are recorded, but
+				// not followed.
+				if c.maxDepth >= 0 && depth+1 > c.maxDepth {
 					continue
 				}
-				if visited[l] {
+
+				// We only want to enqueue non-duplicate URLS
+				key := c.visitKey(link)
+				if visited[key] {
 					continue
 				}
-				work = append(work, l)
+				visited[key] = true
+				if c.canonicalHost && c.siteOf(link.Host) == c.siteOf(root.Host) {
+					link.Host = root.Host
+				}
+				c.dns.prefetch(link.Hostname())
+				discovered[link.String()] = len(discovered)
+				f.push(queuedURL{url: link.String(), host: link.Host, key: key, depth: depth + 1, scope: root.Host})
 			}
-			results = append(results, page)
+			emit(c.spillLinks(root, base, page))
+		}
+		stopResume()
+		if fetchedPage && c.onProgress != nil && c.progressEvery <= 0 {
+			updateCounts()
+			c.onProgress(c.Stats())
 		}
+	}
+	if c.linkCheck {
+		c.checkLinks(ctx)
+	}
+	return root, nil
+}
 
+// outboundLinks returns the visit keys of the distinct pages a result links
+// to on and off the site of the crawl from root, given the base its links
+// resolve against.
+func (c Crawler) outboundLinks(root, base *url.URL, r Result) (internal, external map[string]bool) {
+	// Links to the page itself aren't counted, even if its <base href>
+	// is elsewhere.
+	self := ""
+	if u, err := url.Parse(r.URL); err == nil {
+		self = c.visitKey(normalize(u))
+	}
+	internal, external = make(map[string]bool), make(map[string]bool)
+	for _, l := range c.followedLinks(r) {
+		st := linkState{root: root, base: base, page: r.URL, href: l}
+		if d, ok := c.filterLink(&st, nil); ok {
+			internal[c.visitKey(st.link)] = true
+		} else if d.Step == stepScope && (st.link.Scheme == "http" || st.link.Scheme == "https") {
+			// Links dropped by the exclusion and inclusion steps are
+			// on the site, so are neither.
+			external[c.visitKey(st.link)] = true
+		}
 	}
+	delete(internal, self)
+	return internal, external
+}
 
-	// Clean up the results.
+// spillLinks passes a page with more links than the threshold set with
+// WithLinkSpill to the sink, and returns it with only the first links kept.
+// Its links must already have been followed, from base, in the crawl from
+// root, and its Outbound counts are made from them all first. Pages whose
+// results are to be dropped by WithResultFilter aren't spilled.
+func (c Crawler) spillLinks(root, base *url.URL, page Result) Result {
+	if c.spill == nil || len(page.Links) <= c.spillThreshold || !c.retains(page) {
+		return page
+	}
+	internal, external := c.outboundLinks(root, base, page)
+	page.OutboundInternal, page.OutboundExternal = len(internal), len(external)
+	c.spill(page)
+	page.LinkCount = len(page.Links)
+	page.Links = append([]string(nil), page.Links[:c.spillThreshold]...)
+	page.LinksSpilled = true
+	return page
+}
+
+// MarshalJSON marshals a Result with its Err as its message, or null, as
+// errors have no exported fields to marshal. Its Relations are left out if
+// there are none, as omitempty doesn't apply to structs.
+func (r Result) MarshalJSON() ([]byte, error) {
+	// result has Result's fields but not its methods, so marshalling it
+	// doesn't recurse.
+	type result Result
+	var msg *string
+	if r.Err != nil {
+		m := r.Err.Error()
+		msg = &m
+	}
+	var rels *Relations
+	if !r.Relations.empty() {
+		rels = &r.Relations
+	}
+	return json.Marshal(struct {
+		result
+		Err       *string
+		Relations *Relations `json:",omitempty"`
+	}{result(r), msg, rels})
+}
+
+// UnmarshalJSON unmarshals a Result marshalled by MarshalJSON. Its Err has
+// the original message, and wraps ErrDisallowed, ErrFileLimit or
+// ErrBodyTooLarge if the original did, so errors.Is still works on it, and
+// an *HTTPError with the result's StatusCode if the original did, for
+// errors.As.
+func (r *Result) UnmarshalJSON(b []byte) error {
+	type result Result
+	aux := struct {
+		*result
+		Err *string
+	}{result: (*result)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	r.Err = nil
+	if aux.Err != nil {
+		r.Err = unmarshalledError(*aux.Err, r.StatusCode)
+	}
+	return nil
+}
+
+// sentinelErrors are the errors a Result's Err may wrap that callers test
+// for with errors.Is.
+var sentinelErrors = []error{ErrDisallowed, ErrFileLimit, ErrBodyTooLarge}
+
+// unmarshalledError is an error unmarshalled from its message, wrapping the
+// sentinel error the message shows the original wrapped, if any, or the
+// *HTTPError for status.
+func unmarshalledError(msg string, status int) error {
+	for _, sentinel := range sentinelErrors {
+		if strings.HasSuffix(msg, sentinel.Error()) {
+			return &jsonError{msg: msg, wrapped: sentinel}
+		}
+	}
+	if status != 0 {
+		prefix := (&HTTPError{StatusCode: status}).Error()
+		if i := strings.LastIndex(msg, prefix); i >= 0 {
+			return &jsonError{msg: msg, wrapped: &HTTPError{StatusCode: status, Status: msg[i+len(prefix):]}}
+		}
+	}
+	return &jsonError{msg: msg}
+}
+
+// jsonError is an error recreated from JSON.
+type jsonError struct {
+	msg     string
+	wrapped error
+}
+
+func (e *jsonError) Error() string { return e.msg }
+func (e *jsonError) Unwrap() error { return e.wrapped }
+
+// base returns the URL the result's links are relative to.
+func (r Result) base() string {
+	if r.Base != "" {
+		return r.Base
+	}
+	if r.FinalURL != "" {
+		return r.FinalURL
+	}
+	return r.URL
+}
+
+// followedLinks returns the links on a page that the crawl follows.
+func (c Crawler) followedLinks(page Result) []string {
+	links := page.Links
+	if c.followSpec {
+		links = append(append([]string(nil), links...), page.Speculative...)
+	}
+	if page.Relations.Next != "" {
+		links = append(append([]string(nil), links...), page.Relations.Next)
+	}
+	if page.Location != "" {
+		links = append(append([]string(nil), links...), page.Location)
+	}
+	return links
+}
+
+// resultKeys maps the visit key of each result's URL to its index. The
+// pages a result's redirects led through and to map to it too, unless they
+// have results of their own, as they were fetched with it.
+func (c Crawler) resultKeys(results []Result) map[string]int {
+	pages := make(map[string]int, len(results))
+	for i, r := range results {
+		if u, err := url.Parse(r.URL); err == nil {
+			pages[c.visitKey(normalize(u))] = i
+		}
+	}
+	for i, r := range results {
+		for _, addr := range append(r.RedirectChain, r.FinalURL) {
+			u, err := url.Parse(addr)
+			if err != nil || addr == "" {
+				continue
+			}
+			if key := c.visitKey(normalize(u)); !hasKey(pages, key) {
+				pages[key] = i
+			}
+		}
+	}
+	return pages
+}
+
+func hasKey(m map[string]int, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// countLinks fills in the inbound and outbound link counts, and referrers, of
+// the results of a crawl from root. Links are filtered and matched to pages
+// exactly as the crawl followed them, through filterLink and visitKey.
+func (c Crawler) countLinks(root *url.URL, results []Result) {
+	pages := c.resultKeys(results)
+	for i := range results {
+		r := &results[i]
+		base, err := url.Parse(r.base())
+		if err != nil {
+			continue
+		}
+		internal, external := c.outboundLinks(root, base, *r)
+		if !r.LinksSpilled {
+			// Those of spilled pages were counted from all their links.
+			r.OutboundInternal, r.OutboundExternal = len(internal), len(external)
+		}
+		for key := range internal {
+			if j, ok := pages[key]; ok {
+				results[j].Inbound++
+				results[j].Referrers = append(results[j].Referrers, r.URL)
+			}
+		}
+	}
+}
+
+// sortResults puts everything in the results whose order isn't meaningful
+// into a stable order, so the same crawl always produces the same output,
+// and then orders the results as configured with WithResultOrder.
+func (c Crawler) sortResults(results []Result) {
 	for _, res := range results {
 		sort.Strings(res.Links)
+		sort.Strings(res.Speculative)
+		sort.Strings(res.Referrers)
+		sort.Slice(res.Assets, func(i, j int) bool {
+			if res.Assets[i].URL != res.Assets[j].URL {
+				return res.Assets[i].URL < res.Assets[j].URL
+			}
+			return res.Assets[i].Tag < res.Assets[j].Tag
+		})
+		sort.Strings(res.Relations.Alternates)
+		sortInvalidLinks(res.InvalidLinks)
+		sort.SliceStable(res.Warnings, func(i, j int) bool {
+			if res.Warnings[i].Offset != res.Warnings[j].Offset {
+				return res.Warnings[i].Offset < res.Warnings[j].Offset
+			}
+			return res.Warnings[i].Msg < res.Warnings[j].Msg
+		})
 	}
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].URL < results[j].URL
-	})
-
-	return results, nil
+	order := c.resultOrder
+	if order == nil {
+		order = SortByURL
+	}
+	order(results)
 }
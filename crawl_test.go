@@ -1,54 +1,98 @@
 package crawl
 
 import (
+	"bytes"
+	"context"
+	"crawl/crawltest"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/net/html"
 )
 
 func TestCrawl(t *testing.T) {
-	want := []Result{
-		{URL: "https://monzo.com", Links: []string{"/", "/bar"}},
-		{URL: "https://monzo.com/", Links: []string{"/foo", "https://monzo.com/bar"}},
-		{URL: "https://monzo.com/foo", Links: []string{"/", "bar", "/baz"}},
-		{URL: "https://monzo.com/bar", Links: []string{"https://community.monzo.com", "bar"}},
-		{URL: "https://monzo.com/baz", Links: []string{"https://facebook.com"}},
-	}
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/foo", "https://MONZO.com:443/bar")
+	site.Page("https://monzo.com/foo", "/", "bar", "/baz")
+	site.Page("https://monzo.com/bar", "https://community.monzo.com", "bar")
+	site.Page("https://monzo.com/baz", "https://facebook.com")
 
-	fetchMem := func(addr string) ([]string, error) {
-		for _, r := range want {
-			if r.URL != addr {
-				continue
-			}
-			return r.Links, nil
+	page := func(url string, depth int, links ...string) Result {
+		// The size of the body the fake serves for the links.
+		var n int64
+		for _, l := range links {
+			n += int64(len(fmt.Sprintf("<a href=\"%s\">%s</a>\n", l, l)))
 		}
-		return nil, fmt.Errorf("url (%s) not found", addr)
+		return Result{URL: url, Links: links, Depth: depth, StatusCode: 200, ContentType: "text/html", Proto: "HTTP/1.1", BytesOnWire: n, BytesDecoded: n, Timeout: defaultTimeout}
+	}
+	// The starting URL, and the links to / and /bar, are all normalized,
+	// so each page is only crawled once.
+	want := []Result{
+		page("https://monzo.com/", 0, "/foo", "https://MONZO.com:443/bar"),
+		page("https://monzo.com/bar", 1, "bar", "https://community.monzo.com"),
+		page("https://monzo.com/baz", 2, "https://facebook.com"),
+		page("https://monzo.com/foo", 1, "/", "/baz", "bar"),
+	}
+	// The link counts follow from the links above, e.g. /bar's link to bar
+	// is to itself, so isn't counted.
+	counts := [][3]int{{2, 0, 1}, {0, 1, 2}, {0, 1, 1}, {3, 0, 1}}
+	for i, n := range counts {
+		want[i].OutboundInternal, want[i].OutboundExternal, want[i].Inbound = n[0], n[1], n[2]
+	}
+	// The pages linking to each, e.g. /baz is only reached through /foo.
+	referrers := [][]string{{"https://monzo.com/foo"}, {"https://monzo.com/", "https://monzo.com/foo"}, {"https://monzo.com/foo"}, {"https://monzo.com/"}}
+	for i, r := range referrers {
+		want[i].Referrers = r
+	}
+	// Only one page discovers each new URL, so the discovery order is fixed.
+	for i, n := range []int{0, 2, 3, 1} {
+		want[i].Discovered = n
 	}
 
-	c := NewCrawler(25)
-
-	// Override the default fetcher for this test
-	c.fetch = fetchMem
-
+	c := NewCrawler(25, WithTransportMiddleware(site.Wrap))
 	got, err := c.Crawl("https://monzo.com")
-
 	if err != nil {
-		t.Errorf("Crawl erred when not expected")
+		t.Errorf("Crawl erred when not expected: %v", err)
 	}
-
-	sortResults := cmpopts.SortSlices(func(i, j Result) bool {
-		return i.URL < j.URL
-	})
-	sortStrings := cmpopts.SortSlices(func(i, j string) bool {
-		return i < j
-	})
-
-	if diff := cmp.Diff(want, got, sortResults, sortStrings); diff != "" {
+	// Every page takes some time to fetch, but how long varies.
+	for i := range got {
+		if got[i].Duration <= 0 {
+			t.Errorf("%s Duration = %v, want it timed", got[i].URL, got[i].Duration)
+		}
+		got[i].Duration = 0
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("Crawl() mismatch (-want +got):\n%s", diff)
 	}
 
+	// Each page is only fetched once, and nothing off the site is, besides
+	// its robots.txt.
+	for _, r := range want {
+		if n := site.Calls(r.URL); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", r.URL, n)
+		}
+	}
+	if n := len(site.Requests()); n != len(want)+1 {
+		t.Errorf("Crawl made %d requests, want %d", n, len(want)+1)
+	}
 }
 
 func TestScrape(t *testing.T) {
@@ -114,10 +158,1386 @@ func TestScrape(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		got, _ := scrape(c.body)
-		if diff := cmp.Diff(c.want, got); diff != "" {
+		got, _ := scrape(c.body, nil, nil, 0)
+		if diff := cmp.Diff(c.want, got.links); diff != "" {
 			t.Errorf("scrape() mismatch (-want +got):\n%s", diff)
 		}
 
 	}
 }
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"https://monzo.com", "https://monzo.com/"},
+		{"HTTPS://Monzo.COM/About", "https://monzo.com/About"},
+		{"https://monzo.com:443/a", "https://monzo.com/a"},
+		{"http://monzo.com:80/a", "http://monzo.com/a"},
+		{"https://monzo.com:8443/a", "https://monzo.com:8443/a"},
+		{"https://monzo.com/a/./b/../c", "https://monzo.com/a/c"},
+		{"https://monzo.com/%7Euser/%41%2Fb", "https://monzo.com/~user/A%2Fb"},
+		{"https://monzo.com/a/../b?x=1#top", "https://monzo.com/b?x=1"},
+		{"mailto:help@monzo.com", "mailto:help@monzo.com"},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.in)
+		if err != nil {
+			t.Fatalf("url.Parse(%q) erred: %v", tc.in, err)
+		}
+		if got := canonicalize(u).String(); got != tc.want {
+			t.Errorf("canonicalize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com/":    {"/foo", "/bar"},
+		"https://monzo.com/foo": {"/", "/bar", "/foo"},
+	}
+
+	c := NewCrawler(2)
+	var mu sync.Mutex
+	var during []Stats
+	c.fetch = func(ctx context.Context, addr string) (Result, error) {
+		mu.Lock()
+		during = append(during, c.Stats())
+		mu.Unlock()
+		links, ok := site[addr]
+		if !ok {
+			return Result{}, fmt.Errorf("url (%s) not found", addr)
+		}
+		return Result{Links: links}, nil
+	}
+
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected")
+	}
+
+	for _, s := range during {
+		if s.Fetched >= s.Discovered {
+			t.Errorf("Stats() during crawl fetched %d of %d discovered, want fewer", s.Fetched, s.Discovered)
+		}
+	}
+
+	want := Stats{Root: "https://monzo.com/", Fetched: 3, Errors: 1, Queued: 0, Discovered: 3}
+	got := c.Stats()
+	if got.Elapsed <= 0 {
+		t.Errorf("Stats().Elapsed = %v, want > 0", got.Elapsed)
+	}
+	got.Elapsed, got.Workers = 0, WorkerStats{}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+	if p := got.Progress(); p != 1 {
+		t.Errorf("Progress() = %v after crawl, want 1", p)
+	}
+}
+
+// fetchSite returns a fetcher serving the links of an in-memory site.
+func fetchSite(site map[string][]string) func(context.Context, string) (Result, error) {
+	// The crawl requests URLs in their canonical form, e.g. with a root
+	// path, but the sites are easier to read as written.
+	pages := make(map[string][]string, len(site))
+	for addr, links := range site {
+		u, err := url.Parse(addr)
+		if err != nil {
+			panic(err)
+		}
+		pages[canonicalize(u).String()] = links
+	}
+	return func(ctx context.Context, addr string) (Result, error) {
+		links, ok := pages[addr]
+		if !ok {
+			return Result{}, fmt.Errorf("url (%s) not found", addr)
+		}
+		return Result{Links: links}, nil
+	}
+}
+
+// crawledURLs returns the URLs of the results of crawling the in-memory site
+// with the given options.
+func crawledURLs(t *testing.T, site map[string][]string, seed string, opts ...Option) []string {
+	t.Helper()
+	c := NewCrawler(5, opts...)
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl(seed)
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	return urls
+}
+
+func TestHostAliases(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com/":        {"https://www.monzo.com/foo", "/bar", "https://monzo.co.uk/baz"},
+		"https://www.monzo.com/foo": {"https://monzo.com/foo", "https://WWW.monzo.com/bar"},
+		"https://monzo.com/foo":     {},
+		"https://monzo.com/bar":     {},
+		"https://monzo.co.uk/baz":   {},
+		"https://monzo.com/baz":     {},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "same host only",
+			want: []string{"https://monzo.com/", "https://monzo.com/bar"},
+		},
+		{
+			name: "coalesce www",
+			opts: []Option{WithCoalesceWWW(true)},
+			want: []string{"https://monzo.com/", "https://monzo.com/bar", "https://www.monzo.com/foo"},
+		},
+		{
+			name: "coalesce www with canonical host",
+			opts: []Option{WithCoalesceWWW(true), WithCanonicalHost(true)},
+			want: []string{"https://monzo.com/", "https://monzo.com/bar", "https://monzo.com/foo"},
+		},
+		{
+			name: "aliases",
+			opts: []Option{WithHostAliases("monzo.com", "www.monzo.com", "monzo.co.uk")},
+			want: []string{"https://monzo.co.uk/baz", "https://monzo.com/", "https://monzo.com/bar", "https://www.monzo.com/foo"},
+		},
+		{
+			name: "allowed hosts with canonical host",
+			opts: []Option{WithAllowedHosts("monzo.co.uk"), WithCoalesceWWW(true), WithCanonicalHost(true)},
+			want: []string{"https://monzo.co.uk/baz", "https://monzo.com/", "https://monzo.com/bar", "https://monzo.com/foo"},
+		},
+		{
+			name: "aliases with canonical host",
+			opts: []Option{WithHostAliases("monzo.co.uk", "monzo.com"), WithCanonicalHost(true)},
+			want: []string{"https://monzo.com/", "https://monzo.com/bar", "https://monzo.com/baz"},
+		},
+	}
+
+	for _, c := range cases {
+		got := crawledURLs(t, site, "https://monzo.com/", c.opts...)
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%s: Crawl() mismatch (-want +got):\n%s", c.name, diff)
+		}
+	}
+}
+
+func TestDirectoryIndex(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":                 {"/docs", "/blog/"},
+		"https://monzo.com/docs":            {"/docs/", "/docs/index.html", "/"},
+		"https://monzo.com/blog/":           {"/blog", "/blog/index.htm"},
+		"https://monzo.com/blog/index.htm":  {},
+		"https://monzo.com/docs/":           {},
+		"https://monzo.com/docs/index.html": {},
+		"https://monzo.com/blog":            {},
+	}
+
+	cases := []struct {
+		opts []Option
+		want []string
+	}{
+		{
+			want: []string{
+				"https://monzo.com/", "https://monzo.com/blog",
+				"https://monzo.com/blog/", "https://monzo.com/blog/index.htm", "https://monzo.com/docs",
+				"https://monzo.com/docs/", "https://monzo.com/docs/index.html",
+			},
+		},
+		{
+			opts: []Option{WithDirectoryIndex()},
+			want: []string{
+				"https://monzo.com/", "https://monzo.com/blog/", "https://monzo.com/blog/index.htm",
+				"https://monzo.com/docs", "https://monzo.com/docs/index.html",
+			},
+		},
+		{
+			opts: []Option{WithDirectoryIndex("index.html", "index.htm")},
+			want: []string{"https://monzo.com/", "https://monzo.com/blog/", "https://monzo.com/docs"},
+		},
+	}
+	for _, tc := range cases {
+		got := crawledURLs(t, site, "https://monzo.com", tc.opts...)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("crawl with %d options mismatch (-want +got):\n%s", len(tc.opts), diff)
+		}
+	}
+}
+
+func TestScrapeExtra(t *testing.T) {
+	body := []byte(`<!DOCTYPE html>
+<html>
+<body>
+<a href="/foo" data-href="/foo-js">foo</a>
+<a data-href="/bar-js">bar</a>
+<img src="/img.png" data-src="/lazy.png">
+<div data-url="/not-configured"></div>
+<iframe srcdoc="<a href=&quot;/embedded&quot;>e</a><img data-src=&quot;/embedded.png&quot;>"></iframe>
+</body>
+</html>
+`)
+	extra := map[string][]string{
+		"a":   {"data-href"},
+		"img": {"data-src"},
+	}
+
+	got, err := scrape(body, extra, nil, 0)
+	if err != nil {
+		t.Fatalf("scrape erred when not expected: %v", err)
+	}
+	if diff := cmp.Diff([]string{"/foo", "/embedded"}, got.links); diff != "" {
+		t.Errorf("scrape() links mismatch (-want +got):\n%s", diff)
+	}
+	want := []string{"/foo-js", "/bar-js", "/lazy.png", "/embedded.png"}
+	if diff := cmp.Diff(want, got.speculative); diff != "" {
+		t.Errorf("scrape() speculative mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path != "/" {
+			return
+		}
+		w.Write([]byte(`<html><head>
+<link rel="stylesheet" href="/site.css">
+<script src="/app.js"></script>
+</head><body>
+<a href="/a">a</a>
+<img src="/logo.png" usemap="#map">
+<map name="map"><area href="/area"></map>
+<iframe src="/frame"></iframe>
+</body></html>`))
+	}))
+	defer ts.Close()
+
+	attrs := map[string][]string{"img": {"src"}}
+	for element, keys := range DefaultAssetAttributes {
+		attrs[element] = keys
+	}
+	c := NewCrawler(1, WithIgnoreRobots(true), WithAssets(attrs))
+	results, err := c.Crawl(ts.URL)
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	// Assets are only recorded, so only the anchor is crawled.
+	if len(results) != 2 || results[1].URL != ts.URL+"/a" {
+		t.Fatalf("Crawl() = %+v, want / and /a", results)
+	}
+	want := []Asset{{"/area", "area"}, {"/frame", "iframe"}, {"/logo.png", "img"}, {"/site.css", "link"}}
+	if diff := cmp.Diff(want, results[0].Assets); diff != "" {
+		t.Errorf("Assets mismatch (-want +got):\n%s", diff)
+	}
+
+	results, err = NewCrawler(1, WithIgnoreRobots(true)).Crawl(ts.URL)
+	if err != nil || results[0].Assets != nil {
+		t.Errorf("Crawl() without WithAssets = %+v, %v, want no assets", results[0].Assets, err)
+	}
+}
+
+func TestResultTitle(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/untitled", "/report.pdf")
+	site.Handle("https://monzo.com/", crawltest.Response{Body: `<html><head><title>
+  Monzo <b>Bank</b>
+  home</title><title>Second</title></head><body>
+<a href="/untitled">untitled</a><a href="/report.pdf">report</a></body></html>`})
+	site.Handle("https://monzo.com/untitled", crawltest.Response{Body: `<p>No title here</p>`})
+	site.Handle("https://monzo.com/report.pdf", crawltest.Response{Header: http.Header{"Content-Type": {"application/pdf"}}, Body: "%PDF-1.4 <title>x</title>"})
+
+	results, err := NewCrawler(1, WithSkipNonHTML(true), WithTransportMiddleware(site.Wrap)).Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	got := make(map[string]string)
+	for _, r := range results {
+		got[r.URL] = r.Title
+	}
+	// Markup in a title is its text, and only the first title counts. A
+	// PDF isn't scraped, so has none.
+	want := map[string]string{
+		"https://monzo.com/":           "Monzo <b>Bank</b> home",
+		"https://monzo.com/untitled":   "",
+		"https://monzo.com/report.pdf": "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("titles mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpeculativeLinks(t *testing.T) {
+	site := map[string]Result{
+		"https://monzo.com/":    {Links: []string{"/foo"}, Speculative: []string{"/bar"}},
+		"https://monzo.com/foo": {},
+		"https://monzo.com/bar": {},
+	}
+	fetch := func(ctx context.Context, addr string) (Result, error) {
+		return site[addr], nil
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "recorded only",
+			want: []string{"https://monzo.com/", "https://monzo.com/foo"},
+		},
+		{
+			name: "followed",
+			opts: []Option{WithSpeculativeLinks(true)},
+			want: []string{"https://monzo.com/", "https://monzo.com/bar", "https://monzo.com/foo"},
+		},
+	}
+
+	for _, c := range cases {
+		cr := NewCrawler(5, c.opts...)
+		cr.fetch = fetch
+		results, err := cr.Crawl("https://monzo.com/")
+		if err != nil {
+			t.Fatalf("%s: Crawl erred when not expected: %v", c.name, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.URL)
+		}
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%s: Crawl() mismatch (-want +got):\n%s", c.name, diff)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGoldenJSON(t *testing.T) {
+	site := map[string]Result{
+		"https://monzo.com/": {
+			Links: []string{"/foo", "/bar", "/baz#top"},
+			Warnings: []Warning{
+				{Line: 9, Offset: 120, Msg: "unclosed <a>"},
+				{Line: 2, Offset: 14, Msg: "unquoted href attribute"},
+				{Line: 2, Offset: 14, Msg: "2 href attributes, only the first is used"},
+			},
+		},
+		"https://monzo.com/foo": {Links: []string{"/", "bar"}, Speculative: []string{"/lazy.png", "/a.png"}},
+		"https://monzo.com/bar": {},
+		"https://monzo.com/baz": {},
+	}
+	fetch := func(ctx context.Context, addr string) (Result, error) {
+		r := site[addr]
+		// Copy, so the crawl's sorting can't leak between runs.
+		r.Links = append([]string(nil), r.Links...)
+		r.Speculative = append([]string(nil), r.Speculative...)
+		r.Warnings = append([]Warning(nil), r.Warnings...)
+		return r, nil
+	}
+
+	var outputs [][]byte
+	for i := 0; i < 2; i++ {
+		c := NewCrawler(5)
+		c.fetch = fetch
+		results, err := c.Crawl("https://monzo.com/")
+		if err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		j, err := json.MarshalIndent(results, "", "\t")
+		if err != nil {
+			t.Fatalf("json.MarshalIndent erred when not expected: %v", err)
+		}
+		outputs = append(outputs, j)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Errorf("JSON output differs between identical crawls:\n%s\n%s", outputs[0], outputs[1])
+	}
+
+	golden := filepath.Join("testdata", "results.golden.json")
+	if *update {
+		if err := ioutil.WriteFile(golden, outputs[0], 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if diff := cmp.Diff(string(want), string(outputs[0])); diff != "" {
+		t.Errorf("JSON output mismatch with %s (-want +got):\n%s", golden, diff)
+	}
+}
+
+func TestWorkerStats(t *testing.T) {
+	// Each page links only to the next, so however many fetchers there
+	// are, only one can be busy at a time.
+	site := map[string][]string{
+		"https://monzo.com":   {"/1"},
+		"https://monzo.com/1": {"/2"},
+		"https://monzo.com/2": {"/3"},
+		"https://monzo.com/3": {},
+	}
+	slow := func(ctx context.Context, addr string) (Result, error) {
+		time.Sleep(20 * time.Millisecond)
+		return fetchSite(site)(ctx, addr)
+	}
+
+	for _, tc := range []struct {
+		fetchers int
+		min, max float64
+	}{
+		{fetchers: 1, min: 0.8, max: 1},
+		{fetchers: 4, min: 0.15, max: 0.35},
+	} {
+		c := NewCrawler(tc.fetchers)
+		c.fetch = slow
+		if _, err := c.Crawl("https://monzo.com"); err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		w := c.Stats().Workers
+		if u := w.Utilization(); u < tc.min || u > tc.max {
+			t.Errorf("with %d fetchers, utilization = %.2f (%+v), want between %.2f and %.2f", tc.fetchers, u, w, tc.min, tc.max)
+		}
+		if sum := w.Utilization() + w.IdleFraction() + w.BlockedFraction(); math.Abs(sum-1) > 1e-9 {
+			t.Errorf("with %d fetchers, fractions sum to %v, want 1", tc.fetchers, sum)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":   {"/a", "/b"},
+		"https://monzo.com/a": {},
+		"https://monzo.com/b": {"/missing"},
+	}
+
+	var fetched []int64
+	c := NewCrawler(1, WithProgress(0, func(s Stats) {
+		fetched = append(fetched, s.Fetched)
+	}))
+	c.fetch = fetchSite(site)
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	// Once after each page, then once at the end.
+	if want := []int64{1, 2, 3, 4, 4}; !cmp.Equal(fetched, want) {
+		t.Errorf("progress reported Fetched %v, want %v", fetched, want)
+	}
+
+	if _, err := NewCrawler(1, WithProgress(-time.Second, func(Stats) {})).Crawl("https://monzo.com"); err == nil {
+		t.Error("Crawl with a negative progress interval didn't err")
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/a", StatusCode: 404, Err: fmt.Errorf("fetchHTTP(https://monzo.com/a) %w", &HTTPError{StatusCode: 404, Status: "404 Not Found"})},
+		{URL: "https://monzo.com/private", Err: fmt.Errorf("checking robots.txt: %w", ErrDisallowed)},
+		{URL: "https://monzo.com/", Links: []string{"/a"}, Relations: Relations{Canonical: "/"}},
+		{URL: "https://monzo.com/big", StatusCode: 200, Err: fmt.Errorf("getHTTP(https://monzo.com/big) read 10 bytes: %w", ErrBodyTooLarge)},
+	}
+	j, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("marshalling results erred: %v", err)
+	}
+	if want := `"Err":"fetchHTTP(https://monzo.com/a) got bad HTTP reponse code (404): 404 Not Found"`; !strings.Contains(string(j), want) {
+		t.Errorf("marshalled results %s don't contain %s", j, want)
+	}
+	// Optional fields are left out unless set.
+	for _, field := range []string{"Speculative", "Timeout", "Warnings"} {
+		if strings.Contains(string(j), `"`+field+`"`) {
+			t.Errorf("marshalled results %s contain unset %s", j, field)
+		}
+	}
+	if n := strings.Count(string(j), `"Relations"`); n != 1 {
+		t.Errorf("marshalled results %s contain Relations %d times, want once", j, n)
+	}
+
+	var got []Result
+	if err := json.Unmarshal(j, &got); err != nil {
+		t.Fatalf("unmarshalling results erred: %v", err)
+	}
+	if len(got) != len(results) {
+		t.Fatalf("unmarshalled %d results, want %d", len(got), len(results))
+	}
+	for i, r := range got {
+		if want := results[i].Err; (r.Err == nil) != (want == nil) || r.Err != nil && r.Err.Error() != want.Error() {
+			t.Errorf("unmarshalled Err of %s = %v, want %v", r.URL, r.Err, want)
+		}
+	}
+	if !errors.Is(got[1].Err, ErrDisallowed) {
+		t.Errorf("unmarshalled Err %v doesn't wrap ErrDisallowed", got[1].Err)
+	}
+	if !errors.Is(got[3].Err, ErrBodyTooLarge) {
+		t.Errorf("unmarshalled Err %v doesn't wrap ErrBodyTooLarge", got[3].Err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(got[0].Err, &httpErr) || *httpErr != (HTTPError{StatusCode: 404, Status: "404 Not Found"}) {
+		t.Errorf("unmarshalled Err %v doesn't wrap the *HTTPError", got[0].Err)
+	}
+	if errors.As(got[3].Err, &httpErr) {
+		t.Errorf("unmarshalled Err %v of a 200 wraps an *HTTPError", got[3].Err)
+	}
+	if got[0].StatusCode != 404 || !cmp.Equal(got[2].Links, []string{"/a"}) || got[2].Relations.Canonical != "/" {
+		t.Errorf("unmarshalled results %+v lost their other fields", got)
+	}
+}
+
+func TestErrorRateAbort(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":   {"/a", "/b", "/c", "/d", "/e", "/f"},
+		"https://monzo.com/a": {},
+	}
+
+	c := NewCrawler(1, WithErrorRateAbort(0.5, 4))
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	var rateErr *ErrorRateError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("Crawl err = %v, want *ErrorRateError", err)
+	}
+	// Pages are fetched in order, so the crawl is aborted after the 5th,
+	// when 3 of 5 failed is the first rate over the threshold.
+	want := Stats{Root: "https://monzo.com/", Fetched: 5, Errors: 3, Queued: 2, InFlight: 1, Discovered: 7}
+	got := rateErr.Stats
+	got.Elapsed, got.Workers = 0, WorkerStats{}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ErrorRateError.Stats mismatch (-want +got):\n%s", diff)
+	}
+	if len(results) != 5 {
+		t.Errorf("Crawl returned %d results, want the 5 fetched before aborting", len(results))
+	}
+
+	// Below the threshold, the crawl finishes.
+	c = NewCrawler(1, WithErrorRateAbort(0.9, 4))
+	c.fetch = fetchSite(site)
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Errorf("Crawl with error rate below threshold erred: %v", err)
+	}
+
+	for _, opt := range []Option{WithErrorRateAbort(1, 10), WithErrorRateAbort(-0.1, 10), WithErrorRateAbort(0.5, 0)} {
+		if _, err := NewCrawler(1, opt).Crawl("https://monzo.com"); err == nil {
+			t.Errorf("Crawl did not err with invalid error rate abort")
+		}
+	}
+}
+
+func TestRequestStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/foo">foo</a><a href="/missing">missing</a>`))
+		case "/foo":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2)
+	if _, err := c.Crawl(ts.URL + "/"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	// The request for the missing robots.txt doesn't count as a page.
+	s := c.Stats()
+	if s.Fetched != 3 || s.Errors != 1 {
+		t.Errorf("Stats() Fetched, Errors = %d, %d, want 3, 1", s.Fetched, s.Errors)
+	}
+	want := map[string]struct{ requests, errors int64 }{
+		"page":   {3, 1},
+		"robots": {1, 1},
+	}
+	if len(s.Requests) != len(want) {
+		t.Errorf("Stats().Requests = %v, want purposes %v", s.Requests, want)
+	}
+	for purpose, w := range want {
+		r := s.Requests[purpose]
+		if r.Requests != w.requests || r.Errors != w.errors {
+			t.Errorf("Stats().Requests[%s] requests, errors = %d, %d, want %d, %d", purpose, r.Requests, r.Errors, w.requests, w.errors)
+		}
+		var inHistogram int64
+		for _, n := range r.Latency {
+			inHistogram += n
+		}
+		if inHistogram != r.Requests || len(r.Latency) != len(LatencyBuckets())+1 {
+			t.Errorf("Stats().Requests[%s].Latency = %v, want %d requests in %d buckets", purpose, r.Latency, r.Requests, len(LatencyBuckets())+1)
+		}
+		if r.Duration <= 0 {
+			t.Errorf("Stats().Requests[%s].Duration = %v, want > 0", purpose, r.Duration)
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clk := crawltest.NewClock(time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC))
+	site := crawltest.NewFake()
+	site.Clock = clk
+	site.Page("https://monzo.com", "/slow")
+	site.Handle("https://monzo.com/slow", crawltest.Response{Latency: 3 * time.Second})
+
+	c := NewCrawler(1, WithClock(clk), WithTransportMiddleware(site.Wrap))
+	done := make(chan error)
+	go func() {
+		_, err := c.Crawl("https://monzo.com")
+		done <- err
+	}()
+	clk.WaitForTimers(1)
+	if s := c.Snapshot(0); len(s.InFlight) != 1 || s.InFlight[0].Elapsed != 0 {
+		t.Errorf("Snapshot() InFlight = %+v, want /slow with no time elapsed", s.InFlight)
+	}
+	clk.Advance(3 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	s := c.Stats()
+	if s.Elapsed != 3*time.Second {
+		t.Errorf("Stats().Elapsed = %v, want 3s", s.Elapsed)
+	}
+	pages := s.Requests["page"]
+	if pages.Duration != 3*time.Second {
+		t.Errorf("page request Duration = %v, want 3s", pages.Duration)
+	}
+	// The fast page is in the first bucket, the slow one in (2.5s, 5s].
+	if diff := cmp.Diff([]int64{1, 0, 0, 0, 0, 1, 0, 0}, pages.Latency); diff != "" {
+		t.Errorf("page request Latency mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	site := crawltest.NewFake()
+	redirect := func(from, to string) {
+		site.Handle(from, crawltest.Response{Status: http.StatusFound, Header: http.Header{"Location": {to}}})
+	}
+	site.Page("https://monzo.com", "/a", "/loop")
+	redirect("https://monzo.com/a", "/b")
+	redirect("https://monzo.com/b", "/c")
+	site.Page("https://monzo.com/c")
+	redirect("https://monzo.com/loop", "/loop2")
+	redirect("https://monzo.com/loop2", "/loop")
+
+	c := NewCrawler(1, WithMaxRedirects(3), WithRedirectBudget(4), WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Crawl() = %+v, want 3 results", got)
+	}
+	if r := got[1]; r.URL != "https://monzo.com/a" || r.Redirects != 2 || r.Err != nil {
+		t.Errorf("result for /a = %+v, want 2 redirects", r)
+	}
+	if r := got[2]; r.URL != "https://monzo.com/loop" || r.Err == nil || !strings.Contains(r.Err.Error(), "stopped after 3 redirects") {
+		t.Errorf("result for /loop = %+v, want stopped after 3 redirects", r)
+	}
+
+	s := c.Stats()
+	if s.Redirects != 5 || s.Requests["page"].Redirects != 5 {
+		t.Errorf("Stats() Redirects = %d, page Redirects = %d, want 5", s.Redirects, s.Requests["page"].Redirects)
+	}
+	if !s.OverRedirectBudget {
+		t.Errorf("Stats().OverRedirectBudget = false, want true with 5 redirects over a budget of 4")
+	}
+
+	if err := NewCrawler(1, WithMaxRedirects(-1)).err; err == nil {
+		t.Errorf("WithMaxRedirects(-1) accepted, want an error")
+	}
+}
+
+func TestRedirectDedup(t *testing.T) {
+	var offSite int64
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&offSite, 1)
+		w.Write([]byte(`<a href="/elsewhere">elsewhere</a>`))
+	}))
+	defer other.Close()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/a"></a><a href="/away"></a><a href="/d"></a>`))
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		case "/c":
+			w.Write([]byte(`<a href="/b"></a><a href="/c"></a>`))
+		case "/d":
+			w.Write([]byte(`<a href="/c"></a>`))
+		case "/away":
+			http.Redirect(w, r, other.URL+"/", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	// With one fetcher, /a is fetched before /d, so /d's link to /c is
+	// found once /c has been fetched by way of /a.
+	c := NewCrawler(1, WithIgnoreRobots(true))
+	got, err := c.Crawl(ts.URL)
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range got {
+		urls = append(urls, r.URL)
+	}
+	if want := []string{ts.URL + "/", ts.URL + "/a", ts.URL + "/away", ts.URL + "/d"}; !cmp.Equal(urls, want) {
+		t.Fatalf("Crawl() crawled %v, want %v", urls, want)
+	}
+	if r := got[1]; r.FinalURL != ts.URL+"/c" || r.Redirects != 2 || !cmp.Equal(r.RedirectChain, []string{ts.URL + "/a", ts.URL + "/b"}) || r.Err != nil {
+		t.Errorf("result for /a = %+v, want it redirected through /b to /c", r)
+	}
+	if want := map[string]int{"/": 1, "/a": 1, "/b": 1, "/c": 1, "/d": 1, "/away": 1}; !cmp.Equal(requests, want) {
+		t.Errorf("requests = %v, want %v, each page fetched once", requests, want)
+	}
+
+	// The redirect off the site isn't followed, but recorded.
+	if r := got[2]; r.StatusCode != http.StatusFound || r.Location != other.URL+"/" || r.Err != nil || r.FinalURL != "" {
+		t.Errorf("result for /away = %+v, want an unfollowed 302 to the other site", r)
+	}
+	if n := atomic.LoadInt64(&offSite); n != 0 {
+		t.Errorf("the other site got %d requests, want none", n)
+	}
+}
+
+func TestNoFollowRedirects(t *testing.T) {
+	site := crawltest.NewFake()
+	redirect := func(from, to string) {
+		site.Handle(from, crawltest.Response{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {to}}})
+	}
+	site.Page("https://monzo.com", "/a", "/away")
+	redirect("https://monzo.com/a", "/b")
+	site.Page("https://monzo.com/b")
+	redirect("https://monzo.com/away", "https://example.com/")
+
+	c := NewCrawler(1, WithFollowRedirects(false), WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range got {
+		urls = append(urls, r.URL)
+	}
+	// The redirect to /b is crawled as a link, and that off the site isn't.
+	if want := []string{"https://monzo.com/", "https://monzo.com/a", "https://monzo.com/away", "https://monzo.com/b"}; !cmp.Equal(urls, want) {
+		t.Fatalf("Crawl() crawled %v, want %v", urls, want)
+	}
+	if r := got[1]; r.StatusCode != 301 || r.Location != "/b" || r.Err != nil || r.Redirects != 0 || r.FinalURL != "" {
+		t.Errorf("result for /a = %+v, want an unfollowed 301 to /b", r)
+	}
+	if r := got[2]; r.StatusCode != 301 || r.Location != "https://example.com/" || r.OutboundExternal != 1 {
+		t.Errorf("result for /away = %+v, want an unfollowed 301 to example.com, counted as an external link", r)
+	}
+	if s := c.Stats(); s.Redirects != 0 || s.Errors != 0 {
+		t.Errorf("Stats() = %d redirects, %d errors, want none", s.Redirects, s.Errors)
+	}
+	if !c.Config().NoFollowRedirects {
+		t.Error("Config().NoFollowRedirects = false, want true")
+	}
+}
+
+func TestScrapeFallback(t *testing.T) {
+	cases := []struct {
+		file string
+		// want are the links the parser finds, and wantFallback those
+		// found by scanning the raw markup.
+		want, wantFallback []string
+	}{
+		{"truncated.html", []string{"/foo", "/bar?a=1&b=2", "/baz"}, []string{"/foo", "/bar?a=1&b=2", "/baz"}},
+		{"garbage.html", []string{"/foo", "/bar"}, []string{"/foo", "/commented", "/bar"}},
+	}
+
+	for _, c := range cases {
+		body, err := ioutil.ReadFile(filepath.Join("testdata", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := scrape(body, nil, nil, 0)
+		if err != nil || got.fallback {
+			t.Errorf("scrape(%s) = fallback %v, %v, want parsed", c.file, got.fallback, err)
+		}
+		if diff := cmp.Diff(c.want, got.links); diff != "" {
+			t.Errorf("scrape(%s) mismatch (-want +got):\n%s", c.file, diff)
+		}
+
+		parseHTML = func(io.Reader) (*html.Node, error) { return nil, errors.New("rejected") }
+		got, err = scrape(body, nil, nil, 0)
+		parseHTML = html.Parse
+		if err != nil || !got.fallback {
+			t.Errorf("scrape(%s) with failing parser = fallback %v, %v, want fallback", c.file, got.fallback, err)
+		}
+		if diff := cmp.Diff(c.wantFallback, got.links); diff != "" {
+			t.Errorf("scrape(%s) with failing parser mismatch (-want +got):\n%s", c.file, diff)
+		}
+	}
+
+	// With no links to fall back on, the parser's error stands.
+	parseHTML = func(io.Reader) (*html.Node, error) { return nil, errors.New("rejected") }
+	defer func() { parseHTML = html.Parse }()
+	if _, err := scrape([]byte("\x00\x01\x02"), nil, nil, 0); err == nil {
+		t.Errorf("scrape(garbage) with failing parser succeeded, want an error")
+	}
+}
+
+func TestMaxLinksPerPage(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/tags/1", "/tags/2", "/tags/3", "/tags/4")
+	site.Page("https://monzo.com/tags/1")
+
+	c := NewCrawler(1, WithMaxLinksPerPage(2), WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Crawl() = %+v, want the starting URL and its first 2 links", got)
+	}
+	if diff := cmp.Diff([]string{"/tags/1", "/tags/2"}, got[0].Links); diff != "" {
+		t.Errorf("Links mismatch (-want +got):\n%s", diff)
+	}
+	if !got[0].LinksTruncated || got[1].LinksTruncated {
+		t.Errorf("LinksTruncated = %v, %v, want true for the starting URL only", got[0].LinksTruncated, got[1].LinksTruncated)
+	}
+	if diff := cmp.Diff([]string{"https://monzo.com/"}, LinkOverflow(got)); diff != "" {
+		t.Errorf("LinkOverflow() mismatch (-want +got):\n%s", diff)
+	}
+	if n := site.Calls("https://monzo.com/tags/3"); n != 0 {
+		t.Errorf("/tags/3 fetched %d times, want 0", n)
+	}
+}
+
+func TestCrawlContext(t *testing.T) {
+	site := map[string][]string{"https://monzo.com/": nil}
+	for i := 0; i < 20; i++ {
+		u := fmt.Sprintf("https://monzo.com/%d", i)
+		site["https://monzo.com/"] = append(site["https://monzo.com/"], u)
+		site[u] = nil
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fetches int32
+	c := NewCrawler(5)
+	c.fetch = func(ctx context.Context, addr string) (Result, error) {
+		// Cancel on the fourth fetch, and hold up any fetches after it
+		// until their requests would be aborted.
+		if n := atomic.AddInt32(&fetches, 1); n >= 4 {
+			cancel()
+			<-ctx.Done()
+			return Result{}, ctx.Err()
+		}
+		return fetchSite(site)(ctx, addr)
+	}
+	results, err := c.CrawlContext(ctx, "https://monzo.com/")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CrawlContext() err = %v, want context.Canceled", err)
+	}
+	// The fetches in flight with the fourth may finish either side of the
+	// cancellation, but the first is over before any others start.
+	if len(results) < 1 || len(results) > 3 {
+		t.Errorf("CrawlContext() returned %d results, want 1 to 3 fetched before cancelling", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("result for %s erred: %v, want only completed fetches", r.URL, r.Err)
+		}
+	}
+
+	// The fetchers all exit.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines running after CrawlContext returned, want %d", n, before)
+	}
+}
+
+func TestCrawlStream(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/a", "/b")
+	site.Page("https://monzo.com/a", "/c")
+	site.Page("https://monzo.com/b")
+	site.Page("https://monzo.com/c")
+
+	c := NewCrawler(2, WithIgnoreRobots(true), WithTransportMiddleware(site.Wrap))
+	stream, err := c.CrawlStream("https://monzo.com/")
+	if err != nil {
+		t.Fatalf("CrawlStream erred when not expected: %v", err)
+	}
+	var got []string
+	for r := range stream {
+		got = append(got, r.URL)
+		// Each page is streamed once fetched, so /c is found after /a.
+		if r.URL == "https://monzo.com/c" && !contains(got, "https://monzo.com/a") {
+			t.Errorf("/c streamed before /a, which links to it")
+		}
+	}
+	sort.Strings(got)
+	want := []string{"https://monzo.com/", "https://monzo.com/a", "https://monzo.com/b", "https://monzo.com/c"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CrawlStream() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The channel is closed even if the crawl can't start.
+	stream, err = c.CrawlStream("://monzo.com")
+	if err == nil {
+		t.Errorf("CrawlStream with an invalid URL didn't err")
+	}
+	if _, ok := <-stream; ok {
+		t.Errorf("CrawlStream with an invalid URL sent a result")
+	}
+
+	// Or is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream, err = c.CrawlStreamContext(ctx, "https://monzo.com/")
+	if err != nil {
+		t.Fatalf("CrawlStreamContext erred when not expected: %v", err)
+	}
+	for r := range stream {
+		t.Errorf("cancelled CrawlStreamContext sent %s", r.URL)
+	}
+
+	// A consumer may cancel and stop reading, without the crawl being left
+	// blocked on sending it the next result.
+	finished := make(chan struct{})
+	c = NewCrawler(1, WithIgnoreRobots(true), WithTransportMiddleware(site.Wrap), WithProgress(time.Hour, func(Stats) {
+		// Only called when the crawl finishes, given the long interval.
+		close(finished)
+	}))
+	ctx, cancel = context.WithCancel(context.Background())
+	stream, err = c.CrawlStreamContext(ctx, "https://monzo.com/")
+	if err != nil {
+		t.Fatalf("CrawlStreamContext erred when not expected: %v", err)
+	}
+	<-stream
+	// Wait for the next page to be fetched, and so on its way to the
+	// stream, before cancelling.
+	for c.Stats().Fetched < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("crawl still running 5s after its consumer cancelled and stopped reading")
+	}
+	for range stream {
+	}
+}
+
+func TestConcurrentCrawls(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":   {"/a", "/b"},
+		"https://monzo.com/a": {"/c"},
+		"https://monzo.com/b": {},
+		"https://monzo.com/c": {},
+	}
+	c := NewCrawler(2)
+	fetch := fetchSite(site)
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	c.fetch = func(ctx context.Context, addr string) (Result, error) {
+		if addr == "https://monzo.com/" {
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+		}
+		return fetch(ctx, addr)
+	}
+
+	stream, err := c.CrawlStream("https://monzo.com")
+	if err != nil {
+		t.Fatalf("CrawlStream erred when not expected: %v", err)
+	}
+	<-started
+	// The crawler's state is shared by its crawls, so others can't start
+	// until this one is over.
+	if _, err := c.Crawl("https://monzo.com"); !errors.Is(err, ErrCrawlerBusy) {
+		t.Errorf("Crawl during another crawl err = %v, want ErrCrawlerBusy", err)
+	}
+	if s, err := c.CrawlStream("https://monzo.com"); !errors.Is(err, ErrCrawlerBusy) {
+		t.Errorf("CrawlStream during another crawl err = %v, want ErrCrawlerBusy", err)
+	} else if _, ok := <-s; ok {
+		t.Errorf("CrawlStream during another crawl sent a result")
+	}
+	if _, err := c.CheckPages(context.Background(), []string{"https://monzo.com/a"}); !errors.Is(err, ErrCrawlerBusy) {
+		t.Errorf("CheckPages during a crawl err = %v, want ErrCrawlerBusy", err)
+	}
+	// Another crawler can crawl at the same time.
+	other := NewCrawler(2)
+	other.fetch = fetch
+	if got, err := other.Crawl("https://monzo.com"); err != nil || len(got) != 4 {
+		t.Errorf("Crawl by another crawler = %d results, %v, want 4, nil", len(got), err)
+	}
+
+	close(release)
+	var got []string
+	for r := range stream {
+		got = append(got, r.URL)
+	}
+	if len(got) != 4 {
+		t.Errorf("CrawlStream during other crawls got %v, want the 4 pages of the site", got)
+	}
+	// Once it is over, the crawler can crawl again.
+	if got, err := c.Crawl("https://monzo.com"); err != nil || len(got) != 4 {
+		t.Errorf("Crawl after another crawl = %d results, %v, want 4, nil", len(got), err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMaxDepth(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com/":  {"/1", "/1b"},
+		"https://monzo.com/1": {"/2", "/1b"},
+		"https://monzo.com/2": {"/3"},
+		"https://monzo.com/3": {},
+	}
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"https://monzo.com/"}},
+		{1, []string{"https://monzo.com/", "https://monzo.com/1", "https://monzo.com/1b"}},
+		{2, []string{"https://monzo.com/", "https://monzo.com/1", "https://monzo.com/1b", "https://monzo.com/2"}},
+	}
+	for _, tt := range tests {
+		got := crawledURLs(t, site, "https://monzo.com/", WithMaxDepth(tt.depth))
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("Crawl() with max depth %d mismatch (-want +got):\n%s", tt.depth, diff)
+		}
+	}
+}
+
+func TestMaxPages(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com/":  {"/1", "/2", "/3"},
+		"https://monzo.com/1": {"/4"},
+		"https://monzo.com/2": {},
+		"https://monzo.com/3": {},
+		"https://monzo.com/4": {},
+	}
+	for _, max := range []int{1, 3, 5} {
+		c := NewCrawler(2, WithMaxPages(max))
+		c.fetch = fetchSite(site)
+		results, err := c.Crawl("https://monzo.com/")
+		if err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		if len(results) != max {
+			t.Errorf("Crawl() with max pages %d returned %d results", max, len(results))
+		}
+		s := c.Stats()
+		if s.Fetched != int64(max) || s.Truncated != (max < len(site)) {
+			t.Errorf("Stats() with max pages %d: Fetched, Truncated = %d, %v, want %d, %v", max, s.Fetched, s.Truncated, max, max < len(site))
+		}
+	}
+}
+
+func TestSeedRedirectScope(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("http://monzo.com", crawltest.Response{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"https://www.monzo.com/"}}})
+	site.Page("https://www.monzo.com/", "/a", "http://monzo.com/b")
+	site.Page("https://www.monzo.com/a")
+
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("http://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var crawled []string
+	for _, r := range got {
+		crawled = append(crawled, r.URL)
+	}
+	want := []string{"http://monzo.com/", "https://www.monzo.com/a"}
+	if diff := cmp.Diff(want, crawled); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	if got[0].FinalURL != "https://www.monzo.com/" {
+		t.Errorf("FinalURL = %q, want https://www.monzo.com/", got[0].FinalURL)
+	}
+	if root := c.Stats().Root; root != "https://www.monzo.com/" {
+		t.Errorf("Stats().Root = %q, want https://www.monzo.com/", root)
+	}
+
+	// With a literal scope, nothing on the new site is crawled.
+	c = NewCrawler(1, WithLiteralScope(true), WithTransportMiddleware(site.Wrap))
+	got, err = c.Crawl("http://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 2 || got[1].URL != "http://monzo.com/b" {
+		t.Errorf("Crawl() with literal scope = %+v, want the seed and /b", got)
+	}
+}
+
+func TestScrapeBase(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{"none", `<a href="/foo">foo</a>`, ""},
+		{"absolute", `<head><base href="https://monzo.com/sub/"></head><a href="foo">foo</a>`, "https://monzo.com/sub/"},
+		{"relative", `<head><base href=" /sub/ "></head>`, "/sub/"},
+		{"first only", `<head><base target="_blank"><base href="/first/"><base href="/second/"></head>`, "/first/"},
+	}
+	for _, tc := range cases {
+		s, err := scrape([]byte(tc.body), nil, nil, 0)
+		if err != nil {
+			t.Fatalf("%s: scrape erred when not expected: %v", tc.name, err)
+		}
+		if s.base != tc.want {
+			t.Errorf("%s: scrape() base = %q, want %q", tc.name, s.base, tc.want)
+		}
+	}
+}
+
+func TestBase(t *testing.T) {
+	site := crawltest.NewFake()
+	// Links to /a/page itself aren't counted, but those to its base are.
+	site.Handle("https://monzo.com/a/page", crawltest.Response{Body: `<head><base href="/b/"></head><a href="c">c</a><a href="/a/page">self</a><a href="/b/">base</a><a href="http://exa mple.com/">invalid</a>`})
+	site.Handle("https://monzo.com/x/page", crawltest.Response{Body: `<head><base href="https://monzo.com/y/"></head><a href="z">z</a>`})
+	site.Page("https://monzo.com", "/a/page", "/x/page")
+	site.Page("https://monzo.com/b/")
+	site.Page("https://monzo.com/b/c")
+	site.Page("https://monzo.com/y/z")
+
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var crawled []string
+	for _, r := range got {
+		crawled = append(crawled, r.URL)
+	}
+	want := []string{"https://monzo.com/", "https://monzo.com/a/page", "https://monzo.com/b/", "https://monzo.com/b/c", "https://monzo.com/x/page", "https://monzo.com/y/z"}
+	if diff := cmp.Diff(want, crawled); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	if r := got[1]; r.Base != "https://monzo.com/b/" || r.Inbound != 1 || r.OutboundInternal != 2 || !cmp.Equal(r.Referrers, []string{"https://monzo.com/"}) {
+		t.Errorf("result for /a/page = %+v, want base /b/, two links out and one in, from /", r)
+	}
+	// Invalid links are attributed to the page they are on, not its base.
+	if invalid := InvalidLinks(got); len(invalid) != 1 || invalid[0].Page != "https://monzo.com/a/page" {
+		t.Errorf("InvalidLinks() = %+v, want one on /a/page", invalid)
+	}
+}
+
+func TestLinkSpill(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":   {"/a", "/b", "/c"},
+		"https://monzo.com/a": {"/b"},
+		"https://monzo.com/b": {},
+		"https://monzo.com/c": {},
+	}
+	var spilled []Result
+	c := NewCrawler(1, WithLinkSpill(2, func(r Result) {
+		spilled = append(spilled, r)
+	}))
+	c.fetch = fetchSite(site)
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	// Every page is still crawled, as links are followed before spilling.
+	if len(got) != 4 {
+		t.Fatalf("Crawl() = %+v, want 4 results", got)
+	}
+	if len(spilled) != 1 || spilled[0].URL != "https://monzo.com/" || len(spilled[0].Links) != 3 {
+		t.Fatalf("spilled %+v, want the root with all 3 links", spilled)
+	}
+	if r := got[0]; !r.LinksSpilled || r.LinkCount != 3 || len(r.Links) != 2 || r.OutboundInternal != 3 {
+		t.Errorf("result for the root = %+v, want 2 of 3 links kept, and all 3 counted", r)
+	}
+	if spilled[0].OutboundInternal != 3 {
+		t.Errorf("spilled root OutboundInternal = %d, want 3", spilled[0].OutboundInternal)
+	}
+	// Pages only count links from a spilled page if they were kept.
+	if r := got[3]; r.URL != "https://monzo.com/c" || r.Inbound != 0 || len(r.Referrers) != 0 {
+		t.Errorf("result for /c = %+v, want no inbound links counted", r)
+	}
+	if r := got[2]; r.Inbound != 2 || len(r.Referrers) != 2 {
+		t.Errorf("result for /b = %+v, want 2 inbound links counted", r)
+	}
+	if r := got[1]; r.LinksSpilled || r.LinkCount != 0 {
+		t.Errorf("result for /a = %+v, want nothing spilled", r)
+	}
+
+	if err := NewCrawler(1, WithLinkSpill(-1, func(Result) {})).err; err == nil {
+		t.Errorf("WithLinkSpill(-1) accepted, want an error")
+	}
+}
+
+func TestMisdeclaredContentType(t *testing.T) {
+	served := func(ct, body string) crawltest.Response {
+		return crawltest.Response{Header: http.Header{"Content-Type": {ct}}, Body: body}
+	}
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/plain.html", "/notes.txt", "/image.png")
+	site.Handle("https://monzo.com/plain.html", served("text/plain; charset=utf-8", `<!DOCTYPE html><a href="/a">a</a>`))
+	site.Handle("https://monzo.com/notes.txt", served("text/plain", `see <a href="/b">b</a>`))
+	site.Handle("https://monzo.com/image.png", served("image/png", `<html><a href="/c">c</a>`))
+	site.Page("https://monzo.com/a")
+
+	crawl := func(opts ...Option) []Result {
+		t.Helper()
+		c := NewCrawler(1, append(opts, WithTransportMiddleware(site.Wrap))...)
+		got, err := c.Crawl("https://monzo.com")
+		if err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		return got
+	}
+
+	// Every page is scraped, but only HTML served as plain text is
+	// misdeclared.
+	got := crawl()
+	if len(got) != 7 {
+		t.Fatalf("Crawl() = %+v, want 7 results, including /a, /b and /c", got)
+	}
+	if diff := cmp.Diff([]string{"https://monzo.com/plain.html"}, MisdeclaredContentTypes(got)); diff != "" {
+		t.Errorf("MisdeclaredContentTypes() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Skipping what isn't HTML, only the pages served as HTML, or that
+	// sniff as HTML, are scraped.
+	got = crawl(WithSkipNonHTML(true))
+	if len(got) != 5 || len(MisdeclaredContentTypes(got)) != 1 {
+		t.Errorf("Crawl() with WithSkipNonHTML = %+v, want 5 results, including /a, one misdeclared", got)
+	}
+
+	// Strictly, only the pages served as HTML are scraped.
+	if got := crawl(WithStrictContentType(true)); len(got) != 4 || len(MisdeclaredContentTypes(got)) != 0 {
+		t.Errorf("Crawl() with WithStrictContentType = %+v, want 4 results, none misdeclared", got)
+	}
+}
+
+func TestResultStatusCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/forbidden">a</a><a href="/missing">b</a><a href="/broken">c</a>`))
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	results, err := NewCrawler(2, WithIgnoreRobots(true)).Crawl(ts.URL)
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	got := make(map[string]int)
+	for _, r := range results {
+		got[strings.TrimPrefix(r.URL, ts.URL)] = r.StatusCode
+		var httpErr *HTTPError
+		if r.StatusCode != http.StatusOK && (!errors.As(r.Err, &httpErr) || httpErr.StatusCode != r.StatusCode) {
+			t.Errorf("%s Err = %v, want an HTTPError with status %d", r.URL, r.Err, r.StatusCode)
+		}
+	}
+	want := map[string]int{"/": 200, "/forbidden": 403, "/missing": 404, "/broken": 500}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("status codes mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without a response, there's no status.
+	ts.Close()
+	results, _ = NewCrawler(1, WithIgnoreRobots(true)).Crawl(ts.URL)
+	if len(results) != 1 || results[0].StatusCode != 0 || results[0].Err == nil {
+		t.Errorf("Crawl() of a closed server = %+v, want one failed result without a status", results)
+	}
+}
+
+func TestProgressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.json")
+	read := func() Checkpoint {
+		t.Helper()
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading checkpoint: %v", err)
+		}
+		var cp Checkpoint
+		if err := json.Unmarshal(b, &cp); err != nil {
+			t.Fatalf("unmarshalling checkpoint %q: %v", b, err)
+		}
+		return cp
+	}
+
+	start := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	clk := crawltest.NewClock(start)
+	site := crawltest.NewFake()
+	site.Clock = clk
+	site.Page("https://monzo.com", "/slow")
+	site.Handle("https://monzo.com/slow", crawltest.Response{Latency: 3 * time.Second})
+
+	c := NewCrawler(1, WithClock(clk), WithTransportMiddleware(site.Wrap), WithProgressFile(path, time.Second))
+	done := make(chan error)
+	go func() {
+		_, err := c.Crawl("https://monzo.com")
+		done <- err
+	}()
+	// Wait for /slow to be in flight, and the checkpoint timer to be set,
+	// then for it to be set again once the first checkpoint is written.
+	clk.WaitForTimers(2)
+	clk.Advance(time.Second)
+	clk.WaitForTimers(2)
+	// Queued and InFlight are updated by the crawl between pages, so may
+	// lag behind the fetch of /slow.
+	got := read()
+	got.Queued, got.InFlight = 0, 0
+	want := Checkpoint{Time: start.Add(time.Second), Root: "https://monzo.com/", Fetched: 1, Rate: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("first checkpoint mismatch (-want +got):\n%s", diff)
+	}
+
+	clk.Advance(2 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	got = read()
+	if !got.Done || got.Fetched != 2 || got.InFlight != 0 || !got.Time.Equal(start.Add(3*time.Second)) {
+		t.Errorf("last checkpoint = %+v, want 2 pages fetched, done at 3s", got)
+	}
+	// It is readable by others, e.g. a monitoring agent.
+	if fi, err := os.Stat(path); err != nil {
+		t.Errorf("checkpoint file: %v", err)
+	} else if fi.Mode().Perm() != 0644 {
+		t.Errorf("checkpoint file mode = %v, want -rw-r--r--", fi.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files left in the checkpoint's directory, want just the checkpoint", len(files))
+	}
+
+	if err := NewCrawler(1, WithProgressFile(path, 0)).err; err == nil {
+		t.Errorf("WithProgressFile with no interval accepted, want an error")
+	}
+}
@@ -0,0 +1,182 @@
+// Package crawltest provides utilities for testing crawl configurations.
+package crawltest
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault is a kind of failure Chaos can inject into a request.
+type Fault int
+
+const (
+	// Timeout fails the request with a network timeout error.
+	Timeout Fault = iota + 1
+	// ServerError responds with a 500, without calling the server.
+	ServerError
+	// Reset fails the request with a connection reset error.
+	Reset
+)
+
+func (f Fault) String() string {
+	switch f {
+	case Timeout:
+		return "timeout"
+	case ServerError:
+		return "server error"
+	case Reset:
+		return "reset"
+	}
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// Profile describes how badly requests misbehave.
+type Profile struct {
+	// Latency is added to requests, with probability LatencyRate.
+	Latency     time.Duration
+	LatencyRate float64
+	// ErrorRate is the probability of a request failing, with one of
+	// Faults chosen at random. With no Faults, ServerError is used.
+	ErrorRate float64
+	Faults    []Fault
+}
+
+// Phase is a Profile applied to a number of consecutive requests to a host.
+type Phase struct {
+	Profile
+	// Requests is the number of requests the phase lasts for. The last
+	// phase of a schedule lasts indefinitely.
+	Requests int
+}
+
+// Chaos injects latency and failures into requests, as a transport
+// middleware for crawl.WithTransportMiddleware, e.g.
+//
+//	chaos := &crawltest.Chaos{Seed: 1, Default: crawltest.Profile{ErrorRate: 0.1}}
+//	c := crawl.NewCrawler(10, crawl.WithTransportMiddleware(chaos.Wrap))
+//
+// Its fields must not be changed once it is in use.
+//
+// Whether a request misbehaves is decided by a random source seeded from
+// Seed, the request's URL and the number of times that URL has been
+// requested, so a crawl makes the same decisions for each URL however its
+// requests are ordered. Host schedules count requests to the host, and so
+// do depend on ordering when crawling with multiple fetchers.
+type Chaos struct {
+	Seed int64
+	// Default applies to hosts without a schedule.
+	Default Profile
+	// Hosts are degradation schedules for particular hosts, as a sequence
+	// of phases.
+	Hosts map[string][]Phase
+	// Clock times injected latency, or the real clock if nil.
+	Clock *Clock
+
+	mu       sync.Mutex
+	urlReqs  map[string]int
+	hostReqs map[string]int
+}
+
+// Wrap returns a transport that injects chaos into requests made with next.
+func (ch *Chaos) Wrap(next http.RoundTripper) http.RoundTripper {
+	return chaosTransport{ch, next}
+}
+
+// profile returns the profile for the next request to the URL, and a random
+// source for it.
+func (ch *Chaos) profile(req *http.Request) (Profile, *rand.Rand) {
+	u, host := req.URL.String(), strings.ToLower(req.URL.Host)
+
+	ch.mu.Lock()
+	if ch.urlReqs == nil {
+		ch.urlReqs = make(map[string]int)
+		ch.hostReqs = make(map[string]int)
+	}
+	attempt := ch.urlReqs[u]
+	ch.urlReqs[u]++
+	n := ch.hostReqs[host]
+	ch.hostReqs[host]++
+	ch.mu.Unlock()
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s#%d", u, attempt)
+	rnd := rand.New(rand.NewSource(ch.Seed ^ int64(h.Sum64())))
+
+	phases, ok := ch.Hosts[host]
+	if !ok || len(phases) == 0 {
+		return ch.Default, rnd
+	}
+	for _, p := range phases[:len(phases)-1] {
+		if n < p.Requests {
+			return p.Profile, rnd
+		}
+		n -= p.Requests
+	}
+	return phases[len(phases)-1].Profile, rnd
+}
+
+type chaosTransport struct {
+	chaos *Chaos
+	next  http.RoundTripper
+}
+
+func (t chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, rnd := t.chaos.profile(req)
+
+	// Always draw both values, so a change to one rate doesn't change the
+	// decisions made about the other.
+	delay, fail := rnd.Float64() < p.LatencyRate, rnd.Float64() < p.ErrorRate
+	if delay && p.Latency > 0 {
+		fire, stop := newTimer(t.chaos.Clock, p.Latency)
+		select {
+		case <-fire:
+		case <-req.Context().Done():
+			stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if !fail {
+		return t.next.RoundTrip(req)
+	}
+
+	fault := ServerError
+	if len(p.Faults) > 0 {
+		fault = p.Faults[rnd.Intn(len(p.Faults))]
+	}
+	switch fault {
+	case Timeout:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+	case Reset:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	default:
+		body := "crawltest: injected server error"
+		return &http.Response{
+			Status:        "500 Internal Server Error",
+			StatusCode:    http.StatusInternalServerError,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+// timeoutError is an injected network timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "crawltest: injected timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
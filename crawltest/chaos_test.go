@@ -0,0 +1,139 @@
+package crawltest_test
+
+import (
+	"context"
+	"crawl"
+	"crawl/crawltest"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newSite serves a root page linking to n leaf pages.
+func newSite(n int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			return
+		}
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+		}
+	}))
+}
+
+// failures returns the URLs of the failed results of a crawl.
+func failures(t *testing.T, c crawl.Crawler, seed string) []string {
+	t.Helper()
+	results, err := c.Crawl(seed)
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, strings.TrimPrefix(r.URL, seed))
+		}
+	}
+	return failed
+}
+
+func TestChaosDeterministic(t *testing.T) {
+	ts := newSite(50)
+	defer ts.Close()
+
+	crawlWith := func(seed int64) []string {
+		chaos := &crawltest.Chaos{
+			Seed: seed,
+			Default: crawltest.Profile{
+				ErrorRate: 0.3,
+				Faults:    []crawltest.Fault{crawltest.Timeout, crawltest.ServerError, crawltest.Reset},
+			},
+		}
+		// Faults injected into robots.txt would stop the crawl.
+		c := crawl.NewCrawler(5, crawl.WithIgnoreRobots(true), crawl.WithTransportMiddleware(chaos.Wrap))
+		return failures(t, c, ts.URL)
+	}
+
+	first := crawlWith(1)
+	if len(first) == 0 || len(first) == 51 {
+		t.Fatalf("crawl with 30%% error rate failed %d of 51 pages", len(first))
+	}
+	if diff := cmp.Diff(first, crawlWith(1)); diff != "" {
+		t.Errorf("crawls with the same seed failed different pages (-first +second):\n%s", diff)
+	}
+}
+
+func TestChaosFaults(t *testing.T) {
+	ts := newSite(0)
+	defer ts.Close()
+
+	cases := []struct {
+		fault crawltest.Fault
+		check func(*crawl.Page, error) bool
+	}{
+		{crawltest.Timeout, func(_ *crawl.Page, err error) bool {
+			var ne net.Error
+			return errors.As(err, &ne) && ne.Timeout()
+		}},
+		{crawltest.Reset, func(_ *crawl.Page, err error) bool {
+			return errors.Is(err, syscall.ECONNRESET)
+		}},
+		{crawltest.ServerError, func(p *crawl.Page, err error) bool {
+			return err != nil && p != nil && p.StatusCode == http.StatusInternalServerError
+		}},
+	}
+	for _, tc := range cases {
+		chaos := &crawltest.Chaos{Default: crawltest.Profile{ErrorRate: 1, Faults: []crawltest.Fault{tc.fault}}}
+		p, err := crawl.Fetch(context.Background(), ts.URL, crawl.WithTransportMiddleware(chaos.Wrap))
+		if !tc.check(p, err) {
+			t.Errorf("Fetch with injected %s = %+v, %v, want %s", tc.fault, p, err, tc.fault)
+		}
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	ts := newSite(0)
+	defer ts.Close()
+
+	chaos := &crawltest.Chaos{Default: crawltest.Profile{Latency: time.Second, LatencyRate: 1}}
+	_, err := crawl.Fetch(context.Background(), ts.URL,
+		crawl.WithTransportMiddleware(chaos.Wrap),
+		crawl.WithTimeoutOverride(regexp.MustCompile(`.`), 10*time.Millisecond),
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch with injected latency beyond its timeout = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestChaosHostSchedule(t *testing.T) {
+	ts := newSite(5)
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	chaos := &crawltest.Chaos{Hosts: map[string][]crawltest.Phase{
+		host: {
+			{Requests: 3},
+			{Requests: 2, Profile: crawltest.Profile{ErrorRate: 1}},
+			{},
+		},
+	}}
+	// With one fetcher, pages are requested in the order they are linked,
+	// and without robots.txt, nothing else is requested.
+	c := crawl.NewCrawler(1, crawl.WithIgnoreRobots(true), crawl.WithTransportMiddleware(chaos.Wrap))
+	got := failures(t, c, ts.URL)
+	if diff := cmp.Diff([]string{"/2", "/3"}, got); diff != "" {
+		t.Errorf("failed pages mismatch (-want +got):\n%s", diff)
+	}
+	if s := c.Stats(); s.Errors != 2 {
+		t.Errorf("Stats().Errors = %d, want 2", s.Errors)
+	}
+}
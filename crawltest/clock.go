@@ -0,0 +1,132 @@
+package crawltest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock for crawl.WithClock, and for the latency of Chaos and
+// Fake. Its time only moves when advanced, so tests of time-dependent
+// behaviour run in no time at all.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewClock returns a Clock set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a channel that receives the time once the clock has been
+// advanced by d, and a func that stops the timer.
+func (c *Clock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+	c.timers = append(c.timers, t)
+	c.notify()
+	stop := func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, tt := range c.timers {
+			if tt == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				c.notify()
+				return true
+			}
+		}
+		return false
+	}
+	return t.c, stop
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch, _ := c.NewTimer(d)
+	return ch
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward by d, firing any timers that become due,
+// in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+	fired := 0
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			break
+		}
+		t.c <- t.at
+		fired++
+	}
+	c.timers = c.timers[fired:]
+	if fired > 0 {
+		c.notify()
+	}
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least n timers are waiting to fire, so a
+// test can advance the clock once the code under test has started waiting
+// on it.
+func (c *Clock) WaitForTimers(n int) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) >= n {
+			c.mu.Unlock()
+			return
+		}
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+	}
+}
+
+// notify wakes anything waiting for the timers to change. c.mu must be held.
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// newTimer returns a timer on clk, or on the real clock if clk is nil.
+func newTimer(clk *Clock, d time.Duration) (<-chan time.Time, func() bool) {
+	if clk == nil {
+		t := time.NewTimer(d)
+		return t.C, t.Stop
+	}
+	return clk.NewTimer(d)
+}
@@ -0,0 +1,57 @@
+package crawltest_test
+
+import (
+	"crawl"
+	"crawl/crawltest"
+	"testing"
+	"time"
+)
+
+var _ crawl.Clock = (*crawltest.Clock)(nil)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	clk := crawltest.NewClock(start)
+
+	late := clk.After(2 * time.Second)
+	early := clk.After(time.Second)
+	stopped, stop := clk.NewTimer(time.Second)
+	if !stop() {
+		t.Errorf("stopping a pending timer returned false")
+	}
+	if n := clk.Timers(); n != 2 {
+		t.Errorf("Timers() = %d, want 2", n)
+	}
+
+	clk.Advance(1500 * time.Millisecond)
+	select {
+	case at := <-early:
+		if want := start.Add(time.Second); !at.Equal(want) {
+			t.Errorf("timer fired at %v, want %v", at, want)
+		}
+	default:
+		t.Errorf("timer due didn't fire")
+	}
+	select {
+	case <-late:
+		t.Errorf("timer not yet due fired")
+	case <-stopped:
+		t.Errorf("stopped timer fired")
+	default:
+	}
+
+	clk.Advance(time.Second)
+	if _, ok := <-late; !ok || !clk.Now().Equal(start.Add(2500*time.Millisecond)) {
+		t.Errorf("Now() = %v, want %v", clk.Now(), start.Add(2500*time.Millisecond))
+	}
+
+	// Sleepers can be woken once they are waiting.
+	done := make(chan struct{})
+	go func() {
+		clk.Sleep(time.Minute)
+		close(done)
+	}()
+	clk.WaitForTimers(1)
+	clk.Advance(time.Minute)
+	<-done
+}
@@ -0,0 +1,157 @@
+package crawltest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a scripted response to a request to a Fake.
+type Response struct {
+	// Status defaults to 200.
+	Status int
+	// Header defaults to a Content-Type of text/html.
+	Header http.Header
+	Body   string
+	// Latency delays the response.
+	Latency time.Duration
+	// Err, if set, fails the request instead of responding.
+	Err error
+}
+
+// Fake is an in-memory web site, serving scripted responses to a crawler
+// as a transport middleware for crawl.WithTransportMiddleware, e.g.
+//
+//	site := crawltest.NewFake()
+//	site.Page("https://example.com/", "/foo")
+//	c := crawl.NewCrawler(1, crawl.WithTransportMiddleware(site.Wrap))
+//
+// URLs without responses are 404s. Responses may be added while crawling.
+// A URL without a path, such as https://example.com, is the same as with
+// the root path, as the crawler requests it.
+type Fake struct {
+	// Clock times scripted latency, or the real clock if nil.
+	Clock *Clock
+
+	mu        sync.Mutex
+	responses map[string][]Response
+	calls     map[string]int
+	requests  []string
+}
+
+// NewFake returns a Fake with no pages.
+func NewFake() *Fake {
+	return &Fake{
+		responses: make(map[string][]Response),
+		calls:     make(map[string]int),
+	}
+}
+
+// Handle scripts the responses to requests for a URL: the first request gets
+// the first response, the second the second, and so on, with the last
+// response repeated for any further requests.
+func (f *Fake) Handle(url string, responses ...Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[key(url)] = responses
+}
+
+// Page scripts an HTML page at url linking to each of links.
+func (f *Fake) Page(url string, links ...string) {
+	var body strings.Builder
+	for _, l := range links {
+		fmt.Fprintf(&body, "<a href=\"%s\">%s</a>\n", l, l)
+	}
+	f.Handle(url, Response{Body: body.String()})
+}
+
+// Calls returns the number of requests made for url.
+func (f *Fake) Calls(url string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[key(url)]
+}
+
+// key returns the form of a URL a Fake keys its responses and calls by: as
+// given, or with the root path if it has none.
+func key(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" || u.Path != "" || u.Opaque != "" {
+		return rawurl
+	}
+	u.Path = "/"
+	return u.String()
+}
+
+// Requests returns the URLs requested, in the order they were requested.
+func (f *Fake) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// Wrap returns the Fake, ignoring next, so no requests reach the network.
+func (f *Fake) Wrap(next http.RoundTripper) http.RoundTripper {
+	return f
+}
+
+// RoundTrip serves the scripted response to a request.
+func (f *Fake) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := key(req.URL.String())
+
+	f.mu.Lock()
+	attempt := f.calls[u]
+	f.calls[u]++
+	f.requests = append(f.requests, u)
+	responses, ok := f.responses[u]
+	f.mu.Unlock()
+
+	r := Response{Status: http.StatusNotFound, Body: "404 page not found"}
+	if ok && len(responses) > 0 {
+		if attempt >= len(responses) {
+			attempt = len(responses) - 1
+		}
+		r = responses[attempt]
+	}
+
+	if r.Latency > 0 {
+		fire, stop := newTimer(f.Clock, r.Latency)
+		select {
+		case <-fire:
+		case <-req.Context().Done():
+			stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if _, ok := header["Content-Type"]; !ok {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}, nil
+}
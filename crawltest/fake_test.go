@@ -0,0 +1,75 @@
+package crawltest_test
+
+import (
+	"context"
+	"crawl"
+	"crawl/crawltest"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFake(t *testing.T) {
+	reset := errors.New("connection reset")
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com/flaky",
+		crawltest.Response{Err: reset},
+		crawltest.Response{Status: http.StatusServiceUnavailable},
+		crawltest.Response{Header: http.Header{"X-Attempt": {"3"}}, Body: `<a href="/ok">ok</a>`},
+	)
+	site.Handle("https://monzo.com/old", crawltest.Response{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"/new"}}})
+	site.Page("https://monzo.com/new", "/foo")
+	site.Handle("https://monzo.com/slow", crawltest.Response{Latency: time.Second})
+
+	fetch := func(url string, opts ...crawl.Option) (*crawl.Page, error) {
+		return crawl.Fetch(context.Background(), url, append(opts, crawl.WithTransportMiddleware(site.Wrap))...)
+	}
+
+	// Scripted responses are served in order, with the last repeated.
+	if _, err := fetch("https://monzo.com/flaky"); !errors.Is(err, reset) {
+		t.Errorf("first fetch of /flaky = %v, want %v", err, reset)
+	}
+	if p, _ := fetch("https://monzo.com/flaky"); p == nil || p.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second fetch of /flaky = %+v, want 503", p)
+	}
+	for i := 0; i < 2; i++ {
+		p, err := fetch("https://monzo.com/flaky")
+		if err != nil || p.Header.Get("X-Attempt") != "3" {
+			t.Errorf("fetch %d of /flaky = %+v, %v, want the third response", i+3, p, err)
+		}
+	}
+	if n := site.Calls("https://monzo.com/flaky"); n != 4 {
+		t.Errorf("Calls(/flaky) = %d, want 4", n)
+	}
+
+	p, err := fetch("https://monzo.com/old")
+	if err != nil || p.FinalURL != "https://monzo.com/new" {
+		t.Errorf("fetch of /old = %+v, %v, want redirect to /new", p, err)
+	}
+	if links, _ := p.Links(); !cmp.Equal(links, []string{"/foo"}) {
+		t.Errorf("links of /new = %v, want [/foo]", links)
+	}
+
+	if p, _ := fetch("https://monzo.com/missing"); p == nil || p.StatusCode != http.StatusNotFound {
+		t.Errorf("fetch of /missing = %+v, want 404", p)
+	}
+
+	_, err = fetch("https://monzo.com/slow", crawl.WithTimeoutOverride(regexp.MustCompile(`/slow`), 10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("fetch of /slow = %v, want context.DeadlineExceeded", err)
+	}
+
+	want := []string{
+		"https://monzo.com/flaky", "https://monzo.com/flaky", "https://monzo.com/flaky", "https://monzo.com/flaky",
+		"https://monzo.com/old", "https://monzo.com/new",
+		"https://monzo.com/missing",
+		"https://monzo.com/slow",
+	}
+	if diff := cmp.Diff(want, site.Requests()); diff != "" {
+		t.Errorf("Requests() mismatch (-want +got):\n%s", diff)
+	}
+}
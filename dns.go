@@ -0,0 +1,159 @@
+package crawl
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+)
+
+// defaultPrefetchers is the number of DNS lookups WithDNSPrefetch makes
+// ahead of time at once.
+const defaultPrefetchers = 4
+
+// dnsEntry is a host's addresses, which are ready once resolved is closed.
+type dnsEntry struct {
+	resolved chan struct{}
+	addrs    []string
+	err      error
+	// prefetched is set if the lookup was made ahead of time.
+	prefetched bool
+}
+
+// dnsCache resolves hosts for the default client's dialer, caching their
+// addresses for the rest of the crawl, as Go's resolver doesn't. With
+// prefetching enabled, the Crawl loop looks up each new in-scope host as
+// soon as a link to it is found, so its first request, made later by a
+// fetcher, needn't wait for DNS.
+type dnsCache struct {
+	mu      sync.Mutex
+	enabled bool
+	entries map[string]*dnsEntry
+	// requested records the hosts requested so far, to spot their first
+	// request.
+	requested map[string]bool
+	// sem bounds the lookups made ahead of time; prefetches beyond it are
+	// skipped, and the host looked up when it is dialled instead.
+	sem        chan struct{}
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{
+		entries:    make(map[string]*dnsEntry),
+		requested:  make(map[string]bool),
+		sem:        make(chan struct{}, defaultPrefetchers),
+		lookupHost: net.DefaultResolver.LookupHost,
+	}
+}
+
+func (d *dnsCache) reset() {
+	d.mu.Lock()
+	d.entries = make(map[string]*dnsEntry)
+	d.requested = make(map[string]bool)
+	d.mu.Unlock()
+}
+
+// prefetch looks up host in the background, if it hasn't been already and
+// there is a spare prefetcher.
+func (d *dnsCache) prefetch(host string) {
+	if d == nil || !d.enabled || net.ParseIP(host) != nil {
+		return
+	}
+	host = strings.ToLower(host)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[host]; ok {
+		return
+	}
+	select {
+	case d.sem <- struct{}{}:
+	default:
+		return
+	}
+	e := &dnsEntry{resolved: make(chan struct{}), prefetched: true}
+	d.entries[host] = e
+	go func() {
+		defer func() { <-d.sem }()
+		e.addrs, e.err = d.lookupHost(context.Background(), host)
+		close(e.resolved)
+	}()
+}
+
+// lookup returns the addresses of host, waiting for any lookup in progress,
+// or making one.
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(host)
+	d.mu.Lock()
+	e, ok := d.entries[host]
+	if !ok || e.isFailed() {
+		e = &dnsEntry{resolved: make(chan struct{})}
+		d.entries[host] = e
+		ok = false
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		e.addrs, e.err = d.lookupHost(ctx, host)
+		close(e.resolved)
+	}
+	select {
+	case <-e.resolved:
+		return e.addrs, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// isFailed reports whether the lookup has finished with an error, so should
+// be retried rather than cached.
+func (e *dnsEntry) isFailed() bool {
+	select {
+	case <-e.resolved:
+		return e.err != nil
+	default:
+		return false
+	}
+}
+
+// firstRequest reports whether this is the first request to host in the
+// crawl, and if so, whether its addresses were prefetched.
+func (d *dnsCache) firstRequest(host string) (first, prefetched bool) {
+	if d == nil || !d.enabled {
+		return false, false
+	}
+	host = strings.ToLower(host)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.requested[host] {
+		return false, false
+	}
+	d.requested[host] = true
+	e, ok := d.entries[host]
+	return true, ok && e.prefetched
+}
+
+// dialer returns a dial function resolving hosts with the cache, and
+// dialling their addresses in turn with dial.
+func (d *dnsCache) dialer(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		for _, a := range addrs {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, net.JoinHostPort(a, port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,77 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDNSPrefetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<a href="http://other.test:%s/page">other</a>`, portOf(r.Host))
+		}
+	}))
+	defer ts.Close()
+	port := portOf(ts.Listener.Addr().String())
+
+	var mu sync.Mutex
+	lookups := make(map[string]int)
+	c := NewCrawler(1, WithDNSPrefetch(true), WithAllowedHosts("other.test:"+port))
+	c.dns.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		mu.Lock()
+		lookups[host]++
+		mu.Unlock()
+		return []string{"127.0.0.1"}, nil
+	}
+	got, err := c.Crawl("http://monzo.test:" + port + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	for _, r := range got {
+		if r.Err != nil {
+			t.Errorf("result for %s erred: %v", r.URL, r.Err)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("Crawl() = %+v, want 2 results", got)
+	}
+
+	// Each host is looked up once, for all its requests.
+	if diff := cmp.Diff(map[string]int{"monzo.test": 1, "other.test": 1}, lookups); diff != "" {
+		t.Errorf("lookups mismatch (-want +got):\n%s", diff)
+	}
+	s := c.Stats()
+	if s.NewHosts["cold"].Requests != 1 || s.NewHosts["prefetched"].Requests != 1 {
+		t.Errorf("Stats().NewHosts = %+v, want 1 cold and 1 prefetched", s.NewHosts)
+	}
+}
+
+func TestDNSCacheRetriesFailures(t *testing.T) {
+	d := newDNSCache()
+	calls := 0
+	d.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		calls++
+		if calls == 1 {
+			return nil, &net.DNSError{Err: "timeout", Name: host, IsTimeout: true}
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	if _, err := d.lookup(context.Background(), "monzo.test"); err == nil {
+		t.Fatalf("lookup() succeeded, want the first to fail")
+	}
+	if addrs, err := d.lookup(context.Background(), "monzo.test"); err != nil || len(addrs) != 1 {
+		t.Errorf("lookup() after a failure = %v, %v, want it retried", addrs, err)
+	}
+}
+
+func portOf(hostport string) string {
+	_, port, _ := net.SplitHostPort(hostport)
+	return port
+}
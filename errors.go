@@ -0,0 +1,67 @@
+package crawl
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+)
+
+// HTTPError is wrapped by the Err of results for pages whose response wasn't
+// a 200, so callers can tell e.g. a 404 from a failure to connect with
+// errors.As.
+type HTTPError struct {
+	StatusCode int
+	// Status is the response's status line, e.g. "404 Not Found".
+	Status string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("got bad HTTP reponse code (%d): %s", e.StatusCode, e.Status)
+}
+
+// NetworkError is wrapped by the Err of results for pages that couldn't be
+// fetched, or whose bodies couldn't be read, for want of a working
+// connection: DNS failures, refused connections, timeouts and the like.
+// The underlying error stays in the chain, so errors.Is still finds e.g.
+// context.DeadlineExceeded or ErrFileLimit.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string { return e.Err.Error() }
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// ScrapeError is wrapped by the Err of results for pages that were fetched,
+// but whose bodies couldn't be decoded, or parsed for links.
+type ScrapeError struct {
+	Err error
+}
+
+func (e *ScrapeError) Error() string { return e.Err.Error() }
+func (e *ScrapeError) Unwrap() error { return e.Err }
+
+// PanicError is wrapped by the Err of results for pages whose fetching or
+// scraping panicked, e.g. in a transport middleware. The panic is recovered,
+// so the rest of the crawl carries on, unless WithFailFastOnPanic is set.
+type PanicError struct {
+	// Value is the value the code panicked with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// bodyError classifies an error reading a response's body: as a
+// ScrapeError if the body was malformed, or a NetworkError if reading it
+// failed.
+func bodyError(err error) error {
+	var corrupt flate.CorruptInputError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.As(err, &corrupt) {
+		return &ScrapeError{err}
+	}
+	return &NetworkError{classifyNetError(err)}
+}
@@ -0,0 +1,128 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"crawl/crawltest"
+
+	"golang.org/x/net/html"
+)
+
+func TestErrorTypes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<p>No links here</p>`))
+		case "/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte("this body is not gzipped at all"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	refused := closed.URL + "/"
+	closed.Close()
+
+	c := NewCrawler(1, WithIgnoreRobots(true))
+	fetch := func(addr string) error {
+		_, err := c.fetchHTTP(context.Background(), addr)
+		return err
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{{"/missing", 404}, {"/broken", 500}} {
+		err := fetch(ts.URL + tc.path)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Errorf("fetching %s erred with %v, want an *HTTPError", tc.path, err)
+			continue
+		}
+		if want := fmt.Sprintf("%d %s", tc.status, http.StatusText(tc.status)); httpErr.StatusCode != tc.status || httpErr.Status != want {
+			t.Errorf("fetching %s erred with HTTPError %+v, want status %d", tc.path, httpErr, tc.status)
+		}
+	}
+
+	err := fetch(refused)
+	var netErr *NetworkError
+	if !errors.As(err, &netErr) {
+		t.Errorf("fetching from a closed server erred with %v, want a *NetworkError", err)
+	}
+
+	var scrapeErr *ScrapeError
+	if err := fetch(ts.URL + "/gzip"); !errors.As(err, &scrapeErr) {
+		t.Errorf("fetching a malformed gzip body erred with %v, want a *ScrapeError", err)
+	} else if errors.As(err, &netErr) {
+		t.Errorf("fetching a malformed gzip body erred with %v, want only a *ScrapeError", err)
+	}
+	parseHTML = func(io.Reader) (*html.Node, error) { return nil, errors.New("rejected") }
+	defer func() { parseHTML = html.Parse }()
+	if err := fetch(ts.URL + "/"); !errors.As(err, &scrapeErr) {
+		t.Errorf("fetching an unparseable page erred with %v, want a *ScrapeError", err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/broken", "/z")
+	site.Page("https://monzo.com/broken")
+	site.Page("https://monzo.com/z")
+	// A middleware stands in for any code that panics on a malformed page.
+	panicky := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/broken" {
+				panic("malformed page")
+			}
+			return next.RoundTrip(req)
+		})
+	}
+
+	// With one fetcher, the page after the panic is only fetched if the
+	// fetcher survived it.
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap), WithTransportMiddleware(panicky))
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(results) != 3 || results[2].URL != "https://monzo.com/z" || results[2].Err != nil {
+		t.Fatalf("Crawl = %+v, want 3 results, with /z fetched after the panic", results)
+	}
+	broken := results[1]
+	var pe *PanicError
+	if !errors.As(broken.Err, &pe) || pe.Value != "malformed page" || !strings.Contains(string(pe.Stack), "TestPanicRecovery") {
+		t.Errorf("Err for /broken = %v, want a *PanicError with the value and stack", broken.Err)
+	}
+	if len(broken.Warnings) != 1 || !strings.HasPrefix(broken.Warnings[0].Msg, "panic: malformed page\n") {
+		t.Errorf("Warnings for /broken = %v, want the panic with its stack", broken.Warnings)
+	}
+	if s := c.Stats(); s.Panics != 1 || s.Errors != 1 {
+		t.Errorf("Stats() Panics, Errors = %d, %d, want 1, 1", s.Panics, s.Errors)
+	}
+
+	// Failing fast, the panic isn't recovered.
+	c = NewCrawler(1, WithFailFastOnPanic(true))
+	c.fetch = func(context.Context, string) (Result, error) { panic("malformed page") }
+	func() {
+		defer func() {
+			if v := recover(); v != "malformed page" {
+				t.Errorf("with WithFailFastOnPanic, recovered %v, want the panic", v)
+			}
+		}()
+		c.guardedFetch(context.Background(), "https://monzo.com/")
+	}()
+	if !c.Config().FailFastOnPanic {
+		t.Errorf("Config().FailFastOnPanic = false, want true")
+	}
+}
@@ -0,0 +1,272 @@
+package crawl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ExclusionRule is a named pattern of links not to crawl, such as those to
+// log out.
+type ExclusionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Mutating is set for links that change state on the server when
+	// fetched, such as deleting or adding to a cart, which Stats counts
+	// even if the rule isn't applied.
+	Mutating bool
+}
+
+// SafeExclusions are the rules applied with WithSafeExclusions: links that
+// change state when fetched, and endless or duplicate views of pages that
+// waste a crawl's requests. They are matched against links as resolved,
+// with their queries.
+var SafeExclusions = []ExclusionRule{
+	{Name: "logout", Pattern: regexp.MustCompile(`(?i)/(log-?out|log-?off|sign-?out|sign-?off)([/?.]|$)`), Mutating: true},
+	{Name: "delete", Pattern: regexp.MustCompile(`(?i)(/(delete|remove)([/?.]|$)|[?&](action|do)=(delete|remove)(&|$))`), Mutating: true},
+	{Name: "add-to-cart", Pattern: regexp.MustCompile(`(?i)([?&]add[-_]?to[-_]?(cart|basket)=|/(cart|basket)/add([/?]|$)|/add[-_]?to[-_]?(cart|basket)([/?]|$))`), Mutating: true},
+	{Name: "print", Pattern: regexp.MustCompile(`(?i)(/print([/?.]|$)|[?&](print|printable)=|[?&](format|view)=print(&|$))`)},
+	{Name: "calendar", Pattern: regexp.MustCompile(`(?i)(/calendar/.*\d{4}|[?&](month|year|week|date|day)=)`)},
+}
+
+// Names of the link filter steps, continued.
+const (
+	stepExclude = "exclude"
+	stepInclude = "include"
+)
+
+// excludeStep skips links matching the rules in effect, or the patterns set
+// with WithExcludePatterns, recording which, and any mutating rule the link
+// matches even if it isn't in effect.
+func excludeStep(c Crawler, s *linkState) (bool, string) {
+	addr := s.resolved.String()
+	for _, r := range SafeExclusions {
+		if r.Mutating && r.Pattern.MatchString(addr) {
+			s.mutating = r.Name
+			break
+		}
+	}
+	for _, r := range c.exclusions {
+		if r.Pattern.MatchString(addr) {
+			s.excludedBy = r.Name
+			return false, fmt.Sprintf("excluded by rule %s (%s)", r.Name, r.Pattern)
+		}
+	}
+	link := s.link.String()
+	for _, p := range c.excludePatterns {
+		if p.MatchString(link) {
+			s.excludedBy = p.String()
+			return false, fmt.Sprintf("excluded by pattern %s", p)
+		}
+	}
+	if n := len(c.exclusions) + len(c.excludePatterns); n > 0 {
+		return true, fmt.Sprintf("none of %d exclusion rules matched", n)
+	}
+	return true, "no exclusion rules"
+}
+
+// includeStep skips links matching none of the patterns set with
+// WithIncludePatterns, if there are any. It comes after excludeStep, so
+// exclusions win.
+func includeStep(c Crawler, s *linkState) (bool, string) {
+	if len(c.includePatterns) == 0 {
+		return true, "no include patterns"
+	}
+	link := s.link.String()
+	for _, p := range c.includePatterns {
+		if p.MatchString(link) {
+			return true, fmt.Sprintf("included by pattern %s", p)
+		}
+	}
+	return false, fmt.Sprintf("matched none of %d include patterns", len(c.includePatterns))
+}
+
+// compilePatterns compiles regular expressions for an option, returning the
+// first that fails to compile as an invalid option.
+func (c *Crawler) compilePatterns(option string, patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			c.invalid("%s: %v", option, err)
+			return nil
+		}
+		res = append(res, re)
+	}
+	return res
+}
+
+// buildExclusions sets the rules in effect, from the options given.
+func (c *Crawler) buildExclusions() {
+	c.exclusions = nil
+	if !c.safeExclusions {
+		return
+	}
+	disabled := make(map[string]bool, len(c.disabledRules))
+	for _, name := range c.disabledRules {
+		disabled[name] = true
+	}
+	for _, r := range SafeExclusions {
+		if !disabled[r.Name] {
+			c.exclusions = append(c.exclusions, r)
+		}
+	}
+}
+
+// ExcludedLink is the target of internal links that weren't crawled because
+// it matched an exclusion rule or pattern, recorded if enabled with
+// WithExcludedLinks.
+type ExcludedLink struct {
+	// URL is the target as resolved, with its query.
+	URL string
+	// Rule is the name of the exclusion rule, or the pattern, it matched.
+	Rule string
+	// Links is the number of links found to the target, and Pages the
+	// first of the pages they were found on, up to the limit set with
+	// WithExcludedLinks.
+	Links int64
+	Pages []string
+}
+
+// ExcludedLinkReport lists the targets of the links a crawl excluded, so
+// e.g. links from public pages into an excluded /drafts/ can be found
+// without crawling the drafts.
+type ExcludedLinkReport struct {
+	// Targets are sorted by rule, then URL.
+	Targets []ExcludedLink
+	// Untracked is the number of links excluded to further targets, once
+	// the limit on targets set with WithExcludedLinks was reached.
+	Untracked int64
+}
+
+// ExcludedLinks returns the targets of the links excluded by the crawl
+// currently being run by this Crawler, or by the last one if it has
+// finished, as recorded with WithExcludedLinks. As with Stats, it is safe to
+// call concurrently with Crawl.
+func (c Crawler) ExcludedLinks() ExcludedLinkReport {
+	return c.counters.exclusions.report()
+}
+
+// exclusionCounters hold the live values behind Stats.Excluded,
+// Stats.MutatingLinks and ExcludedLinks. Being maps, they are guarded by a
+// mutex rather than accessed atomically.
+type exclusionCounters struct {
+	mu        sync.Mutex
+	excluded  map[string]int64
+	mutating  map[string]int64
+	targets   map[string]*ExcludedLink
+	untracked int64
+}
+
+func (e *exclusionCounters) reset() {
+	e.mu.Lock()
+	e.excluded, e.mutating, e.targets, e.untracked = nil, nil, nil, 0
+	e.mu.Unlock()
+}
+
+// record counts a link's exclusion, and whether it looked mutating. If
+// maxTargets is positive, the link's target is recorded too, along with the
+// page it was found on, until there are maxTargets of them, each with up to
+// maxPages pages.
+func (e *exclusionCounters) record(s *linkState, page string, maxTargets, maxPages int) {
+	if s.excludedBy == "" && s.mutating == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s.excludedBy != "" {
+		if e.excluded == nil {
+			e.excluded = make(map[string]int64)
+		}
+		e.excluded[s.excludedBy]++
+		if maxTargets > 0 {
+			e.recordTarget(s, page, maxTargets, maxPages)
+		}
+	}
+	if s.mutating != "" {
+		if e.mutating == nil {
+			e.mutating = make(map[string]int64)
+		}
+		e.mutating[s.mutating]++
+	}
+}
+
+// recordTarget records the target of an excluded link. e.mu must be held.
+func (e *exclusionCounters) recordTarget(s *linkState, page string, maxTargets, maxPages int) {
+	addr := s.resolved.String()
+	t := e.targets[addr]
+	if t == nil {
+		if len(e.targets) >= maxTargets {
+			e.untracked++
+			return
+		}
+		if e.targets == nil {
+			e.targets = make(map[string]*ExcludedLink)
+		}
+		t = &ExcludedLink{URL: addr, Rule: s.excludedBy}
+		e.targets[addr] = t
+	}
+	t.Links++
+	// A page's links are recorded together, so it need only be compared
+	// with the last page.
+	if n := len(t.Pages); n < maxPages && (n == 0 || t.Pages[n-1] != page) {
+		t.Pages = append(t.Pages, page)
+	}
+}
+
+// report returns a copy of the targets recorded.
+func (e *exclusionCounters) report() ExcludedLinkReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r := ExcludedLinkReport{Untracked: e.untracked}
+	for _, t := range e.targets {
+		c := *t
+		c.Pages = append([]string(nil), t.Pages...)
+		r.Targets = append(r.Targets, c)
+	}
+	sort.Slice(r.Targets, func(i, j int) bool {
+		if r.Targets[i].Rule != r.Targets[j].Rule {
+			return r.Targets[i].Rule < r.Targets[j].Rule
+		}
+		return r.Targets[i].URL < r.Targets[j].URL
+	})
+	return r
+}
+
+// stats returns copies of the counts, or nils if there are none.
+func (e *exclusionCounters) stats() (excluded, mutating map[string]int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return copyCounts(e.excluded), copyCounts(e.mutating)
+}
+
+func copyCounts(m map[string]int64) map[string]int64 {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// exclusionNames returns the names of the rules, in order.
+func exclusionNames(rules []ExclusionRule) []string {
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// hasExclusion reports whether rules include one with the name.
+func hasExclusion(rules []ExclusionRule, name string) bool {
+	for _, r := range rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
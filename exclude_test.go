@@ -0,0 +1,241 @@
+package crawl
+
+import (
+	"testing"
+
+	"crawl/crawltest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSafeExclusionRules(t *testing.T) {
+	cases := map[string]struct{ match, miss []string }{
+		"logout": {
+			match: []string{"https://monzo.com/logout", "https://monzo.com/account/sign-out?next=/", "https://monzo.com/user/LogOff"},
+			miss:  []string{"https://monzo.com/logout-tips", "https://monzo.com/catalogue"},
+		},
+		"delete": {
+			match: []string{"https://monzo.com/post/1/delete", "https://monzo.com/items?action=delete&id=1"},
+			miss:  []string{"https://monzo.com/deleted-scenes", "https://monzo.com/items?action=deleted"},
+		},
+		"add-to-cart": {
+			match: []string{"https://monzo.com/product/1?add-to-cart=1", "https://monzo.com/cart/add?id=1", "https://monzo.com/add_to_basket/"},
+			miss:  []string{"https://monzo.com/cart", "https://monzo.com/blog/add-to-cart-buttons-considered-harmful"},
+		},
+		"print": {
+			match: []string{"https://monzo.com/article/1/print", "https://monzo.com/article?print=1", "https://monzo.com/article?format=print"},
+			miss:  []string{"https://monzo.com/printers", "https://monzo.com/blueprint"},
+		},
+		"calendar": {
+			match: []string{"https://monzo.com/events/calendar/2020/12", "https://monzo.com/events?month=2020-12"},
+			miss:  []string{"https://monzo.com/calendar", "https://monzo.com/events?monthly=1"},
+		},
+	}
+	for _, r := range SafeExclusions {
+		tc, ok := cases[r.Name]
+		if !ok {
+			t.Errorf("rule %s isn't tested", r.Name)
+		}
+		for _, u := range tc.match {
+			if !r.Pattern.MatchString(u) {
+				t.Errorf("rule %s doesn't match %s, want a match", r.Name, u)
+			}
+		}
+		for _, u := range tc.miss {
+			if r.Pattern.MatchString(u) {
+				t.Errorf("rule %s matches %s, want no match", r.Name, u)
+			}
+		}
+	}
+}
+
+func TestSafeExclusions(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/a", "/logout", "/cart/add?id=1", "/a/print", "https://example.com/logout")
+	site.Page("https://monzo.com/a", "/logout")
+	site.Page("https://monzo.com/logout")
+	site.Page("https://monzo.com/cart/add")
+	site.Page("https://monzo.com/a/print")
+
+	crawled := func(opts ...Option) ([]string, Stats, []Result) {
+		t.Helper()
+		c := NewCrawler(1, append(opts, WithTransportMiddleware(site.Wrap))...)
+		results, err := c.Crawl("https://monzo.com")
+		if err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		var urls []string
+		for _, r := range results {
+			urls = append(urls, r.URL)
+		}
+		return urls, c.Stats(), results
+	}
+
+	// Without the exclusions, state changing links are crawled, but
+	// counted so they can be warned about.
+	urls, s, _ := crawled()
+	want := []string{"https://monzo.com/", "https://monzo.com/a", "https://monzo.com/a/print", "https://monzo.com/cart/add", "https://monzo.com/logout"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int64{"logout": 2, "add-to-cart": 1}, s.MutatingLinks); diff != "" || s.Excluded != nil {
+		t.Errorf("Stats() MutatingLinks mismatch (-want +got):\n%s\nExcluded = %v, want none", diff, s.Excluded)
+	}
+
+	urls, s, results := crawled(WithSafeExclusions(true), WithoutExclusions("print"), WithLinkTargets(true))
+	want = []string{"https://monzo.com/", "https://monzo.com/a", "https://monzo.com/a/print"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("crawled URLs with exclusions mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int64{"logout": 2, "add-to-cart": 1}, s.Excluded); diff != "" {
+		t.Errorf("Stats().Excluded mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(s.Excluded, s.MutatingLinks); diff != "" {
+		t.Errorf("Stats().MutatingLinks differs from the links excluded (-want +got):\n%s", diff)
+	}
+	target := results[1].LinkTargets[0]
+	if target.State != LinkSkipped || target.Reason == "" {
+		t.Errorf("link target of /a's link to /logout = %+v, want skipped by the logout rule", target)
+	}
+
+	if err := NewCrawler(1, WithoutExclusions("nope")).err; err == nil {
+		t.Errorf("WithoutExclusions(\"nope\") accepted, want an error")
+	}
+	if got := NewCrawler(1, WithSafeExclusions(true), WithoutExclusions("calendar")).Config().Exclusions; !cmp.Equal(got, []string{"logout", "delete", "add-to-cart", "print"}) {
+		t.Errorf("Config().Exclusions = %v, want all but calendar", got)
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":                     {"/calendar/2020/12", "/search/?q=cards", "/search/cards/page/2", "/blog", "/Calendar/2020"},
+		"https://monzo.com/blog":                {"/calendar/2021/01", "/blog/calendar"},
+		"https://monzo.com/blog/calendar":       {},
+		"https://monzo.com/search/cards/page/2": {},
+	}
+	// The patterns overlap on /search/, and the first matching counts the
+	// link. The last matches the starting URL, which is still fetched.
+	patterns := []string{`/calendar/\d{4}`, `/search/`, `/search/.*/page/`, `^https://monzo\.com/$`}
+	c := NewCrawler(1, WithExcludePatterns(patterns...))
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	// Matching is case sensitive, so /Calendar/2020 is crawled.
+	want := []string{"https://monzo.com/", "https://monzo.com/Calendar/2020", "https://monzo.com/blog", "https://monzo.com/blog/calendar"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(site["https://monzo.com"], results[0].Links); diff != "" {
+		t.Errorf("starting URL's Links mismatch, want excluded links kept (-want +got):\n%s", diff)
+	}
+	// Excluded links are on the site, so aren't counted as external.
+	if r := results[0]; r.OutboundInternal != 2 || r.OutboundExternal != 0 {
+		t.Errorf("starting URL's OutboundInternal, OutboundExternal = %d, %d, want 2, 0", r.OutboundInternal, r.OutboundExternal)
+	}
+	wantExcluded := map[string]int64{`/calendar/\d{4}`: 2, `/search/`: 2}
+	if diff := cmp.Diff(wantExcluded, c.Stats().Excluded); diff != "" {
+		t.Errorf("Stats().Excluded mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(patterns, c.Config().ExcludePatterns); diff != "" {
+		t.Errorf("Config().ExcludePatterns mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := NewCrawler(1, WithExcludePatterns(`/ok/`, `(`)).err; err == nil {
+		t.Errorf("WithExcludePatterns with an invalid pattern accepted, want an error")
+	}
+}
+
+func TestIncludePatterns(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":         {"/docs/", "/blog", "https://community.monzo.com/docs/x"},
+		"https://monzo.com/docs/":   {"/docs/a", "/docs/drafts/b", "/blog", "/"},
+		"https://monzo.com/docs/a":  {},
+		"https://monzo.com/blog":    {},
+		"https://monzo.com/docs/x":  {},
+		"https://monzo.com/drafts/": {},
+	}
+	// The starting URL doesn't match, but is fetched. Off-site links that
+	// match are still out of scope, and exclusions win over inclusions.
+	c := NewCrawler(1, WithIncludePatterns(`/docs/`), WithExcludePatterns(`/drafts/`), WithLinkTargets(true))
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	want := []string{"https://monzo.com/", "https://monzo.com/docs/", "https://monzo.com/docs/a"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	wantTargets := []LinkTarget{
+		{Link: 0, Result: -1, State: LinkSkipped, Reason: "matched none of 1 include patterns"},
+		{Link: 1, Result: 1, State: LinkFetched},
+	}
+	if diff := cmp.Diff(wantTargets, results[0].LinkTargets); diff != "" {
+		t.Errorf("starting URL's LinkTargets mismatch (-want +got):\n%s", diff)
+	}
+
+	decisions, err := c.Explain("https://monzo.com", "/docs/drafts/b")
+	if err != nil {
+		t.Fatalf("Explain erred when not expected: %v", err)
+	}
+	if d := decisions[len(decisions)-1]; d.Step != stepExclude || d.Pass {
+		t.Errorf("Explain(/docs/drafts/b) ended with %v, want it excluded", d)
+	}
+
+	if err := NewCrawler(1, WithIncludePatterns(`[`)).err; err == nil {
+		t.Errorf("WithIncludePatterns with an invalid pattern accepted, want an error")
+	}
+}
+
+func TestExcludedLinks(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":      {"/drafts/a", "/drafts/a", "/blog", "/drafts/b"},
+		"https://monzo.com/blog": {"/drafts/a", "/logout?next=/"},
+	}
+	crawl := func(opts ...Option) Crawler {
+		opts = append(opts, WithSafeExclusions(true), WithExcludePatterns(`/drafts/`))
+		c := NewCrawler(1, opts...)
+		c.fetch = fetchSite(site)
+		if _, err := c.Crawl("https://monzo.com"); err != nil {
+			t.Fatalf("Crawl erred when not expected: %v", err)
+		}
+		return c
+	}
+
+	c := crawl(WithExcludedLinks(10, 10))
+	want := ExcludedLinkReport{Targets: []ExcludedLink{
+		{URL: "https://monzo.com/drafts/a", Rule: "/drafts/", Links: 3, Pages: []string{"https://monzo.com/", "https://monzo.com/blog"}},
+		{URL: "https://monzo.com/drafts/b", Rule: "/drafts/", Links: 1, Pages: []string{"https://monzo.com/"}},
+		{URL: "https://monzo.com/logout?next=/", Rule: "logout", Links: 1, Pages: []string{"https://monzo.com/blog"}},
+	}}
+	if diff := cmp.Diff(want, c.ExcludedLinks()); diff != "" {
+		t.Errorf("ExcludedLinks() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Beyond the limits, links are only counted.
+	c = crawl(WithExcludedLinks(1, 1))
+	want = ExcludedLinkReport{
+		Targets:   []ExcludedLink{{URL: "https://monzo.com/drafts/a", Rule: "/drafts/", Links: 3, Pages: []string{"https://monzo.com/"}}},
+		Untracked: 2,
+	}
+	if diff := cmp.Diff(want, c.ExcludedLinks()); diff != "" {
+		t.Errorf("ExcludedLinks() with limits of 1 mismatch (-want +got):\n%s", diff)
+	}
+
+	if r := crawl().ExcludedLinks(); r.Targets != nil || r.Untracked != 0 {
+		t.Errorf("ExcludedLinks() without WithExcludedLinks = %+v, want nothing recorded", r)
+	}
+	if err := NewCrawler(1, WithExcludedLinks(0, 1)).err; err == nil {
+		t.Errorf("WithExcludedLinks(0, 1) accepted, want an error")
+	}
+}
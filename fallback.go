@@ -0,0 +1,27 @@
+package crawl
+
+import (
+	"html"
+	"regexp"
+)
+
+// anchorHref matches the href attribute of an <a> tag in raw markup, with
+// its value double quoted, single quoted or unquoted.
+var anchorHref = regexp.MustCompile(`(?is)<a\s[^>]*?\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// fallbackLinks scans raw markup for the hrefs of <a> tags, for documents the
+// HTML parser rejects. It is cruder than parsing, finding links in comments
+// and scripts too, but recovers most of a page's links from markup too broken
+// to parse.
+func fallbackLinks(body []byte) []string {
+	var links []string
+	for _, m := range anchorHref.FindAllSubmatch(body, -1) {
+		for _, v := range m[1:] {
+			if v != nil {
+				links = append(links, html.UnescapeString(string(v)))
+				break
+			}
+		}
+	}
+	return links
+}
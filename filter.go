@@ -0,0 +1,158 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Decision is the outcome of one step in deciding whether a link is crawled.
+type Decision struct {
+	Step   string
+	Pass   bool
+	Detail string
+}
+
+func (d Decision) String() string {
+	outcome := "pass"
+	if !d.Pass {
+		outcome = "FAIL"
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Step, outcome, d.Detail)
+}
+
+// linkState is a link found on a page, as it passes through the filters.
+type linkState struct {
+	// root is the starting URL of the crawl.
+	root *url.URL
+	// base is the URL links on the page are resolved against: the page's
+	// own, or that of its <base href>.
+	base *url.URL
+	// page is the URL of the page the link was found on, if it was found
+	// on one, for reporting.
+	page string
+	// href is the raw link.
+	href string
+	// link is the link as resolved and transformed by the filters so far.
+	link *url.URL
+	// resolved is the link as resolved, before it was normalized.
+	resolved *url.URL
+	// invalid is set if href could not be parsed, even if it was then
+	// repaired.
+	invalid *InvalidLink
+	// excludedBy is the name of the exclusion rule the link matched, if
+	// any, and mutating that of the rule for links that change state.
+	excludedBy string
+	mutating   string
+}
+
+// linkFilter is a named step in deciding whether a link should be crawled.
+// Steps may transform the link, for later steps, as well as checking it.
+type linkFilter struct {
+	name  string
+	apply func(c Crawler, s *linkState) (pass bool, detail string)
+}
+
+// Names of the link filter steps.
+const (
+	stepResolve   = "resolve"
+	stepNormalize = "normalize"
+	stepScope     = "scope"
+)
+
+// linkFilters are the steps every link found on a page passes through, in
+// order, before being considered for the work queue.
+var linkFilters = []linkFilter{
+	{stepResolve, resolveStep},
+	{stepNormalize, normalizeStep},
+	{stepScope, scopeStep},
+	{stepExclude, excludeStep},
+	{stepInclude, includeStep},
+}
+
+func resolveStep(c Crawler, s *linkState) (bool, string) {
+	link, err := resolve(s.base, s.href)
+	if err == nil {
+		s.link, s.resolved = link, link
+		return true, "resolved to " + link.String()
+	}
+	page := s.page
+	if page == "" {
+		page = s.base.String()
+	}
+	s.invalid = &InvalidLink{Page: page, Href: s.href, Err: err.Error()}
+	href, fix := lenientHref(s.href)
+	if fix == "" {
+		return false, err.Error()
+	}
+	if link, lerr := resolve(s.base, href); lerr == nil {
+		s.link, s.resolved, s.invalid.Fix = link, link, fix
+		return true, fmt.Sprintf("resolved to %s after repairing invalid link (%s): %v", link, fix, err)
+	}
+	return false, err.Error()
+}
+
+func normalizeStep(c Crawler, s *linkState) (bool, string) {
+	s.link = normalize(s.link)
+	return true, "normalized to " + s.link.String()
+}
+
+func scopeStep(c Crawler, s *linkState) (bool, string) {
+	return c.inScope(s.root.Host, s.link.Host)
+}
+
+// inScope reports whether a host is part of the crawl of the site of the
+// root host, and why.
+func (c Crawler) inScope(root, host string) (bool, string) {
+	site := c.siteOf(root)
+	hostSite := c.siteOf(host)
+	if hostSite == site {
+		return true, fmt.Sprintf("host %s is part of site %s", host, site)
+	}
+	if c.allowedSites[hostSite] {
+		return true, fmt.Sprintf("host %s is an allowed host", host)
+	}
+	if c.subdomains && sameDomain(root, host) {
+		return true, fmt.Sprintf("host %s is a subdomain of %s", host, registrableDomain(root))
+	}
+	return false, fmt.Sprintf("host %s is not part of site %s or an allowed host", host, site)
+}
+
+// filterLink runs a link through the filters, stopping at the first that it
+// fails. It returns that failing decision, or the last decision and true if
+// the link passed them all. Each decision is also passed to trace, if set.
+func (c Crawler) filterLink(s *linkState, trace func(Decision)) (Decision, bool) {
+	var d Decision
+	for _, f := range linkFilters {
+		d.Step = f.name
+		d.Pass, d.Detail = f.apply(c, s)
+		if trace != nil {
+			trace(d)
+		}
+		if !d.Pass {
+			return d, false
+		}
+	}
+	return d, true
+}
+
+// Explain returns the decisions made about whether target would be crawled,
+// if it were linked to from the starting URL seed. If target passes the link
+// filters, the robots.txt of its host is fetched, unless ignored with
+// WithIgnoreRobots, to decide whether it may be; nothing else is fetched.
+// Whether target is a duplicate of an already crawled page depends on the
+// crawl's progress, so it is not considered.
+func (c Crawler) Explain(seed, target string) ([]Decision, error) {
+	root, err := url.Parse(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid starting URL %s: %w", seed, err)
+	}
+	var decisions []Decision
+	s := &linkState{root: root, base: root, href: target}
+	if _, ok := c.filterLink(s, func(d Decision) {
+		decisions = append(decisions, d)
+	}); ok {
+		decisions = append(decisions, c.explainRobots(context.Background(), s.link))
+	}
+	return decisions, nil
+}
@@ -0,0 +1,157 @@
+package crawl
+
+import (
+	"crawl/crawltest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkFilters(t *testing.T) {
+	root, _ := url.Parse("https://monzo.com/")
+	base, _ := url.Parse("https://monzo.com/foo/")
+	c := NewCrawler(1, WithCoalesceWWW(true), WithAllowedHosts("monzo.co.uk", "Blog.Monzo.org", "shop.monzo.com:443"))
+
+	cases := []struct {
+		name     string
+		apply    func(Crawler, *linkState) (bool, string)
+		link     string
+		href     string
+		wantPass bool
+		wantLink string
+	}{
+		{"resolve relative", resolveStep, "", "bar#baz", true, "https://monzo.com/foo/bar"},
+		{"resolve invalid", resolveStep, "", "http://exa mple.com", false, ""},
+		{"normalize", normalizeStep, "https://monzo.com/bar?a=b", "", true, "https://monzo.com/bar"},
+		{"scope same host", scopeStep, "https://monzo.com/bar", "", true, "https://monzo.com/bar"},
+		{"scope alias", scopeStep, "https://www.monzo.com/bar", "", true, "https://www.monzo.com/bar"},
+		{"scope other host", scopeStep, "https://community.monzo.com/", "", false, "https://community.monzo.com/"},
+		{"scope allowed host", scopeStep, "https://www.monzo.co.uk/", "", true, "https://www.monzo.co.uk/"},
+		{"scope allowed host case", scopeStep, "https://blog.monzo.org/", "", true, "https://blog.monzo.org/"},
+		{"scope allowed host port", scopeStep, "https://shop.monzo.com/", "", true, "https://shop.monzo.com/"},
+	}
+
+	for _, tc := range cases {
+		s := &linkState{root: root, base: base, href: tc.href}
+		if tc.link != "" {
+			s.link, _ = url.Parse(tc.link)
+		}
+		pass, detail := tc.apply(c, s)
+		if pass != tc.wantPass {
+			t.Errorf("%s: pass = %v (%s), want %v", tc.name, pass, detail, tc.wantPass)
+		}
+		if !pass {
+			continue
+		}
+		if got := s.link.String(); got != tc.wantLink {
+			t.Errorf("%s: link = %s, want %s", tc.name, got, tc.wantLink)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com/robots.txt", crawltest.Response{Body: "User-agent: *\nDisallow: /private/\n"})
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap))
+
+	cases := []struct {
+		target string
+		want   []Decision
+	}{
+		{
+			target: "/foo?a=b",
+			want: []Decision{
+				{Step: stepResolve, Pass: true, Detail: "resolved to https://monzo.com/foo?a=b"},
+				{Step: stepNormalize, Pass: true, Detail: "normalized to https://monzo.com/foo"},
+				{Step: stepScope, Pass: true, Detail: "host monzo.com is part of site monzo.com"},
+				{Step: stepExclude, Pass: true, Detail: "no exclusion rules"},
+				{Step: stepInclude, Pass: true, Detail: "no include patterns"},
+				{Step: stepRobots, Pass: true, Detail: "robots.txt of monzo.com allows /foo"},
+			},
+		},
+		{
+			target: "/private/x",
+			want: []Decision{
+				{Step: stepResolve, Pass: true, Detail: "resolved to https://monzo.com/private/x"},
+				{Step: stepNormalize, Pass: true, Detail: "normalized to https://monzo.com/private/x"},
+				{Step: stepScope, Pass: true, Detail: "host monzo.com is part of site monzo.com"},
+				{Step: stepExclude, Pass: true, Detail: "no exclusion rules"},
+				{Step: stepInclude, Pass: true, Detail: "no include patterns"},
+				{Step: stepRobots, Pass: false, Detail: "robots.txt of monzo.com disallows /private/x"},
+			},
+		},
+		{
+			target: "https://community.monzo.com/foo",
+			want: []Decision{
+				{Step: stepResolve, Pass: true, Detail: "resolved to https://community.monzo.com/foo"},
+				{Step: stepNormalize, Pass: true, Detail: "normalized to https://community.monzo.com/foo"},
+				{Step: stepScope, Pass: false, Detail: "host community.monzo.com is not part of site monzo.com or an allowed host"},
+			},
+		},
+		{
+			target: "http://exa mple.com",
+			want: []Decision{
+				{Step: stepResolve, Pass: false, Detail: `parse "http://exa mple.com": invalid character " " in host name`},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		got, err := c.Explain("https://monzo.com", tc.target)
+		if err != nil {
+			t.Fatalf("Explain erred when not expected: %v", err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Explain(%s) mismatch (-want +got):\n%s", tc.target, diff)
+		}
+	}
+	// robots.txt is only fetched for links that pass the other steps.
+	if n := site.Calls("https://monzo.com/robots.txt"); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", n)
+	}
+
+	// Unless it is ignored.
+	c = NewCrawler(1, WithIgnoreRobots(true), WithTransportMiddleware(site.Wrap))
+	got, err := c.Explain("https://monzo.com", "/private/x")
+	if err != nil {
+		t.Fatalf("Explain erred when not expected: %v", err)
+	}
+	if want := (Decision{Step: stepRobots, Pass: true, Detail: "robots.txt ignored"}); len(got) == 0 || got[len(got)-1] != want {
+		t.Errorf("Explain(/private/x) ignoring robots.txt = %v, want it to end with %v", got, want)
+	}
+	if n := site.Calls("https://monzo.com/robots.txt"); n != 2 {
+		t.Errorf("robots.txt fetched %d times after Explain ignoring it, want 2", n)
+	}
+}
+
+func TestIncludeSubdomains(t *testing.T) {
+	cases := []struct {
+		root, link string
+		want       bool
+	}{
+		{"https://monzo.com/", "https://www.monzo.com/", true},
+		{"https://monzo.com/", "https://community.monzo.com/", true},
+		{"https://monzo.com/", "https://a.b.c.monzo.com:8443/", true},
+		{"https://www.monzo.com/", "https://monzo.com/", true},
+		{"https://www.monzo.com/", "https://Community.Monzo.com/", true},
+		{"https://monzo.co.uk/", "https://help.monzo.co.uk/", true},
+		{"https://monzo.com/", "https://notmonzo.com/", false},
+		{"https://monzo.com/", "https://monzo.com.evil.com/", false},
+		{"https://monzo.com/", "https://monzo.co.uk/", false},
+		{"https://monzo.co.uk/", "https://other.co.uk/", false},
+		{"https://alice.github.io/", "https://bob.github.io/", false},
+		{"http://127.0.0.1/", "http://127.0.0.2/", false},
+	}
+	for _, tc := range cases {
+		root, _ := url.Parse(tc.root)
+		link, _ := url.Parse(tc.link)
+		for _, enabled := range []bool{false, true} {
+			c := NewCrawler(1, WithIncludeSubdomains(enabled))
+			pass, detail := scopeStep(c, &linkState{root: root, base: root, link: link})
+			if want := tc.want && enabled || root.Host == link.Host; pass != want {
+				t.Errorf("scope of %s from %s with subdomains %v = %v (%s), want %v", tc.link, tc.root, enabled, pass, detail, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package crawl
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flight is a fetch in progress, whose result is shared with any identical
+// fetches made while it runs.
+type flight struct {
+	wg  sync.WaitGroup
+	r   Result
+	err error
+}
+
+// flightGroup coalesces concurrent fetches of the same page, keyed by visit
+// key, so they make one request between them. The Crawl loop never
+// dispatches the same key twice at once, which assertInvariants checks in
+// tests, so this only guards against that going wrong, e.g. as URLs are
+// normalized in new ways.
+type flightGroup struct {
+	mu        sync.Mutex
+	flights   map[string]*flight
+	coalesced int64
+}
+
+// do calls fn and returns its results, unless a call with the same key is
+// already in progress, in which case it waits for that to finish and returns
+// its results instead. The Result is shared, so must not be modified in
+// place.
+func (g *flightGroup) do(key string, fn func() (Result, error)) (Result, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		atomic.AddInt64(&g.coalesced, 1)
+		f.wg.Wait()
+		return f.r, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.r, f.err = fn()
+	f.wg.Done()
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	return f.r, f.err
+}
@@ -0,0 +1,67 @@
+package crawl
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Every crawl in the tests checks the frontier never has the same page
+	// in flight twice.
+	assertInvariants = true
+}
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	var calls int64
+	release := make(chan struct{})
+	fn := func() (Result, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return Result{Links: []string{"/foo"}}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Result, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do("https://monzo.com", fn)
+		}(i)
+	}
+	// Wait for every call to join the first.
+	for atomic.LoadInt64(&g.coalesced) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	for i, r := range results {
+		if len(r.Links) != 1 {
+			t.Errorf("result %d = %+v, want the shared result", i, r)
+		}
+	}
+	// Once finished, the next call fetches afresh.
+	g.do("https://monzo.com", fn)
+	if calls != 2 {
+		t.Errorf("fn called %d times after the flight landed, want 2", calls)
+	}
+}
+
+func TestFrontierInvariant(t *testing.T) {
+	var f frontier
+	f.reset()
+	f.start(queuedURL{url: "https://monzo.com/a", key: "https://monzo.com/a"}, time.Now())
+	defer func() {
+		if recover() == nil {
+			t.Errorf("start() of a key already in flight didn't panic")
+		}
+	}()
+	f.start(queuedURL{url: "https://www.monzo.com/a", key: "https://monzo.com/a"}, time.Now())
+}
@@ -1,6 +1,6 @@
 module crawl
 
-go 1.13
+go 1.14
 
 require (
 	github.com/google/go-cmp v0.5.3
@@ -0,0 +1,102 @@
+package crawl
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hostHeaders are headers sent with requests to the hosts matching a
+// pattern, as set with WithHostHeaders and WithHostUserAgent.
+type hostHeaders struct {
+	// pattern is a normalized host, or *. and a domain to match its
+	// subdomains.
+	pattern string
+	header  http.Header
+}
+
+// normalizeHost lower cases a host, and strips any port and trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func (h hostHeaders) matches(host string) bool {
+	host = normalizeHost(host)
+	if strings.HasPrefix(h.pattern, "*.") {
+		return strings.HasSuffix(host, h.pattern[1:])
+	}
+	return host == h.pattern
+}
+
+// decorate sets the headers of a request for its host: the crawler's
+// User-Agent, then those of each matching host's headers, in the order
+// given. Headers for other hosts are removed, as the client copies the
+// headers of a request onto its redirects, and credentials meant for one
+// host must never be sent to another.
+func (c Crawler) decorate(req *http.Request) {
+	for _, h := range c.hostHeaders {
+		for name := range h.header {
+			req.Header.Del(name)
+		}
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	for _, h := range c.hostHeaders {
+		if !h.matches(req.URL.Host) {
+			continue
+		}
+		for name, values := range h.header {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+}
+
+// capturedHeaders returns the headers of a response named with
+// WithHeaderCapture, or nil if it had none of them.
+func (c Crawler) capturedHeaders(h http.Header) http.Header {
+	var captured http.Header
+	for _, name := range c.captureHeaders {
+		if values, ok := h[name]; ok {
+			if captured == nil {
+				captured = make(http.Header)
+			}
+			captured[name] = append([]string(nil), values...)
+		}
+	}
+	return captured
+}
+
+// userAgentFor returns the User-Agent sent with requests to host.
+func (c Crawler) userAgentFor(host string) string {
+	ua := c.userAgent
+	for _, h := range c.hostHeaders {
+		if v := h.header.Get("User-Agent"); v != "" && h.matches(host) {
+			ua = v
+		}
+	}
+	return ua
+}
+
+// redactedHeaders describes the host headers for Config, with the values of
+// all but the User-Agent redacted, as they may be credentials.
+func (c Crawler) redactedHeaders() map[string]map[string]string {
+	if len(c.hostHeaders) == 0 {
+		return nil
+	}
+	m := make(map[string]map[string]string)
+	for _, h := range c.hostHeaders {
+		if m[h.pattern] == nil {
+			m[h.pattern] = make(map[string]string)
+		}
+		for name := range h.header {
+			v := "[redacted]"
+			if name == "User-Agent" {
+				v = h.header.Get(name)
+			}
+			m[h.pattern][name] = v
+		}
+	}
+	return m
+}
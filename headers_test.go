@@ -0,0 +1,74 @@
+package crawl
+
+import (
+	"context"
+	"crawl/crawltest"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHostHeaders(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://docs.partner.com/")
+	site.Page("https://partner.com/")
+	site.Page("https://other.com/")
+	site.Handle("https://docs.partner.com/moved", crawltest.Response{Status: http.StatusFound, Header: http.Header{"Location": {"https://other.com/"}}})
+
+	var mu sync.Mutex
+	sent := make(map[string]http.Header)
+	capture := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			sent[req.URL.String()] = req.Header.Clone()
+			mu.Unlock()
+			return next.RoundTrip(req)
+		})
+	}
+	opts := []Option{
+		WithHostHeaders("*.Partner.com", map[string]string{"X-Token": "secret"}),
+		WithHostUserAgent("*.partner.com", "partnerbot/1.0"),
+		WithTransportMiddleware(site.Wrap),
+		WithTransportMiddleware(capture),
+	}
+	for _, u := range []string{"https://docs.partner.com/", "https://partner.com/", "https://other.com/", "https://docs.partner.com/moved"} {
+		if _, err := Fetch(context.Background(), u, opts...); err != nil {
+			t.Fatalf("Fetch(%s) erred when not expected: %v", u, err)
+		}
+	}
+
+	type headers struct{ UserAgent, Token string }
+	got := make(map[string]headers)
+	for u, h := range sent {
+		got[u] = headers{h.Get("User-Agent"), h.Get("X-Token")}
+	}
+	want := map[string]headers{
+		"https://docs.partner.com/":      {"partnerbot/1.0", "secret"},
+		"https://docs.partner.com/moved": {"partnerbot/1.0", "secret"},
+		// The apex doesn't match the subdomain pattern, and the token
+		// isn't sent on when the redirect leaves the partner's hosts.
+		"https://partner.com/": {DefaultUserAgent, ""},
+		"https://other.com/":   {DefaultUserAgent, ""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("headers sent mismatch (-want +got):\n%s", diff)
+	}
+
+	c := NewCrawler(1, opts...)
+	if agent := c.robotsAgent("docs.partner.com:443"); agent != "partnerbot" {
+		t.Errorf("robotsAgent(docs.partner.com) = %q, want partnerbot", agent)
+	}
+	wantConfig := map[string]map[string]string{"*.partner.com": {"X-Token": "[redacted]", "User-Agent": "partnerbot/1.0"}}
+	if diff := cmp.Diff(wantConfig, c.Config().HostHeaders); diff != "" {
+		t.Errorf("Config().HostHeaders mismatch (-want +got):\n%s", diff)
+	}
+	if err := NewCrawler(1, WithHostHeaders("*.", map[string]string{"X-Token": "secret"})).err; err == nil {
+		t.Errorf("WithHostHeaders(*.) accepted, want an error")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,158 @@
+package crawl
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// histogram counts non-negative values in buckets of logarithmically
+// increasing width, in the manner of an HDR histogram, so quantiles of any
+// number of values can be estimated in a fixed amount of memory. Values
+// below histSub have a bucket each; above, each power of two is split into
+// histSub buckets, so a value's bucket is within 1/histSub of it, and its
+// midpoint within half that. All access is atomic, so values may be
+// recorded from any goroutine.
+type histogram struct {
+	counts [histBuckets]int64
+	count  int64
+	sum    int64
+	// min is the smallest value plus one, so 0 means none.
+	min int64
+	max int64
+}
+
+const (
+	histSubBits = 5
+	histSub     = 1 << histSubBits
+	// histBuckets covers every non-negative int64: histSub exact buckets,
+	// then histSub for each power of two from histSub to 2^62.
+	histBuckets = (64 - histSubBits) * histSub
+)
+
+// histBucket returns the index of the bucket counting v.
+func histBucket(v int64) int {
+	if v < histSub {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBits - 1
+	return (shift+1)*histSub + int(v>>uint(shift)) - histSub
+}
+
+// histBucketMid returns the midpoint of bucket i's values.
+func histBucketMid(i int) int64 {
+	if i < histSub {
+		return int64(i)
+	}
+	shift := uint(i/histSub - 1)
+	low := int64(histSub+i%histSub) << shift
+	return low + (int64(1)<<shift)/2
+}
+
+func (h *histogram) reset() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.min, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// record counts v, or 0 if it is negative.
+func (h *histogram) record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if v == math.MaxInt64 {
+		v--
+	}
+	atomic.AddInt64(&h.counts[histBucket(v)], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+	for {
+		min := atomic.LoadInt64(&h.min)
+		if min != 0 && min-1 <= v || atomic.CompareAndSwapInt64(&h.min, min, v+1) {
+			break
+		}
+	}
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if max >= v || atomic.CompareAndSwapInt64(&h.max, max, v) {
+			break
+		}
+	}
+}
+
+// quantile estimates the value below which a fraction q of the recorded
+// values fall, to within 1/(2*histSub) of it, or returns 0 if there are
+// none.
+func (h *histogram) quantile(q float64) int64 {
+	n := atomic.LoadInt64(&h.count)
+	if n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(n)))
+	if rank < 1 {
+		rank = 1
+	}
+	min, max := h.minimum(), atomic.LoadInt64(&h.max)
+	var seen int64
+	for i := range h.counts {
+		seen += atomic.LoadInt64(&h.counts[i])
+		if seen < rank {
+			continue
+		}
+		v := histBucketMid(i)
+		if v < min {
+			v = min
+		}
+		if v > max {
+			v = max
+		}
+		return v
+	}
+	return max
+}
+
+// minimum returns the smallest value recorded, or 0 if there are none.
+func (h *histogram) minimum() int64 {
+	if min := atomic.LoadInt64(&h.min); min != 0 {
+		return min - 1
+	}
+	return 0
+}
+
+// distribution summarizes the recorded values.
+func (h *histogram) distribution() Distribution {
+	return Distribution{
+		Count: atomic.LoadInt64(&h.count),
+		Sum:   atomic.LoadInt64(&h.sum),
+		Min:   h.minimum(),
+		Max:   atomic.LoadInt64(&h.max),
+		P50:   h.quantile(0.5),
+		P90:   h.quantile(0.9),
+		P99:   h.quantile(0.99),
+	}
+}
+
+// Distribution summarizes a set of values, such as page sizes, without
+// keeping them. The percentiles are estimates, within 2% of the true
+// values; the rest are exact.
+type Distribution struct {
+	Count int64
+	Sum   int64
+	Min   int64
+	Max   int64
+	P50   int64
+	P90   int64
+	P99   int64
+}
+
+// Mean returns the average of the values, or 0 if there are none.
+func (d Distribution) Mean() float64 {
+	if d.Count == 0 {
+		return 0
+	}
+	return float64(d.Sum) / float64(d.Count)
+}
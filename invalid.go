@@ -0,0 +1,75 @@
+package crawl
+
+import (
+	"sort"
+	"strings"
+)
+
+// InvalidLink is a link on a page that could not be parsed as a URL. Such
+// links are usually authoring bugs, even where browsers are lenient enough
+// to follow them.
+type InvalidLink struct {
+	// Page is the URL of the page the link was found on.
+	Page string
+	// Href is the raw link.
+	Href string
+	// Err is why it could not be parsed.
+	Err string
+	// Fix describes how it was repaired, the way a browser would, so it
+	// could still be crawled, e.g. "removed tabs and newlines". It is ""
+	// if it couldn't be, and the link was dropped.
+	Fix string `json:",omitempty"`
+}
+
+// lenientHref repairs a raw link the way browsers do before parsing it:
+// removing tabs and newlines, trimming leading and trailing whitespace and
+// control characters, and escaping any % not starting an escape sequence.
+// It returns the repaired link and a description of the repairs made.
+func lenientHref(href string) (string, string) {
+	var fixes []string
+	if strings.ContainsAny(href, "\t\n\r") {
+		href = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(href)
+		fixes = append(fixes, "removed tabs and newlines")
+	}
+	if t := strings.TrimFunc(href, func(r rune) bool { return r <= ' ' }); t != href {
+		href = t
+		fixes = append(fixes, "trimmed whitespace")
+	}
+	var sb strings.Builder
+	for i := 0; i < len(href); i++ {
+		if href[i] == '%' && (i+2 >= len(href) || !isHex(href[i+1]) || !isHex(href[i+2])) {
+			sb.WriteString("%25")
+			continue
+		}
+		sb.WriteByte(href[i])
+	}
+	if e := sb.String(); e != href {
+		href = e
+		fixes = append(fixes, "escaped stray %")
+	}
+	return href, strings.Join(fixes, ", ")
+}
+
+func isHex(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+// InvalidLinks returns the invalid links found by a crawl, sorted by page
+// and then link.
+func InvalidLinks(results []Result) []InvalidLink {
+	var links []InvalidLink
+	for _, r := range results {
+		links = append(links, r.InvalidLinks...)
+	}
+	sortInvalidLinks(links)
+	return links
+}
+
+func sortInvalidLinks(links []InvalidLink) {
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Page != links[j].Page {
+			return links[i].Page < links[j].Page
+		}
+		return links[i].Href < links[j].Href
+	})
+}
@@ -0,0 +1,60 @@
+package crawl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLenientHref(t *testing.T) {
+	cases := []struct {
+		href, want, fix string
+	}{
+		{"/foo", "/foo", ""},
+		{"/fo o", "/fo o", ""},
+		{" /foo\n", "/foo", "removed tabs and newlines, trimmed whitespace"},
+		{"/foo\n/bar", "/foo/bar", "removed tabs and newlines"},
+		{"/100%", "/100%25", "escaped stray %"},
+		{"/a%2Fb%zz", "/a%2Fb%25zz", "escaped stray %"},
+	}
+	for _, tc := range cases {
+		got, fix := lenientHref(tc.href)
+		if got != tc.want || fix != tc.fix {
+			t.Errorf("lenientHref(%q) = %q, %q, want %q, %q", tc.href, got, fix, tc.want, tc.fix)
+		}
+	}
+}
+
+func TestInvalidLinks(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com": {"http://exa mple.com/foo", "/foo\n", "/bar%zz", "/ok"},
+	}
+	c := NewCrawler(1)
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	want := []InvalidLink{
+		{Page: "https://monzo.com/", Href: "/bar%zz", Err: `parse "/bar%zz": invalid URL escape "%zz"`, Fix: "escaped stray %"},
+		{Page: "https://monzo.com/", Href: "/foo\n", Err: `parse "/foo\n": net/url: invalid control character in URL`, Fix: "removed tabs and newlines"},
+		{Page: "https://monzo.com/", Href: "http://exa mple.com/foo", Err: `parse "http://exa mple.com/foo": invalid character " " in host name`},
+	}
+	if diff := cmp.Diff(want, InvalidLinks(results)); diff != "" {
+		t.Errorf("InvalidLinks() mismatch (-want +got):\n%s", diff)
+	}
+	if n := c.Stats().InvalidLinks; n != 3 {
+		t.Errorf("Stats().InvalidLinks = %d, want 3", n)
+	}
+
+	// Repaired links are still crawled.
+	var crawled []string
+	for _, r := range results {
+		crawled = append(crawled, r.URL)
+	}
+	wantCrawled := []string{"https://monzo.com/", "https://monzo.com/bar%25zz", "https://monzo.com/foo", "https://monzo.com/ok"}
+	if diff := cmp.Diff(wantCrawled, crawled); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+}
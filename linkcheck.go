@@ -0,0 +1,166 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// CheckedLinks returns the links checked by the crawl currently being run
+// by this Crawler, or by the last one if it has finished, as recorded with
+// WithLinkCheck, sorted by URL. External links are only checked once the
+// crawl is over, so are missing until then. Use LinkCheck.Broken to pick
+// out the broken ones. As with Stats, it is safe to call concurrently with
+// Crawl.
+func (c Crawler) CheckedLinks() []LinkCheck {
+	return c.counters.links.report()
+}
+
+// linkChecks hold the links recorded for CheckedLinks: every link found on
+// the crawl's pages, with the pages linking to it, by the key it is
+// deduplicated with, as by CheckPages, and the outcome of fetching each of
+// the crawl's pages, by visit key. Being maps, they are guarded by a mutex.
+type linkChecks struct {
+	mu       sync.Mutex
+	links    map[string]*LinkCheck
+	outcomes map[string]linkOutcome
+	// checked are the links once the crawl is over and the external ones
+	// have been checked.
+	checked []LinkCheck
+}
+
+// linkOutcome is what became of fetching a page of the crawl, for the
+// links to it.
+type linkOutcome struct {
+	status           int
+	err              error
+	accessControlled bool
+}
+
+func (l *linkChecks) reset() {
+	l.mu.Lock()
+	l.links, l.outcomes, l.checked = nil, nil, nil
+	l.mu.Unlock()
+}
+
+// refer records that a page links to a link, internal or external, that
+// passed through the filters as far as st.
+func (l *linkChecks) refer(c Crawler, st *linkState, internal bool, page string) {
+	if st.link == nil || st.link.Scheme != "http" && st.link.Scheme != "https" {
+		return
+	}
+	key := st.link.String()
+	if internal {
+		key = c.visitKey(st.link)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.links == nil {
+		l.links = make(map[string]*LinkCheck)
+	}
+	lc, ok := l.links[key]
+	if !ok {
+		lc = &LinkCheck{URL: st.link.String(), External: !internal}
+		l.links[key] = lc
+	}
+	if n := len(lc.Pages); n == 0 || lc.Pages[n-1] != page {
+		lc.Pages = append(lc.Pages, page)
+	}
+}
+
+// fetched records the outcome of fetching a page, under the visit keys of
+// its URL and, unless they have outcomes of their own, those its redirects
+// led through and to.
+func (l *linkChecks) fetched(c Crawler, page Result) {
+	outcome := linkOutcome{status: page.StatusCode, err: page.Err, accessControlled: page.AccessControlled}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.outcomes == nil {
+		l.outcomes = make(map[string]linkOutcome)
+	}
+	if u, err := url.Parse(page.URL); err == nil {
+		l.outcomes[c.visitKey(normalize(u))] = outcome
+	}
+	for _, addr := range append(page.RedirectChain, page.FinalURL) {
+		u, err := url.Parse(addr)
+		if err != nil || addr == "" {
+			continue
+		}
+		if key := c.visitKey(normalize(u)); !hasOutcome(l.outcomes, key) {
+			l.outcomes[key] = outcome
+		}
+	}
+}
+
+func hasOutcome(m map[string]linkOutcome, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func (l *linkChecks) report() []LinkCheck {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.checked != nil {
+		return append([]LinkCheck(nil), l.checked...)
+	}
+	links, _ := l.split()
+	sortLinkChecks(links)
+	return links
+}
+
+// split returns the internal links whose targets have been fetched, with
+// the outcomes, and the external links, unchecked. l.mu must be held.
+func (l *linkChecks) split() (internal, external []LinkCheck) {
+	for key, lc := range l.links {
+		if lc.External {
+			e := *lc
+			e.Pages = append([]string(nil), lc.Pages...)
+			external = append(external, e)
+		} else if o, ok := l.outcomes[key]; ok {
+			internal = append(internal, o.check(*lc))
+		}
+	}
+	return internal, external
+}
+
+// check returns lc with the outcome of fetching its target.
+func (o linkOutcome) check(lc LinkCheck) LinkCheck {
+	lc.Pages = append([]string(nil), lc.Pages...)
+	sort.Strings(lc.Pages)
+	lc.StatusCode, lc.AccessControlled = o.status, o.accessControlled
+	if o.err != nil {
+		lc.Err, lc.Disallowed = o.err.Error(), errors.Is(o.err, ErrDisallowed)
+	}
+	return lc
+}
+
+func sortLinkChecks(links []LinkCheck) {
+	sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+}
+
+// checkLinks finishes the checks of the crawl's links, with WithLinkCheck.
+// Internal links take the outcomes of fetching their targets, and those
+// the crawl didn't fetch, because of WithMaxDepth or WithMaxPages, aren't
+// checked. External links are checked with a HEAD request each, by as many
+// fetchers as the crawler has.
+func (c Crawler) checkLinks(ctx context.Context) {
+	l := &c.counters.links
+	l.mu.Lock()
+	links, external := l.split()
+	l.mu.Unlock()
+
+	c.parallel(len(external), func(i int) {
+		sort.Strings(external[i].Pages)
+		c.checkLink(ctx, &external[i])
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	links = append(links, external...)
+	sortLinkChecks(links)
+	l.mu.Lock()
+	l.checked = links
+	l.mu.Unlock()
+}
@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Warning describes a problem found with a page that did not prevent it
+// from being crawled.
+type Warning struct {
+	// Line is the 1-based line of the body the problem was found on, or 0
+	// if unknown.
+	Line int
+	// Offset is the byte offset into the body of the problem, or 0 if
+	// unknown.
+	Offset int
+	Msg    string
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return w.Msg
+	}
+	return fmt.Sprintf("line %d (offset %d): %s", w.Line, w.Offset, w.Msg)
+}
+
+// unquotedHref matches an href attribute whose value is not quoted.
+var unquotedHref = regexp.MustCompile(`(?i)\shref\s*=\s*[^\s"'>]`)
+
+// lint tokenizes an HTML document, looking for markup anomalies that affect
+// link extraction. The parser used by scrape recovers from all of these,
+// but not necessarily in the way a browser (or the page's author) would.
+func lint(body []byte) []Warning {
+	var warnings []Warning
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	// Position of the current token.
+	offset, line := 0, 1
+	// Position of the currently open anchor, if any.
+	var open *Warning
+
+	for {
+		tt := z.Next()
+		raw := z.Raw()
+		at := func(format string, args ...interface{}) {
+			warnings = append(warnings, Warning{Line: line, Offset: offset, Msg: fmt.Sprintf(format, args...)})
+		}
+
+		switch tt {
+		case html.ErrorToken:
+			if len(raw) > 0 {
+				at("unterminated tag at end of document")
+			}
+			if open != nil {
+				open.Msg = "unclosed <a>"
+				warnings = append(warnings, *open)
+			}
+			return warnings
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data != "a" {
+				break
+			}
+			if open != nil {
+				at("nested <a>, the enclosing anchor on line %d is implicitly closed", open.Line)
+			}
+			if tt == html.StartTagToken {
+				open = &Warning{Line: line, Offset: offset}
+			}
+			if unquotedHref.Match(raw) {
+				at("unquoted href attribute")
+			}
+			hrefs := 0
+			for _, a := range tok.Attr {
+				switch {
+				case a.Key == "href":
+					hrefs++
+					if strings.ContainsAny(a.Val, " \t\r\n") {
+						at("href %q contains unescaped whitespace", a.Val)
+					}
+				case strings.ContainsAny(a.Key, `<"'`):
+					at("malformed attribute %q, possibly a missing '>'", a.Key)
+				}
+			}
+			if hrefs > 1 {
+				at("%d href attributes, only the first is used", hrefs)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) != "a" {
+				break
+			}
+			if open == nil {
+				at("stray </a>")
+			}
+			open = nil
+		}
+
+		offset += len(raw)
+		line += bytes.Count(raw, []byte("\n"))
+	}
+}
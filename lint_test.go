@@ -0,0 +1,71 @@
+package crawl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		name string
+		body []byte
+		want []Warning
+	}{
+		{
+			name: "valid anchors",
+			body: []byte(`<p><a href="/foo">foo</a>
+<a href='/bar'>bar</a><a href="/baz"/></p>`),
+			want: nil,
+		},
+		{
+			name: "just broken anchor",
+			body: []byte(`<a href="/no-closing-tag"`),
+			want: []Warning{
+				{Line: 1, Offset: 0, Msg: "unterminated tag at end of document"},
+			},
+		},
+		{
+			name: "unclosed anchor",
+			body: []byte(`<p>
+<a href="/foo">foo</p>`),
+			want: []Warning{
+				{Line: 2, Offset: 4, Msg: "unclosed <a>"},
+			},
+		},
+		{
+			name: "nested anchor",
+			body: []byte(`<a href="/foo"><a href="/bar">to bar</a>to foo</a>`),
+			want: []Warning{
+				{Line: 1, Offset: 15, Msg: "nested <a>, the enclosing anchor on line 1 is implicitly closed"},
+				{Line: 1, Offset: 46, Msg: "stray </a>"},
+			},
+		},
+		{
+			name: "broken anchors",
+			body: []byte(`<a href="/foo"<a href="/bar">to bar</a>to foo</a>`),
+			want: []Warning{
+				{Line: 1, Offset: 0, Msg: `malformed attribute "<a", possibly a missing '>'`},
+				{Line: 1, Offset: 0, Msg: "2 href attributes, only the first is used"},
+				{Line: 1, Offset: 45, Msg: "stray </a>"},
+			},
+		},
+		{
+			name: "bad href values",
+			body: []byte(`<a href=/foo>foo</a>
+<a href="/bar
+baz">bar</a>`),
+			want: []Warning{
+				{Line: 1, Offset: 0, Msg: "unquoted href attribute"},
+				{Line: 2, Offset: 21, Msg: `href "/bar\nbaz" contains unescaped whitespace`},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got := lint(c.body)
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("%s: lint() mismatch (-want +got):\n%s", c.name, diff)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crawl"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// runCheck runs the check command: checking the links on just the pages
+// listed in a file, e.g. those changed by a pull request, without crawling
+// the rest of the site. It returns the exit code.
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	logger := log.New(stderr, "", log.LstdFlags)
+	fs := newFlagSet("check", stderr)
+	urlFile := fs.String("url-file", "", "File listing the pages to check, one URL per line (- for stdin)")
+	jsonOut := fs.Bool("j", false, "Print the links checked as json, rather than just the broken ones")
+	allowedHosts := fs.String("allowed-hosts", "", "Comma separated list of other hosts to check with a GET, as well as each page's own")
+	relativeURLs := fs.Bool("relative-urls", false, "Print URLs on the site of the first page listed as paths relative to its root")
+	var requests requestFlags
+	var client clientFlags
+	var auth authFlags
+	requests.register(fs)
+	client.register(fs)
+	auth.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *urlFile == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitError
+	}
+	pages, err := readURLs(*urlFile)
+	if err != nil {
+		logger.Println(err)
+		return exitFailed
+	}
+
+	opts := append(requests.options(), client.options()...)
+	// Credentials are sent to the hosts of the pages listed, but not to
+	// those they link to.
+	authOpts, err := auth.options(pageHosts(pages)...)
+	if err != nil {
+		logger.Println(err)
+		return exitError
+	}
+	opts = append(opts, authOpts...)
+	if *allowedHosts != "" {
+		opts = append(opts, crawl.WithAllowedHosts(strings.Split(*allowedHosts, ",")...))
+	}
+	c := crawl.NewCrawler(*requests.numFetchers, opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			signal.Stop(interrupt)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	report, err := c.CheckPages(ctx, pages)
+	if err != nil {
+		logger.Println(err)
+		return exitFailed
+	}
+	if *relativeURLs && len(pages) > 0 {
+		rel, err := c.Relativizer(pages[0])
+		if err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		report.Pages, report.Links = rel.Results(report.Pages), rel.LinkChecks(report.Links)
+	}
+	broken := report.Broken()
+	if *jsonOut {
+		if err := json.NewEncoder(stdout).Encode(report.Links); err != nil {
+			logger.Printf("error marshalling links to json: %s", err)
+			return exitFailed
+		}
+	} else {
+		printBroken(stdout, broken)
+	}
+	logger.Printf("checked %d pages and %d links: %d broken", len(report.Pages), len(report.Links), len(broken))
+	if len(broken) > 0 {
+		return exitBroken
+	}
+	return exitOK
+}
+
+// readURLs reads a list of URLs, one per line, skipping blank lines and
+// those starting with #.
+func readURLs(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening url file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var urls []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error reading url file: %w", err)
+	}
+	return urls, nil
+}
+
+// pageHosts returns the distinct hosts of pages, skipping any that can't be
+// parsed, which fail when checked.
+func pageHosts(pages []string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, p := range pages {
+		u, err := url.Parse(p)
+		if err != nil || u.Host == "" || seen[u.Host] {
+			continue
+		}
+		seen[u.Host] = true
+		hosts = append(hosts, u.Host)
+	}
+	return hosts
+}
+
+// printBroken prints each broken link, with the pages linking to it. Links
+// to pages that are gone (410) are labelled so, as they were removed on
+// purpose, so the links should be removed rather than the pages restored.
+func printBroken(w io.Writer, broken []crawl.LinkCheck) {
+	for _, l := range broken {
+		if crawl.ClassifyStatus(l.StatusCode) == crawl.ClassGone {
+			fmt.Fprintf(w, "%s\tgone, intentionally removed: %s\n", l.URL, l.Err)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", l.URL, l.Err)
+		}
+		for _, p := range l.Pages {
+			fmt.Fprintf(w, "\tlinked from %s\n", p)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"crawl"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The flags are grouped by what they configure, so commands can share them:
+// each group registers its flags on a command's flag set, and turns their
+// values into crawler options once parsed.
+
+// scopeFlags decide which pages are part of the crawled site.
+type scopeFlags struct {
+	coalesceWWW    *bool
+	aliases        *string
+	canonicalHost  *bool
+	literalScope   *bool
+	allowedHosts   *string
+	hosts          listFlag
+	subdomains     *bool
+	safeExclusions *bool
+	withoutRules   listFlag
+	exclude        listFlag
+	include        listFlag
+	dirIndex       *bool
+	indexDocs      *string
+	extraAttrs     *string
+	assets         *string
+	speculative    *bool
+	detectSessions *bool
+	sessionRules   sessionRuleFlag
+	seedFrom       *string
+}
+
+func (f *scopeFlags) register(fs *flag.FlagSet) {
+	f.coalesceWWW = fs.Bool("coalesce-www", false, "Treat apex and www. hosts as the same site")
+	f.aliases = fs.String("aliases", "", "Comma separated list of hosts to treat as the same site as the starting URL")
+	f.canonicalHost = fs.Bool("canonical-host", false, "Fetch pages on aliased hosts from the starting URL's host")
+	f.literalScope = fs.Bool("literal-scope", false, "Scope the crawl to the starting URL's host, even if it redirects to another")
+	f.allowedHosts = fs.String("allowed-hosts", "", "Comma separated list of other hosts to crawl, as well as the starting URL's")
+	fs.Var(&f.hosts, "host", "Another host to crawl, as well as the starting URL's (repeatable)")
+	f.subdomains = fs.Bool("subdomains", false, "Crawl every subdomain of the starting URL's domain, e.g. community.example.com when crawling example.com")
+	f.safeExclusions = fs.Bool("safe-exclusions", false, "Skip links that change state when fetched, such as logging out or adding to a cart, and endless views such as calendars and print pages")
+	fs.Var(&f.withoutRules, "without-exclusion", "Name of a -safe-exclusions rule not to apply: logout, delete, add-to-cart, print or calendar (repeatable)")
+	fs.Var(&f.exclude, "exclude", "Regular expression of links not to crawl, matched against the whole link, e.g. /calendar/ (repeatable)")
+	fs.Var(&f.include, "include", "Regular expression of links to crawl, matched against the whole link, e.g. ^https://example.com/docs/; others are only recorded (repeatable)")
+	f.dirIndex = fs.Bool("dir-index", false, "Treat directory paths with and without a trailing slash as the same page")
+	f.indexDocs = fs.String("index-docs", "", "Comma separated index documents, e.g. index.html, to treat as their directory's page (implies -dir-index)")
+	f.extraAttrs = fs.String("extra-attrs", "", "Comma separated element:attribute pairs to collect speculative links from, e.g. a:data-href,img:data-src")
+	f.assets = fs.String("assets", "", "Comma separated element:attribute pairs to record assets from, e.g. img:src,script:src, or \"default\" for link:href,area:href,iframe:src,frame:src; assets are never crawled")
+	f.speculative = fs.Bool("speculative", false, "Crawl speculative links, as well as recording them")
+	f.detectSessions = fs.Bool("detect-sessions", false, "Infer session IDs in URL paths from pages that only differ by them, and stop crawling further variants")
+	f.seedFrom = fs.String("seed-from", "", "Also start from the pages fetched successfully by the crawl whose results, as written with -j, -stream -j or -report, are in `file`; those now out of scope or excluded are skipped")
+	fs.Var(&f.sessionRules, "session-rule", "Path segment to collapse as a session ID, as host/path with * for the segment, e.g. example.com/browse/*/shoes (repeatable)")
+}
+
+// options returns the crawler options for the flags, for a crawl starting
+// on host.
+func (f *scopeFlags) options(host string) ([]crawl.Option, error) {
+	opts := []crawl.Option{
+		crawl.WithCoalesceWWW(*f.coalesceWWW),
+		crawl.WithCanonicalHost(*f.canonicalHost),
+		crawl.WithLiteralScope(*f.literalScope),
+		crawl.WithIncludeSubdomains(*f.subdomains),
+		crawl.WithSafeExclusions(*f.safeExclusions),
+		crawl.WithSpeculativeLinks(*f.speculative),
+	}
+	if len(f.sessionRules) > 0 {
+		opts = append(opts, crawl.WithSessionRules(f.sessionRules...))
+	}
+	if *f.detectSessions {
+		opts = append(opts, crawl.WithSessionDetection(crawl.DefaultSessionThresholds))
+	}
+	if *f.extraAttrs != "" {
+		attrs, err := parseAttrs(*f.extraAttrs)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, crawl.WithExtraLinkAttributes(attrs))
+	}
+	if *f.assets == "default" {
+		opts = append(opts, crawl.WithAssets(crawl.DefaultAssetAttributes))
+	} else if *f.assets != "" {
+		attrs, err := parseAttrs(*f.assets)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, crawl.WithAssets(attrs))
+	}
+	if *f.indexDocs != "" {
+		opts = append(opts, crawl.WithDirectoryIndex(strings.Split(*f.indexDocs, ",")...))
+	} else if *f.dirIndex {
+		opts = append(opts, crawl.WithDirectoryIndex())
+	}
+	if *f.allowedHosts != "" {
+		opts = append(opts, crawl.WithAllowedHosts(strings.Split(*f.allowedHosts, ",")...))
+	}
+	if len(f.hosts) > 0 {
+		opts = append(opts, crawl.WithAllowedHosts(f.hosts...))
+	}
+	if len(f.exclude) > 0 {
+		opts = append(opts, crawl.WithExcludePatterns(f.exclude...))
+	}
+	if len(f.include) > 0 {
+		opts = append(opts, crawl.WithIncludePatterns(f.include...))
+	}
+	if len(f.withoutRules) > 0 {
+		opts = append(opts, crawl.WithoutExclusions(f.withoutRules...))
+	}
+	if *f.aliases != "" {
+		hosts := append([]string{host}, strings.Split(*f.aliases, ",")...)
+		opts = append(opts, crawl.WithHostAliases(hosts...))
+	}
+	if *f.seedFrom != "" {
+		seeds, err := readSeeds(*f.seedFrom)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, crawl.WithSeeds(seeds...))
+	}
+	return opts, nil
+}
+
+// readSeeds returns the seeds in the results file name.
+func readSeeds(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seeds: %w", err)
+	}
+	defer file.Close()
+	seeds, err := crawl.SeedsFromResults(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seeds from %s: %w", name, err)
+	}
+	return seeds, nil
+}
+
+// limitFlags bound how much of the site a crawl covers, and how much it may
+// go wrong before giving up.
+type limitFlags struct {
+	maxDepth        *int
+	maxPages        *int
+	maxLinks        *int
+	maxBody         *int64
+	truncateBodies  *bool
+	redirectBudget  *int
+	abortErrorRate  *float64
+	abortMinSamples *int
+	failFast        *bool
+	window          *string
+	linkSpill       *int
+	linkSpillFile   *string
+}
+
+func (f *limitFlags) register(fs *flag.FlagSet) {
+	f.maxDepth = fs.Int("depth", -1, "Maximum number of links to follow from the starting URL (0 for just the starting URL, -1 for no limit)")
+	f.maxPages = fs.Int("max-pages", 0, "Stop the crawl after fetching this many pages (0 for no limit)")
+	f.maxLinks = fs.Int("max-links", 0, "Maximum number of links collected from each page (0 for no limit); pages over it are reported to stderr")
+	f.maxBody = fs.Int64("max-body", crawl.DefaultMaxBodySize, "Maximum bytes of each page's body read, after decompression; longer pages fail, unless -truncate-bodies is set")
+	f.truncateBodies = fs.Bool("truncate-bodies", false, "Scrape the first -max-body bytes of longer pages, rather than failing them")
+	f.redirectBudget = fs.Int("redirect-budget", 0, "Warn when the crawl follows more than this many redirects in total (0 for no budget)")
+	f.abortErrorRate = fs.Float64("abort-error-rate", 0, "Abort the crawl when more than this fraction of pages fail, e.g. 0.5 (0 to never abort)")
+	f.abortMinSamples = fs.Int("abort-min-pages", 50, "Number of pages to fetch before -abort-error-rate applies")
+	f.failFast = fs.Bool("fail-fast", false, "Crash on a panic fetching or scraping a page, rather than recording it as the page's error and carrying on")
+	f.linkSpill = fs.Int("link-spill", 0, "Keep only this many links in the results of pages with more, to bound memory, writing their full results to -link-spill-file (0 to keep every link)")
+	f.linkSpillFile = fs.String("link-spill-file", "", "File to write the full results of pages with more than -link-spill links to, as a json object per line")
+	f.window = fs.String("window", "", "Only crawl during this time of day, as start-end and a time zone, e.g. \"22:00-06:00 Europe/London\"")
+}
+
+func (f *limitFlags) options() ([]crawl.Option, error) {
+	opts := []crawl.Option{
+		crawl.WithFailFastOnPanic(*f.failFast),
+		crawl.WithMaxBodySize(*f.maxBody, *f.truncateBodies),
+	}
+	if *f.maxDepth >= 0 {
+		opts = append(opts, crawl.WithMaxDepth(*f.maxDepth))
+	}
+	if *f.maxPages > 0 {
+		opts = append(opts, crawl.WithMaxPages(*f.maxPages))
+	}
+	if *f.maxLinks > 0 {
+		opts = append(opts, crawl.WithMaxLinksPerPage(*f.maxLinks))
+	}
+	if *f.redirectBudget > 0 {
+		opts = append(opts, crawl.WithRedirectBudget(*f.redirectBudget))
+	}
+	if *f.abortErrorRate > 0 {
+		opts = append(opts, crawl.WithErrorRateAbort(*f.abortErrorRate, *f.abortMinSamples))
+	}
+	if *f.window != "" {
+		start, end, loc, err := parseWindow(*f.window)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, crawl.WithCrawlWindow(start, end, loc))
+	}
+	return opts, nil
+}
+
+// requestFlags configure how each request is made: how many at once, how
+// long they may take, and how they are retried.
+type requestFlags struct {
+	numFetchers      *int
+	maxSockets       *int
+	clampFDs         *bool
+	dnsPrefetch      *bool
+	delay            *time.Duration
+	timeout          *time.Duration
+	timeoutOverrides timeoutOverrideFlag
+	attempts         *int
+	retryBackoff     *time.Duration
+	maxRedirects     *int
+	noFollow         *bool
+	acceptStatuses   acceptStatusFlag
+}
+
+func (f *requestFlags) register(fs *flag.FlagSet) {
+	f.numFetchers = fs.Int("c", 25, "Number of concurrently operating HTTP fetchers")
+	f.maxSockets = fs.Int("max-sockets", 0, "Maximum number of connections open at once (0 for no limit)")
+	f.clampFDs = fs.Bool("clamp-fds", false, "Reduce concurrency to fit the open file limit, rather than just warning")
+	f.dnsPrefetch = fs.Bool("dns-prefetch", false, "Look up the DNS of newly found hosts in the background, before they are fetched")
+	f.delay = fs.Duration("delay", 0, "Minimum time between requests to the same host, e.g. 500ms")
+	f.timeout = fs.Duration("timeout", 0, "Maximum time for each request, including reading the body, e.g. 10s (0 for the default of 30s)")
+	fs.Var(&f.timeoutOverrides, "timeout-override", "Timeout for URLs matching a pattern, as pattern=duration (repeatable, first match wins)")
+	f.attempts = fs.Int("attempts", 1, "Maximum number of requests made for each page, retrying network errors, 429s and 5xx responses")
+	f.retryBackoff = fs.Duration("retry-backoff", 500*time.Millisecond, "Wait before the first retry, doubled for each further one")
+	f.maxRedirects = fs.Int("max-redirects", 10, "Maximum number of redirects followed per request")
+	fs.Var(&f.acceptStatuses, "accept-status", "Statuses to treat as reachable but access controlled, rather than broken, for paths starting with a prefix, as statuses:prefix, e.g. 401:/account/ or 401,403:/admin/ (repeatable)")
+	f.noFollow = fs.Bool("no-follow-redirects", false, "Don't follow redirects: report each with its status and Location, and crawl its target as a link")
+}
+
+func (f *requestFlags) options() []crawl.Option {
+	opts := []crawl.Option{
+		crawl.WithMaxSockets(*f.maxSockets),
+		crawl.WithDNSPrefetch(*f.dnsPrefetch),
+		crawl.WithFileLimitClamp(*f.clampFDs),
+		crawl.WithMaxRedirects(*f.maxRedirects),
+		crawl.WithFollowRedirects(!*f.noFollow),
+		crawl.WithDelay(*f.delay),
+	}
+	opts = append(opts, f.timeoutOverrides...)
+	opts = append(opts, f.acceptStatuses...)
+	if *f.timeout > 0 {
+		opts = append(opts, crawl.WithRequestTimeout(*f.timeout))
+	}
+	if *f.attempts > 1 {
+		opts = append(opts, crawl.WithRetries(*f.attempts, *f.retryBackoff))
+	}
+	return opts
+}
+
+// clientFlags configure how the crawler presents itself to the site, and
+// how it reads the pages served.
+type clientFlags struct {
+	userAgent         *string
+	hostHeaders       hostHeaderFlag
+	noRobots          *bool
+	strictHTML        *bool
+	strictContentType *bool
+	skipNonHTML       *bool
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	f.userAgent = fs.String("user-agent", crawl.DefaultUserAgent, "User-Agent header to send, whose product token robots.txt rules are matched against")
+	fs.Var(&f.hostHeaders, "host-header", "Header to send to a host, which may be *.domain for its subdomains, as host=Name: value, e.g. 'docs.example.com=X-Token: abc' (repeatable; a User-Agent header replaces -user-agent)")
+	f.noRobots = fs.Bool("no-robots", false, "Ignore robots.txt, e.g. when crawling your own site")
+	f.strictHTML = fs.Bool("strict", false, "Report markup problems affecting link extraction as per-page warnings")
+	f.strictContentType = fs.Bool("strict-content-type", false, "Only scrape pages served as HTML, rather than also those served as plain text that sniff as HTML")
+	f.skipNonHTML = fs.Bool("skip-non-html", false, "Only download and scrape the bodies of pages that are HTML, or sniff as HTML, e.g. skipping images and PDFs")
+}
+
+func (f *clientFlags) options() []crawl.Option {
+	opts := []crawl.Option{
+		crawl.WithUserAgent(*f.userAgent),
+		crawl.WithIgnoreRobots(*f.noRobots),
+		crawl.WithStrictHTML(*f.strictHTML),
+		crawl.WithStrictContentType(*f.strictContentType),
+		crawl.WithSkipNonHTML(*f.skipNonHTML),
+	}
+	return append(opts, f.hostHeaders...)
+}
+
+// authFlags give the credentials to send to the site. They are only sent to
+// the hosts given to options, and so never leak to other sites linked to.
+type authFlags struct {
+	basicAuth   *string
+	bearerToken *string
+	cookies     listFlag
+}
+
+func (f *authFlags) register(fs *flag.FlagSet) {
+	f.basicAuth = fs.String("basic-auth", "", "Username and password to log in to the site with HTTP basic auth, as user:password")
+	f.bearerToken = fs.String("bearer-token", "", "Token to send to the site in an Authorization: Bearer header")
+	fs.Var(&f.cookies, "cookie", "Cookie to send to the site, as name=value, e.g. a session cookie copied from a browser (repeatable)")
+}
+
+// options returns the crawler options sending the credentials to hosts.
+func (f *authFlags) options(hosts ...string) ([]crawl.Option, error) {
+	headers := make(map[string]string)
+	if *f.basicAuth != "" {
+		if !strings.Contains(*f.basicAuth, ":") {
+			return nil, fmt.Errorf("-basic-auth is not of the form user:password")
+		}
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(*f.basicAuth))
+	}
+	if *f.bearerToken != "" {
+		if *f.basicAuth != "" {
+			return nil, fmt.Errorf("-basic-auth and -bearer-token can't both be used")
+		}
+		headers["Authorization"] = "Bearer " + *f.bearerToken
+	}
+	for _, c := range f.cookies {
+		if !strings.Contains(c, "=") {
+			return nil, fmt.Errorf("-cookie %q is not of the form name=value", c)
+		}
+	}
+	if len(f.cookies) > 0 {
+		headers["Cookie"] = strings.Join(f.cookies, "; ")
+	}
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	var opts []crawl.Option
+	for _, host := range hosts {
+		opts = append(opts, crawl.WithHostHeaders(host, headers))
+	}
+	return opts, nil
+}
+
+// outputFlags choose what a crawl prints: its results, in one of several
+// forms, or one of the reports on them instead.
+type outputFlags struct {
+	jsonOut           *bool
+	report            *bool
+	stream            *bool
+	sortBy            *string
+	stats             *bool
+	progress          *bool
+	progressFile      *string
+	progressInterval  *time.Duration
+	relativeURLs      *bool
+	timings           *bool
+	hosts             *bool
+	sections          *int
+	breadcrumbs       *int
+	anomalies         *int
+	statuses          *bool
+	encodings         *bool
+	compressionReport *bool
+	tlsReport         *bool
+	tlsMin            *string
+	linkHygiene       *int
+	excludedLinks     *int
+	pageGroups        *bool
+	cacheReport       *bool
+	check             *bool
+	urlTemplates      listFlag
+	linkTargets       *bool
+	onlyHTML          *bool
+	summaryOut        *string
+	summaryPrevious   *string
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	f.jsonOut = fs.Bool("j", false, "Return results as json formatted string")
+	f.report = fs.Bool("report", false, "Return a json crawl report: the results along with the configuration that produced them")
+	f.stream = fs.Bool("stream", false, "Print each result as soon as it is fetched, rather than all of them sorted once the crawl finishes; with -j, as a json object per line")
+	f.sortBy = fs.String("sort", "url", "Order of the results: url, depth, status or discovered")
+	f.stats = fs.Bool("stats", false, "Print a summary of page fetches to stderr after crawling, or with -j, every request's stats as JSON")
+	f.progress = fs.Bool("progress", false, "Print a status line to stderr every second while crawling")
+	f.progressFile = fs.String("progress-file", "", "Rewrite a json checkpoint of the crawl's progress to this file every -progress-interval while crawling, for health checks; it holds the time it was written, so a stale one means the crawl is stuck")
+	f.progressInterval = fs.Duration("progress-interval", 10*time.Second, "How often to rewrite the -progress-file")
+	f.relativeURLs = fs.Bool("relative-urls", false, "Print URLs on the crawled site as paths relative to its root, for comparing crawls of different hosts")
+	f.timings = fs.Bool("timings", false, "Add the time each page took to fetch, and the bytes of its body read, to the text output")
+	f.hosts = fs.Bool("hosts", false, "Print a summary of the crawl by host, instead of the results")
+	f.sections = fs.Int("sections", 0, "Print a summary of the crawl by the first # path segments, instead of the results")
+	f.breadcrumbs = fs.Int("breadcrumbs", -1, "Print pages whose breadcrumb trail depth differs from their crawl depth by more than #, instead of the results")
+	f.anomalies = fs.Int("anomalies", 0, "Print directories, by the first # path segments, serving unusual mixes of content types or status codes, instead of the results")
+	f.statuses = fs.Bool("statuses", false, "Print the number of pages with each class of response status, instead of the results")
+	f.encodings = fs.Bool("encodings", false, "Print the number of pages served with each HTTP version and content encoding, instead of the results")
+	f.compressionReport = fs.Bool("compression-report", false, "Print the bytes transferred and compression ratio for each content type, and the largest pages served uncompressed, instead of the results")
+	f.tlsReport = fs.Bool("tls-report", false, "Print the TLS versions and cipher suites negotiated with each host, weak ones first, instead of the results")
+	f.tlsMin = fs.String("tls-min", "TLS 1.2", "Lowest TLS version not reported as weak by -tls-report, e.g. \"TLS 1.2\"")
+	f.linkTargets = fs.Bool("link-targets", false, "Record in each result what became of the target of each of its internal links: fetched, with its status, skipped or not fetched")
+	f.onlyHTML = fs.Bool("only-html", false, "Only output the results for HTML pages, and those that failed; other pages are still crawled, and counted in -stats")
+	f.summaryOut = fs.String("summary-out", "", "Write a short text summary of the crawl to `file`, e.g. for posting to a chat channel, as well as the output asked for")
+	f.summaryPrevious = fs.String("summary-previous", "", "Count the pages new and removed since the crawl whose -report is in `file`, in the -summary-out summary")
+	f.linkHygiene = fs.Int("link-hygiene", 0, "Print the # URLs linked to in the most inconsistent forms, instead of the results")
+	f.pageGroups = fs.Bool("page-groups", false, "Print the number of pages, error rate, mean size and mean latency of each group of pages by URL template, instead of the results")
+	fs.Var(&f.urlTemplates, "url-template", "Template to group pages by, with {name} for any one path segment, e.g. /blog/{yyyy}/{mm}/{slug}; pages matching none are grouped by their paths, with numbers and UUIDs replaced (repeatable)")
+	f.check = fs.Bool("check", false, "Check every link found, including those off the site with a HEAD request, and print the broken ones with the pages linking to them, instead of the results, or with -j, every link checked as json; exits with status 4 if any are broken")
+	f.cacheReport = fs.Bool("cache-report", false, "Print the caching headers the pages were served with, the groups of pages cached inconsistently, and the pages no CDN can cache, instead of the results")
+	f.excludedLinks = fs.Int("excluded-links", 0, "Print the links not crawled because they matched an exclusion rule or -exclude pattern, with up to # of the pages linking to each, instead of the results")
+}
+
+func (f *outputFlags) options() ([]crawl.Option, error) {
+	order, ok := resultOrders[*f.sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown -sort order %q", *f.sortBy)
+	}
+	opts := []crawl.Option{
+		crawl.WithResultOrder(order),
+		crawl.WithBreadcrumbs(*f.breadcrumbs >= 0),
+		crawl.WithLinkTargets(*f.linkTargets),
+		crawl.WithLinkCheck(*f.check),
+	}
+	if *f.pageGroups || len(f.urlTemplates) > 0 {
+		opts = append(opts, crawl.WithURLTemplates(f.urlTemplates...))
+	}
+	if *f.cacheReport {
+		opts = append(opts, crawl.WithHeaderCapture(crawl.CacheHeaders...))
+	}
+	if *f.excludedLinks > 0 {
+		opts = append(opts, crawl.WithExcludedLinks(maxExcludedTargets, *f.excludedLinks))
+	}
+	if *f.progressFile != "" {
+		opts = append(opts, crawl.WithProgressFile(*f.progressFile, *f.progressInterval))
+	}
+	if *f.onlyHTML {
+		opts = append(opts, crawl.WithResultFilter(crawl.OnlyContentTypes("text/html", "application/xhtml+xml")))
+	}
+	return opts, nil
+}
+
+// maxExcludedTargets is the most targets -excluded-links reports, bounding
+// the memory they take.
+const maxExcludedTargets = 10000
+
+// resultOrders are the orders the -sort flag accepts.
+var resultOrders = map[string]func([]crawl.Result){
+	"url":        crawl.SortByURL,
+	"depth":      crawl.SortByDepth,
+	"status":     crawl.SortByStatus,
+	"discovered": crawl.SortByDiscovery,
+}
+
+// timeoutOverrideFlag collects repeated pattern=duration timeout overrides.
+type timeoutOverrideFlag []crawl.Option
+
+func (f *timeoutOverrideFlag) String() string {
+	return fmt.Sprintf("%d overrides", len(*f))
+}
+
+func (f *timeoutOverrideFlag) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return fmt.Errorf("%q is not of the form pattern=duration", s)
+	}
+	pattern, err := regexp.Compile(s[:i])
+	if err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(s[i+1:])
+	if err != nil {
+		return err
+	}
+	*f = append(*f, crawl.WithTimeoutOverride(pattern, d))
+	return nil
+}
+
+// acceptStatusFlag collects repeated acceptable statuses, as options.
+type acceptStatusFlag []crawl.Option
+
+func (f *acceptStatusFlag) String() string {
+	return fmt.Sprintf("%d prefixes", len(*f))
+}
+
+func (f *acceptStatusFlag) Set(s string) error {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return fmt.Errorf("%q is not of the form statuses:prefix", s)
+	}
+	var statuses []int
+	for _, field := range strings.Split(s[:i], ",") {
+		status, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || status < 100 || status > 999 {
+			return fmt.Errorf("%q is not an HTTP status", field)
+		}
+		statuses = append(statuses, status)
+	}
+	*f = append(*f, crawl.WithAcceptableStatuses(crawl.AcceptStatusesUnder(s[i+1:], statuses...)))
+	return nil
+}
+
+// listFlag collects repeated values.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty value")
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// sessionRuleFlag collects repeated session rules.
+type sessionRuleFlag []crawl.SessionRule
+
+func (f *sessionRuleFlag) String() string {
+	return fmt.Sprintf("%d rules", len(*f))
+}
+
+func (f *sessionRuleFlag) Set(s string) error {
+	r, err := crawl.ParseSessionRule(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// hostHeaderFlag collects repeated host=Name: value headers.
+type hostHeaderFlag []crawl.Option
+
+func (f *hostHeaderFlag) String() string {
+	return fmt.Sprintf("%d headers", len(*f))
+}
+
+func (f *hostHeaderFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	j := strings.Index(s, ":")
+	if i <= 0 || j < i {
+		return fmt.Errorf("%q is not of the form host=Name: value", s)
+	}
+	host, name, value := s[:i], strings.TrimSpace(s[i+1:j]), strings.TrimSpace(s[j+1:])
+	if strings.EqualFold(name, "User-Agent") {
+		*f = append(*f, crawl.WithHostUserAgent(host, value))
+	} else {
+		*f = append(*f, crawl.WithHostHeaders(host, map[string]string{name: value}))
+	}
+	return nil
+}
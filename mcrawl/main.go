@@ -1,47 +1,1145 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crawl"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// command is one of mcrawl's subcommands.
+type command struct {
+	name    string
+	summary string
+	usage   string
+	// examples are shown in the command's help, after its flags.
+	examples []string
+	// run runs the command with the arguments following its name,
+	// returning the exit code.
+	run func(args []string, stdout, stderr io.Writer) int
+}
+
+// commands are mcrawl's subcommands, in the order they are listed in its
+// help.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:    "crawl",
+			summary: "crawl a site from a starting URL, printing its pages and their links",
+			usage:   "mcrawl crawl [flags] starting_URL",
+			examples: []string{
+				"mcrawl crawl https://monzo.com",
+				"mcrawl crawl -c 10 -delay 100ms -j https://monzo.com > results.json",
+				"mcrawl crawl -statuses -depth 2 https://monzo.com",
+			},
+			run: runCrawl,
+		},
+		{
+			name:    "check",
+			summary: "check the links on just the pages listed in a file, without crawling further",
+			usage:   "mcrawl check -url-file file [flags]",
+			examples: []string{
+				"git diff --name-only | sed 's|^|https://example.com/|' | mcrawl check -url-file -",
+				"mcrawl check -url-file changed.txt -j > links.json",
+			},
+			run: runCheck,
+		},
+		{
+			name:    "explain",
+			summary: "explain each step in deciding whether a crawl would fetch a URL",
+			usage:   "mcrawl explain [flags] starting_URL target_URL",
+			examples: []string{
+				"mcrawl explain -dir-index https://monzo.com https://monzo.com/blog/",
+			},
+			run: runExplain,
+		},
+		// The commands below are planned, and only have their help so
+		// far.
+		{
+			name:    "diff",
+			summary: "compare the results of two crawls, listing the pages added, removed or changed (not implemented yet)",
+			usage:   "mcrawl diff old_results new_results",
+			examples: []string{
+				"mcrawl diff before.json after.json",
+			},
+			run: notImplemented("diff"),
+		},
+		{
+			name:    "report",
+			summary: "print the reports on a crawl from its saved results, without crawling again (not implemented yet)",
+			usage:   "mcrawl report results",
+			examples: []string{
+				"mcrawl report results.json",
+			},
+			run: notImplemented("report"),
+		},
+		{
+			name:    "serve",
+			summary: "run crawls requested over HTTP, serving their progress and results (not implemented yet)",
+			usage:   "mcrawl serve",
+			examples: []string{
+				"mcrawl serve",
+			},
+			run: notImplemented("serve"),
+		},
+		{
+			name:    "ui",
+			summary: "crawl a site, showing its progress in an interactive terminal view (not implemented yet)",
+			usage:   "mcrawl ui starting_URL",
+			examples: []string{
+				"mcrawl ui https://monzo.com",
+			},
+			run: notImplemented("ui"),
+		},
+	}
+}
+
+// notImplemented returns the run func of a planned command, which only
+// prints its help, or that it isn't implemented yet.
+func notImplemented(name string) func(args []string, stdout, stderr io.Writer) int {
+	return func(args []string, stdout, stderr io.Writer) int {
+		fs := newFlagSet(name, stderr)
+		if code, ok := parseFlags(fs, args); !ok {
+			return code
+		}
+		fmt.Fprintf(stderr, "mcrawl %s is not implemented yet\n", name)
+		return exitFailed
+	}
+}
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	numFetchers := flag.Int("c", 25, "Number of concurrently operating HTTP fetchers")
-	jsonOut := flag.Bool("j", false, "Return results as json formatted string")
-	flag.Parse()
+// run runs the subcommand named by the first argument. For compatibility,
+// anything else is taken to be the arguments of the crawl command, so that
+// `mcrawl starting_URL` still crawls.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			if len(args) > 1 {
+				if cmd, ok := lookupCommand(args[1]); ok {
+					return cmd.run([]string{"-h"}, stdout, stdout)
+				}
+			}
+			printUsage(stdout)
+			return exitOK
+		}
+		if cmd, ok := lookupCommand(args[0]); ok {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitError
+	}
+	return runCrawl(args, stdout, stderr)
+}
 
-	if len(flag.Args()) < 1 {
-		log.Fatalln("You must provide a URL to start the crawl")
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
 	}
+	return command{}, false
+}
 
-	u, err := url.Parse(flag.Arg(0))
+// printUsage prints mcrawl's help: its commands, and how to get theirs.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mcrawl command [flags] [arguments]")
+	fmt.Fprintln(w, "   or: mcrawl [flags] starting_URL, as for mcrawl crawl")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nRun mcrawl help command for a command's flags and examples.")
+	fmt.Fprintln(w, "\nexit codes:")
+	for _, e := range exitCodes {
+		fmt.Fprintf(w, "  %d  %s\n", e.code, e.meaning)
+	}
+}
+
+// newFlagSet returns a flag set for the named command, whose help shows its
+// usage, flags and examples.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	cmd, _ := lookupCommand(name)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "usage: %s\n\n%s.\n", cmd.usage, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+		flags := false
+		fs.VisitAll(func(*flag.Flag) { flags = true })
+		if flags {
+			fmt.Fprintln(w, "\nflags:")
+			fs.PrintDefaults()
+		}
+		if len(cmd.examples) > 0 {
+			fmt.Fprintln(w, "\nexamples:")
+			for _, e := range cmd.examples {
+				fmt.Fprintf(w, "  %s\n", e)
+			}
+		}
+	}
+	return fs
+}
+
+// parseFlags parses a command's flags, returning the exit code to stop with
+// if it shouldn't go on: success if help was asked for, or a usage error.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK, false
+	}
 	if err != nil {
-		log.Fatalf("Invalid URL (%s): %s\n", flag.Arg(0), err)
+		return exitError, false
+	}
+	return 0, true
+}
+
+// Exit codes shared by the commands. Each outcome has its own, so scripts
+// such as CI jobs can tell broken links from a crawl that couldn't run.
+const (
+	exitOK = 0
+	// exitFailed is the exit code when a command can't be run, or its
+	// output written.
+	exitFailed = 1
+	// exitError is the exit code for invalid flags or arguments.
+	exitError = 2
+	// exitErrorRate is the exit code when the crawl is aborted by
+	// -abort-error-rate, so scripts can tell a misconfigured crawl from
+	// others.
+	exitErrorRate = 3
+	// exitBroken is the exit code when the check command or -check find
+	// broken links.
+	exitBroken = 4
+)
+
+// exitCodes are the exit codes listed in mcrawl's help, with their meaning.
+var exitCodes = []struct {
+	code    int
+	meaning string
+}{
+	{exitOK, "success"},
+	{exitFailed, "the command couldn't be run, or its output written"},
+	{exitError, "invalid flags or arguments"},
+	{exitErrorRate, "the crawl was aborted by -abort-error-rate"},
+	{exitBroken, "broken links were found by check or -check"},
+}
+
+// crawlFlags are the flag groups of the crawl and explain commands.
+type crawlFlags struct {
+	scope    scopeFlags
+	limits   limitFlags
+	requests requestFlags
+	client   clientFlags
+	auth     authFlags
+	output   outputFlags
+}
+
+func (f *crawlFlags) register(fs *flag.FlagSet) {
+	f.scope.register(fs)
+	f.limits.register(fs)
+	f.requests.register(fs)
+	f.client.register(fs)
+	f.auth.register(fs)
+	f.output.register(fs)
+}
+
+// newCrawler returns the crawler configured by the flags, for a crawl
+// starting at u.
+func (f *crawlFlags) newCrawler(u *url.URL, extra ...crawl.Option) (crawl.Crawler, error) {
+	opts := f.requests.options()
+	opts = append(opts, f.client.options()...)
+	for _, group := range []func() ([]crawl.Option, error){
+		func() ([]crawl.Option, error) { return f.scope.options(u.Host) },
+		func() ([]crawl.Option, error) { return f.auth.options(u.Host) },
+		f.limits.options,
+		f.output.options,
+	} {
+		o, err := group()
+		if err != nil {
+			return crawl.Crawler{}, err
+		}
+		opts = append(opts, o...)
 	}
+	opts = append(opts, extra...)
+	return crawl.NewCrawler(*f.requests.numFetchers, opts...), nil
+}
 
-	results, err := crawl.NewCrawler(*numFetchers).Crawl(u.String())
+// runExplain runs the explain command, printing each step in deciding
+// whether the target URL would be crawled.
+func runExplain(args []string, stdout, stderr io.Writer) int {
+	return crawlCommand("explain", args, stdout, stderr)
+}
+
+// runCrawl runs the crawl command. For compatibility, it runs the explain
+// command if its arguments are "explain starting_URL target_URL".
+func runCrawl(args []string, stdout, stderr io.Writer) int {
+	return crawlCommand("crawl", args, stdout, stderr)
+}
+
+func crawlCommand(name string, args []string, stdout, stderr io.Writer) int {
+	logger := log.New(stderr, "", log.LstdFlags)
+	fs := newFlagSet(name, stderr)
+	var flags crawlFlags
+	flags.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
 
+	args = fs.Args()
+	explain := name == "explain"
+	if !explain && len(args) > 0 && args[0] == "explain" {
+		explain, args = true, args[1:]
+	}
+	if explain && len(args) != 2 {
+		fmt.Fprintln(stderr, "usage: mcrawl explain [flags] starting_URL target_URL")
+		return exitError
+	}
+	if len(args) != 1 && !explain {
+		fmt.Fprintln(stderr, "You must provide a URL to start the crawl")
+		return exitError
+	}
+
+	u, err := url.Parse(args[0])
 	if err != nil {
-		log.Fatalln(err)
+		logger.Printf("Invalid URL (%s): %s\n", args[0], err)
+		return exitFailed
+	}
+	var extra []crawl.Option
+	if *flags.output.progress && !explain {
+		extra = append(extra, crawl.WithProgress(time.Second, printProgress(stderr)))
+	}
+	if *flags.limits.linkSpill > 0 && !explain {
+		if *flags.limits.linkSpillFile == "" {
+			fmt.Fprintln(stderr, "-link-spill needs a -link-spill-file to write the full results to")
+			return exitError
+		}
+		spill, closeSpill, err := spillTo(*flags.limits.linkSpillFile, logger)
+		if err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		defer func() {
+			if err := closeSpill(); err != nil {
+				logger.Println(err)
+			}
+		}()
+		extra = append(extra, crawl.WithLinkSpill(*flags.limits.linkSpill, spill))
+	}
+	c, err := flags.newCrawler(u, extra...)
+	if err != nil {
+		logger.Println(err)
+		return exitFailed
 	}
 
-	if *jsonOut {
-		j, err := json.Marshal(results)
+	if explain {
+		decisions, err := c.Explain(u.String(), args[1])
 		if err != nil {
-			log.Printf("error marshalling results to json")
-			// Let's return the non-json results in this case
-		} else {
-			fmt.Println(string(j))
-			return
+			logger.Println(err)
+			return exitFailed
+		}
+		for _, d := range decisions {
+			fmt.Fprintln(stdout, d)
+		}
+		return exitOK
+	}
+	return doCrawl(c, u, &flags, stdout, stderr, logger)
+}
+
+// spillTo creates the file for -link-spill-file, and returns a sink writing
+// each result passed to it there as a line of json, and a func closing the
+// file once the crawl is done.
+func spillTo(name string, logger *log.Logger) (func(crawl.Result), func() error, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating link spill file: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	sink := func(r crawl.Result) {
+		if err := enc.Encode(r); err != nil {
+			logger.Printf("error writing spilled links of %s: %s", r.URL, err)
+		}
+	}
+	closeFile := func() error {
+		err := bw.Flush()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("error writing link spill file: %w", err)
+		}
+		return nil
+	}
+	return sink, closeFile, nil
+}
+
+// doCrawl runs the crawl, and prints its results, or the report on them
+// asked for by the output flags.
+func doCrawl(c crawl.Crawler, u *url.URL, flags *crawlFlags, stdout, stderr io.Writer, logger *log.Logger) int {
+	out := &flags.output
+
+	// The progress line is printed over, until the crawl ends it.
+	stopProgress := func() {}
+	if *out.progress {
+		stopProgress = func() { fmt.Fprintln(stderr) }
+	}
+
+	// Stop crawling on an interrupt, and output what has been crawled so
+	// far. A second interrupt kills us as usual.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			signal.Stop(interrupt)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// With -relative-urls, URLs on the site are printed relative to its
+	// root, however the results are output.
+	var rel *crawl.Relativizer
+	if *out.relativeURLs {
+		r, err := c.Relativizer(u.String())
+		if err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		rel = &r
+	}
+
+	if *out.stream {
+		code := streamCrawl(ctx, c, u, rel, *out.jsonOut, *out.timings, stdout, logger)
+		stopProgress()
+		if *out.stats {
+			printStats(stderr, logger, c.Stats(), *out.jsonOut)
+		}
+		if *out.check && code == exitOK && ctx.Err() == nil {
+			// The results have been streamed as json, so the broken
+			// links are only counted.
+			if !*out.jsonOut {
+				fmt.Fprintln(stdout, "broken links:")
+			}
+			return reportBroken(stdout, logger, checkedLinks(c, rel), false, *out.jsonOut)
+		}
+		return code
+	}
+
+	results, err := c.CrawlContext(ctx, u.String())
+	stopProgress()
+	if *out.stats {
+		printStats(stderr, logger, c.Stats(), *out.jsonOut)
+	}
+	if *flags.scope.detectSessions {
+		printSessionRules(logger, c.SessionRules())
+	}
+	if misdeclared := crawl.MisdeclaredContentTypes(results); len(misdeclared) > 0 {
+		logger.Printf("misdeclared content type: %d pages were served as plain text or binary data, but scraped as HTML; the server may be misconfigured:", len(misdeclared))
+		for _, u := range misdeclared {
+			logger.Printf("\t%s", u)
+		}
+	}
+	if overflow := crawl.LinkOverflow(results); len(overflow) > 0 {
+		logger.Printf("link overflow: %d pages had more than %d links, and may be crawl traps worth excluding:", len(overflow), *flags.limits.maxLinks)
+		for _, u := range overflow {
+			logger.Printf("\t%s", u)
+		}
+	}
+	if s := c.Stats(); s.Truncated {
+		logger.Printf("stopped after %s pages, as limited by -max-pages, with %s still queued", thousands(s.Fetched), thousands(s.Queued))
+	}
+	if s := c.Stats(); len(s.MutatingLinks) > 0 {
+		logger.Printf("WARNING: found links that look like they change state when fetched (%s); %s", countsByName(s.MutatingLinks), mutatingAdvice(s))
+	}
+	if s := c.Stats(); s.OverRedirectBudget {
+		logger.Printf("warning: followed %s redirects, over the budget of %s", thousands(s.Redirects), thousands(int64(*flags.limits.redirectBudget)))
+	}
+
+	var rateErr *crawl.ErrorRateError
+	if errors.As(err, &rateErr) {
+		logger.Println(err)
+		logger.Println(likelyCause(results))
+		return exitErrorRate
+	}
+	if errors.Is(err, context.Canceled) {
+		logger.Printf("interrupted: outputting the %d pages crawled so far", len(results))
+	} else if err != nil {
+		logger.Println(err)
+		return exitFailed
+	}
+
+	fdErrors := 0
+	for _, r := range results {
+		if errors.Is(r.Err, crawl.ErrFileLimit) {
+			fdErrors++
+		}
+	}
+	if fdErrors > 0 {
+		logger.Printf("%d pages failed because we ran out of file descriptors; lower -c, set -max-sockets or raise the limit (ulimit -n)", fdErrors)
+	}
+
+	if *out.summaryOut != "" {
+		report := crawl.CrawlReport{Seed: u.String(), Root: c.Stats().Root, Results: results}
+		if err := writeSummaryText(*out.summaryOut, *out.summaryPrevious, report); err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+	}
+
+	if *out.check {
+		if err != nil {
+			// Interrupted, so the links off the site weren't checked.
+			logger.Println("interrupted before the links off the site were checked")
+			return exitFailed
+		}
+		return reportBroken(stdout, logger, checkedLinks(c, rel), *out.jsonOut, false)
+	}
+
+	if *out.hosts {
+		for _, h := range crawl.HostSummaries(results) {
+			fmt.Fprintf(stdout, "%s\t%d pages\t%d errors\n", h.Host, h.Pages, h.Errors)
+		}
+		return exitOK
+	}
+
+	if *out.breadcrumbs >= 0 {
+		r := crawl.NewBreadcrumbReport(results, *out.breadcrumbs)
+		fmt.Fprintf(stdout, "%d pages with breadcrumbs, %d without\n", r.With, r.Without)
+		for _, m := range r.Mismatches {
+			fmt.Fprintf(stdout, "%s\tbreadcrumb depth %d, crawl depth %d\t%s\n", m.URL, m.BreadcrumbDepth, m.CrawlDepth, strings.Join(m.Breadcrumbs, " > "))
+		}
+		return exitOK
+	}
+
+	if *out.anomalies > 0 {
+		t := crawl.DefaultAnomalyThresholds
+		t.Depth = *out.anomalies
+		for _, d := range crawl.Anomalies(results, t) {
+			if len(d.Problems) == 0 {
+				break
+			}
+			fmt.Fprintf(stdout, "%s\t%d pages\n", d.Path, d.Pages)
+			for _, p := range d.Problems {
+				fmt.Fprintf(stdout, "\t%s\n", p)
+			}
+		}
+		return exitOK
+	}
+
+	if *out.statuses {
+		for _, s := range crawl.StatusSummary(results) {
+			fmt.Fprintf(stdout, "%s\t%d pages\n", s.Class, s.Pages)
+		}
+		return exitOK
+	}
+
+	if *out.encodings {
+		for _, e := range crawl.EncodingSummary(results) {
+			fmt.Fprintf(stdout, "%s\t%s\t%d pages\n", e.Proto, e.ContentEncoding, e.Pages)
+		}
+		return exitOK
+	}
+
+	if *out.compressionReport {
+		printCompressionReport(stdout, c.Stats(), results)
+		return exitOK
+	}
+
+	if *out.pageGroups {
+		for _, g := range c.Summary().PageGroups {
+			fmt.Fprintf(stdout, "%s\t%d pages\t%.1f%% errors\t%s bytes mean\t%v mean latency\n", g.Group, g.Pages, g.ErrorRate*100, thousands(g.MeanSize), g.MeanLatency.Round(time.Millisecond))
+		}
+		return exitOK
+	}
+
+	if *out.cacheReport {
+		printCacheReport(stdout, crawl.NewCacheReport(results, 1))
+		return exitOK
+	}
+
+	if *out.excludedLinks > 0 {
+		printExcludedLinks(stdout, c.ExcludedLinks())
+		return exitOK
+	}
+
+	if *out.tlsReport {
+		if err := printTLSReport(stdout, results, *out.tlsMin); err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		return exitOK
+	}
+
+	if *out.sections > 0 {
+		for _, s := range crawl.SectionSummary(results, *out.sections) {
+			fmt.Fprintf(stdout, "%s\t%d pages\t%d errors\n", s.Path, s.Pages, s.Errors)
+		}
+		return exitOK
+	}
+
+	if rel != nil {
+		if *out.linkHygiene > 0 {
+			invalid := crawl.InvalidLinks(results)
+			for i := range invalid {
+				invalid[i].Page = rel.URL(invalid[i].Page)
+			}
+			printLinkHygiene(stdout, rel.NormalizationReport(c.NormalizationReport(results)), invalid, *out.linkHygiene)
+			return exitOK
+		}
+		results = rel.Results(results)
+	}
+
+	if *out.linkHygiene > 0 {
+		printLinkHygiene(stdout, c.NormalizationReport(results), crawl.InvalidLinks(results), *out.linkHygiene)
+		return exitOK
+	}
+
+	if *out.report {
+		summary, workers := c.Summary(), c.Stats().Workers
+		report := crawl.CrawlReport{
+			Seed:    u.String(),
+			Root:    c.Stats().Root,
+			Config:  c.Config(),
+			Summary: &summary,
+			Workers: &workers,
+			Results: results,
 		}
+		if err := writeReport(stdout, logger, report); err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		return exitOK
+	}
+
+	if *out.jsonOut {
+		if err := writeJSON(stdout, logger, results); err != nil {
+			logger.Println(err)
+			return exitFailed
+		}
+		return exitOK
 	}
 	for _, r := range results {
-		fmt.Printf("%s, %s\n", r.URL, r.Links)
+		fmt.Fprintln(stdout, resultLine(r, *out.timings))
+		if r.Err != nil {
+			fmt.Fprintf(stdout, "\terror: %s\n", r.Err)
+			for _, p := range r.Referrers {
+				fmt.Fprintf(stdout, "\tlinked from %s\n", p)
+			}
+		}
+		if len(r.Speculative) > 0 {
+			fmt.Fprintf(stdout, "\tspeculative: %s\n", r.Speculative)
+		}
+		for _, w := range r.Warnings {
+			fmt.Fprintf(stdout, "\twarning: %s\n", w)
+		}
+	}
+	return exitOK
+}
+
+// streamCrawl runs the crawl, printing each result as soon as it is
+// fetched, as a line of text or JSON, with its URLs rendered by rel, if
+// not nil.
+func streamCrawl(ctx context.Context, c crawl.Crawler, u *url.URL, rel *crawl.Relativizer, asJSON, timings bool, w io.Writer, logger *log.Logger) int {
+	results, err := c.CrawlStreamContext(ctx, u.String())
+	if err != nil {
+		logger.Println(err)
+		return exitFailed
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	for r := range results {
+		n++
+		if rel != nil {
+			r = rel.Result(r)
+		}
+		if !asJSON {
+			fmt.Fprintln(bw, resultLine(r, timings))
+			if r.Err != nil {
+				fmt.Fprintf(bw, "\terror: %s\n", r.Err)
+			}
+		} else if err := enc.Encode(r); err != nil {
+			logger.Printf("error marshalling result for %s to json: %s", r.URL, err)
+		}
+		// Flush each result, so they are seen as they arrive.
+		bw.Flush()
+	}
+	if err := bw.Flush(); err != nil {
+		logger.Println(err)
+		return exitFailed
+	}
+	s := c.Stats()
+	switch {
+	case s.Aborted:
+		logger.Printf("crawl aborted: %d of %d pages failed, more than the %.0f%% allowed", s.Errors, s.Fetched, c.Config().AbortErrorRate*100)
+		return exitErrorRate
+	case ctx.Err() != nil:
+		logger.Printf("interrupted after streaming %d pages", n)
+	}
+	return exitOK
+}
+
+// checkedLinks returns the links checked by c, with their URLs rendered by
+// rel, if not nil.
+func checkedLinks(c crawl.Crawler, rel *crawl.Relativizer) []crawl.LinkCheck {
+	if rel == nil {
+		return c.CheckedLinks()
+	}
+	return rel.LinkChecks(c.CheckedLinks())
+}
+
+// reportBroken prints the broken links found by -check, with the pages
+// linking to them, or with asJSON, every link checked, unless quiet, and
+// returns the exit code: exitBroken if any are broken.
+func reportBroken(w io.Writer, logger *log.Logger, links []crawl.LinkCheck, asJSON, quiet bool) int {
+	var broken []crawl.LinkCheck
+	for _, l := range links {
+		if l.Broken() {
+			broken = append(broken, l)
+		}
+	}
+	switch {
+	case quiet:
+	case asJSON:
+		if err := json.NewEncoder(w).Encode(links); err != nil {
+			logger.Printf("error marshalling links to json: %s", err)
+			return exitFailed
+		}
+	default:
+		printBroken(w, broken)
+	}
+	logger.Printf("checked %d links: %d broken", len(links), len(broken))
+	if len(broken) > 0 {
+		return exitBroken
+	}
+	return exitOK
+}
+
+// resultLine returns the line of text output for a result: its URL and
+// links, and with timings, the time it took to fetch and the bytes of its
+// body read.
+func resultLine(r crawl.Result, timings bool) string {
+	line := fmt.Sprintf("%s, %s", r.URL, r.Links)
+	if timings {
+		line += fmt.Sprintf(", %v, %s bytes", r.Duration.Round(time.Millisecond), thousands(r.BytesDecoded))
+	}
+	return line
+}
+
+// printLinkHygiene prints up to n of the worst offenders from the report.
+func printLinkHygiene(w io.Writer, report crawl.NormalizationReport, invalid []crawl.InvalidLink, n int) {
+	if len(report) < n {
+		n = len(report)
+	}
+	for _, e := range report[:n] {
+		fmt.Fprintf(w, "%s (%d variants)\n", e.URL, len(e.Variants))
+		for _, v := range e.Variants {
+			fmt.Fprintf(w, "\t%s: %d links on %d pages %s\n", v.URL, v.Count, len(v.Pages), v.Pages)
+		}
+	}
+	if len(invalid) > 0 {
+		fmt.Fprintf(w, "%d invalid links\n", len(invalid))
+	}
+	for _, l := range invalid {
+		outcome := "dropped"
+		if l.Fix != "" {
+			outcome = "crawled after " + l.Fix
+		}
+		fmt.Fprintf(w, "\t%q on %s: %s (%s)\n", l.Href, l.Page, l.Err, outcome)
 	}
+}
+
+// printExcludedLinks prints each excluded target, with the rule or pattern
+// that excluded it and the pages linking to it.
+func printExcludedLinks(w io.Writer, r crawl.ExcludedLinkReport) {
+	for _, t := range r.Targets {
+		fmt.Fprintf(w, "%s\texcluded by %s\t%d links\n", t.URL, t.Rule, t.Links)
+		for _, p := range t.Pages {
+			fmt.Fprintf(w, "\t%s\n", p)
+		}
+	}
+	if r.Untracked > 0 {
+		fmt.Fprintf(w, "%s more links to targets over the limit of %s\n", thousands(r.Untracked), thousands(maxExcludedTargets))
+	}
+}
+
+// printCacheReport prints the policies in a CacheReport, with how long
+// CDNs may cache their pages, then the groups of pages served with more
+// than one, then the pages hostile to caching.
+func printCacheReport(w io.Writer, r crawl.CacheReport) {
+	for _, p := range r.Policies {
+		fmt.Fprintf(w, "%s\t%d pages%s\n", p.Policy, p.Pages, maxAge(p.Policy))
+	}
+	for _, g := range r.Groups {
+		if len(g.Policies) < 2 {
+			continue
+		}
+		fmt.Fprintf(w, "inconsistent: %s\t%d pages\t%d policies\n", g.Group, g.Pages, len(g.Policies))
+		for _, p := range g.Policies {
+			fmt.Fprintf(w, "\t%s\t%d pages%s\n", p.Policy, p.Pages, maxAge(p.Policy))
+		}
+	}
+	for _, h := range r.Hostile {
+		fmt.Fprintf(w, "uncacheable: %s\t%s\n", h.URL, h.Reason)
+	}
+}
+
+// maxAge returns a column with how long shared caches may serve the pages
+// of a policy, or "" if it doesn't say.
+func maxAge(p crawl.CachePolicy) string {
+	n, ok := p.MaxAge()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("\tmax age %v", time.Duration(n)*time.Second)
+}
+
+// printProgress returns a func printing a crawl's Stats to w as a status
+// line, overwriting the last one.
+func printProgress(w io.Writer) func(crawl.Stats) {
+	return func(s crawl.Stats) {
+		fmt.Fprintf(w, "\rfetched %s / discovered %s (queue %s, %s in flight, %.0f req/s, %s errors)",
+			thousands(s.Fetched), thousands(s.Discovered), thousands(s.Queued), thousands(s.InFlight), s.Rate(), thousands(s.Errors))
+	}
+}
 
+// workerHint returns a line suggesting how to size the crawl's fetchers,
+// if their time was poorly spent, or "" if it wasn't.
+func workerHint(ws crawl.WorkerStats) string {
+	switch {
+	case ws.IdleFraction() > 0.5:
+		return fmt.Sprintf("fetchers idle %.0f%% of the time; consider lowering -c or raising rate limits", ws.IdleFraction()*100)
+	case ws.BlockedFraction() > 0.25:
+		return fmt.Sprintf("fetchers blocked %.0f%% of the time waiting for their pages to be processed; raising -c won't help", ws.BlockedFraction()*100)
+	case ws.Utilization() > 0.9:
+		return fmt.Sprintf("fetchers busy %.0f%% of the time; raising -c may speed up the crawl", ws.Utilization()*100)
+	}
+	return ""
+}
+
+// countsByName formats counts by name, e.g. of links by exclusion rule, in
+// order of name.
+func countsByName(counts map[string]int64) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %s", name, thousands(counts[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// mutatingAdvice says whether the links that look like they change state
+// were crawled, and if so, how not to.
+func mutatingAdvice(s crawl.Stats) string {
+	for name := range s.MutatingLinks {
+		if s.Excluded[name] == 0 {
+			return "they were crawled; use -safe-exclusions to skip them"
+		}
+	}
+	return "they were skipped"
+}
+
+// thousands formats n with comma separated thousands.
+func thousands(n int64) string {
+	if n < 0 {
+		return "-" + thousands(-n)
+	}
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// parseWindow parses a crawl window, e.g. "22:00-06:00 Europe/London", into
+// its start and end as times since midnight, and its time zone, which
+// defaults to local time.
+func parseWindow(s string) (start, end time.Duration, loc *time.Location, err error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, nil, fmt.Errorf("window %q is not of the form start-end [zone]", s)
+	}
+	loc = time.Local
+	if len(fields) == 2 {
+		if loc, err = time.LoadLocation(fields[1]); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return 0, 0, nil, fmt.Errorf("window %q is not of the form start-end [zone]", s)
+	}
+	var tods [2]time.Duration
+	for i, t := range times {
+		tod, err := time.Parse("15:04", t)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("window %q: %w", s, err)
+		}
+		tods[i] = time.Duration(tod.Hour())*time.Hour + time.Duration(tod.Minute())*time.Minute
+	}
+	return tods[0], tods[1], loc, nil
+}
+
+// parseAttrs parses a comma separated list of element:attribute pairs.
+func parseAttrs(s string) (map[string][]string, error) {
+	attrs := make(map[string][]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid element:attribute pair %q", pair)
+		}
+		attrs[parts[0]] = append(attrs[parts[0]], parts[1])
+	}
+	return attrs, nil
+}
+
+// writeJSON writes the results as a JSON array, marshalling one result at a
+// time so we never hold more than a single result's JSON in memory. A result
+// that can't be marshalled is logged and left out, so the array stays valid.
+func writeJSON(w io.Writer, logger *log.Logger, results []crawl.Result) error {
+	bw := bufio.NewWriter(w)
+	writeResults(bw, logger, results)
+	// bufio.Writer errors are sticky, so any error writing is returned here.
+	return bw.Flush()
+}
+
+// writeReport writes a crawl.CrawlReport, streaming its results as for
+// writeJSON.
+func writeReport(w io.Writer, logger *log.Logger, report crawl.CrawlReport) error {
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"seed", report.Seed},
+		{"root", report.Root},
+		{"config", report.Config},
+		{"summary", report.Summary},
+		{"workers", report.Workers},
+	}
+	bw := bufio.NewWriter(w)
+	sep := "{"
+	for _, f := range fields {
+		j, err := json.Marshal(f.value)
+		if err != nil {
+			return fmt.Errorf("error marshalling %s to json: %w", f.name, err)
+		}
+		if string(j) == "null" {
+			continue
+		}
+		fmt.Fprintf(bw, "%s%q: %s", sep, f.name, j)
+		sep = ",\n"
+	}
+	bw.WriteString(",\n\"results\": ")
+	writeResults(bw, logger, report.Results)
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// writeSummaryText writes the text summary of a crawl's report to the file
+// name, comparing it with the report in the file previous, if given.
+func writeSummaryText(name, previous string, report crawl.CrawlReport) error {
+	var prev *crawl.CrawlReport
+	if previous != "" {
+		b, err := ioutil.ReadFile(previous)
+		if err != nil {
+			return fmt.Errorf("error reading previous report: %w", err)
+		}
+		prev = new(crawl.CrawlReport)
+		if err := json.Unmarshal(b, prev); err != nil {
+			return fmt.Errorf("error parsing previous report %s: %w", previous, err)
+		}
+	}
+	if err := ioutil.WriteFile(name, []byte(crawl.SummaryText(report, prev)), 0644); err != nil {
+		return fmt.Errorf("error writing summary: %w", err)
+	}
+	return nil
+}
+
+// writeResults writes results as a json array, one result per line.
+func writeResults(bw *bufio.Writer, logger *log.Logger, results []crawl.Result) {
+	sep := "[\n"
+	for _, r := range results {
+		j, err := json.Marshal(r)
+		if err != nil {
+			logger.Printf("error marshalling result for %s to json: %s", r.URL, err)
+			continue
+		}
+		bw.WriteString(sep)
+		bw.Write(j)
+		sep = ",\n"
+	}
+	if sep == "[\n" {
+		bw.WriteString("[")
+	}
+	bw.WriteString("\n]\n")
+}
+
+// printSessionRules logs the session rules inferred by a crawl to stderr,
+// so they are seen even when the results are redirected, along with how to
+// pin them.
+func printSessionRules(logger *log.Logger, rules []crawl.SessionRule) {
+	for _, r := range rules {
+		if r.Samples == 0 {
+			continue
+		}
+		logger.Printf("inferred session ID rule from %d URLs serving identical pages: check, and pin with -session-rule %s", r.Samples, r)
+	}
+}
+
+// printCompressionReport prints the bytes transferred for each content type,
+// and the pages that would most benefit from being compressed.
+func printCompressionReport(w io.Writer, s crawl.Stats, results []crawl.Result) {
+	types := make([]string, 0, len(s.Transfer))
+	for ct := range s.Transfer {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	for _, ct := range types {
+		t := s.Transfer[ct]
+		if ct == "" {
+			ct = "unknown"
+		}
+		fmt.Fprintf(w, "%s\t%d pages\t%s bytes on the wire\t%s decoded\t%.1fx\n", ct, t.Pages, thousands(t.BytesOnWire), thousands(t.BytesDecoded), t.CompressionRatio())
+	}
+	if pages := crawl.UncompressedPages(results, crawl.DefaultCompressionThreshold); len(pages) > 0 {
+		fmt.Fprintf(w, "\n%d pages over %s bytes served uncompressed:\n", len(pages), thousands(crawl.DefaultCompressionThreshold))
+		for _, p := range pages {
+			fmt.Fprintf(w, "%s\t%s\t%s bytes\n", p.URL, p.ContentType, thousands(p.Bytes))
+		}
+	}
+}
+
+// printTLSReport prints the TLS report for results, flagging versions below
+// the one named by min.
+func printTLSReport(w io.Writer, results []crawl.Result, min string) error {
+	versions := map[string]uint16{
+		"TLS 1.0": tls.VersionTLS10,
+		"TLS 1.1": tls.VersionTLS11,
+		"TLS 1.2": tls.VersionTLS12,
+		"TLS 1.3": tls.VersionTLS13,
+	}
+	v, ok := versions[strings.ToUpper(strings.TrimSpace(min))]
+	if !ok {
+		return fmt.Errorf("unknown -tls-min version %q, want one of TLS 1.0, TLS 1.1, TLS 1.2 or TLS 1.3", min)
+	}
+	for _, h := range crawl.TLSReport(results, v) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", h.Host, strings.Join(h.Versions, ", "), strings.Join(h.CipherSuites, ", "))
+		for _, p := range h.Problems {
+			fmt.Fprintf(w, "\tweak: %s\n", p)
+		}
+	}
+	return nil
+}
+
+// likelyCause suggests why most pages of an aborted crawl failed, from the
+// most common kind of failure.
+func likelyCause(results []crawl.Result) string {
+	kinds := make(map[string]int)
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		switch {
+		case r.StatusCode == 401 || r.StatusCode == 403:
+			kinds["most pages were refused (401/403): check any authentication headers or cookies, and that the crawler isn't blocked"]++
+		case r.StatusCode == 404 || r.StatusCode == 410:
+			kinds["most pages were not found (404/410): check the starting URL and host aliases"]++
+		case r.StatusCode == 429:
+			kinds["most pages were rate limited (429): lower -c"]++
+		case r.StatusCode >= 500:
+			kinds["most pages were server errors (5xx): the site may be down or overloaded; lower -c"]++
+		case r.StatusCode == 0:
+			kinds["most pages got no response: check DNS, network access, proxies and TLS, and any -timeout-override"]++
+		default:
+			kinds["most pages failed with unexpected responses: check the failures with -j"]++
+		}
+	}
+	cause, most := "", 0
+	for k, n := range kinds {
+		if n > most || (n == most && k < cause) {
+			cause, most = k, n
+		}
+	}
+	return "likely cause: " + cause
+}
+
+// printStats prints the final stats of a crawl to w: a summary of the page
+// fetches, or, as JSON, the full stats including auxiliary requests.
+func printStats(w io.Writer, logger *log.Logger, s crawl.Stats, asJSON bool) {
+	if asJSON {
+		j, err := json.Marshal(s)
+		if err != nil {
+			logger.Printf("error marshalling stats to json: %s", err)
+			return
+		}
+		fmt.Fprintf(w, "%s\n", j)
+		return
+	}
+	pages := s.Requests[crawl.PurposePage.String()]
+	fmt.Fprintf(w, "fetched %s pages in %v (%.0f req/s, %s errors, %s redirects, %v mean request)\n",
+		thousands(s.Fetched), s.Elapsed.Round(time.Millisecond), s.Rate(), thousands(s.Errors), thousands(pages.Redirects), pages.MeanDuration().Round(time.Millisecond))
+	if pages.Requests > 0 {
+		fmt.Fprintf(w, "request times: %v p50, %v p90, %v p99\n",
+			pages.P50.Round(time.Millisecond), pages.P90.Round(time.Millisecond), pages.P99.Round(time.Millisecond))
+	}
+	if hint := workerHint(s.Workers); hint != "" {
+		fmt.Fprintln(w, hint)
+	}
+	if retries := s.Requests[crawl.PurposeRetry.String()]; retries.Requests > 0 {
+		fmt.Fprintf(w, "retried %s requests, %s of them failing again\n", thousands(retries.Requests), thousands(retries.Errors))
+	}
+	if s.Disallowed > 0 {
+		fmt.Fprintf(w, "skipped %s pages disallowed by robots.txt\n", thousands(s.Disallowed))
+	}
+	if s.AccessControlled > 0 {
+		fmt.Fprintf(w, "%s pages access controlled, by -accept-status\n", thousands(s.AccessControlled))
+	}
+	if len(s.SkippedSeeds) > 0 {
+		fmt.Fprintf(w, "skipped seeds: %s\n", countsByName(s.SkippedSeeds))
+	}
+	if len(s.Excluded) > 0 {
+		fmt.Fprintf(w, "excluded links: %s\n", countsByName(s.Excluded))
+	}
+	if s.Filtered > 0 {
+		fmt.Fprintf(w, "left %s pages out of the results\n", thousands(s.Filtered))
+	}
+	if s.Panics > 0 {
+		fmt.Fprintf(w, "recovered from panics on %s pages; their errors have the stacks\n", thousands(s.Panics))
+	}
+	if cold, prefetched := s.NewHosts["cold"], s.NewHosts["prefetched"]; prefetched.Requests > 0 {
+		fmt.Fprintf(w, "first byte from new hosts: %v mean for %s prefetched, %v for %s cold (%v saved)\n",
+			prefetched.MeanDuration().Round(time.Millisecond), thousands(prefetched.Requests), cold.MeanDuration().Round(time.Millisecond), thousands(cold.Requests), s.PrefetchSaving().Round(time.Millisecond))
+	}
+	if s.Paused > 0 {
+		fmt.Fprintf(w, "paused for %v outside the crawl window\n", s.Paused.Round(time.Second))
+	}
 }
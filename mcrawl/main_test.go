@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"crawl"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testSite serves a titled page linking to another, and to one that is
+// missing.
+func testSite() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<title>Home</title><a href="/a">a</a><a href="/missing">missing</a>`))
+		case "/a":
+			w.Write([]byte(`<a href="/">home</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// durationPattern matches the durations in mcrawl's output, which vary from
+// run to run: as JSON, and as text.
+var durationPattern = regexp.MustCompile(`("Duration":)\d+|\b\d[\d.]*(ns|µs|ms|s)\b`)
+
+// stripDurations replaces the durations in s with ?.
+func stripDurations(s string) string {
+	return durationPattern.ReplaceAllString(s, "$1?")
+}
+
+// runArgs runs mcrawl with args, returning its exit code and output.
+func runArgs(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestCrawlCommand(t *testing.T) {
+	ts := testSite()
+	defer ts.Close()
+
+	code, out, errOut := runArgs("crawl", "-j", "-c", "2", ts.URL+"/")
+	if code != exitOK {
+		t.Fatalf("mcrawl crawl exited %d, want %d; stderr:\n%s", code, exitOK, errOut)
+	}
+	var results []struct {
+		URL, Title, Err string
+		Referrers       []string
+	}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("mcrawl crawl -j output isn't JSON: %v\n%s", err, out)
+	}
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	if len(results) == 3 && (results[0].Title != "Home" || results[1].Title != "") {
+		t.Errorf("mcrawl crawl -j Titles = %q, %q, want %q, %q", results[0].Title, results[1].Title, "Home", "")
+	}
+	if len(results) == 3 && !strings.Contains(results[2].Err, "404") {
+		t.Errorf("mcrawl crawl -j Err for /missing = %q, want the 404", results[2].Err)
+	}
+	if len(results) == 3 && !cmp.Equal(results[2].Referrers, []string{ts.URL + "/"}) {
+		t.Errorf("mcrawl crawl -j Referrers for /missing = %q, want %q", results[2].Referrers, ts.URL+"/")
+	}
+	want := []string{ts.URL + "/", ts.URL + "/a", ts.URL + "/missing"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("mcrawl crawl -j results mismatch (-want +got):\n%s", diff)
+	}
+
+	// A bare mcrawl starting_URL is the crawl command.
+	code, bare, _ := runArgs("-j", "-c", "2", ts.URL+"/")
+	if code != exitOK || stripDurations(bare) != stripDurations(out) {
+		t.Errorf("mcrawl -j starting_URL = %d, %q, want the same as mcrawl crawl -j", code, bare)
+	}
+
+	// Streamed results are a json object per line, in the order fetched.
+	code, streamed, _ := runArgs("crawl", "-stream", "-j", ts.URL+"/")
+	lines := strings.Split(strings.TrimSpace(streamed), "\n")
+	if code != exitOK || len(lines) != 3 {
+		t.Fatalf("mcrawl crawl -stream -j = %d, %q, want 3 lines", code, streamed)
+	}
+	var first struct{ URL string }
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.URL != ts.URL+"/" {
+		t.Errorf("first streamed line = %q, want the starting URL's result", lines[0])
+	}
+	code, streamed, _ = runArgs("crawl", "-stream", "-j", "-relative-urls", ts.URL+"/")
+	lines = strings.Split(strings.TrimSpace(streamed), "\n")
+	if err := json.Unmarshal([]byte(lines[0]), &first); code != exitOK || err != nil || first.URL != "/" {
+		t.Errorf("mcrawl crawl -stream -j -relative-urls = %d, %q, want the starting URL's result as /", code, streamed)
+	}
+	code, out, _ = runArgs("crawl", "-check", "-relative-urls", ts.URL+"/")
+	if code != exitBroken || !strings.HasPrefix(out, "/missing\t") || !strings.HasSuffix(out, "\tlinked from /\n") {
+		t.Errorf("mcrawl crawl -check -relative-urls = %d, %q, want /missing reported broken, linked from /", code, out)
+	}
+
+	// The report includes the results' summary, and how the fetchers
+	// spent their time.
+	code, out, _ = runArgs("crawl", "-report", ts.URL+"/")
+	var report crawl.CrawlReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || code != exitOK {
+		t.Fatalf("mcrawl crawl -report = %d, %q, want a JSON report: %v", code, out, err)
+	}
+	if report.Summary == nil || report.Summary.Pages != 3 || report.Workers == nil || len(report.Results) != 3 {
+		t.Errorf("mcrawl crawl -report = %+v, want a summary of 3 pages, worker stats and 3 results", report)
+	}
+
+	// The text summary is written as well as the results, and compared
+	// with the previous report.
+	dir, err := ioutil.TempDir("", "mcrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	previous, summary := filepath.Join(dir, "report.json"), filepath.Join(dir, "summary.txt")
+	if err := ioutil.WriteFile(previous, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runArgs("crawl", "-summary-out", summary, "-summary-previous", previous, ts.URL+"/"); code != exitOK {
+		t.Fatalf("mcrawl crawl -summary-out exited %d; stderr:\n%s", code, errOut)
+	}
+	b, err := ioutil.ReadFile(summary)
+	lines = strings.Split(string(b), "\n")
+	// The slowest pages vary from run to run.
+	for i, l := range lines {
+		if strings.HasPrefix(l, "Slowest: ") {
+			lines[i] = "Slowest: ..."
+		}
+	}
+	want = []string{"Crawled " + ts.URL + "/: 3 pages, 1 errors", "Errors: 1 not found", "Broken links: 1", "Slowest: ...", "Since the last crawl: 0 new pages, 0 removed", ""}
+	if diff := cmp.Diff(want, lines); err != nil || diff != "" {
+		t.Errorf("mcrawl crawl -summary-out wrote %q, %v, want (-want +got):\n%s", b, err, diff)
+	}
+
+	// The last progress checkpoint is written once the crawl is done.
+	progress := filepath.Join(dir, "progress.json")
+	if code, _, errOut := runArgs("crawl", "-progress-file", progress, ts.URL+"/"); code != exitOK {
+		t.Fatalf("mcrawl crawl -progress-file exited %d; stderr:\n%s", code, errOut)
+	}
+	var cp crawl.Checkpoint
+	if b, err := ioutil.ReadFile(progress); err != nil || json.Unmarshal(b, &cp) != nil || !cp.Done || cp.Fetched != 3 {
+		t.Errorf("mcrawl crawl -progress-file wrote %q, %v, want a final checkpoint of 3 pages fetched", b, err)
+	}
+
+	// Pages with more links than -link-spill keep only the first, and
+	// their full results are written to the spill file.
+	spill := filepath.Join(dir, "spill.jsonl")
+	code, out, errOut = runArgs("crawl", "-j", "-link-spill", "1", "-link-spill-file", spill, ts.URL+"/")
+	var kept []crawl.Result
+	if code != exitOK || json.Unmarshal([]byte(out), &kept) != nil || len(kept) != 3 || !kept[0].LinksSpilled || len(kept[0].Links) != 1 || kept[0].OutboundInternal != 2 {
+		t.Errorf("mcrawl crawl -link-spill 1 = %d, %q, want the home page with 1 of its 2 links kept; stderr:\n%s", code, out, errOut)
+	}
+	var spilled crawl.Result
+	if b, err := ioutil.ReadFile(spill); err != nil || json.Unmarshal(b, &spilled) != nil || spilled.URL != ts.URL+"/" || len(spilled.Links) != 2 {
+		t.Errorf("mcrawl crawl -link-spill-file wrote %q, %v, want the home page with both its links", b, err)
+	}
+	if code, _, _ := runArgs("crawl", "-link-spill", "1", ts.URL+"/"); code != exitError {
+		t.Errorf("mcrawl crawl -link-spill without -link-spill-file = %d, want %d", code, exitError)
+	}
+
+	// The pages fetched by the previous crawl seed the next, unless now
+	// excluded.
+	code, _, errOut = runArgs("crawl", "-seed-from", previous, "-exclude", "/a$", "-stats", ts.URL+"/")
+	if code != exitOK || !strings.Contains(errOut, "skipped seeds: exclude 1\n") {
+		t.Errorf("mcrawl crawl -seed-from = %d, stderr %q, want the seed /a skipped", code, errOut)
+	}
+
+	// Timings add a column of the time taken, and one of bytes read.
+	code, out, _ = runArgs("crawl", "-timings", ts.URL+"/")
+	if want := ts.URL + "/a, [/], ?, 20 bytes\n"; code != exitOK || !strings.Contains(stripDurations(out), want) {
+		t.Errorf("mcrawl crawl -timings = %d, %q, want a line %q", code, out, want)
+	}
+
+	// Failed pages are listed with their errors, and the pages linking to
+	// them.
+	code, text, _ := runArgs("crawl", ts.URL+"/")
+	if code != exitOK || !strings.Contains(text, ts.URL+"/missing, []\n\terror: ") || !strings.HasSuffix(text, "\n\tlinked from "+ts.URL+"/\n") {
+		t.Errorf("mcrawl crawl = %d, %q, want /missing listed with its error and referrer", code, text)
+	}
+
+	code, out, _ = runArgs("crawl", "-statuses", ts.URL+"/")
+	if code != exitOK || !strings.Contains(out, "ok\t2 pages") || !strings.Contains(out, "not found\t1 pages") {
+		t.Errorf("mcrawl crawl -statuses = %d, %q, want 2 ok pages and 1 not found", code, out)
+	}
+
+	code, out, _ = runArgs("crawl", "-accept-status", "404:/missing", "-statuses", ts.URL+"/")
+	if code != exitOK || !strings.Contains(out, "access controlled\t1 pages") || !strings.Contains(out, "not found\t0 pages") {
+		t.Errorf("mcrawl crawl -accept-status 404:/missing -statuses = %d, %q, want /missing access controlled", code, out)
+	}
+	if code, _, _ = runArgs("crawl", "-accept-status", "401", ts.URL+"/"); code != exitError {
+		t.Errorf("mcrawl crawl -accept-status 401 = %d, want %d", code, exitError)
+	}
+
+	code, out, _ = runArgs("crawl", "-page-groups", "-url-template", "/{page}", ts.URL+"/")
+	if want := "/{page}\t2 pages\t50.0% errors\t20 bytes mean\t? mean latency\n/\t1 pages\t0.0% errors\t67 bytes mean\t? mean latency\n"; code != exitOK || stripDurations(out) != want {
+		t.Errorf("mcrawl crawl -page-groups = %d, %q, want %q", code, out, want)
+	}
+
+	// The test server sets no caching headers, so no page can be cached.
+	code, out, _ = runArgs("crawl", "-cache-report", ts.URL+"/")
+	if code != exitOK || !strings.HasPrefix(out, "no caching headers\t2 pages\n") || !strings.Contains(out, "uncacheable: "+ts.URL+"/\tno caching headers\n") {
+		t.Errorf("mcrawl crawl -cache-report = %d, %q, want 2 pages without caching headers", code, out)
+	}
+
+	// Broken links are reported with the pages linking to them, and fail
+	// the crawl.
+	code, out, _ = runArgs("crawl", "-check", ts.URL+"/")
+	if want := ts.URL + "/missing\t"; code != exitBroken || !strings.HasPrefix(out, want) || !strings.HasSuffix(out, "\tlinked from "+ts.URL+"/\n") {
+		t.Errorf("mcrawl crawl -check = %d, %q, want %s linked from %s/", code, out, ts.URL+"/missing", ts.URL)
+	}
+	code, out, _ = runArgs("crawl", "-check", "-exclude", "/missing", ts.URL+"/")
+	if code != exitOK || out != "" {
+		t.Errorf("mcrawl crawl -check -exclude /missing = %d, %q, want no broken links", code, out)
+	}
+
+	// Excluded links are reported with the pages linking to them, without
+	// being fetched.
+	code, out, _ = runArgs("crawl", "-exclude", "/missing", "-excluded-links", "5", ts.URL+"/")
+	if want := ts.URL + "/missing\texcluded by /missing\t1 links\n\t" + ts.URL + "/\n"; code != exitOK || out != want {
+		t.Errorf("mcrawl crawl -excluded-links = %d, %q, want %q", code, out, want)
+	}
+
+	if code, _, errOut := runArgs("crawl", "-sort", "size", ts.URL+"/"); code != exitFailed || !strings.Contains(errOut, `unknown -sort order "size"`) {
+		t.Errorf("mcrawl crawl -sort size = %d, %q, want an unknown order error", code, errOut)
+	}
+	if code, _, _ := runArgs("crawl", "-no-such-flag", ts.URL+"/"); code != exitError {
+		t.Errorf("mcrawl crawl -no-such-flag exited %d, want %d", code, exitError)
+	}
+	if code, _, _ := runArgs("crawl"); code != exitError {
+		t.Errorf("mcrawl crawl without a URL exited %d, want %d", code, exitError)
+	}
+}
+
+func TestWorkerHint(t *testing.T) {
+	cases := []struct {
+		workers crawl.WorkerStats
+		want    string
+	}{
+		{crawl.WorkerStats{}, ""},
+		{crawl.WorkerStats{Fetching: 28, Idle: 72}, "fetchers idle 72% of the time; consider lowering -c or raising rate limits"},
+		{crawl.WorkerStats{Fetching: 60, Idle: 10, Blocked: 30}, "fetchers blocked 30% of the time waiting for their pages to be processed; raising -c won't help"},
+		{crawl.WorkerStats{Fetching: 95, Idle: 5}, "fetchers busy 95% of the time; raising -c may speed up the crawl"},
+		{crawl.WorkerStats{Fetching: 70, Idle: 30}, ""},
+	}
+	for _, c := range cases {
+		if got := workerHint(c.workers); got != c.want {
+			t.Errorf("workerHint(%+v) = %q, want %q", c.workers, got, c.want)
+		}
+	}
+}
+
+func TestPrintBroken(t *testing.T) {
+	broken := []crawl.LinkCheck{
+		{URL: "https://monzo.com/missing", StatusCode: 404, Err: "404 Not Found", Pages: []string{"https://monzo.com/"}},
+		{URL: "https://monzo.com/old", StatusCode: 410, Err: "410 Gone", Pages: []string{"https://monzo.com/", "https://monzo.com/a"}},
+	}
+	var b bytes.Buffer
+	printBroken(&b, broken)
+	want := "https://monzo.com/missing\t404 Not Found\n" +
+		"\tlinked from https://monzo.com/\n" +
+		"https://monzo.com/old\tgone, intentionally removed: 410 Gone\n" +
+		"\tlinked from https://monzo.com/\n" +
+		"\tlinked from https://monzo.com/a\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("printBroken() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrintCacheReport(t *testing.T) {
+	short := crawl.CachePolicy{CacheControl: "max-age=60, public"}
+	cdn := crawl.CachePolicy{CacheControl: "max-age=60, s-maxage=3600"}
+	report := crawl.CacheReport{
+		Policies: []crawl.PolicyCount{{Policy: short, Pages: 3}, {Policy: cdn, Pages: 1}, {Pages: 1}},
+		Groups: []crawl.CacheGroup{
+			{Group: "/blog", Pages: 2, Policies: []crawl.PolicyCount{{Policy: short, Pages: 1}, {Policy: cdn, Pages: 1}}},
+			{Group: "/", Pages: 3, Policies: []crawl.PolicyCount{{Policy: short, Pages: 2}, {Pages: 1}}},
+		},
+		Hostile: []crawl.CacheHostilePage{{URL: "https://monzo.com/", Reason: "no caching headers"}},
+	}
+	var b bytes.Buffer
+	printCacheReport(&b, report)
+	want := "Cache-Control: max-age=60, public\t3 pages\tmax age 1m0s\n" +
+		"Cache-Control: max-age=60, s-maxage=3600\t1 pages\tmax age 1h0m0s\n" +
+		"no caching headers\t1 pages\n" +
+		"inconsistent: /blog\t2 pages\t2 policies\n" +
+		"\tCache-Control: max-age=60, public\t1 pages\tmax age 1m0s\n" +
+		"\tCache-Control: max-age=60, s-maxage=3600\t1 pages\tmax age 1h0m0s\n" +
+		"inconsistent: /\t3 pages\t2 policies\n" +
+		"\tCache-Control: max-age=60, public\t2 pages\tmax age 1m0s\n" +
+		"\tno caching headers\t1 pages\n" +
+		"uncacheable: https://monzo.com/\tno caching headers\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("printCacheReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	// robots.txt is ignored, so it isn't fetched from the real site.
+	code, out, errOut := runArgs("explain", "-no-robots", "-dir-index", "https://monzo.com", "https://monzo.com/blog/")
+	if code != exitOK || out == "" {
+		t.Fatalf("mcrawl explain = %d, %q, want its decisions; stderr:\n%s", code, out, errOut)
+	}
+	// The explain command was once given after the crawl's flags.
+	if code, old, _ := runArgs("-no-robots", "-dir-index", "explain", "https://monzo.com", "https://monzo.com/blog/"); code != exitOK || old != out {
+		t.Errorf("mcrawl -dir-index explain = %d, %q, want %q", code, old, out)
+	}
+	// Each -host is crawled as well as the starting URL's.
+	code, out, _ = runArgs("explain", "-no-robots", "-host", "shop.monzo.com", "-host", "Help.Monzo.com:443", "https://monzo.com", "https://help.monzo.com/faq")
+	if code != exitOK || !strings.Contains(out, "host help.monzo.com is an allowed host") {
+		t.Errorf("mcrawl explain -host = %d, %q, want help.monzo.com allowed", code, out)
+	}
+	if code, _, _ := runArgs("explain", "https://monzo.com"); code != exitError {
+		t.Errorf("mcrawl explain without a target exited %d, want %d", code, exitError)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	ts := testSite()
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "mcrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	urlFile := filepath.Join(dir, "urls.txt")
+	if err := ioutil.WriteFile(urlFile, []byte("# changed pages\n"+ts.URL+"/\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, errOut := runArgs("check", "-url-file", urlFile, "-c", "2")
+	if code != exitBroken {
+		t.Fatalf("mcrawl check exited %d, want %d; stderr:\n%s", code, exitBroken, errOut)
+	}
+	want := ts.URL + "/missing\t"
+	if !strings.HasPrefix(out, want) || !strings.Contains(out, "\tlinked from "+ts.URL+"/\n") {
+		t.Errorf("mcrawl check output = %q, want /missing reported broken", out)
+	}
+	if !strings.Contains(errOut, "checked 1 pages and 2 links: 1 broken") {
+		t.Errorf("mcrawl check stderr = %q, want a summary", errOut)
+	}
+	code, out, _ = runArgs("check", "-url-file", urlFile, "-relative-urls")
+	if code != exitBroken || !strings.HasPrefix(out, "/missing\t") || !strings.Contains(out, "\tlinked from /\n") {
+		t.Errorf("mcrawl check -relative-urls = %d, %q, want /missing reported broken, linked from /", code, out)
+	}
+
+	if code, _, _ := runArgs("check"); code != exitError {
+		t.Errorf("mcrawl check without -url-file exited %d, want %d", code, exitError)
+	}
+	if code, _, _ := runArgs("check", "-url-file", filepath.Join(dir, "none")); code != exitFailed {
+		t.Errorf("mcrawl check with a missing -url-file exited %d, want %d", code, exitFailed)
+	}
+	// A check that can't be run is told apart from one finding broken
+	// links.
+	if code, _, _ := runArgs("check", "-url-file", urlFile, "-max-redirects", "-1"); code != exitFailed {
+		t.Errorf("mcrawl check with an invalid crawler exited %d, want %d", code, exitFailed)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	_, out, _ := runArgs("help")
+	seen := make(map[int]bool)
+	for _, e := range exitCodes {
+		if seen[e.code] {
+			t.Errorf("exit code %d has more than one meaning", e.code)
+		}
+		seen[e.code] = true
+		if line := fmt.Sprintf("  %d  %s\n", e.code, e.meaning); !strings.Contains(out, line) {
+			t.Errorf("mcrawl help = %q, want it to list exit code %q", out, line)
+		}
+	}
+	for _, code := range []int{exitOK, exitFailed, exitError, exitErrorRate, exitBroken} {
+		if !seen[code] {
+			t.Errorf("exit code %d isn't listed in mcrawl help", code)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	code, _, errOut := runArgs()
+	if code != exitError || !strings.Contains(errOut, "commands:") {
+		t.Errorf("mcrawl without arguments = %d, %q, want the list of commands", code, errOut)
+	}
+	code, out, _ := runArgs("help")
+	for _, cmd := range commands {
+		if !strings.Contains(out, "  "+cmd.name+" ") {
+			t.Errorf("mcrawl help = %q, want it to list %s", out, cmd.name)
+		}
+	}
+	if code != exitOK {
+		t.Errorf("mcrawl help exited %d, want %d", code, exitOK)
+	}
+
+	// Each command's help has its usage, flags and examples.
+	for _, cmd := range commands {
+		code, out, _ := runArgs("help", cmd.name)
+		if code != exitOK || !strings.HasPrefix(out, "usage: "+cmd.usage) || !strings.Contains(out, "examples:\n  "+cmd.examples[0]) {
+			t.Errorf("mcrawl help %s = %d, %q, want its usage and examples", cmd.name, code, out)
+		}
+	}
+	if _, out, _ := runArgs("help", "check"); !strings.Contains(out, "-url-file") || !strings.Contains(out, "-user-agent") {
+		t.Errorf("mcrawl help check = %q, want its own and shared flags", out)
+	}
+	if code, _, errOut := runArgs("check", "-h"); code != exitOK || !strings.Contains(errOut, "usage: mcrawl check") {
+		t.Errorf("mcrawl check -h = %d, %q, want its usage", code, errOut)
+	}
+}
+
+func TestAuthFlags(t *testing.T) {
+	var mu sync.Mutex
+	sent := make(map[string][]string)
+	record := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			sent[name] = append(sent[name], r.Header.Get("Authorization")+"|"+r.Header.Get("Cookie"))
+			mu.Unlock()
+		}
+	}
+	other := httptest.NewServer(record("other"))
+	defer other.Close()
+	// Headers are sent to a host on any port, so the other site is given
+	// another name for the same address.
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("site")(w, r)
+		w.Write([]byte(`<a href="/a">a</a><a href="` + otherURL + `/b">b</a>`))
+	}))
+	defer site.Close()
+
+	code, _, errOut := runArgs("crawl", "-no-robots", "-check", "-basic-auth", "user:pass", "-cookie", "a=1", "-cookie", "b=2", site.URL+"/")
+	if code != exitOK {
+		t.Fatalf("mcrawl crawl -basic-auth -cookie exited %d, want %d; stderr:\n%s", code, exitOK, errOut)
+	}
+	// The credentials are only sent to the site, not to others it links
+	// to.
+	want := map[string][]string{
+		"site":  {"Basic dXNlcjpwYXNz|a=1; b=2", "Basic dXNlcjpwYXNz|a=1; b=2"},
+		"other": {"|"},
+	}
+	if diff := cmp.Diff(want, sent); diff != "" {
+		t.Errorf("credentials sent mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, args := range [][]string{
+		{"-basic-auth", "user"},
+		{"-basic-auth", "user:pass", "-bearer-token", "abc"},
+		{"-cookie", "session"},
+	} {
+		args = append(append([]string{"crawl"}, args...), site.URL+"/")
+		if code, _, _ := runArgs(args...); code != exitFailed {
+			t.Errorf("mcrawl %s exited %d, want %d", strings.Join(args, " "), code, exitFailed)
+		}
+	}
+
+	// The check command sends them to the hosts of the pages listed.
+	sent = make(map[string][]string)
+	dir, err := ioutil.TempDir("", "mcrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	urlFile := filepath.Join(dir, "urls.txt")
+	if err := ioutil.WriteFile(urlFile, []byte(site.URL+"/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runArgs("check", "-no-robots", "-url-file", urlFile, "-bearer-token", "abc"); code != exitOK {
+		t.Fatalf("mcrawl check -bearer-token exited %d, want %d; stderr:\n%s", code, exitOK, errOut)
+	}
+	want = map[string][]string{
+		"site":  {"Bearer abc|", "Bearer abc|"},
+		"other": {"|"},
+	}
+	if diff := cmp.Diff(want, sent); diff != "" {
+		t.Errorf("credentials sent by check mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlannedCommands(t *testing.T) {
+	for _, name := range []string{"diff", "report", "serve", "ui"} {
+		if code, out, _ := runArgs("help", name); code != exitOK || !strings.Contains(out, "(not implemented yet).\n") || strings.Contains(out, "flags:") {
+			t.Errorf("mcrawl help %s = %d, %q, want its usage, saying it isn't implemented", name, code, out)
+		}
+		code, out, errOut := runArgs(name, "results.json")
+		if want := "mcrawl " + name + " is not implemented yet\n"; code != exitFailed || out != "" || errOut != want {
+			t.Errorf("mcrawl %s = %d, %q, %q, want %d, %q", name, code, out, errOut, exitFailed, want)
+		}
+	}
+}
@@ -0,0 +1,805 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Option configures a Crawler. Options are passed to NewCrawler.
+// An option given invalid values makes the Crawler's Crawl (and Fetch) fail
+// with an error describing the problem.
+type Option func(*Crawler)
+
+// invalid records a problem with an option's values, keeping the first.
+func (c *Crawler) invalid(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf("invalid option: "+format, args...)
+	}
+}
+
+// WithStrictHTML enables a diagnostic pass over each page's markup, which
+// records anomalies likely to make our link extraction differ from a
+// browser's as Warnings on the page's Result. It does not change which
+// links are extracted.
+func WithStrictHTML(enabled bool) Option {
+	return func(c *Crawler) {
+		c.strictHTML = enabled
+	}
+}
+
+// WithSkipNonHTML only reads and scrapes the bodies of pages that are
+// HTML: those served as HTML, or as plain text or binary data, or without a
+// type, whose content sniffs as HTML, as a browser would render them. Other
+// bodies, such as images and PDFs, aren't downloaded, though the pages'
+// Link headers are still followed. By default, every successful page is
+// scraped.
+func WithSkipNonHTML(enabled bool) Option {
+	return func(c *Crawler) {
+		c.skipNonHTML = enabled
+	}
+}
+
+// WithStrictContentType only reads and scrapes pages served as HTML, by
+// their Content-Type, as WithSkipNonHTML does but without sniffing. Pages
+// served as plain text or binary data, or without a type, whose content
+// sniffs as HTML, are otherwise scraped as HTML, as a browser would render
+// them, and their Results marked MisdeclaredContentType.
+func WithStrictContentType(enabled bool) Option {
+	return func(c *Crawler) {
+		c.strictContentType = enabled
+	}
+}
+
+// WithFailFastOnPanic lets a panic in fetching or scraping a page crash
+// the program, with its original stack, rather than be recovered and
+// recorded as the page's error. It is for development, e.g. of transport
+// middleware, where a panic is a bug to fix rather than to crawl past.
+func WithFailFastOnPanic(enabled bool) Option {
+	return func(c *Crawler) {
+		c.failFastOnPanic = enabled
+	}
+}
+
+// WithMaxSockets caps the number of connections the crawler may have open at
+// once, busy or idle, across all hosts. This is useful in environments with
+// a low limit on open files. A value of 0 (the default) means no cap.
+func WithMaxSockets(n int) Option {
+	return func(c *Crawler) {
+		c.maxSockets = n
+	}
+}
+
+// WithTransportMiddleware wraps the transport the crawler makes requests
+// with, e.g. to log, modify or fail requests. It may be given multiple times;
+// each wrapper wraps those given before it.
+func WithTransportMiddleware(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(c *Crawler) {
+		if wrap == nil {
+			c.invalid("WithTransportMiddleware: nil wrapper")
+			return
+		}
+		c.transportWrappers = append(c.transportWrappers, wrap)
+	}
+}
+
+// DefaultUserAgent is the User-Agent header sent by crawlers, unless set
+// with WithUserAgent.
+const DefaultUserAgent = "mcrawl/1.0 (+https://github.com/zdjones/crawl)"
+
+// WithUserAgent sets the User-Agent header sent with every request. Its
+// product token, up to the first / or space, is also what robots.txt rules
+// are matched against.
+func WithUserAgent(ua string) Option {
+	return func(c *Crawler) {
+		if strings.TrimSpace(ua) == "" {
+			c.invalid("WithUserAgent: empty User-Agent")
+			return
+		}
+		c.userAgent = ua
+	}
+}
+
+// WithHostHeaders sets headers to send with requests to host, on top of
+// those sent to every host, e.g. a token required by one host of a crawl.
+// The host may be *. and a domain, to match its subdomains. If several
+// patterns match a host, the headers given last win. The headers are only
+// ever sent to matching hosts: they are removed from any redirect leaving
+// them.
+func WithHostHeaders(host string, headers map[string]string) Option {
+	return func(c *Crawler) {
+		h := http.Header{}
+		for name, v := range headers {
+			if strings.TrimSpace(name) == "" {
+				c.invalid("WithHostHeaders(%s): empty header name", host)
+				return
+			}
+			h.Set(name, v)
+		}
+		c.addHostHeaders(host, h)
+	}
+}
+
+// WithHostUserAgent sets the User-Agent sent with requests to host, which
+// may be a pattern as for WithHostHeaders, instead of that set with
+// WithUserAgent. Its product token is what host's robots.txt rules are
+// matched against.
+func WithHostUserAgent(host, ua string) Option {
+	return func(c *Crawler) {
+		if strings.TrimSpace(ua) == "" {
+			c.invalid("WithHostUserAgent(%s): empty User-Agent", host)
+			return
+		}
+		c.addHostHeaders(host, http.Header{"User-Agent": {ua}})
+	}
+}
+
+func (c *Crawler) addHostHeaders(host string, h http.Header) {
+	pattern := normalizeHost(host)
+	if pattern == "" || pattern == "*." || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+		c.invalid("host pattern %q is not a host, or *. and a domain", host)
+		return
+	}
+	c.hostHeaders = append(c.hostHeaders, hostHeaders{pattern: pattern, header: h})
+}
+
+// WithDNSPrefetch looks up the DNS of each new in-scope host in the
+// background, as soon as a link to it is found, so its first request needn't
+// wait for it. A few lookups are made at once, and the addresses are cached
+// for the rest of the crawl. Stats.NewHosts times the first requests to
+// hosts with and without their DNS prefetched. It only applies to the
+// default client, not one given with WithHTTPClient.
+func WithDNSPrefetch(enabled bool) Option {
+	return func(c *Crawler) {
+		c.dns.enabled = enabled
+	}
+}
+
+// WithHTTPClient makes requests with a copy of client, e.g. for its timeout,
+// proxy, transport or cookie jar, instead of the default client, whose
+// requests time out after 30 seconds. Any transport middleware wraps the client's
+// transport, and unless the client has a CheckRedirect of its own, the
+// crawler's redirect policy is used. WithMaxSockets and the file limit
+// settings only apply to the default client's transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Crawler) {
+		if client == nil {
+			c.invalid("WithHTTPClient: nil client")
+			return
+		}
+		c.httpClient = client
+	}
+}
+
+// WithFileLimitClamp controls what happens when the crawler's concurrency
+// settings could exceed the process's limit on open files. By default a
+// warning is logged; when enabled, the number of fetchers, idle connections
+// and sockets are reduced to fit instead.
+func WithFileLimitClamp(enabled bool) Option {
+	return func(c *Crawler) {
+		c.clampToFileLimit = enabled
+	}
+}
+
+// WithHostAliases treats the given hosts as a single site, so links between
+// them are in scope for the crawl, and a path is only fetched once no matter
+// which of the hosts it is linked to on. Can be given multiple times to
+// configure several sets of aliases.
+func WithHostAliases(hosts ...string) Option {
+	return func(c *Crawler) {
+		if len(hosts) == 0 {
+			return
+		}
+		if c.hostAliases == nil {
+			c.hostAliases = make(map[string]string)
+		}
+		site := strings.ToLower(hosts[0])
+		for _, h := range hosts {
+			c.hostAliases[strings.ToLower(h)] = site
+		}
+	}
+}
+
+// WithCoalesceWWW treats each apex host and its www. subdomain (e.g.
+// example.com and www.example.com) as aliases of each other.
+func WithCoalesceWWW(enabled bool) Option {
+	return func(c *Crawler) {
+		c.coalesceWWW = enabled
+	}
+}
+
+// WithCanonicalHost rewrites links to aliases of the starting URL's host to
+// use that host, rather than fetching each page from whichever host it was
+// first linked to on.
+func WithCanonicalHost(enabled bool) Option {
+	return func(c *Crawler) {
+		c.canonicalHost = enabled
+	}
+}
+
+// WithExtraLinkAttributes configures additional attributes, by element name,
+// that scrape collects URLs from, e.g. {"a": {"data-href"}, "img":
+// {"data-src"}}. These are often promoted to real links by scripts at
+// runtime. They are recorded as the Speculative links of each Result, and
+// are only crawled if enabled with WithSpeculativeLinks.
+func WithExtraLinkAttributes(attrs map[string][]string) Option {
+	return func(c *Crawler) {
+		c.extraLinkAttrs = attrs
+	}
+}
+
+// WithAssets configures the attributes, by element name, that scrape
+// collects assets from: references other than links to follow, e.g.
+// DefaultAssetAttributes. They are recorded as the Assets of each Result,
+// tagged with their element, and never crawled. Only <a href> links are
+// collected by default.
+func WithAssets(attrs map[string][]string) Option {
+	return func(c *Crawler) {
+		c.assetAttrs = attrs
+	}
+}
+
+// WithHeaderCapture records the named response headers of each page in its
+// Result's Headers, e.g. WithHeaderCapture(CacheHeaders...) for
+// NewCacheReport. Names are case insensitive. It may be given more than
+// once, adding to the headers recorded.
+func WithHeaderCapture(names ...string) Option {
+	return func(c *Crawler) {
+		for _, name := range names {
+			if name == "" {
+				c.invalid("WithHeaderCapture: empty header name")
+				return
+			}
+			name = http.CanonicalHeaderKey(name)
+			captured := false
+			for _, h := range c.captureHeaders {
+				captured = captured || h == name
+			}
+			if !captured {
+				c.captureHeaders = append(c.captureHeaders, name)
+			}
+		}
+	}
+}
+
+// WithSpeculativeLinks enables crawling of speculative links, as well as
+// recording them.
+func WithSpeculativeLinks(enabled bool) Option {
+	return func(c *Crawler) {
+		c.followSpec = enabled
+	}
+}
+
+// WithBreadcrumbs records the breadcrumb trail of each page in its Result.
+func WithBreadcrumbs(enabled bool) Option {
+	return func(c *Crawler) {
+		c.breadcrumbs = enabled
+	}
+}
+
+// WithLinkTargets records what became of the target of each internal link
+// on a page in its Result's LinkTargets, so its broken links can be found
+// without looking up each link's Result. They refer to the results by
+// index, so are only recorded by Crawl and CrawlContext, which return them
+// all in their final order, and not by CrawlStream.
+func WithLinkTargets(enabled bool) Option {
+	return func(c *Crawler) {
+		c.linkTargets = enabled
+	}
+}
+
+// WithLinkCheck checks every link found on the crawl's pages, for broken
+// link reports with CheckedLinks: internal links by the outcome of fetching
+// their targets, and links off the site, which aren't crawled, with a HEAD
+// request each, or a GET if the server doesn't allow HEAD, once the crawl
+// is over.
+func WithLinkCheck(enabled bool) Option {
+	return func(c *Crawler) {
+		c.linkCheck = enabled
+	}
+}
+
+// WithAllowedHosts adds hosts whose links are crawled as if they were part of
+// the starting URL's site. Unlike aliases, pages on allowed hosts remain
+// distinct from those on the site itself. Hosts are matched in the same way
+// as the site's own host, ignoring case and default ports, so coalescing
+// www. applies to them too.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(c *Crawler) {
+		c.allowedHosts = append(c.allowedHosts, hosts...)
+	}
+}
+
+// WithIncludeSubdomains crawls every host registered under the same domain
+// as the starting URL's, e.g. community.monzo.com and www.monzo.com when
+// crawling monzo.com. Domains are found by the public suffix list, so
+// lookalikes such as notmonzo.com aren't included, and nor are other sites
+// under a shared suffix, such as other github.io sites. Pages on subdomains
+// remain distinct from those on the site itself, as with WithAllowedHosts.
+func WithIncludeSubdomains(enabled bool) Option {
+	return func(c *Crawler) {
+		c.subdomains = enabled
+	}
+}
+
+// WithSafeExclusions skips links matching the SafeExclusions rules: those
+// that change state when fetched, such as logging out or adding to a cart,
+// and endless or duplicate views, such as calendars and print pages. Each
+// link skipped is counted in Stats.Excluded by the rule it matched.
+// Individual rules can be disabled with WithoutExclusions.
+func WithSafeExclusions(enabled bool) Option {
+	return func(c *Crawler) {
+		c.safeExclusions = enabled
+	}
+}
+
+// WithoutExclusions disables the named SafeExclusions rules, e.g. "print".
+func WithoutExclusions(names ...string) Option {
+	return func(c *Crawler) {
+		for _, name := range names {
+			if !hasExclusion(SafeExclusions, name) {
+				c.invalid("WithoutExclusions: no exclusion rule %q", name)
+				return
+			}
+		}
+		c.disabledRules = append(c.disabledRules, names...)
+	}
+}
+
+// WithExcludePatterns skips links matching any of the regular expressions,
+// such as those of calendars or faceted search. They are matched against
+// the whole link, once resolved and normalized, e.g.
+// "https://example.com/search/". Links skipped are still recorded in their
+// pages' Links, and counted in Stats.Excluded by pattern. The starting URL
+// is always fetched, even if it matches.
+func WithExcludePatterns(patterns ...string) Option {
+	return func(c *Crawler) {
+		c.excludePatterns = append(c.excludePatterns, c.compilePatterns("WithExcludePatterns", patterns)...)
+	}
+}
+
+// WithIncludePatterns only crawls links matching at least one of the
+// regular expressions, e.g. "^https://example.com/docs/" to crawl under a
+// path. They are matched as WithExcludePatterns's are, and links matching
+// both are excluded. Links not matching are still recorded in their pages'
+// Links, and the starting URL is always fetched, even if it doesn't match.
+func WithIncludePatterns(patterns ...string) Option {
+	return func(c *Crawler) {
+		c.includePatterns = append(c.includePatterns, c.compilePatterns("WithIncludePatterns", patterns)...)
+	}
+}
+
+// WithSeeds queues further URLs at depth 0 alongside the starting URL, such
+// as those from SeedsFromResults, so a crawl can revalidate the pages an
+// earlier one found rather than rediscover them. Seeds are filtered as links
+// on the starting page would be: those out of scope, excluded, or not
+// included are skipped, and counted in Stats.SkippedSeeds. They are queued
+// once the starting URL has been fetched, so if it redirects to another
+// site, they are scoped to that site instead.
+func WithSeeds(urls ...string) Option {
+	return func(c *Crawler) {
+		c.seeds = append(c.seeds, urls...)
+	}
+}
+
+// WithExcludedLinks records the targets of the internal links not crawled
+// because they matched an exclusion rule or pattern, with the pages linking
+// to them, for ExcludedLinks. They aren't fetched. To bound the memory held
+// on sites with many such links, up to maxTargets targets are recorded,
+// each with up to maxPages of the pages linking to it.
+func WithExcludedLinks(maxTargets, maxPages int) Option {
+	return func(c *Crawler) {
+		if maxTargets <= 0 || maxPages <= 0 {
+			c.invalid("WithExcludedLinks: limits %d and %d are not both positive", maxTargets, maxPages)
+			return
+		}
+		c.excludedTargets, c.excludedPages = maxTargets, maxPages
+	}
+}
+
+// WithURLTemplates groups pages by template, in each Result's PageGroup
+// and the Summary's PageGroups, e.g. for rolling up analytics. A page's
+// group is the first of the templates its path matches, where a {name}
+// segment matches any one segment, e.g. /blog/{yyyy}/{mm}/{slug}. Pages
+// matching none are grouped by their paths with the segments that look
+// like identifiers, numbers and UUIDs, replaced, e.g. /product/{id}. With
+// no templates, all pages are grouped that way.
+func WithURLTemplates(templates ...string) Option {
+	return func(c *Crawler) {
+		for _, raw := range templates {
+			t, err := parseURLTemplate(raw)
+			if err != nil {
+				c.invalid("WithURLTemplates: %v", err)
+				return
+			}
+			c.urlTemplates = append(c.urlTemplates, t)
+		}
+		c.pageGroups = true
+	}
+}
+
+// WithDirectoryIndex treats a directory path with and without a trailing
+// slash, and with any of the given index documents (e.g. "index.html"), as
+// the same page, for servers that serve them all identically. Only the first
+// form found is fetched.
+func WithDirectoryIndex(names ...string) Option {
+	return func(c *Crawler) {
+		c.dirIndex = true
+		c.indexDocuments = append(c.indexDocuments, names...)
+	}
+}
+
+// WithErrorRateAbort aborts the crawl once at least minSamples pages have
+// been fetched and more than threshold (a fraction, e.g. 0.5) of them have
+// failed, which usually means the crawl is misconfigured rather than the
+// site broken. Crawl then returns the results so far, and an
+// *ErrorRateError.
+func WithErrorRateAbort(threshold float64, minSamples int) Option {
+	return func(c *Crawler) {
+		if threshold < 0 || threshold >= 1 {
+			c.invalid("WithErrorRateAbort: threshold %v is not in [0, 1)", threshold)
+			return
+		}
+		if minSamples < 1 {
+			c.invalid("WithErrorRateAbort: minSamples %d is not positive", minSamples)
+			return
+		}
+		c.abortErrorRate, c.abortMinSamples = threshold, minSamples
+	}
+}
+
+// WithProgress calls fn with the crawl's Stats every interval while it
+// runs, or after each page is fetched if interval is 0, and once more when
+// it finishes. It is called from the goroutine running the crawl, never
+// concurrently, so it needn't synchronize, but it holds up the crawl while
+// it runs, so should be quick.
+func WithProgress(interval time.Duration, fn func(Stats)) Option {
+	return func(c *Crawler) {
+		if fn == nil {
+			c.invalid("WithProgress: nil func")
+			return
+		}
+		if interval < 0 {
+			c.invalid("WithProgress: interval %v is negative", interval)
+			return
+		}
+		c.onProgress, c.progressEvery = fn, interval
+	}
+}
+
+// WithProgressFile writes a Checkpoint of the crawl's progress to the file
+// at path every interval while it runs, and once more when it finishes, as
+// JSON, so something watching a long crawl, such as a health check, can
+// tell it is still alive by how recently the checkpoint was written. Each
+// checkpoint atomically replaces the last. Writing them never holds up the
+// crawl, and failing to is logged, but doesn't fail it.
+func WithProgressFile(path string, interval time.Duration) Option {
+	return func(c *Crawler) {
+		if path == "" {
+			c.invalid("WithProgressFile: empty path")
+			return
+		}
+		if interval <= 0 {
+			c.invalid("WithProgressFile: interval %v is not positive", interval)
+			return
+		}
+		c.checkpoints = &checkpointFile{path: path, every: interval}
+	}
+}
+
+// WithClock sets the clock the crawler measures time with, e.g. a
+// crawltest.Clock in tests. Request timeouts, which are enforced by the
+// standard library, always use the real clock.
+func WithClock(clk Clock) Option {
+	return func(c *Crawler) {
+		if clk == nil {
+			c.invalid("WithClock: nil clock")
+			return
+		}
+		c.clock = clk
+	}
+}
+
+// WithMaxRedirects sets the number of redirects followed per request, 10 by
+// default. Requests needing more fail.
+func WithMaxRedirects(n int) Option {
+	return func(c *Crawler) {
+		if n < 0 {
+			c.invalid("WithMaxRedirects: %d is negative", n)
+			return
+		}
+		c.maxRedirects = n
+	}
+}
+
+// WithFollowRedirects sets whether redirects are followed, as they are by
+// default. If not, a redirect is the outcome of its page: its Result has the
+// 3xx StatusCode and the Location it redirects to, which is crawled as a
+// link, if it is in scope. This is for auditing a site's redirects; their
+// targets' Results have no FinalURL or Redirects. robots.txt and sitemaps
+// are still fetched through redirects.
+func WithFollowRedirects(enabled bool) Option {
+	return func(c *Crawler) {
+		c.noFollow = !enabled
+	}
+}
+
+// WithRetries retries pages that fail transiently, making up to maxAttempts
+// requests for each: those failing without a response, or with a 429 or 5xx
+// response. Other failures, such as 404s, are never retried. Each retry
+// waits for backoff, doubled for each attempt so far, with jitter, or longer
+// if the response's Retry-After header asks for it, up to a minute. A body
+// whose transfer broke off partway is resumed from where it did with a Range
+// request, if the server advertised Accept-Ranges: bytes and a strong ETag
+// to check the rest is of the same version, and the body wasn't compressed;
+// otherwise it is fetched again in full.
+func WithRetries(maxAttempts int, backoff time.Duration) Option {
+	return func(c *Crawler) {
+		if maxAttempts < 1 {
+			c.invalid("WithRetries: %d attempts is less than 1", maxAttempts)
+			return
+		}
+		if backoff < 0 {
+			c.invalid("WithRetries: backoff %v is negative", backoff)
+			return
+		}
+		c.retries = retryPolicy{attempts: maxAttempts, backoff: backoff}
+	}
+}
+
+// WithRedirectBudget sets the number of redirects a crawl may follow in
+// total before Stats.OverRedirectBudget is set. Each redirect is another
+// request, so a site with many of them is loaded more heavily, and crawled
+// more slowly, than its number of pages suggests. The crawl carries on
+// regardless.
+func WithRedirectBudget(n int) Option {
+	return func(c *Crawler) {
+		if n <= 0 {
+			c.invalid("WithRedirectBudget: %d is not positive", n)
+			return
+		}
+		c.redirectBudget = int64(n)
+	}
+}
+
+// WithSessionDetection enables the inference of SessionRules: when enough
+// URLs differ only in one random-looking path segment, and all serve the same
+// content once it is removed, the segment is taken to be a session ID, and
+// further URLs differing only in it are not crawled. Inferred rules are
+// reported by Crawler.SessionRules.
+func WithSessionDetection(t SessionThresholds) Option {
+	return func(c *Crawler) {
+		if t.MinSamples < 2 {
+			c.invalid("WithSessionDetection: MinSamples %d is less than 2", t.MinSamples)
+			return
+		}
+		c.sessions.enabled, c.sessions.thresholds = true, t
+	}
+}
+
+// WithSessionRules sets rules collapsing session IDs in URLs, e.g. those
+// inferred by a previous crawl with WithSessionDetection. It may be given
+// multiple times.
+func WithSessionRules(rules ...SessionRule) Option {
+	return func(c *Crawler) {
+		for _, r := range rules {
+			r.Samples = 0
+			c.sessions.pinned = append(c.sessions.pinned, r)
+		}
+	}
+}
+
+// WithResultOrder sets the order Crawl returns results in, e.g. SortByDepth.
+// By default they are sorted by URL.
+func WithResultOrder(order func([]Result)) Option {
+	return func(c *Crawler) {
+		if order == nil {
+			c.invalid("WithResultOrder: nil order")
+			return
+		}
+		c.resultOrder = order
+	}
+}
+
+// WithResultFilter drops the results keep returns false for, e.g. those
+// made with OnlyContentTypes, so they aren't returned by Crawl, sent by
+// CrawlStream, passed to the sink set with WithLinkSpill, or included in
+// Summary. Their pages are still fetched, and their links followed, so
+// filtering doesn't change what the crawl finds, and they are still counted
+// in Stats, with those dropped counted in Stats.Filtered. As link counts
+// such as Inbound are made from the results kept, links from dropped pages
+// aren't counted. Given more than once, results must pass every filter.
+func WithResultFilter(keep func(Result) bool) Option {
+	return func(c *Crawler) {
+		if keep == nil {
+			c.invalid("WithResultFilter: nil filter")
+			return
+		}
+		c.resultFilters = append(c.resultFilters, keep)
+	}
+}
+
+// WithAcceptableStatuses treats the responses accept returns true for, given
+// their status and URL, as reachable rather than broken, such as 401s for
+// pages behind a login: see AcceptStatusesUnder. Their results keep their
+// StatusCode, but have no Err, are marked AccessControlled, and are counted
+// in Stats.AccessControlled rather than Errors. Their bodies aren't
+// scraped. Given more than once, a status accepted by any is.
+func WithAcceptableStatuses(accept func(status int, u *url.URL) bool) Option {
+	return func(c *Crawler) {
+		if accept == nil {
+			c.invalid("WithAcceptableStatuses: nil func")
+			return
+		}
+		c.acceptStatuses = append(c.acceptStatuses, accept)
+	}
+}
+
+// WithMaxLinksPerPage limits the number of links collected from each page.
+// Generated pages such as tag clouds and calendars can have tens of
+// thousands, and resolving and deduplicating them all dominates the crawl.
+// Links beyond the limit are dropped while scraping, before any of that
+// work, and the page's Result is marked LinksTruncated.
+func WithMaxLinksPerPage(n int) Option {
+	return func(c *Crawler) {
+		if n <= 0 {
+			c.invalid("WithMaxLinksPerPage: %d is not positive", n)
+			return
+		}
+		c.maxLinksPerPage = n
+	}
+}
+
+// WithMaxBodySize limits the bytes of each page's body read, after any
+// decompression, to n, so a huge or endless response can't exhaust memory.
+// Pages with longer bodies fail with ErrBodyTooLarge or, if truncate is
+// set, have the first n bytes scraped, and their Result marked
+// BodyTruncated. The default is DefaultMaxBodySize, failing.
+func WithMaxBodySize(n int64, truncate bool) Option {
+	return func(c *Crawler) {
+		if n <= 0 {
+			c.invalid("WithMaxBodySize: %d is not positive", n)
+			return
+		}
+		c.maxBodySize, c.truncateBodies = n, truncate
+	}
+}
+
+// WithLinkSpill keeps the memory held by the results of pages with many
+// links bounded. Each page with more than threshold links is passed to sink,
+// with all of them, as soon as they have been followed, and its Result in
+// those returned by Crawl keeps only the first threshold, marked
+// LinksSpilled. Its Outbound counts are made from all its links, before
+// they are spilled, but what is made from the results at the end of the
+// crawl only sees the links kept: the Inbound counts and Referrers of the
+// pages it links to, its LinkTargets, and reports such as
+// NormalizationReport. The Result passed to sink doesn't yet have Inbound
+// counts or Referrers of its own. The sink is called from the crawl's goroutine, so
+// holds up the crawl while it runs.
+func WithLinkSpill(threshold int, sink func(Result)) Option {
+	return func(c *Crawler) {
+		if threshold < 0 || sink == nil {
+			c.invalid("WithLinkSpill: threshold %d is negative, or no sink", threshold)
+			return
+		}
+		c.spillThreshold, c.spill = threshold, sink
+	}
+}
+
+// WithCrawlWindow restricts crawling to a time of day, from start until end,
+// given as the time since midnight in loc, e.g. 22*time.Hour and 6*time.Hour
+// for overnight. Outside the window no new requests are made, though those
+// in progress at its end are allowed to finish, and the crawl waits for it to
+// open again, as recorded in Stats.Paused.
+func WithCrawlWindow(start, end time.Duration, loc *time.Location) Option {
+	return func(c *Crawler) {
+		if start < 0 || start >= 24*time.Hour || end < 0 || end >= 24*time.Hour {
+			c.invalid("WithCrawlWindow: %v-%v is not within a day", start, end)
+			return
+		}
+		if start == end {
+			c.invalid("WithCrawlWindow: window %v-%v is empty", start, end)
+			return
+		}
+		if loc == nil {
+			c.invalid("WithCrawlWindow: nil location")
+			return
+		}
+		c.window = &crawlWindow{start, end, loc}
+	}
+}
+
+// WithMaxDepth limits the crawl to pages at most n links from the starting
+// URL, so 0 only fetches the starting URL. Links on pages at the maximum
+// depth are recorded in their Results, but not followed.
+func WithMaxDepth(n int) Option {
+	return func(c *Crawler) {
+		if n < 0 {
+			c.invalid("WithMaxDepth: %d is negative", n)
+			return
+		}
+		c.maxDepth = n
+	}
+}
+
+// WithMaxPages stops the crawl once n pages have been fetched. Pages being
+// fetched when the limit is reached are finished, and Crawl returns the
+// results as usual, with Stats.Truncated set if there were more to fetch.
+func WithMaxPages(n int) Option {
+	return func(c *Crawler) {
+		if n <= 0 {
+			c.invalid("WithMaxPages: %d is not positive", n)
+			return
+		}
+		c.maxPages = n
+	}
+}
+
+// WithLiteralScope scopes the crawl to the starting URL's site as given,
+// even if it redirects to another, e.g. from http://example.com to
+// https://www.example.com. By default, the crawl follows the redirect, and
+// is scoped to where it leads.
+func WithLiteralScope(enabled bool) Option {
+	return func(c *Crawler) {
+		c.literalScope = enabled
+	}
+}
+
+// WithIgnoreRobots fetches pages whatever the robots.txt of their site says,
+// for crawling your own sites. By default, the robots.txt of each host is
+// fetched before its first page, and pages it disallows for the crawler's
+// User-Agent, or failing a group for that, for *, are skipped.
+func WithIgnoreRobots(enabled bool) Option {
+	return func(c *Crawler) {
+		c.robots.ignore = enabled
+	}
+}
+
+// WithRequestTimeout bounds how long each request may take, including
+// reading the body, unless overridden for its URL with WithTimeoutOverride.
+// A page that takes longer is still in the results, with an Err wrapping
+// context.DeadlineExceeded. It is 30 seconds by default, unless a client is
+// given with WithHTTPClient, when only the client's own Timeout applies.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d <= 0 {
+			c.invalid("WithRequestTimeout: timeout %v is not positive", d)
+			return
+		}
+		c.requestTimeout = d
+	}
+}
+
+// WithDelay sets the minimum time between the starts of requests to the
+// same host, to be polite to the sites crawled. Fetchers wait their turn for
+// a host rather than erroring, so a long delay slows the crawl to one
+// request per delay, whatever the number of fetchers.
+func WithDelay(d time.Duration) Option {
+	return func(c *Crawler) {
+		if d < 0 {
+			c.invalid("WithDelay: delay %v is negative", d)
+			return
+		}
+		c.delays.delay = d
+	}
+}
+
+// WithTimeoutOverride sets the timeout for requests to URLs matching the
+// pattern. It may be given multiple times, and the first matching pattern
+// wins. The timeout covers the whole request, including reading the body.
+func WithTimeoutOverride(pattern *regexp.Regexp, d time.Duration) Option {
+	return func(c *Crawler) {
+		if pattern == nil {
+			c.invalid("WithTimeoutOverride: nil pattern")
+			return
+		}
+		if d <= 0 {
+			c.invalid("WithTimeoutOverride(%s): timeout %v is not positive", pattern, d)
+			return
+		}
+		c.timeoutOverrides = append(c.timeoutOverrides, timeoutOverride{pattern, d})
+	}
+}
@@ -0,0 +1,493 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page is a single fetched web page. Its contents are only parsed when
+// first asked for.
+type Page struct {
+	// URL is the URL that was requested.
+	URL string
+	// FinalURL is the URL the page was eventually served from, after
+	// following any redirects.
+	FinalURL   string
+	StatusCode int
+	// Redirects is the number of redirects followed to reach FinalURL,
+	// and RedirectChain the URLs redirected from, in order, starting with
+	// the one requested.
+	Redirects     int
+	RedirectChain []string
+	// Location is the URL a redirect that wasn't followed redirects to, as
+	// given in its Location header.
+	Location string
+	Header   http.Header
+	// TLS describes the connection the page was served over, or is nil if
+	// TLS wasn't used.
+	TLS *TLSInfo
+	// Proto is the HTTP version of the response, e.g. "HTTP/2.0".
+	Proto string
+	// ContentEncoding is the encoding the server compressed the body with,
+	// e.g. "gzip", or "" if it wasn't. Unlike the Content-Encoding header,
+	// it is set when the body was transparently decompressed.
+	ContentEncoding string
+	// Body is only read for successful (200) responses, and with
+	// WithSkipNonHTML or WithStrictContentType, only for those that may be
+	// HTML, so e.g. images and PDFs aren't downloaded.
+	Body []byte
+	// BytesOnWire is the size of the body as transferred, before any
+	// decompression, and BytesDecoded its size after. Both are 0 if the
+	// body wasn't read.
+	BytesOnWire  int64
+	BytesDecoded int64
+	// BodyTruncated is set if the body was longer than the limit set with
+	// WithMaxBodySize, and only the first part was read, to be scraped.
+	BodyTruncated bool
+	// ResumedFrom is the offset the body was resumed from with a Range
+	// request, after an earlier attempt to read it failed partway, or 0
+	// if it was read in one go. See WithRetries.
+	ResumedFrom int64
+	// Duration is the time taken to fetch the page, from making the
+	// request, including connecting and following redirects, to reading
+	// the body, including that of the attempt it was resumed from.
+	Duration time.Duration
+	// interrupted is set if reading the body failed partway, for want
+	// of a working connection, so Body holds the part read.
+	interrupted bool
+
+	extraLinkAttrs map[string][]string
+	assetAttrs     map[string][]string
+	maxLinks       int
+
+	once     sync.Once
+	scraped  scraped
+	parseErr error
+}
+
+func (p *Page) parse() {
+	p.once.Do(func() {
+		p.scraped, p.parseErr = scrape(p.Body, p.extraLinkAttrs, p.assetAttrs, p.maxLinks)
+	})
+}
+
+// Links returns the raw href values of the links on the page, or an error
+// if it could not be parsed as HTML.
+func (p *Page) Links() ([]string, error) {
+	p.parse()
+	return p.scraped.links, p.parseErr
+}
+
+// Base returns the URL the page's links are relative to: that set by its
+// first <base> element, resolved against FinalURL, or "" if it has none, or
+// it can't be parsed.
+func (p *Page) Base() string {
+	p.parse()
+	if p.scraped.base == "" {
+		return ""
+	}
+	final, err := url.Parse(p.FinalURL)
+	if err != nil {
+		return ""
+	}
+	base, err := final.Parse(p.scraped.base)
+	if err != nil {
+		return ""
+	}
+	return base.String()
+}
+
+// LinksTruncated reports whether Links stopped short of all the links on the
+// page, at the limit set with WithMaxLinksPerPage.
+func (p *Page) LinksTruncated() bool {
+	p.parse()
+	return p.scraped.truncated
+}
+
+// FallbackExtraction reports whether the page couldn't be parsed as HTML, and
+// its links were found by scanning its raw markup instead.
+func (p *Page) FallbackExtraction() bool {
+	p.parse()
+	return p.scraped.fallback
+}
+
+// Speculative returns the speculative links on the page, collected from the
+// attributes configured with WithExtraLinkAttributes.
+func (p *Page) Speculative() []string {
+	p.parse()
+	return p.scraped.speculative
+}
+
+// Assets returns the assets on the page, collected from the attributes
+// configured with WithAssets.
+func (p *Page) Assets() []Asset {
+	p.parse()
+	return p.scraped.assets
+}
+
+// Title returns the page's title, with whitespace collapsed, or "" if it
+// has none.
+func (p *Page) Title() string {
+	p.parse()
+	return p.scraped.title
+}
+
+// Meta returns the content of the page's <meta> elements, keyed by their
+// lowercased name (or property) attribute.
+func (p *Page) Meta() map[string]string {
+	p.parse()
+	return p.scraped.meta
+}
+
+// Breadcrumbs returns the page's breadcrumb trail, from a JSON-LD
+// BreadcrumbList or <nav aria-label="breadcrumb"> markup, or nil if it has
+// none.
+func (p *Page) Breadcrumbs() []string {
+	p.parse()
+	return p.scraped.breadcrumbs
+}
+
+// Relations returns the relations the page declares to other pages, in its
+// HTML and its Link headers.
+func (p *Page) Relations() Relations {
+	p.parse()
+	return mergeRelations(p.scraped.rels, p.Header)
+}
+
+// ContentType returns the media type of the page from its Content-Type
+// header, lowercased and without parameters, or "" if it has none.
+func (p *Page) ContentType() string {
+	ct := p.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		return mt
+	}
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// htmlTypes are the media types of HTML documents.
+var htmlTypes = map[string]bool{"text/html": true, "application/xhtml+xml": true}
+
+// sniffedTypes are the media types misconfigured servers commonly serve
+// HTML as, which browsers sniff the content of instead of trusting.
+var sniffedTypes = map[string]bool{"": true, "text/plain": true, "application/octet-stream": true}
+
+// scrapes reports whether the page should be scraped as HTML. Pages served
+// as HTML always are, as are, unless WithStrictContentType is set, those
+// served without a type or as one of sniffedTypes whose body sniffs as
+// HTML: misdeclared is set for these if a type was given. Any other page
+// is too, unless only HTML is scraped.
+func (c Crawler) scrapes(p *Page) (scrape, misdeclared bool) {
+	ct := p.ContentType()
+	if htmlTypes[ct] {
+		return true, false
+	}
+	if !c.strictContentType && sniffedTypes[ct] {
+		if sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(p.Body)); sniffed == "text/html" {
+			return true, ct != ""
+		}
+	}
+	return !c.htmlOnly(), false
+}
+
+// htmlOnly reports whether only the bodies of pages that may be HTML are
+// read and scraped, as set with WithSkipNonHTML or WithStrictContentType.
+func (c Crawler) htmlOnly() bool {
+	return c.skipNonHTML || c.strictContentType
+}
+
+// Fetch fetches a single page, configured by the same options as a Crawler.
+// If the response is not a 200, the page is returned (without a Body) along
+// with an error. With WithSkipNonHTML, bodies that can't be HTML aren't
+// read.
+func Fetch(ctx context.Context, addr string, opts ...Option) (*Page, error) {
+	c := NewCrawler(1, opts...)
+	if c.err != nil {
+		return nil, c.err
+	}
+	defer c.client.CloseIdleConnections()
+	return c.getHTTP(ctx, addr)
+}
+
+// timeoutOverride is a timeout for requests to URLs matching a pattern.
+type timeoutOverride struct {
+	pattern *regexp.Regexp
+	timeout time.Duration
+}
+
+// timeoutFor returns the timeout for requests to addr, or 0 for none: that
+// of the first matching override, or the request timeout.
+func (c Crawler) timeoutFor(addr string) time.Duration {
+	for _, o := range c.timeoutOverrides {
+		if o.pattern.MatchString(addr) {
+			return o.timeout
+		}
+	}
+	return c.effectiveRequestTimeout()
+}
+
+// effectiveRequestTimeout returns the timeout set with WithRequestTimeout,
+// or else defaultTimeout, unless the client was given with WithHTTPClient,
+// whose own Timeout is left to apply alone.
+func (c Crawler) effectiveRequestTimeout() time.Duration {
+	if c.requestTimeout == 0 && c.httpClient == nil {
+		return defaultTimeout
+	}
+	return c.requestTimeout
+}
+
+// getHTTP fetches a page, counting the request in the crawler's stats under
+// the purpose ctx is tagged with.
+func (c Crawler) getHTTP(ctx context.Context, addr string) (*Page, error) {
+	return c.getHTTPFrom(ctx, addr, nil)
+}
+
+// getHTTPFrom is getHTTP, given the page from an earlier attempt. If reading
+// that page's body failed partway, and it can be resumed, only the rest of
+// it is requested. Should the server answer with anything other than the
+// rest of the same version, such as a 200 for a changed page, the page is
+// read afresh, as part of the same request: without waiting out the host's
+// delay again, or being counted twice.
+func (c Crawler) getHTTPFrom(ctx context.Context, addr string, partial *Page) (p *Page, err error) {
+	if err := c.delays.wait(ctx, c.clock, hostname(addr)); err != nil {
+		return nil, fmt.Errorf("getHTTP(%s) waiting to make request: %w", addr, err)
+	}
+	start := c.clock.Now()
+	defer func() {
+		took := c.since(start)
+		if p != nil {
+			p.Duration = took
+			if p.ResumedFrom > 0 {
+				p.Duration += partial.Duration
+			}
+		}
+		c.counters.recordRequest(purposeOf(ctx), took, err != nil)
+	}()
+
+	if first, prefetched := c.dns.firstRequest(hostname(addr)); first {
+		// Only the first response counts, not those of any redirects.
+		var once sync.Once
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotFirstResponseByte: func() {
+				once.Do(func() { c.counters.recordNewHost(prefetched, c.since(start)) })
+			},
+		})
+	}
+	if d := c.timeoutFor(addr); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	offset := partial.resumeOffset()
+	var res *http.Response
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("getHTTP(%s) invalid request: %w", addr, err)
+		}
+		c.decorate(req)
+		// Asking for gzip ourselves stops the transport decompressing
+		// the body transparently, so its size on the wire can be
+		// counted.
+		req.Header.Set("Accept-Encoding", "gzip")
+		if offset > 0 {
+			partial.requestRest(req, offset)
+		}
+		res, err = c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("getHTTP(%s) failed GET request: %w", addr, &NetworkError{classifyNetError(err)})
+		}
+		if offset == 0 || res.StatusCode != http.StatusPartialContent || partial.continuedBy(res, offset) {
+			break
+		}
+		res.Body.Close()
+		partial, offset = nil, 0
+	}
+	defer res.Body.Close()
+
+	p = &Page{
+		URL:             addr,
+		FinalURL:        res.Request.URL.String(),
+		StatusCode:      res.StatusCode,
+		Redirects:       redirects(res),
+		RedirectChain:   redirectChain(res),
+		Header:          res.Header,
+		TLS:             newTLSInfo(res.TLS),
+		Proto:           res.Proto,
+		ContentEncoding: contentEncoding(res),
+		extraLinkAttrs:  c.extraLinkAttrs,
+		assetAttrs:      c.assetAttrs,
+		maxLinks:        c.maxLinksPerPage,
+	}
+	// A redirect is only returned unfollowed with WithFollowRedirects
+	// (false), or if it leads off the site being crawled.
+	if isRedirect(res.StatusCode) && (c.noFollow || res.Header.Get("Location") != "") {
+		p.Location = res.Header.Get("Location")
+		return p, nil
+	}
+	if offset > 0 && res.StatusCode == http.StatusPartialContent {
+		p.StatusCode, p.ResumedFrom = http.StatusOK, offset
+	}
+	if p.StatusCode != 200 {
+		return p, fmt.Errorf("getHTTP(%s) %w", addr, &HTTPError{StatusCode: res.StatusCode, Status: res.Status})
+	}
+	// With WithSkipNonHTML, only page bodies that may be scraped are read,
+	// so e.g. a large PDF isn't downloaded only to be discarded. Others,
+	// such as robots.txt, are always read.
+	purpose := purposeOf(ctx)
+	ct := p.ContentType()
+	htmlOnly := c.htmlOnly() && (purpose == PurposePage || purpose == PurposeRetry)
+	if htmlOnly && !htmlTypes[ct] && (c.strictContentType || !sniffedTypes[ct]) {
+		return p, nil
+	}
+	wire := &countingReader{r: res.Body}
+	var body io.Reader = wire
+	if p.ContentEncoding == "gzip" && !res.Uncompressed {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return p, fmt.Errorf("getHTTP(%s) failed reading body: %w", addr, bodyError(err))
+		}
+		defer gz.Close()
+		body = gz
+	}
+	if htmlOnly && !htmlTypes[ct] && p.ResumedFrom == 0 {
+		// Read only as much as is needed to sniff the type, and the
+		// rest if it's HTML. A resumed body was sniffed when its start
+		// was read.
+		head, err := readHead(body, sniffLen)
+		if err != nil {
+			return p, fmt.Errorf("getHTTP(%s) failed reading body: %w", addr, bodyError(err))
+		}
+		if sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head)); sniffed != "text/html" {
+			return p, nil
+		}
+		body = io.MultiReader(bytes.NewReader(head), body)
+	}
+	// Read one byte over the limit, to tell a body of exactly the limit
+	// from a longer one.
+	p.Body, err = ioutil.ReadAll(io.LimitReader(body, c.maxBodySize+1-p.ResumedFrom))
+	p.BytesOnWire = wire.n
+	if p.ResumedFrom > 0 {
+		p.Body = append(partial.Body[:offset:offset], p.Body...)
+		p.BytesOnWire += partial.BytesOnWire
+	}
+	tooLarge := int64(len(p.Body)) > c.maxBodySize
+	if tooLarge {
+		p.Body, p.BodyTruncated = p.Body[:c.maxBodySize], c.truncateBodies
+	}
+	p.BytesDecoded = int64(len(p.Body))
+	if err != nil {
+		err = bodyError(err)
+		// There is no more of a body too large worth resuming.
+		var netErr *NetworkError
+		p.interrupted = errors.As(err, &netErr) && !tooLarge
+		return p, fmt.Errorf("getHTTP(%s) failed reading body: %w", addr, err)
+	}
+	if tooLarge && !c.truncateBodies {
+		p.Body = nil
+		return p, fmt.Errorf("getHTTP(%s) read %d bytes: %w", addr, c.maxBodySize, ErrBodyTooLarge)
+	}
+	return p, nil
+}
+
+// DefaultMaxBodySize is the most bytes of a page's body read, unless
+// changed with WithMaxBodySize.
+const DefaultMaxBodySize = 10 << 20
+
+// ErrBodyTooLarge is wrapped by the Err of results for pages whose bodies
+// were longer than the limit set with WithMaxBodySize, unless they are set
+// to be truncated. They aren't retried.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// sniffLen is the most of a body http.DetectContentType considers.
+const sniffLen = 512
+
+// readHead reads up to the first n bytes of r, or all of it if shorter.
+func readHead(r io.Reader, n int) ([]byte, error) {
+	head := make([]byte, n)
+	read, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:read], err
+}
+
+// redirectChain returns the URLs of the requests redirected from to reach a
+// response, in order, or nil if there were none.
+func redirectChain(res *http.Response) []string {
+	var chain []string
+	for r := res.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		chain = append(chain, r.Response.Request.URL.String())
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// isRedirect reports whether a status is that of a redirect the client
+// would follow.
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// hostname returns the host of a URL, without any port, or "" if it can't
+// be parsed.
+func hostname(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// contentEncoding returns the encoding the server sent the response body
+// with. The transport removes the Content-Encoding header when it decompresses
+// a gzipped body itself, so that case is found with Uncompressed instead.
+func contentEncoding(res *http.Response) string {
+	if res.Uncompressed {
+		return "gzip"
+	}
+	return strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+}
+
+// redirects returns the number of redirects followed to get a response.
+func redirects(res *http.Response) int {
+	n := 0
+	for r := res.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,333 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.Write([]byte(`<!DOCTYPE html>
+<html>
+<head>
+<title>
+  The <b>new</b>   page
+</title>
+<meta name="Description" content="A new page">
+<meta property="og:title" content="New">
+</head>
+<body>
+<a href="/foo">foo</a>
+<img data-src="/lazy.png">
+<iframe srcdoc="<title>Embedded</title><a href=&quot;/bar&quot;>bar</a>"></iframe>
+</body>
+</html>
+`))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	p, err := Fetch(context.Background(), ts.URL+"/old", WithExtraLinkAttributes(map[string][]string{"img": {"data-src"}}))
+	if err != nil {
+		t.Fatalf("Fetch erred when not expected: %v", err)
+	}
+	if p.URL != ts.URL+"/old" || p.FinalURL != ts.URL+"/new" {
+		t.Errorf("Fetch() URL, FinalURL = %s, %s, want %s, %s", p.URL, p.FinalURL, ts.URL+"/old", ts.URL+"/new")
+	}
+	if p.StatusCode != 200 || p.Header.Get("X-Test") != "yes" {
+		t.Errorf("Fetch() StatusCode, X-Test = %d, %q, want 200, %q", p.StatusCode, p.Header.Get("X-Test"), "yes")
+	}
+
+	links, err := p.Links()
+	if err != nil {
+		t.Errorf("Links() erred when not expected: %v", err)
+	}
+	if diff := cmp.Diff([]string{"/foo", "/bar"}, links); diff != "" {
+		t.Errorf("Links() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"/lazy.png"}, p.Speculative()); diff != "" {
+		t.Errorf("Speculative() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := p.Title(), "The <b>new</b> page"; got != want {
+		t.Errorf("Title() = %q, want %q", got, want)
+	}
+	wantMeta := map[string]string{"description": "A new page", "og:title": "New"}
+	if diff := cmp.Diff(wantMeta, p.Meta()); diff != "" {
+		t.Errorf("Meta() mismatch (-want +got):\n%s", diff)
+	}
+
+	p, err = Fetch(context.Background(), ts.URL+"/missing")
+	if err == nil {
+		t.Errorf("Fetch(/missing) did not err, want error")
+	}
+	if p == nil || p.StatusCode != 404 {
+		t.Errorf("Fetch(/missing) = %+v, want page with StatusCode 404", p)
+	}
+}
+
+func TestProtoAndEncoding(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		if r.URL.Path == "/plain" || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(`<a href="/plain">plain</a>`))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`<a href="/plain">plain</a>`))
+		gz.Close()
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	c := NewCrawler(1)
+	c.client = ts.Client()
+	c.fetch = c.fetchHTTP
+	results, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	want := []Result{
+		{URL: ts.URL + "/", Links: []string{"/plain"}, StatusCode: 200, ContentType: "text/html", Proto: "HTTP/2.0", ContentEncoding: "gzip"},
+		{URL: ts.URL + "/plain", Links: []string{"/plain"}, StatusCode: 200, ContentType: "text/html", Proto: "HTTP/2.0"},
+	}
+	got := make([]Result, len(results))
+	for i, r := range results {
+		got[i] = Result{URL: r.URL, Links: r.Links, StatusCode: r.StatusCode, ContentType: r.ContentType, Proto: r.Proto, ContentEncoding: r.ContentEncoding}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Crawl mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBytesOnWire(t *testing.T) {
+	body := `<a href="/raw">raw</a>` + strings.Repeat("<p>padding</p>", 2000)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(body))
+	gz.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed.Bytes())
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1, WithIgnoreRobots(true))
+	results, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	n := int64(len(body))
+	want := []Result{
+		{URL: ts.URL + "/", ContentEncoding: "gzip", BytesOnWire: int64(compressed.Len()), BytesDecoded: n},
+		{URL: ts.URL + "/raw", BytesOnWire: n, BytesDecoded: n},
+	}
+	got := make([]Result, len(results))
+	for i, r := range results {
+		got[i] = Result{URL: r.URL, ContentEncoding: r.ContentEncoding, BytesOnWire: r.BytesOnWire, BytesDecoded: r.BytesDecoded}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Crawl mismatch (-want +got):\n%s", diff)
+	}
+
+	wantStats := map[string]TransferStats{"text/html": {Pages: 2, BytesOnWire: n + int64(compressed.Len()), BytesDecoded: 2 * n}}
+	if diff := cmp.Diff(wantStats, c.Stats().Transfer); diff != "" {
+		t.Errorf("Stats().Transfer mismatch (-want +got):\n%s", diff)
+	}
+
+	wantPages := []UncompressedPage{{URL: ts.URL + "/raw", ContentType: "text/html", Bytes: n}}
+	if diff := cmp.Diff(wantPages, UncompressedPages(results, DefaultCompressionThreshold)); diff != "" {
+		t.Errorf("UncompressedPages() mismatch (-want +got):\n%s", diff)
+	}
+	if pages := UncompressedPages(results, n); len(pages) != 0 {
+		t.Errorf("UncompressedPages() with a threshold of the page size = %+v, want none", pages)
+	}
+}
+
+func TestTimeoutOverride(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/reports/slow">slow</a><a href="/slow">slow</a>`))
+		default:
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2,
+		WithTimeoutOverride(regexp.MustCompile(`/reports/`), time.Second),
+		WithTimeoutOverride(regexp.MustCompile(`/slow$`), 10*time.Millisecond),
+	)
+	results, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	want := map[string]struct {
+		timeout time.Duration
+		err     bool
+	}{
+		ts.URL + "/":             {defaultTimeout, false},
+		ts.URL + "/reports/slow": {time.Second, false},
+		ts.URL + "/slow":         {10 * time.Millisecond, true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Crawl returned %d results, want %d", len(results), len(want))
+	}
+	for _, r := range results {
+		w := want[r.URL]
+		if r.Timeout != w.timeout {
+			t.Errorf("%s: Timeout = %v, want %v", r.URL, r.Timeout, w.timeout)
+		}
+		if (r.Err != nil) != w.err {
+			t.Errorf("%s: Err = %v, want error: %v", r.URL, r.Err, w.err)
+		}
+		if w.err && !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("%s: Err = %v, want context.DeadlineExceeded", r.URL, r.Err)
+		}
+	}
+}
+
+func TestTimeoutOverrideValidation(t *testing.T) {
+	cases := []Option{
+		WithTimeoutOverride(nil, time.Second),
+		WithTimeoutOverride(regexp.MustCompile(`.`), 0),
+	}
+	for _, opt := range cases {
+		if _, err := NewCrawler(1, opt).Crawl("https://monzo.com"); err == nil {
+			t.Errorf("Crawl did not err with invalid timeout override")
+		}
+		if _, err := Fetch(context.Background(), "https://monzo.com", opt); err == nil {
+			t.Errorf("Fetch did not err with invalid timeout override")
+		}
+	}
+}
+
+func TestFetchSkipsNonHTMLBodies(t *testing.T) {
+	html := `<a href="/a">a</a>` + strings.Repeat("<p>padding</p>", 100)
+	binary := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 4096)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(html))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(binary))
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.4" + strings.Repeat(" ", 4096)))
+		case "/untyped-html":
+			// A nil value stops the server sniffing a type itself.
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte(html))
+		case "/untyped-binary":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte(binary))
+		}
+	}))
+	defer ts.Close()
+
+	for path, read := range map[string]bool{
+		"/page":           true,
+		"/logo.png":       false,
+		"/report.pdf":     false,
+		"/untyped-html":   true,
+		"/untyped-binary": false,
+	} {
+		p, err := Fetch(context.Background(), ts.URL+path, WithSkipNonHTML(true))
+		if err != nil {
+			t.Errorf("Fetch(%s) erred when not expected: %v", path, err)
+			continue
+		}
+		if !read {
+			if p.Body != nil || p.BytesOnWire != 0 {
+				t.Errorf("Fetch(%s) read %d bytes of the body, want none", path, p.BytesOnWire)
+			}
+			continue
+		}
+		if string(p.Body) != html || p.BytesOnWire != int64(len(html)) {
+			t.Errorf("Fetch(%s) Body = %d bytes, BytesOnWire = %d, want %d of each", path, len(p.Body), p.BytesOnWire, len(html))
+		}
+		if links, err := p.Links(); err != nil || !cmp.Equal([]string{"/a"}, links) {
+			t.Errorf("Fetch(%s) Links() = %v, %v, want [/a]", path, links, err)
+		}
+	}
+
+	// By default, every body is read.
+	p, err := Fetch(context.Background(), ts.URL+"/logo.png")
+	if err != nil || len(p.Body) != len(binary) {
+		t.Errorf("Fetch(/logo.png) without WithSkipNonHTML = %d bytes, %v, want the whole body", len(p.Body), err)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	head := `<a href="/a">a</a>`
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/exact" {
+			w.Write([]byte(head + strings.Repeat(" ", 1000-len(head))))
+			return
+		}
+		// Stream until the client gives up, up to a bound so a bug
+		// can't hang the test.
+		w.Write([]byte(head))
+		chunk := []byte(strings.Repeat("<p>more</p>", 100))
+		for i := 0; i < 10000; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	p, err := Fetch(context.Background(), ts.URL+"/endless", WithMaxBodySize(1000, false), WithRetries(3, time.Millisecond))
+	if !errors.Is(err, ErrBodyTooLarge) || p.Body != nil || p.BodyTruncated {
+		t.Errorf("Fetch(/endless) = %d bytes, truncated %v, %v, want no body, not truncated, and ErrBodyTooLarge", len(p.Body), p.BodyTruncated, err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("Fetch(/endless) made %d requests, want 1, as a body too large isn't retried", n)
+	}
+
+	p, err = Fetch(context.Background(), ts.URL+"/endless", WithMaxBodySize(1000, true))
+	if err != nil {
+		t.Fatalf("Fetch(/endless) truncating erred when not expected: %v", err)
+	}
+	if links, _ := p.Links(); len(p.Body) != 1000 || !p.BodyTruncated || !cmp.Equal(links, []string{"/a"}) {
+		t.Errorf("Fetch(/endless) truncating = %d bytes, truncated %v, links %v, want 1000 bytes, truncated, and /a", len(p.Body), p.BodyTruncated, links)
+	}
+
+	p, err = Fetch(context.Background(), ts.URL+"/exact", WithMaxBodySize(1000, false))
+	if err != nil || len(p.Body) != 1000 || p.BodyTruncated {
+		t.Errorf("Fetch(/exact) = %d bytes, truncated %v, %v, want all 1000 bytes", len(p.Body), p.BodyTruncated, err)
+	}
+
+	if err := NewCrawler(1, WithMaxBodySize(0, true)).err; err == nil {
+		t.Errorf("WithMaxBodySize(0, true) accepted, want an error")
+	}
+}
@@ -0,0 +1,222 @@
+package crawl
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// urlTemplate is a template set with WithURLTemplates, e.g.
+// /blog/{yyyy}/{mm}/{slug}, split into its path segments.
+type urlTemplate struct {
+	raw      string
+	segments []string
+}
+
+// parseURLTemplate parses a template: a path whose segments are either
+// literal, or a {name} placeholder matching any one segment.
+func parseURLTemplate(raw string) (urlTemplate, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return urlTemplate{}, fmt.Errorf("template %q isn't a path starting with /", raw)
+	}
+	t := urlTemplate{raw: raw, segments: pathSegments(raw)}
+	for _, seg := range t.segments {
+		if strings.ContainsAny(seg, "{}") && !isPlaceholder(seg) {
+			return urlTemplate{}, fmt.Errorf("template %q has a placeholder that isn't a whole segment: %q", raw, seg)
+		}
+	}
+	return t, nil
+}
+
+// matches reports whether a path's segments fit the template.
+func (t urlTemplate) matches(segments []string) bool {
+	if len(segments) != len(t.segments) {
+		return false
+	}
+	for i, seg := range t.segments {
+		if !isPlaceholder(seg) && seg != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isPlaceholder(seg string) bool {
+	return len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}' && !strings.ContainsAny(seg[1:len(seg)-1], "{}")
+}
+
+// pathSegments splits a path into its segments, ignoring a trailing slash,
+// so /blog and /blog/ are the same.
+func pathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// pageGroup returns the group of a page's URL, if enabled with
+// WithURLTemplates: the first template its path matches, or else its path
+// generalized by generalizePath.
+func (c Crawler) pageGroup(addr string) string {
+	if !c.pageGroups {
+		return ""
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return ""
+	}
+	segments := pathSegments(u.Path)
+	for _, t := range c.urlTemplates {
+		if t.matches(segments) {
+			return t.raw
+		}
+	}
+	return generalizePath(segments)
+}
+
+// generalizePath joins a path's segments back into a path, with those that
+// look like identifiers replaced by placeholders: {id} for numbers, and
+// {uuid} for UUIDs, keeping any file extension, e.g. /product/{id}.html.
+// Segments that merely contain digits, such as v2 or iphone-12, are kept, as
+// they usually name distinct pages rather than records of the same kind.
+func generalizePath(segments []string) string {
+	var b strings.Builder
+	for _, seg := range segments {
+		b.WriteByte('/')
+		stem, ext := seg, ""
+		if i := strings.LastIndexByte(seg, '.'); i > 0 {
+			stem, ext = seg[:i], seg[i:]
+		}
+		switch {
+		case isNumeric(stem):
+			b.WriteString("{id}" + ext)
+		case isUUID(stem):
+			b.WriteString("{uuid}" + ext)
+		default:
+			b.WriteString(seg)
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID reports whether s is a UUID, with or without its hyphens.
+func isUUID(s string) bool {
+	hex := strings.Replace(s, "-", "", -1)
+	if len(hex) != 32 || (len(s) != 32 && !isHyphenatedUUID(s)) {
+		return false
+	}
+	for i := 0; i < len(hex); i++ {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(hex[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHyphenatedUUID(s string) bool {
+	return len(s) == 36 && s[8] == '-' && s[13] == '-' && s[18] == '-' && s[23] == '-'
+}
+
+// PageGroupSummary aggregates the pages in one group, as found by
+// WithURLTemplates.
+type PageGroupSummary struct {
+	// Group is the template the pages matched, or their generalized path.
+	Group     string
+	Pages     int64
+	Errors    int64
+	ErrorRate float64
+	// MeanSize is the mean decoded size of the bodies of the pages whose
+	// bodies were read.
+	MeanSize int64
+	// MeanLatency is the mean Duration of the pages fetched.
+	MeanLatency time.Duration
+}
+
+// maxPageGroups bounds the groups a Collector keeps. Pages beyond them are
+// summarized as otherPageGroup, so a site of paths that don't generalize
+// can't grow the summary without bound.
+const maxPageGroups = 1000
+
+// otherPageGroup is the group of the pages beyond maxPageGroups.
+const otherPageGroup = "(other)"
+
+// pageGroupCounts are a Collector's counts for a group.
+type pageGroupCounts struct {
+	pages, errors int64
+	// sized is the number of pages whose bodies were read, and bytes
+	// their total size.
+	sized, bytes int64
+	// timed is the number of pages fetched, and latency their total
+	// Duration.
+	timed   int64
+	latency time.Duration
+}
+
+// addPageGroup counts a result in its group. c.mu must be held.
+func (c *Collector) addPageGroup(r Result) {
+	g := c.groups[r.PageGroup]
+	if g == nil {
+		group := r.PageGroup
+		if len(c.groups) >= maxPageGroups {
+			group = otherPageGroup
+		}
+		if g = c.groups[group]; g == nil {
+			g = &pageGroupCounts{}
+			c.groups[group] = g
+		}
+	}
+	g.pages++
+	if r.Err != nil {
+		g.errors++
+	}
+	if r.BytesOnWire > 0 || r.BytesDecoded > 0 {
+		g.sized++
+		g.bytes += r.BytesDecoded
+	}
+	if r.Duration > 0 {
+		g.timed++
+		g.latency += r.Duration
+	}
+}
+
+// pageGroups returns the summaries of the groups, largest first. c.mu must
+// be held.
+func (c *Collector) pageGroups() []PageGroupSummary {
+	var groups []PageGroupSummary
+	for name, g := range c.groups {
+		s := PageGroupSummary{Group: name, Pages: g.pages, Errors: g.errors}
+		s.ErrorRate = float64(g.errors) / float64(g.pages)
+		if g.sized > 0 {
+			s.MeanSize = g.bytes / g.sized
+		}
+		if g.timed > 0 {
+			s.MeanLatency = g.latency / time.Duration(g.timed)
+		}
+		groups = append(groups, s)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Pages != groups[j].Pages {
+			return groups[i].Pages > groups[j].Pages
+		}
+		return groups[i].Group < groups[j].Group
+	})
+	return groups
+}
@@ -0,0 +1,130 @@
+package crawl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGeneralizePath(t *testing.T) {
+	tests := map[string]string{
+		"/":                    "/",
+		"":                     "/",
+		"/product/123":         "/product/{id}",
+		"/product/123/":        "/product/{id}",
+		"/blog/2020/01/hello":  "/blog/{id}/{id}/hello",
+		"/articles/98765.html": "/articles/{id}.html",
+		"/orders/0f8fad5b-d9cb-469f-a165-70867728950e/items/7": "/orders/{uuid}/items/{id}",
+		"/u/0F8FAD5BD9CB469FA16570867728950E":                  "/u/{uuid}",
+		// Segments that merely contain digits name distinct pages.
+		"/api/v2/docs":                          "/api/v2/docs",
+		"/phones/iphone-12":                     "/phones/iphone-12",
+		"/blog/top-10-tips":                     "/blog/top-10-tips",
+		"/html5":                                "/html5",
+		"/en-gb/2fa":                            "/en-gb/2fa",
+		"/releases/1.2.3":                       "/releases/1.2.3",
+		"/commit/deadbeef":                      "/commit/deadbeef",
+		"/events/2020-01-01":                    "/events/2020-01-01",
+		"/x/0f8fad5b-d9cb-469f-a165":            "/x/0f8fad5b-d9cb-469f-a165",
+		"/x/0f8fad5bd9cb469fa16570867728950g":   "/x/0f8fad5bd9cb469fa16570867728950g",
+		"/x/0f8fad5bd-9cb469f-a16570867728950e": "/x/0f8fad5bd-9cb469f-a16570867728950e",
+		"/.well-known/security.txt":             "/.well-known/security.txt",
+		"/files/.123":                           "/files/.123",
+	}
+	for path, want := range tests {
+		if got := generalizePath(pathSegments(path)); got != want {
+			t.Errorf("generalizePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestURLTemplates(t *testing.T) {
+	c := NewCrawler(1, WithURLTemplates("/blog/{yyyy}/{mm}/{slug}", "/product/{id}/", "/product/{id}/reviews"))
+	if c.err != nil {
+		t.Fatalf("WithURLTemplates erred when not expected: %v", c.err)
+	}
+	tests := map[string]string{
+		"https://monzo.com/blog/2020/01/hello":     "/blog/{yyyy}/{mm}/{slug}",
+		"https://monzo.com/blog/drafts/x/y/":       "/blog/{yyyy}/{mm}/{slug}",
+		"https://monzo.com/product/a-card":         "/product/{id}/",
+		"https://monzo.com/product/a-card/reviews": "/product/{id}/reviews",
+		// Pages matching no template are generalized.
+		"https://monzo.com/blog/2020/01/hello/comments/3": "/blog/{id}/{id}/hello/comments/{id}",
+		"https://monzo.com/":                              "/",
+	}
+	for addr, want := range tests {
+		if got := c.pageGroup(addr); got != want {
+			t.Errorf("pageGroup(%q) = %q, want %q", addr, got, want)
+		}
+	}
+	if got := NewCrawler(1).pageGroup("https://monzo.com/product/1"); got != "" {
+		t.Errorf("pageGroup without WithURLTemplates = %q, want none", got)
+	}
+
+	for _, bad := range []string{"blog/{slug}", "/blog/{slug", "/blog/x{slug}", "/blog/{}"} {
+		if err := NewCrawler(1, WithURLTemplates(bad)).err; err == nil {
+			t.Errorf("WithURLTemplates(%q) accepted, want an error", bad)
+		}
+	}
+}
+
+func TestPageGroupSummary(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":                    {"/product/1", "/product/2", "/product/3", "/blog/2020/01/hello"},
+		"https://monzo.com/product/1":          {},
+		"https://monzo.com/product/2":          {},
+		"https://monzo.com/blog/2020/01/hello": {},
+	}
+	c := NewCrawler(1, WithURLTemplates("/blog/{yyyy}/{mm}/{slug}"))
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	groups := make(map[string]string)
+	for _, r := range results {
+		groups[r.URL] = r.PageGroup
+	}
+	wantGroups := map[string]string{
+		"https://monzo.com/":                   "/",
+		"https://monzo.com/blog/2020/01/hello": "/blog/{yyyy}/{mm}/{slug}",
+		"https://monzo.com/product/1":          "/product/{id}",
+		"https://monzo.com/product/2":          "/product/{id}",
+		"https://monzo.com/product/3":          "/product/{id}",
+	}
+	if diff := cmp.Diff(wantGroups, groups); diff != "" {
+		t.Errorf("PageGroups mismatch (-want +got):\n%s", diff)
+	}
+	want := []PageGroupSummary{
+		{Group: "/product/{id}", Pages: 3, Errors: 1, ErrorRate: 1.0 / 3},
+		{Group: "/", Pages: 1},
+		{Group: "/blog/{yyyy}/{mm}/{slug}", Pages: 1},
+	}
+	if diff := cmp.Diff(want, c.Summary().PageGroups); diff != "" {
+		t.Errorf("Summary().PageGroups mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPageGroupCollector(t *testing.T) {
+	c := NewCollector(0)
+	c.Add(Result{URL: "https://monzo.com/a/1", PageGroup: "/a/{id}", BytesOnWire: 100, BytesDecoded: 300, Duration: 30 * time.Millisecond})
+	c.Add(Result{URL: "https://monzo.com/a/2", PageGroup: "/a/{id}", BytesOnWire: 50, BytesDecoded: 100, Duration: 10 * time.Millisecond})
+	// Pages whose bodies weren't read, or that weren't fetched, don't
+	// lower the mean size or latency.
+	c.Add(Result{URL: "https://monzo.com/a/3", PageGroup: "/a/{id}", Err: errors.New("failed")})
+	for i := 0; i < maxPageGroups+1; i++ {
+		c.Add(Result{URL: "https://monzo.com/", PageGroup: fmt.Sprintf("/g%d", i)})
+	}
+	groups := c.Summary().PageGroups
+	want := PageGroupSummary{Group: "/a/{id}", Pages: 3, Errors: 1, ErrorRate: 1.0 / 3, MeanSize: 200, MeanLatency: 20 * time.Millisecond}
+	if diff := cmp.Diff(want, groups[0]); diff != "" {
+		t.Errorf("Summary().PageGroups[0] mismatch (-want +got):\n%s", diff)
+	}
+	// The groups past the limit are counted together.
+	if len(groups) != maxPageGroups+1 || groups[1].Group != otherPageGroup || groups[1].Pages != 2 {
+		t.Errorf("Summary().PageGroups has %d groups, the second %+v, want %d, with 2 pages in %s", len(groups), groups[1], maxPageGroups+1, otherPageGroup)
+	}
+}
@@ -0,0 +1,47 @@
+package crawl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostDelays spaces out requests to each host by a minimum delay, as set
+// with WithDelay. Rather than polling, each request reserves the next free
+// slot for its host and sleeps until then, so fetchers queue up for a host
+// in the order they asked, without spinning.
+type hostDelays struct {
+	mu    sync.Mutex
+	delay time.Duration
+	// next is the earliest time of the next request to each host.
+	next map[string]time.Time
+}
+
+func (h *hostDelays) reset() {
+	h.mu.Lock()
+	h.next = nil
+	h.mu.Unlock()
+}
+
+// wait blocks until a request to host may be made, returning early with the
+// context's error if it is done first. The slot reserved is used up either
+// way.
+func (h *hostDelays) wait(ctx context.Context, clk Clock, host string) error {
+	if h == nil || h.delay <= 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+	h.mu.Lock()
+	now := clk.Now()
+	at := h.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	if h.next == nil {
+		h.next = make(map[string]time.Time)
+	}
+	h.next[host] = at.Add(h.delay)
+	h.mu.Unlock()
+	return sleep(ctx, clk, at.Sub(now))
+}
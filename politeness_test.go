@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"context"
+	"crawl/crawltest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/a">a</a><a href="/b">b</a><a href="/c">c</a>`))
+		}
+	}))
+	defer ts.Close()
+
+	const delay = 50 * time.Millisecond
+	c := NewCrawler(4, WithDelay(delay))
+	got, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("Crawl() = %+v, want 4 results", got)
+	}
+	// The pages and robots.txt.
+	if len(times) != 5 {
+		t.Fatalf("server got %d requests, want 5", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		// Allow for the server seeing requests a little less spaced than
+		// they were sent.
+		if gap := times[i].Sub(times[i-1]); gap < delay-5*time.Millisecond {
+			t.Errorf("request %d came %v after the last, want at least %v", i, gap, delay)
+		}
+	}
+
+	if err := NewCrawler(1, WithDelay(-time.Second)).err; err == nil {
+		t.Errorf("WithDelay(-1s) accepted, want an error")
+	}
+}
+
+func TestHostDelays(t *testing.T) {
+	clk := crawltest.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := &hostDelays{delay: time.Second}
+	ctx := context.Background()
+
+	// The first request to each host needn't wait.
+	if err := h.wait(ctx, clk, "monzo.com"); err != nil {
+		t.Fatalf("wait() erred when not expected: %v", err)
+	}
+	if err := h.wait(ctx, clk, "other.com"); err != nil {
+		t.Fatalf("wait() erred when not expected: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- h.wait(ctx, clk, "MONZO.com") }()
+	clk.WaitForTimers(1)
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("wait() erred when not expected: %v", err)
+	}
+
+	// Waiting is abandoned when the context is done.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := h.wait(ctx, clk, "monzo.com"); err != context.Canceled {
+		t.Errorf("wait() with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestDelayRedirects(t *testing.T) {
+	clk := crawltest.NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com/old", crawltest.Response{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"/new"}}})
+	site.Page("https://monzo.com/new")
+
+	c := NewCrawler(1, WithClock(clk), WithDelay(time.Second), WithIgnoreRobots(true), WithTransportMiddleware(site.Wrap))
+	done := make(chan error)
+	go func() {
+		_, err := c.Crawl("https://monzo.com/old")
+		done <- err
+	}()
+	// The redirect to /new is another request to monzo.com, so waits out
+	// the delay after /old.
+	clk.WaitForTimers(1)
+	if n := len(site.Requests()); n != 1 {
+		t.Errorf("%d requests made before the delay passed, want 1", n)
+	}
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if n := len(site.Requests()); n != 2 {
+		t.Errorf("%d requests made, want 2", n)
+	}
+}
@@ -0,0 +1,192 @@
+package crawl
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Relations are the relationships a page declares to other pages, either
+// with <link rel> elements in its HTML or with Link headers in its HTTP
+// response. Values are raw, unresolved URLs, as with Result.Links.
+//
+// Where both declare a canonical, next or prev page, the header wins: it is
+// set by the server, which we assume knows better than the markup it serves.
+// Alternates from both are kept.
+type Relations struct {
+	Canonical  string   `json:",omitempty"`
+	Next       string   `json:",omitempty"`
+	Prev       string   `json:",omitempty"`
+	Alternates []string `json:",omitempty"`
+}
+
+// empty reports whether r has no relations.
+func (r Relations) empty() bool {
+	return r.Canonical == "" && r.Next == "" && r.Prev == "" && len(r.Alternates) == 0
+}
+
+// add records a relation to target, if rel is one we keep. Unless override
+// is set, existing canonical, next and prev relations are kept.
+func (r *Relations) add(rel, target string, override bool) {
+	set := func(field *string) {
+		if *field == "" || override {
+			*field = target
+		}
+	}
+	switch strings.ToLower(rel) {
+	case "canonical":
+		set(&r.Canonical)
+	case "next":
+		set(&r.Next)
+	case "prev", "previous":
+		set(&r.Prev)
+	case "alternate":
+		for _, a := range r.Alternates {
+			if a == target {
+				return
+			}
+		}
+		r.Alternates = append(r.Alternates, target)
+	}
+}
+
+// mergeRelations combines relations declared in a page's HTML with those from its
+// Link headers, giving the headers precedence.
+func mergeRelations(html Relations, header http.Header) Relations {
+	r := html
+	r.Alternates = append([]string(nil), html.Alternates...)
+	for _, l := range parseLinkHeader(header["Link"]) {
+		for _, rel := range l.rels {
+			r.add(rel, l.target, true)
+		}
+	}
+	sort.Strings(r.Alternates)
+	return r
+}
+
+// headerLink is a single link from a Link header.
+type headerLink struct {
+	target string
+	rels   []string
+}
+
+// parseLinkHeader parses the values of Link headers, as described by RFC
+// 8288. Each value may hold multiple comma separated links, each with
+// semicolon separated parameters. Malformed links are skipped.
+func parseLinkHeader(values []string) []headerLink {
+	var links []headerLink
+	for _, v := range values {
+		p := linkHeaderParser{s: v}
+		for {
+			l, ok, more := p.next()
+			if ok {
+				links = append(links, l)
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return links
+}
+
+type linkHeaderParser struct {
+	s string
+	i int
+}
+
+// next parses the next link. It returns whether that link was well formed,
+// and whether there may be more links to parse.
+func (p *linkHeaderParser) next() (l headerLink, ok, more bool) {
+	p.skip(" \t,")
+	if p.i >= len(p.s) {
+		return l, false, false
+	}
+	if p.s[p.i] != '<' {
+		p.skipLink()
+		return l, false, p.i < len(p.s)
+	}
+	end := strings.IndexByte(p.s[p.i:], '>')
+	if end < 0 {
+		return l, false, false
+	}
+	l.target = strings.TrimSpace(p.s[p.i+1 : p.i+end])
+	p.i += end + 1
+
+	// Parameters
+	for {
+		p.skip(" \t")
+		if p.i >= len(p.s) || p.s[p.i] == ',' {
+			break
+		}
+		if p.s[p.i] != ';' {
+			p.skipLink()
+			return l, false, p.i < len(p.s)
+		}
+		p.i++
+		p.skip(" \t")
+		name := strings.ToLower(p.token())
+		p.skip(" \t")
+		value := ""
+		if p.i < len(p.s) && p.s[p.i] == '=' {
+			p.i++
+			p.skip(" \t")
+			value = p.value()
+		}
+		if name == "rel" && l.rels == nil {
+			l.rels = strings.Fields(value)
+		}
+	}
+	return l, true, p.i < len(p.s)
+}
+
+// skip advances past any of the given characters.
+func (p *linkHeaderParser) skip(chars string) {
+	for p.i < len(p.s) && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// skipLink advances to the comma ending the current link, respecting quoted
+// strings.
+func (p *linkHeaderParser) skipLink() {
+	for p.i < len(p.s) && p.s[p.i] != ',' {
+		if p.s[p.i] == '"' {
+			p.value()
+			continue
+		}
+		p.i++
+	}
+}
+
+// token reads a parameter name or unquoted value.
+func (p *linkHeaderParser) token() string {
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t;,=\"", p.s[p.i]) < 0 {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// value reads a parameter value, which may be a quoted string.
+func (p *linkHeaderParser) value() string {
+	if p.i >= len(p.s) || p.s[p.i] != '"' {
+		return p.token()
+	}
+	p.i++
+	var sb strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\' && p.i < len(p.s):
+			sb.WriteByte(p.s[p.i])
+			p.i++
+		case c == '"':
+			return sb.String()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
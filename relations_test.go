@@ -0,0 +1,106 @@
+package crawl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []string
+		want   []headerLink
+	}{
+		{
+			name:   "single",
+			values: []string{`<https://monzo.com/page/2>; rel="next"`},
+			want:   []headerLink{{target: "https://monzo.com/page/2", rels: []string{"next"}}},
+		},
+		{
+			name:   "multiple values and links",
+			values: []string{`</1>; rel=prev, </3>;rel=next`, `<https://monzo.com/>; rel="canonical"`},
+			want: []headerLink{
+				{target: "/1", rels: []string{"prev"}},
+				{target: "/3", rels: []string{"next"}},
+				{target: "https://monzo.com/", rels: []string{"canonical"}},
+			},
+		},
+		{
+			name:   "quoted params with commas and semicolons",
+			values: []string{`</a,b>; title="one, two; \"three\""; rel="alternate next", </c>; rel=canonical`},
+			want: []headerLink{
+				{target: "/a,b", rels: []string{"alternate", "next"}},
+				{target: "/c", rels: []string{"canonical"}},
+			},
+		},
+		{
+			name:   "only the first rel counts",
+			values: []string{`</a>; rel=next; rel=prev`},
+			want:   []headerLink{{target: "/a", rels: []string{"next"}}},
+		},
+		{
+			name:   "malformed links skipped",
+			values: []string{`/no-brackets; rel=next, </ok>; rel=prev, </bad> junk, </unterminated`},
+			want:   []headerLink{{target: "/ok", rels: []string{"prev"}}},
+		},
+	}
+
+	for _, c := range cases {
+		got := parseLinkHeader(c.values)
+		if diff := cmp.Diff(c.want, got, cmp.AllowUnexported(headerLink{})); diff != "" {
+			t.Errorf("%s: parseLinkHeader() mismatch (-want +got):\n%s", c.name, diff)
+		}
+	}
+}
+
+func TestRelationsPrecedence(t *testing.T) {
+	body := []byte(`<html><head>
+<link rel="canonical" href="/html-canonical">
+<link rel="canonical" href="/second-canonical">
+<link rel="prev" href="/html-prev">
+<link rel="next" href="/html-next">
+<link rel="alternate" hreflang="fr" href="/fr">
+<link rel="stylesheet" href="/style.css">
+</head></html>`)
+	header := http.Header{"Link": {`</header-next>; rel=next, </de>; rel=alternate, </fr>; rel=alternate`}}
+
+	p := &Page{Body: body, Header: header}
+	want := Relations{
+		Canonical:  "/html-canonical",
+		Next:       "/header-next",
+		Prev:       "/html-prev",
+		Alternates: []string{"/de", "/fr"},
+	}
+	if diff := cmp.Diff(want, p.Relations()); diff != "" {
+		t.Errorf("Relations() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeaderNextEnqueued(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Add("Link", `</page/2>; rel="next", <https://example.com/>; rel="alternate"`)
+		case "/page/2":
+			w.Header().Add("Link", `<https://example.com/page/3>; rel="next"`)
+		}
+	}))
+	defer ts.Close()
+
+	results, err := NewCrawler(2).Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.URL)
+	}
+	// The off-site next page is out of scope.
+	want := []string{ts.URL + "/", ts.URL + "/page/2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Crawl() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,177 @@
+package crawl
+
+import (
+	"net/url"
+)
+
+// Relativizer renders URLs on a crawl's site as paths relative to the site
+// root, e.g. /foo/bar?x=1, so the output of crawls of the same site on
+// different hosts (e.g. staging and production) can be compared. URLs on
+// other sites are left absolute.
+//
+// It is only meant for output: results are kept absolute, and rendering
+// them relative loses the host.
+type Relativizer struct {
+	c    Crawler
+	root *url.URL
+}
+
+// Relativizer returns a Relativizer for a crawl by c starting from seed.
+// URLs are on the seed's site if they would be deduplicated with it, so
+// aliases and www. hosts, if configured, are relative too.
+func (c Crawler) Relativizer(seed string) (Relativizer, error) {
+	root, err := url.Parse(seed)
+	if err != nil {
+		return Relativizer{}, err
+	}
+	return Relativizer{c: c, root: root}, nil
+}
+
+// URL renders an absolute URL, as found in Result.URL.
+func (r Relativizer) URL(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	return r.render(u, addr)
+}
+
+// Link renders a link found on the page at base, as found in Result.Links.
+// Links on the site are resolved before being rendered relative, so they
+// all take the same form.
+func (r Relativizer) Link(base, href string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return href
+	}
+	u, err := b.Parse(href)
+	if err != nil {
+		return href
+	}
+	return r.render(u, href)
+}
+
+// render renders u relative to the root if it is on the site, or otherwise
+// returns orig unchanged.
+func (r Relativizer) render(u *url.URL, orig string) string {
+	if !u.IsAbs() || r.c.siteOf(u.Host) != r.c.siteOf(r.root.Host) {
+		return orig
+	}
+	rel := *u
+	rel.Scheme, rel.Opaque, rel.User, rel.Host = "", "", nil, ""
+	if rel.Path == "" {
+		rel.Path, rel.RawPath = "/", ""
+	}
+	return rel.String()
+}
+
+// Results returns copies of results with their URLs and links rendered
+// relative.
+func (r Relativizer) Results(results []Result) []Result {
+	rel := make([]Result, len(results))
+	for i, res := range results {
+		rel[i] = r.Result(res)
+	}
+	return rel
+}
+
+// Result returns a copy of res with its URLs and links rendered relative:
+// those of the page, its redirects and the pages linking to it, and the
+// links, relations and assets found on it.
+func (r Relativizer) Result(res Result) Result {
+	base, served := res.base(), res.URL
+	if res.FinalURL != "" {
+		served = res.FinalURL
+	}
+	links := func(hrefs []string) []string {
+		if hrefs == nil {
+			return nil
+		}
+		out := make([]string, len(hrefs))
+		for j, h := range hrefs {
+			out[j] = r.Link(base, h)
+		}
+		return out
+	}
+	res.Links = links(res.Links)
+	res.Speculative = links(res.Speculative)
+	res.Relations.Alternates = links(res.Relations.Alternates)
+	for _, f := range []*string{&res.Relations.Canonical, &res.Relations.Next, &res.Relations.Prev} {
+		if *f != "" {
+			*f = r.Link(base, *f)
+		}
+	}
+	if res.Assets != nil {
+		assets := make([]Asset, len(res.Assets))
+		for j, a := range res.Assets {
+			a.URL = r.Link(base, a.URL)
+			assets[j] = a
+		}
+		res.Assets = assets
+	}
+	if res.Location != "" {
+		res.Location = r.Link(served, res.Location)
+	}
+	for _, f := range []*string{&res.URL, &res.FinalURL, &res.Base} {
+		if *f != "" {
+			*f = r.URL(*f)
+		}
+	}
+	res.RedirectChain = r.urls(res.RedirectChain)
+	res.Referrers = r.urls(res.Referrers)
+	if res.InvalidLinks != nil {
+		invalid := make([]InvalidLink, len(res.InvalidLinks))
+		for j, l := range res.InvalidLinks {
+			l.Page = r.URL(l.Page)
+			invalid[j] = l
+		}
+		res.InvalidLinks = invalid
+	}
+	return res
+}
+
+// LinkChecks returns copies of links with their URLs, and those of the
+// pages linking to them, rendered relative.
+func (r Relativizer) LinkChecks(links []LinkCheck) []LinkCheck {
+	rel := make([]LinkCheck, len(links))
+	for i, l := range links {
+		l.URL = r.URL(l.URL)
+		l.Pages = r.urls(l.Pages)
+		rel[i] = l
+	}
+	return rel
+}
+
+// urls returns a copy of addrs, absolute URLs, rendered relative.
+func (r Relativizer) urls(addrs []string) []string {
+	if addrs == nil {
+		return nil
+	}
+	out := make([]string, len(addrs))
+	for i, addr := range addrs {
+		out[i] = r.URL(addr)
+	}
+	return out
+}
+
+// NormalizationReport returns a copy of report with its URLs rendered
+// relative.
+func (r Relativizer) NormalizationReport(report NormalizationReport) NormalizationReport {
+	rel := make(NormalizationReport, len(report))
+	for i, e := range report {
+		e.URL = r.URL(e.URL)
+		variants := make([]Variant, len(e.Variants))
+		for j, v := range e.Variants {
+			v.URL = r.URL(v.URL)
+			pages := make([]string, len(v.Pages))
+			for k, p := range v.Pages {
+				pages[k] = r.URL(p)
+			}
+			v.Pages = pages
+			variants[j] = v
+		}
+		e.Variants = variants
+		rel[i] = e
+	}
+	return rel
+}
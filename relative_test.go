@@ -0,0 +1,168 @@
+package crawl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRelativizer(t *testing.T) {
+	results := []Result{
+		{
+			URL:       "https://www.monzo.com",
+			Links:     []string{"foo/bar?x=1#top", "https://monzo.com/baz", "https://facebook.com/monzo", "mailto:help@monzo.com", "http://exa mple.com"},
+			Relations: Relations{Canonical: "https://monzo.com/", Alternates: []string{"/fr"}},
+		},
+		{URL: "https://monzo.com/foo/bar?x=1", Speculative: []string{"../lazy.png"}},
+	}
+	c := NewCrawler(1, WithCoalesceWWW(true))
+	rel, err := c.Relativizer("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Relativizer erred when not expected: %v", err)
+	}
+
+	want := []Result{
+		{
+			URL:       "/",
+			Links:     []string{"/foo/bar?x=1#top", "/baz", "https://facebook.com/monzo", "mailto:help@monzo.com", "http://exa mple.com"},
+			Relations: Relations{Canonical: "/", Alternates: []string{"/fr"}},
+		},
+		{URL: "/foo/bar?x=1", Speculative: []string{"/lazy.png"}},
+	}
+	if diff := cmp.Diff(want, rel.Results(results)); diff != "" {
+		t.Errorf("Results() mismatch (-want +got):\n%s", diff)
+	}
+	if got := results[0].URL; got != "https://www.monzo.com" {
+		t.Errorf("Results() modified its input URL to %s", got)
+	}
+	if got := results[0].Links[0]; got != "foo/bar?x=1#top" {
+		t.Errorf("Results() modified its input link to %s", got)
+	}
+}
+
+func TestRelativizerResult(t *testing.T) {
+	res := Result{
+		URL:           "https://monzo.com/old",
+		FinalURL:      "https://monzo.com/new/",
+		Base:          "https://monzo.com/docs/",
+		Links:         []string{"a", "https://facebook.com/monzo"},
+		Assets:        []Asset{{URL: "style.css", Tag: "link"}},
+		RedirectChain: []string{"https://monzo.com/old"},
+		Location:      "next",
+		Referrers:     []string{"https://monzo.com/", "https://monzo.com/foo"},
+		InvalidLinks:  []InvalidLink{{Page: "https://monzo.com/new/", Href: "http://[::1", Err: "missing ]"}},
+	}
+	rel, err := NewCrawler(1).Relativizer("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Relativizer erred when not expected: %v", err)
+	}
+
+	want := Result{
+		URL:           "/old",
+		FinalURL:      "/new/",
+		Base:          "/docs/",
+		Links:         []string{"/docs/a", "https://facebook.com/monzo"},
+		Assets:        []Asset{{URL: "/docs/style.css", Tag: "link"}},
+		RedirectChain: []string{"/old"},
+		Location:      "/new/next",
+		Referrers:     []string{"/", "/foo"},
+		InvalidLinks:  []InvalidLink{{Page: "/new/", Href: "http://[::1", Err: "missing ]"}},
+	}
+	if diff := cmp.Diff(want, rel.Result(res)); diff != "" {
+		t.Errorf("Result() mismatch (-want +got):\n%s", diff)
+	}
+	if got := res.Referrers[0]; got != "https://monzo.com/" {
+		t.Errorf("Result() modified its input referrer to %s", got)
+	}
+
+	checks := []LinkCheck{{URL: "https://monzo.com/a", Pages: []string{"https://monzo.com/"}}}
+	wantChecks := []LinkCheck{{URL: "/a", Pages: []string{"/"}}}
+	if diff := cmp.Diff(wantChecks, rel.LinkChecks(checks)); diff != "" {
+		t.Errorf("LinkChecks() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestRelativizerFields fails when a string field is added to Result that
+// Relativizer.Result leaves absolute, so new URL fields aren't missed: add
+// it to Result, or if it doesn't hold URLs, to notURLs.
+func TestRelativizerFields(t *testing.T) {
+	notURLs := map[string]bool{
+		"Title":                true,
+		"ContentType":          true,
+		"Proto":                true,
+		"ContentEncoding":      true,
+		"PageGroup":            true,
+		"Breadcrumbs[]":        true,
+		"TLS.Version":          true,
+		"TLS.CipherSuite":      true,
+		"Assets[].Tag":         true,
+		"LinkTargets[].State":  true,
+		"LinkTargets[].Reason": true,
+		// Invalid links can't be parsed, so are kept as found.
+		"InvalidLinks[].Href": true,
+		"InvalidLinks[].Err":  true,
+		"InvalidLinks[].Fix":  true,
+		"Warnings[].Msg":      true,
+	}
+
+	const abs = "https://monzo.com/x"
+	var res Result
+	fillStrings(reflect.ValueOf(&res).Elem(), abs)
+	rel, err := NewCrawler(1).Relativizer("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Relativizer erred when not expected: %v", err)
+	}
+	walkStrings(reflect.ValueOf(rel.Result(res)), "", func(field, s string) {
+		if s == abs && !notURLs[field] {
+			t.Errorf("Result() left Result.%s absolute", field)
+		}
+	})
+}
+
+// fillStrings sets every string reachable from v, through structs, slices
+// and pointers, to s, making slices of one element and allocating pointers
+// to reach them.
+func fillStrings(v reflect.Value, s string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fillStrings(v.Field(i), s)
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillStrings(v.Index(0), s)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillStrings(v.Elem(), s)
+	}
+}
+
+// walkStrings calls fn with every string reachable from v, as fillStrings
+// sets them, and the path of the field holding it, e.g. Assets[].URL.
+func walkStrings(v reflect.Value, path string, fn func(field, s string)) {
+	switch v.Kind() {
+	case reflect.String:
+		fn(path, v.String())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			if path != "" {
+				name = path + "." + name
+			}
+			walkStrings(v.Field(i), name, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), path+"[]", fn)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	}
+}
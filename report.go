@@ -0,0 +1,266 @@
+package crawl
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Variant is one distinct form in which links to a page were written.
+type Variant struct {
+	// URL is the resolved link, before normalization.
+	URL string
+	// Count is the number of links using this form.
+	Count int
+	// Pages are the pages containing at least one such link.
+	Pages []string
+}
+
+// URLVariants groups the variants that normalized to the same crawled URL.
+type URLVariants struct {
+	URL      string
+	Variants []Variant
+}
+
+// NormalizationReport lists the crawled URLs that were linked to in more
+// than one form, e.g. with and without tracking parameters. The crawl
+// treats these as a single page, but they are usually a sign of
+// inconsistent links in the site's templates.
+// Entries are sorted with the worst offenders (most variants) first.
+type NormalizationReport []URLVariants
+
+// NewNormalizationReport builds a NormalizationReport from the results of
+// a crawl run with the default options. Only links to pages that were
+// actually crawled are considered.
+func NewNormalizationReport(results []Result) NormalizationReport {
+	return Crawler{}.NormalizationReport(results)
+}
+
+// NormalizationReport builds a NormalizationReport from the results of a
+// crawl run by c. Links are matched to crawled pages in the same way the
+// crawl deduplicated them, so e.g. a link to an alias of a crawled page's
+// host is a variant of that page.
+func (c Crawler) NormalizationReport(results []Result) NormalizationReport {
+	// visit key -> crawled URL
+	crawled := make(map[string]string, len(results))
+	for _, r := range results {
+		if u, err := url.Parse(r.URL); err == nil {
+			crawled[c.visitKey(normalize(u))] = r.URL
+		}
+	}
+
+	// canonical URL -> variant URL -> variant
+	seen := make(map[string]map[string]*Variant)
+	for _, r := range results {
+		base, err := url.Parse(r.base())
+		if err != nil {
+			continue
+		}
+		for _, l := range r.Links {
+			link, err := resolve(base, l)
+			if err != nil {
+				continue
+			}
+			key, ok := crawled[c.visitKey(normalize(link))]
+			if !ok {
+				continue
+			}
+			if seen[key] == nil {
+				seen[key] = make(map[string]*Variant)
+			}
+			v := seen[key][link.String()]
+			if v == nil {
+				v = &Variant{URL: link.String()}
+				seen[key][link.String()] = v
+			}
+			v.Count++
+			if n := len(v.Pages); n == 0 || v.Pages[n-1] != r.URL {
+				v.Pages = append(v.Pages, r.URL)
+			}
+		}
+	}
+
+	var report NormalizationReport
+	for key, variants := range seen {
+		if len(variants) < 2 {
+			continue
+		}
+		e := URLVariants{URL: key}
+		for _, v := range variants {
+			sort.Strings(v.Pages)
+			e.Variants = append(e.Variants, *v)
+		}
+		sort.Slice(e.Variants, func(i, j int) bool {
+			if e.Variants[i].Count != e.Variants[j].Count {
+				return e.Variants[i].Count > e.Variants[j].Count
+			}
+			return e.Variants[i].URL < e.Variants[j].URL
+		})
+		report = append(report, e)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if len(report[i].Variants) != len(report[j].Variants) {
+			return len(report[i].Variants) > len(report[j].Variants)
+		}
+		return report[i].URL < report[j].URL
+	})
+	return report
+}
+
+// Section is the summary of the crawled pages under a path prefix.
+type Section struct {
+	// Path is the prefix, e.g. /blog, or / for pages at the root.
+	Path   string
+	Pages  int
+	Errors int
+}
+
+// SectionSummary groups the results of a crawl by the first depth segments
+// of their URL paths, counting the pages and errors under each. Paths are
+// decoded and lowercased, and trailing slashes ignored, so /Blog and /blog/
+// are the same section. Sections are sorted by number of pages, largest
+// first.
+func SectionSummary(results []Result, depth int) []Section {
+	sections := make(map[string]*Section)
+	for _, r := range results {
+		path := sectionOf(r.URL, depth)
+		s := sections[path]
+		if s == nil {
+			s = &Section{Path: path}
+			sections[path] = s
+		}
+		s.Pages++
+		if r.Err != nil {
+			s.Errors++
+		}
+	}
+
+	summary := make([]Section, 0, len(sections))
+	for _, s := range sections {
+		summary = append(summary, *s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Pages != summary[j].Pages {
+			return summary[i].Pages > summary[j].Pages
+		}
+		return summary[i].Path < summary[j].Path
+	})
+	return summary
+}
+
+// sectionOf returns the section a URL belongs to: its first depth path
+// segments, decoded and lowercased.
+func sectionOf(addr string, depth int) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "/"
+	}
+	return sectionOfPath(u.Path, depth)
+}
+
+// sectionOfPath returns the first depth segments of a decoded path,
+// lowercased.
+func sectionOfPath(path string, depth int) string {
+	var segments []string
+	for _, seg := range strings.Split(strings.ToLower(path), "/") {
+		if len(segments) == depth {
+			break
+		}
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// HostSummary is the summary of the crawled pages on a single host.
+type HostSummary struct {
+	Host   string
+	Pages  int
+	Errors int
+}
+
+// HostSummaries counts the pages and errors on each host visited by a crawl.
+// Hosts are sorted by number of pages, largest first.
+func HostSummaries(results []Result) []HostSummary {
+	return summarize(results).Hosts
+}
+
+// Encoding is the number of pages served with one combination of HTTP
+// version and content encoding.
+type Encoding struct {
+	// Proto is the HTTP version, e.g. "HTTP/2.0".
+	Proto string
+	// ContentEncoding is the compression used, or "identity" for none.
+	ContentEncoding string
+	Pages           int
+}
+
+// EncodingSummary counts the pages of a crawl by the HTTP version and
+// content encoding they were served with. Pages that failed before a
+// response was received are not counted. Combinations are sorted by number
+// of pages, largest first.
+func EncodingSummary(results []Result) []Encoding {
+	return summarize(results).Encodings
+}
+
+// MisdeclaredContentTypes returns the URLs of the pages served as plain text
+// or binary data that were scraped as HTML anyway, sorted. They point to a
+// misconfigured server.
+func MisdeclaredContentTypes(results []Result) []string {
+	var urls []string
+	for _, r := range results {
+		if r.MisdeclaredContentType {
+			urls = append(urls, r.URL)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// LinkOverflow returns the URLs of the pages whose links were truncated by
+// WithMaxLinksPerPage, sorted. Pages with that many links are usually
+// generated, e.g. tag clouds and calendars, and are the likeliest sources of
+// crawl traps, so are worth considering for exclusion.
+func LinkOverflow(results []Result) []string {
+	var urls []string
+	for _, r := range results {
+		if r.LinksTruncated {
+			urls = append(urls, r.URL)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// DefaultCompressionThreshold is the size above which UncompressedPages
+// flags pages served uncompressed: below it, compression saves too little
+// to be worth the bother.
+const DefaultCompressionThreshold = 10 << 10
+
+// UncompressedPage is a page served without compression, for
+// UncompressedPages.
+type UncompressedPage struct {
+	URL         string
+	ContentType string
+	Bytes       int64
+}
+
+// UncompressedPages returns the pages served without compression whose
+// bodies were larger than threshold bytes, the largest first. Compressing
+// them is an easy saving in transfer size.
+func UncompressedPages(results []Result, threshold int64) []UncompressedPage {
+	var pages []UncompressedPage
+	for _, r := range results {
+		if r.ContentEncoding == "" && r.BytesOnWire > threshold {
+			pages = append(pages, UncompressedPage{URL: r.URL, ContentType: r.ContentType, Bytes: r.BytesOnWire})
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Bytes != pages[j].Bytes {
+			return pages[i].Bytes > pages[j].Bytes
+		}
+		return pages[i].URL < pages[j].URL
+	})
+	return pages
+}
@@ -0,0 +1,148 @@
+package crawl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizationReport(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/", Links: []string{"/foo", "/foo?utm_source=home", "/bar#top", "https://facebook.com?a=b"}},
+		{URL: "https://monzo.com/foo", Links: []string{"/", "/?ref=foo", "/?ref=foo", "bar"}},
+		{URL: "https://monzo.com/bar", Links: []string{"/foo?utm_source=bar", "/bar"}},
+	}
+
+	want := NormalizationReport{
+		{URL: "https://monzo.com/foo", Variants: []Variant{
+			{URL: "https://monzo.com/foo", Count: 1, Pages: []string{"https://monzo.com/"}},
+			{URL: "https://monzo.com/foo?utm_source=bar", Count: 1, Pages: []string{"https://monzo.com/bar"}},
+			{URL: "https://monzo.com/foo?utm_source=home", Count: 1, Pages: []string{"https://monzo.com/"}},
+		}},
+		{URL: "https://monzo.com/", Variants: []Variant{
+			{URL: "https://monzo.com/?ref=foo", Count: 2, Pages: []string{"https://monzo.com/foo"}},
+			{URL: "https://monzo.com/", Count: 1, Pages: []string{"https://monzo.com/foo"}},
+		}},
+	}
+
+	got := NewNormalizationReport(results)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NewNormalizationReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNormalizationReportMatchesVisited(t *testing.T) {
+	// The crawl fetched one form of each page, but links use others that
+	// it treated as the same page.
+	results := []Result{
+		{URL: "https://monzo.com/", Links: []string{"/docs/", "https://www.monzo.com/about"}},
+		{URL: "https://monzo.com/docs/", Links: []string{"/docs", "/docs/index.html", "/about"}},
+		{URL: "https://monzo.com/about"},
+	}
+	c := NewCrawler(1, WithCoalesceWWW(true), WithDirectoryIndex("index.html"))
+
+	want := NormalizationReport{
+		{URL: "https://monzo.com/docs/", Variants: []Variant{
+			{URL: "https://monzo.com/docs", Count: 1, Pages: []string{"https://monzo.com/docs/"}},
+			{URL: "https://monzo.com/docs/", Count: 1, Pages: []string{"https://monzo.com/"}},
+			{URL: "https://monzo.com/docs/index.html", Count: 1, Pages: []string{"https://monzo.com/docs/"}},
+		}},
+		{URL: "https://monzo.com/about", Variants: []Variant{
+			{URL: "https://monzo.com/about", Count: 1, Pages: []string{"https://monzo.com/docs/"}},
+			{URL: "https://www.monzo.com/about", Count: 1, Pages: []string{"https://monzo.com/"}},
+		}},
+	}
+	if diff := cmp.Diff(want, c.NormalizationReport(results)); diff != "" {
+		t.Errorf("NormalizationReport() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without the options, the variants are distinct pages, and only
+	// links to the crawled forms count.
+	if got := NewNormalizationReport(results); len(got) != 0 {
+		t.Errorf("NewNormalizationReport() = %+v, want none", got)
+	}
+}
+
+func TestSectionSummary(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com"},
+		{URL: "https://monzo.com/"},
+		{URL: "https://monzo.com/blog"},
+		{URL: "https://monzo.com/Blog/"},
+		{URL: "https://monzo.com/blog/2020/hello"},
+		{URL: "https://monzo.com/blog/2020/bye", Err: errors.New("not found")},
+		{URL: "https://monzo.com/blog/2019/old"},
+		{URL: "https://monzo.com/caf%C3%A9/menu"},
+		{URL: "https://monzo.com/café", Err: errors.New("not found")},
+	}
+
+	cases := []struct {
+		depth int
+		want  []Section
+	}{
+		{
+			depth: 1,
+			want: []Section{
+				{Path: "/blog", Pages: 5, Errors: 1},
+				{Path: "/", Pages: 2},
+				{Path: "/café", Pages: 2, Errors: 1},
+			},
+		},
+		{
+			depth: 2,
+			want: []Section{
+				{Path: "/", Pages: 2},
+				{Path: "/blog", Pages: 2},
+				{Path: "/blog/2020", Pages: 2, Errors: 1},
+				{Path: "/blog/2019", Pages: 1},
+				{Path: "/café", Pages: 1, Errors: 1},
+				{Path: "/café/menu", Pages: 1},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got := SectionSummary(results, c.depth)
+		if diff := cmp.Diff(c.want, got); diff != "" {
+			t.Errorf("SectionSummary(depth %d) mismatch (-want +got):\n%s", c.depth, diff)
+		}
+	}
+}
+
+func TestHostSummaries(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/"},
+		{URL: "https://monzo.com/foo", Err: errors.New("not found")},
+		{URL: "https://Blog.monzo.org/"},
+		{URL: "https://blog.monzo.org/post"},
+		{URL: "https://monzo.co.uk/"},
+	}
+	want := []HostSummary{
+		{Host: "blog.monzo.org", Pages: 2},
+		{Host: "monzo.com", Pages: 2, Errors: 1},
+		{Host: "monzo.co.uk", Pages: 1},
+	}
+	if diff := cmp.Diff(want, HostSummaries(results)); diff != "" {
+		t.Errorf("HostSummaries() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodingSummary(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/", Proto: "HTTP/2.0", ContentEncoding: "br"},
+		{URL: "https://monzo.com/a", Proto: "HTTP/2.0", ContentEncoding: "br"},
+		{URL: "https://monzo.com/b", Proto: "HTTP/2.0"},
+		{URL: "https://monzo.com/c", Proto: "HTTP/1.1", ContentEncoding: "gzip"},
+		{URL: "https://monzo.com/d", Err: errors.New("connection refused")},
+	}
+
+	want := []Encoding{
+		{Proto: "HTTP/2.0", ContentEncoding: "br", Pages: 2},
+		{Proto: "HTTP/1.1", ContentEncoding: "gzip", Pages: 1},
+		{Proto: "HTTP/2.0", ContentEncoding: "identity", Pages: 1},
+	}
+	if diff := cmp.Diff(want, EncodingSummary(results)); diff != "" {
+		t.Errorf("EncodingSummary() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,67 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// resumeOffset returns the offset a Range request can resume the page's body
+// from, after reading it failed partway, or 0 if it can't be resumed. The
+// server must have advertised Accept-Ranges: bytes, and given a strong ETag,
+// for If-Range to make sure the rest is of the same version of the page.
+// Compressed bodies can't be resumed either, as only their decoded bytes
+// are kept.
+func (p *Page) resumeOffset() int64 {
+	if p == nil || !p.interrupted || len(p.Body) == 0 || p.BodyTruncated {
+		return 0
+	}
+	if p.ContentEncoding != "" && p.ContentEncoding != "identity" {
+		return 0
+	}
+	if !strings.EqualFold(strings.TrimSpace(p.Header.Get("Accept-Ranges")), "bytes") {
+		return 0
+	}
+	if etag := p.Header.Get("ETag"); etag == "" || strings.HasPrefix(etag, "W/") {
+		return 0
+	}
+	return int64(len(p.Body))
+}
+
+// requestRest asks for the rest of the page's body from offset, if it is
+// still the same version.
+func (p *Page) requestRest(req *http.Request, offset int64) {
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	req.Header.Set("If-Range", p.Header.Get("ETag"))
+}
+
+// continuedBy reports whether a 206 response to requestRest continues the
+// page's body from offset: the range starts there, and the response is of
+// the same version, uncompressed.
+func (p *Page) continuedBy(res *http.Response, offset int64) bool {
+	if etag := res.Header.Get("ETag"); etag != "" && etag != p.Header.Get("ETag") {
+		return false
+	}
+	if ce := contentEncoding(res); ce != "" && ce != "identity" {
+		return false
+	}
+	start, ok := contentRangeStart(res.Header.Get("Content-Range"))
+	return ok && start == offset
+}
+
+// contentRangeStart parses the offset of the first byte of a Content-Range
+// header, e.g. 100 for "bytes 100-199/200".
+func contentRangeStart(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, false
+	}
+	v = strings.TrimSpace(v[len("bytes "):])
+	i := strings.IndexByte(v, '-')
+	if i < 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(v[:i], 10, 64)
+	return start, err == nil && start >= 0
+}
@@ -0,0 +1,46 @@
+package crawl
+
+import "strings"
+
+// OnlyContentTypes returns a result filter, for WithResultFilter, keeping
+// only the results for pages of the given media types, e.g. "text/html".
+// Results without a content type, such as pages that couldn't be fetched
+// or were disallowed by robots.txt, are kept too, so failures aren't
+// hidden.
+func OnlyContentTypes(types ...string) func(Result) bool {
+	set := contentTypeSet(types)
+	return func(r Result) bool {
+		return r.ContentType == "" || set[r.ContentType]
+	}
+}
+
+// ExceptContentTypes returns a result filter, for WithResultFilter,
+// dropping the results for pages of the given media types, e.g.
+// "application/pdf".
+func ExceptContentTypes(types ...string) func(Result) bool {
+	set := contentTypeSet(types)
+	return func(r Result) bool {
+		return !set[r.ContentType]
+	}
+}
+
+// contentTypeSet returns the set of media types, lowercased as Result's
+// ContentType is.
+func contentTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+	return set
+}
+
+// retains reports whether a result passes every filter set with
+// WithResultFilter.
+func (c Crawler) retains(r Result) bool {
+	for _, keep := range c.resultFilters {
+		if !keep(r) {
+			return false
+		}
+	}
+	return true
+}
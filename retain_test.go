@@ -0,0 +1,84 @@
+package crawl
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+
+	"crawl/crawltest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResultFilter(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/a", "/report.pdf", "/logo.png")
+	site.Page("https://monzo.com/a")
+	site.Handle("https://monzo.com/report.pdf", crawltest.Response{Header: http.Header{"Content-Type": {"application/pdf"}}, Body: "%PDF-1.4"})
+	site.Handle("https://monzo.com/logo.png", crawltest.Response{Status: http.StatusNotFound, Header: http.Header{"Content-Type": {"image/png"}}})
+
+	var spilled []string
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap), WithResultFilter(OnlyContentTypes("text/html")),
+		WithLinkSpill(0, func(r Result) { spilled = append(spilled, r.URL) }))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var urls []string
+	for _, r := range got {
+		urls = append(urls, r.URL)
+	}
+	want := []string{"https://monzo.com/", "https://monzo.com/a"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"https://monzo.com/"}, spilled); diff != "" {
+		t.Errorf("spilled mismatch (-want +got):\n%s", diff)
+	}
+	// The pages filtered out are still counted, so the totals add up.
+	if s := c.Stats(); s.Fetched != 4 || s.Errors != 1 || s.Filtered != 2 {
+		t.Errorf("Stats() Fetched, Errors, Filtered = %d, %d, %d, want 4, 1, 2", s.Fetched, s.Errors, s.Filtered)
+	}
+	if s := c.Summary(); s.Pages != 2 {
+		t.Errorf("Summary().Pages = %d, want 2", s.Pages)
+	}
+
+	// Streamed results are filtered too, and filters combine.
+	c = NewCrawler(1, WithTransportMiddleware(site.Wrap),
+		WithResultFilter(ExceptContentTypes("Application/PDF")),
+		WithResultFilter(func(r Result) bool { return r.URL != "https://monzo.com/a" }))
+	stream, err := c.CrawlStream("https://monzo.com")
+	if err != nil {
+		t.Fatalf("CrawlStream erred when not expected: %v", err)
+	}
+	urls = nil
+	for r := range stream {
+		urls = append(urls, r.URL)
+	}
+	sort.Strings(urls)
+	want = []string{"https://monzo.com/", "https://monzo.com/logo.png"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("streamed results mismatch (-want +got):\n%s", diff)
+	}
+	if n := c.Stats().Filtered; n != 2 {
+		t.Errorf("Stats().Filtered = %d, want 2", n)
+	}
+
+	if err := NewCrawler(1, WithResultFilter(nil)).err; err == nil {
+		t.Errorf("WithResultFilter(nil) accepted, want an error")
+	}
+}
+
+func TestOnlyContentTypes(t *testing.T) {
+	keep := OnlyContentTypes("text/html", " Application/XHTML+XML")
+	for ct, want := range map[string]bool{
+		"text/html":             true,
+		"application/xhtml+xml": true,
+		"":                      true,
+		"application/pdf":       false,
+	} {
+		if got := keep(Result{ContentType: ct}); got != want {
+			t.Errorf("OnlyContentTypes keeps %q = %v, want %v", ct, got, want)
+		}
+	}
+}
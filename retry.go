@@ -0,0 +1,97 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter is the longest a Retry-After header may ask us to wait.
+// Pages asking for longer fail instead, rather than tie up a fetcher.
+const maxRetryAfter = time.Minute
+
+// retryPolicy is how transient failures are retried, as set with
+// WithRetries.
+type retryPolicy struct {
+	// attempts is the most requests made for a page, or 0 for no retries.
+	attempts int
+	backoff  time.Duration
+}
+
+// getWithRetries is getHTTP, retrying transient failures with exponential
+// backoff. It returns the last attempt's page and error, and the number of
+// attempts made. Retries are counted in the stats under PurposeRetry. Bodies
+// that failed partway are resumed, where the server allows it, rather than
+// downloaded again from the start.
+func (c Crawler) getWithRetries(ctx context.Context, addr string) (*Page, int, error) {
+	var partial *Page
+	for attempt := 1; ; attempt++ {
+		p, err := c.getHTTPFrom(ctx, addr, partial)
+		if p.resumeOffset() > 0 {
+			partial = p
+		}
+		if err == nil || attempt >= c.retries.attempts || !transient(p, err) || ctx.Err() != nil {
+			return p, attempt, err
+		}
+		wait, ok := c.retries.wait(attempt, p, c.clock.Now())
+		if !ok || sleep(ctx, c.clock, wait) != nil {
+			return p, attempt, err
+		}
+		ctx = withPurpose(ctx, PurposeRetry)
+	}
+}
+
+// transient reports whether a failed request may succeed if made again:
+// those failing without a response, or while reading a successful one, and
+// those whose status class is retryable. Other 4xx responses, and bodies
+// too large to read, are permanent.
+func transient(p *Page, err error) bool {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return false
+	}
+	if p == nil || p.StatusCode == http.StatusOK {
+		return true
+	}
+	return ClassifyStatus(p.StatusCode).Retryable()
+}
+
+// wait returns how long to wait after a failed attempt before the next: the
+// backoff, doubled for each attempt so far, with jitter so that fetchers
+// failing together don't retry together, or longer if the response's
+// Retry-After header asks for it. It returns false if the server asks for
+// longer than maxRetryAfter.
+func (r retryPolicy) wait(attempt int, p *Page, now time.Time) (time.Duration, bool) {
+	d := r.backoff << uint(attempt-1)
+	if d > 0 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	if p != nil {
+		if after, ok := retryAfter(p.Header.Get("Retry-After"), now); ok {
+			if after > maxRetryAfter {
+				return 0, false
+			}
+			if after > d {
+				d = after
+			}
+		}
+	}
+	return d, true
+}
+
+// retryAfter parses a Retry-After header, either a number of seconds or an
+// HTTP date, as a time to wait from now.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
@@ -0,0 +1,233 @@
+package crawl
+
+import (
+	"bytes"
+	"crawl/crawltest"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com",
+		crawltest.Response{Status: http.StatusServiceUnavailable},
+		crawltest.Response{Err: syscall.ECONNRESET},
+		crawltest.Response{Body: `<a href="/missing">missing</a><a href="/down">down</a>`},
+	)
+	site.Handle("https://monzo.com/down", crawltest.Response{Status: http.StatusInternalServerError})
+
+	c := NewCrawler(1, WithIgnoreRobots(true), WithRetries(3, time.Millisecond), WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Crawl() = %+v, want 3 results", got)
+	}
+	if r := got[0]; r.Err != nil || r.Attempts != 3 || r.StatusCode != 200 {
+		t.Errorf("result for the starting URL = %+v, want success on the 3rd attempt", r)
+	}
+	if r := got[1]; r.Err == nil || !strings.Contains(r.Err.Error(), "after 3 attempts") || r.Attempts != 3 {
+		t.Errorf("result for /down = %+v, want failure after 3 attempts", r)
+	}
+	// 404s are never retried.
+	if r := got[2]; r.Err == nil || r.Attempts != 0 || site.Calls(r.URL) != 1 {
+		t.Errorf("result for /missing = %+v after %d calls, want a single failed attempt", r, site.Calls(r.URL))
+	}
+	if n := c.Stats().Requests[PurposeRetry.String()].Requests; n != 4 {
+		t.Errorf("Stats() retry requests = %d, want 4", n)
+	}
+
+	if err := NewCrawler(1, WithRetries(0, time.Second)).err; err == nil {
+		t.Errorf("WithRetries(0, 1s) accepted, want an error")
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := retryPolicy{attempts: 5, backoff: time.Second}
+	page := func(retryAfter string) *Page {
+		return &Page{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {retryAfter}}}
+	}
+	tests := []struct {
+		attempt  int
+		page     *Page
+		min, max time.Duration
+		ok       bool
+	}{
+		{1, nil, 500 * time.Millisecond, time.Second, true},
+		{3, nil, 2 * time.Second, 4 * time.Second, true},
+		{1, page("10"), 10 * time.Second, 10 * time.Second, true},
+		{1, page(now.Add(20 * time.Second).Format(http.TimeFormat)), 20 * time.Second, 20 * time.Second, true},
+		// A Retry-After shorter than the backoff doesn't shorten it.
+		{3, page("1"), 2 * time.Second, 4 * time.Second, true},
+		{1, page("garbage"), 500 * time.Millisecond, time.Second, true},
+		{1, page("3600"), 0, 0, false},
+	}
+	for _, tt := range tests {
+		d, ok := r.wait(tt.attempt, tt.page, now)
+		if ok != tt.ok || d < tt.min || d > tt.max {
+			t.Errorf("wait(%d, %+v) = %v, %v, want between %v and %v, %v", tt.attempt, tt.page, d, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+
+	if transient(&Page{StatusCode: http.StatusNotFound}, nil) {
+		t.Errorf("transient(404) = true, want false")
+	}
+	if transient(&Page{StatusCode: http.StatusOK}, ErrBodyTooLarge) {
+		t.Errorf("transient(ErrBodyTooLarge) = true, want false")
+	}
+}
+
+// flakyServer serves a large page, breaking off the first transfer of it at
+// cut bytes, and the rest of each request through http.ServeContent, which
+// honours Range and If-Range. It records the Range and If-Range headers of
+// each request.
+type flakyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	body     []byte
+	etag     string
+	requests []string
+}
+
+func newFlakyServer(t *testing.T, etag string, cut int) *flakyServer {
+	var b bytes.Buffer
+	for i := 0; b.Len() < 64<<10; i++ {
+		fmt.Fprintf(&b, "<p>Row %d of the report</p>\n", i)
+	}
+	b.WriteString(`<a href="/end">end</a>`)
+	f := &flakyServer{body: b.Bytes(), etag: etag}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		first, body, etag := len(f.requests) == 1, f.body, f.etag
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if !first {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+			return
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body[:cut])
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() erred when not expected: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	return f
+}
+
+func TestRetryResumesBody(t *testing.T) {
+	const cut = 10000
+	for _, tc := range []struct {
+		name string
+		etag string
+		// change is the page's ETag after the first response, if it
+		// changes. Only the ETag changes, so the bodies can be
+		// compared.
+		change string
+		// ignoreIfRange strips If-Range from requests, as a server
+		// that doesn't support it would ignore it.
+		ignoreIfRange bool
+		wantRequest   string
+		// wantRefetch is set if the rest of the page is requested,
+		// but the page is then requested whole.
+		wantRefetch bool
+		wantResumed int64
+	}{
+		{name: "resumed", etag: `"v1"`, wantRequest: fmt.Sprintf(`bytes=%d- "v1"`, cut), wantResumed: cut},
+		// If-Range makes the server send the whole of a changed page.
+		{name: "changed", etag: `"v1"`, change: `"v2"`, wantRequest: fmt.Sprintf(`bytes=%d- "v1"`, cut)},
+		// Otherwise, the rest of a different version is sent, and the
+		// page is requested again, in the same attempt.
+		{name: "changed ignoring If-Range", etag: `"v1"`, change: `"v2"`, ignoreIfRange: true, wantRequest: fmt.Sprintf(`bytes=%d- `, cut), wantRefetch: true},
+		{name: "weak etag", etag: `W/"v1"`, wantRequest: " "},
+		{name: "no etag", wantRequest: " "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newFlakyServer(t, tc.etag, cut)
+			defer ts.Close()
+			c := NewCrawler(1, WithIgnoreRobots(true), WithRetries(2, time.Millisecond), WithMaxDepth(0),
+				WithTransportMiddleware(func(next http.RoundTripper) http.RoundTripper {
+					return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						if tc.ignoreIfRange {
+							req.Header.Del("If-Range")
+						}
+						res, err := next.RoundTrip(req)
+						if tc.change != "" && err == nil {
+							ts.mu.Lock()
+							ts.etag = tc.change
+							ts.mu.Unlock()
+						}
+						return res, err
+					})
+				}))
+			got, err := c.Crawl(ts.URL)
+			if err != nil || len(got) != 1 {
+				t.Fatalf("Crawl() = %+v, %v, want one result", got, err)
+			}
+			r := got[0]
+			if r.Err != nil || r.Attempts != 2 || r.ResumedFrom != tc.wantResumed {
+				t.Errorf("result Err, Attempts, ResumedFrom = %v, %d, %d, want nil, 2, %d", r.Err, r.Attempts, r.ResumedFrom, tc.wantResumed)
+			}
+			if want := int64(len(ts.body)); r.BytesDecoded != want {
+				t.Errorf("BytesDecoded = %d, want %d", r.BytesDecoded, want)
+			}
+			// The last link is only in the part of the body after the
+			// cut, and the page is only scraped once whole.
+			if len(r.Links) != 1 || r.Links[0] != "/end" {
+				t.Errorf("Links = %q, want [/end]", r.Links)
+			}
+			// A refetch is made without waiting again, so is counted as
+			// part of the retry.
+			if s := c.Stats(); s.Requests["page"].Requests != 1 || s.Requests["retry"].Requests != 1 {
+				t.Errorf("Stats().Requests = %+v, want a page and a retry request", s.Requests)
+			}
+			ts.mu.Lock()
+			defer ts.mu.Unlock()
+			want := 2
+			if tc.wantRefetch {
+				want = 3
+			}
+			if len(ts.requests) != want || ts.requests[1] != tc.wantRequest || tc.wantRefetch && ts.requests[2] != " " {
+				t.Errorf("requests' Range and If-Range = %q, want %d, the second %q", ts.requests, want, tc.wantRequest)
+			}
+		})
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	for v, want := range map[string]int64{
+		"bytes 100-199/200": 100,
+		"bytes 0-9/*":       0,
+		" bytes 5-9/10 ":    5,
+		"bytes */200":       -1,
+		"items 1-2/3":       -1,
+		"":                  -1,
+	} {
+		got, ok := contentRangeStart(v)
+		if !ok {
+			got = -1
+		}
+		if got != want {
+			t.Errorf("contentRangeStart(%q) = %d, %v, want %d", v, got, ok, want)
+		}
+	}
+}
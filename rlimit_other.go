@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package crawl
+
+// fileLimit returns 0, as we don't know how to determine the limit on open
+// files on this platform.
+func fileLimit() uint64 {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package crawl
+
+import "syscall"
+
+// fileLimit returns the soft limit on the number of files the process may
+// have open, or 0 if it can't be determined.
+func fileLimit() uint64 {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	return rl.Cur
+}
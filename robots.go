@@ -0,0 +1,247 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrDisallowed is wrapped by the Err of results for pages that were not
+// fetched because the site's robots.txt disallows them. They are counted in
+// Stats.Disallowed, rather than as fetched pages or errors.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsAgent returns the product token matched against the User-agent
+// lines of host's robots.txt: the User-Agent sent to it up to the first / or
+// space, e.g. mcrawl.
+func (c Crawler) robotsAgent(host string) string {
+	ua := c.userAgentFor(host)
+	if i := strings.IndexAny(ua, "/ "); i >= 0 {
+		ua = ua[:i]
+	}
+	return ua
+}
+
+// robotsRule is an Allow or Disallow line of a robots.txt file.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsRules are the rules of a robots.txt file that apply to us. A nil
+// *robotsRules allows everything.
+type robotsRules struct {
+	rules []robotsRule
+	// disallowAll is set if the file couldn't be fetched because of a
+	// server error, which RFC 9309 says to treat as disallowing everything.
+	disallowAll bool
+}
+
+// parseRobots parses a robots.txt file, keeping the rules of the groups for
+// agent, matched case-insensitively, or if there are none, those for *. Groups naming the same agent are
+// merged, and lines it doesn't understand are ignored.
+func parseRobots(body []byte, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	var mine, star []robotsRule
+	var foundMine bool
+	// The agents of the current group, and whether its rules have started,
+	// so a User-agent line after them starts a new group.
+	var forMine, forStar, inRules bool
+
+	s := bufio.NewScanner(bytes.NewReader(body))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if inRules {
+				forMine, forStar, inRules = false, false, false
+			}
+			name := strings.ToLower(value)
+			if name == "*" {
+				forStar = true
+			} else if name == agent {
+				forMine, foundMine = true, true
+			}
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow disallows nothing.
+			if value == "" {
+				continue
+			}
+			r := robotsRule{allow: key == "allow", pattern: value, re: compileRobots(value)}
+			if forMine {
+				mine = append(mine, r)
+			}
+			if forStar {
+				star = append(star, r)
+			}
+		}
+	}
+	if foundMine {
+		return &robotsRules{rules: mine}
+	}
+	return &robotsRules{rules: star}
+}
+
+// allowed reports whether the rules allow fetching path, which includes any
+// query. The rule with the longest matching pattern applies, and Allow wins
+// ties.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil || path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || n == longest && rule.allow {
+			allow, longest = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// compileRobots compiles a robots.txt path pattern, in which * matches any
+// sequence of characters, and a trailing $ anchors it to the end of the
+// path. Otherwise, it matches any path it is a prefix of.
+func compileRobots(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsCache holds the robots.txt rules of each host fetched from during a
+// crawl, fetching each file once. Fetchers consult it concurrently, so all
+// access is under mu.
+type robotsCache struct {
+	mu     sync.Mutex
+	ignore bool
+	hosts  map[string]*robotsEntry
+}
+
+// robotsEntry is a host's rules, which are ready once loaded is closed.
+type robotsEntry struct {
+	loaded chan struct{}
+	rules  *robotsRules
+}
+
+func (rc *robotsCache) reset() {
+	rc.mu.Lock()
+	rc.hosts = make(map[string]*robotsEntry)
+	rc.mu.Unlock()
+}
+
+// rules returns the rules for the host of u, calling load to fetch them if
+// no other fetcher has yet.
+func (rc *robotsCache) rules(ctx context.Context, u *url.URL, load func(context.Context, *url.URL) *robotsRules) (*robotsRules, error) {
+	key := u.Scheme + "://" + strings.ToLower(u.Host)
+	rc.mu.Lock()
+	e, ok := rc.hosts[key]
+	if !ok {
+		e = &robotsEntry{loaded: make(chan struct{})}
+		rc.hosts[key] = e
+	}
+	rc.mu.Unlock()
+
+	if !ok {
+		e.rules = load(ctx, u)
+		close(e.loaded)
+	}
+	select {
+	case <-e.loaded:
+		return e.rules, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkRobots returns an error wrapping ErrDisallowed if the robots.txt of
+// addr's host disallows fetching it, unless ignored with WithIgnoreRobots.
+func (c Crawler) checkRobots(ctx context.Context, addr string) error {
+	if c.robots == nil || c.robots.ignore {
+		return nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil
+	}
+	rules, err := c.robots.rules(ctx, u, c.loadRobots)
+	if err != nil {
+		return err
+	}
+	if !rules.allowed(u.RequestURI()) {
+		return fmt.Errorf("%s: %w", addr, ErrDisallowed)
+	}
+	return nil
+}
+
+// stepRobots is the step Explain adds after the link filters, for the
+// robots.txt of the link's host, which crawls check when fetching a page.
+const stepRobots = "robots"
+
+// explainRobots decides whether the robots.txt of link's host allows
+// fetching it, loading the file unless ignored with WithIgnoreRobots.
+func (c Crawler) explainRobots(ctx context.Context, link *url.URL) Decision {
+	d := Decision{Step: stepRobots, Pass: true}
+	if c.robots == nil || c.robots.ignore {
+		d.Detail = "robots.txt ignored"
+		return d
+	}
+	path := link.RequestURI()
+	rules := c.loadRobots(ctx, link)
+	d.Pass = rules.allowed(path)
+	switch {
+	case rules == nil:
+		d.Detail = fmt.Sprintf("no robots.txt rules for %s", link.Host)
+	case d.Pass:
+		d.Detail = fmt.Sprintf("robots.txt of %s allows %s", link.Host, path)
+	default:
+		d.Detail = fmt.Sprintf("robots.txt of %s disallows %s", link.Host, path)
+	}
+	return d
+}
+
+// loadRobots fetches and parses the robots.txt of u's host. A missing file,
+// or any other client error, allows everything; a server error disallows
+// everything, so we back off from an ailing site. If the request fails
+// altogether, everything is allowed, and each page fetch fails on its own.
+func (c Crawler) loadRobots(ctx context.Context, u *url.URL) *robotsRules {
+	addr := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+	p, err := c.getHTTP(withPurpose(ctx, PurposeRobots), addr)
+	switch {
+	case p != nil && p.StatusCode >= 500:
+		log.Printf("robots.txt for %s unavailable (%d): not crawling it", u.Host, p.StatusCode)
+		return &robotsRules{disallowAll: true}
+	case err != nil:
+		return nil
+	}
+	return parseRobots(p.Body, c.robotsAgent(u.Host))
+}
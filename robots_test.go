@@ -0,0 +1,146 @@
+package crawl
+
+import (
+	"crawl/crawltest"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRobotsAllowed(t *testing.T) {
+	robots := `
+# Everyone else.
+User-agent: *
+Disallow: /
+
+User-agent: mcrawl
+User-agent: other
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search*q=
+Allow: /page
+Disallow: /page
+
+User-agent: MCRAWL
+Disallow: /merged
+`
+	rules := parseRobots([]byte(robots), NewCrawler(1).robotsAgent("monzo.com"))
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private", false},
+		{"/private/secret", false},
+		{"/private/public/page", true},
+		{"/report.pdf", false},
+		{"/report.pdf?download=1", true},
+		{"/search?page=2&q=shoes", false},
+		{"/search?page=2", true},
+		// Allow wins a tie.
+		{"/page", true},
+		{"/merged", false},
+		{"/robots.txt", true},
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// Without a group for us, the * group applies.
+	if rules := parseRobots([]byte(robots), "otherbot"); rules.allowed("/page") {
+		t.Errorf("allowed(/page) for otherbot = true, want false under the * group")
+	}
+	// With no robots.txt, everything is allowed.
+	var none *robotsRules
+	if !none.allowed("/private") {
+		t.Errorf("allowed(/private) without robots.txt = false, want true")
+	}
+}
+
+func TestRobots(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("https://monzo.com/robots.txt", crawltest.Response{Body: "User-agent: *\nDisallow: /private\n"})
+	site.Page("https://monzo.com", "/a", "/private/b")
+	site.Page("https://monzo.com/a")
+	site.Page("https://monzo.com/private/b")
+
+	c := NewCrawler(2, WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Crawl() = %+v, want 3 results", got)
+	}
+	if r := got[2]; r.URL != "https://monzo.com/private/b" || !errors.Is(r.Err, ErrDisallowed) {
+		t.Errorf("result for /private/b = %+v, want ErrDisallowed", r)
+	}
+	if n := site.Calls("https://monzo.com/private/b"); n != 0 {
+		t.Errorf("/private/b fetched %d times, want 0", n)
+	}
+	if n := site.Calls("https://monzo.com/robots.txt"); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+	s := c.Stats()
+	if s.Fetched != 2 || s.Errors != 0 || s.Disallowed != 1 {
+		t.Errorf("Stats() Fetched, Errors, Disallowed = %d, %d, %d, want 2, 0, 1", s.Fetched, s.Errors, s.Disallowed)
+	}
+
+	// Ignoring robots.txt, it isn't fetched at all.
+	site = crawltest.NewFake()
+	site.Page("https://monzo.com", "/private/b")
+	c = NewCrawler(1, WithIgnoreRobots(true), WithTransportMiddleware(site.Wrap))
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	want := []string{"https://monzo.com/", "https://monzo.com/private/b"}
+	if diff := cmp.Diff(want, site.Requests()); diff != "" {
+		t.Errorf("requests with WithIgnoreRobots mismatch (-want +got):\n%s", diff)
+	}
+
+	// A server error for robots.txt disallows the whole site.
+	site = crawltest.NewFake()
+	site.Handle("https://monzo.com/robots.txt", crawltest.Response{Status: http.StatusServiceUnavailable})
+	site.Page("https://monzo.com")
+	c = NewCrawler(1, WithTransportMiddleware(site.Wrap))
+	got, err = c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 1 || !errors.Is(got[0].Err, ErrDisallowed) {
+		t.Errorf("Crawl() with robots.txt unavailable = %+v, want the starting URL disallowed", got)
+	}
+
+	// robots.txt is read even when only HTML pages are, although it is
+	// served as plain text.
+	site = crawltest.NewFake()
+	site.Handle("https://monzo.com/robots.txt", crawltest.Response{
+		Header: http.Header{"Content-Type": {"text/plain"}},
+		Body:   "User-agent: *\nDisallow: /private/\n",
+	})
+	site.Page("https://monzo.com", "/private/x")
+	site.Page("https://monzo.com/private/x")
+	for name, opt := range map[string]Option{
+		"WithSkipNonHTML":       WithSkipNonHTML(true),
+		"WithStrictContentType": WithStrictContentType(true),
+	} {
+		c = NewCrawler(1, opt, WithTransportMiddleware(site.Wrap))
+		if _, err := c.Crawl("https://monzo.com"); err != nil {
+			t.Fatalf("Crawl with %s erred when not expected: %v", name, err)
+		}
+		if n := c.Stats().Disallowed; n != 1 {
+			t.Errorf("Stats().Disallowed with %s = %d, want 1", name, n)
+		}
+		if got, _ := c.Explain("https://monzo.com", "/private/x"); len(got) == 0 || got[len(got)-1].Pass {
+			t.Errorf("Explain(/private/x) with %s = %v, want it disallowed by robots.txt", name, got)
+		}
+	}
+	if n := site.Calls("https://monzo.com/private/x"); n != 0 {
+		t.Errorf("/private/x fetched %d times, want 0", n)
+	}
+}
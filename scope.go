@@ -0,0 +1,83 @@
+package crawl
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// siteOf returns the site a host belongs to, for the purposes of scoping
+// and deduplication. Hosts configured as aliases of each other, and apex and
+// www hosts when coalescing them, belong to the same site.
+func (c Crawler) siteOf(host string) string {
+	host = strings.ToLower(host)
+	if a, ok := c.hostAliases[host]; ok {
+		host = a
+	}
+	if c.coalesceWWW {
+		host = strings.TrimPrefix(host, "www.")
+	}
+	return host
+}
+
+// withoutDefaultPort strips an http or https default port from a host, as
+// canonicalize does from links. The scheme isn't known, so either is.
+func withoutDefaultPort(host string) string {
+	for _, port := range defaultPorts {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	return host
+}
+
+// registrableDomain returns the domain a host is registered under, by the
+// public suffix list, e.g. monzo.com for community.monzo.com, and
+// monzo.co.uk for www.monzo.co.uk. It returns "" for hosts without one,
+// such as IP addresses and localhost.
+func registrableDomain(host string) string {
+	host = strings.ToLower((&url.URL{Host: host}).Hostname())
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// sameDomain reports whether two hosts are registered under the same
+// domain, for WithIncludeSubdomains.
+func sameDomain(a, b string) bool {
+	domain := registrableDomain(a)
+	return domain != "" && domain == registrableDomain(b)
+}
+
+// visitKey returns the key used to record a normalized link as visited.
+// Links to the same path on different hosts of the same site share a key, as
+// do directory variants of the same path if WithDirectoryIndex is set, and
+// paths differing only in a session ID collapsed by a SessionRule. Every
+// comparison of links with crawled pages must go through visitKey, so it
+// agrees with the crawl about which links point to which pages.
+func (c Crawler) visitKey(link *url.URL) string {
+	k := *link
+	k.Host = c.siteOf(link.Host)
+	c.sessions.collapse(&k)
+	if c.dirIndex {
+		k.Path, k.RawPath = c.directoryOf(link.Path), ""
+	}
+	return k.String()
+}
+
+// directoryOf strips any index document and trailing slash from a path, so
+// /docs, /docs/ and /docs/index.html are all /docs, and the root is "".
+func (c Crawler) directoryOf(path string) string {
+	for _, name := range c.indexDocuments {
+		if strings.HasSuffix(path, "/"+name) {
+			path = strings.TrimSuffix(path, name)
+			break
+		}
+	}
+	return strings.TrimRight(path, "/")
+}
@@ -0,0 +1,95 @@
+package crawl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// SeedsFromResults reads the results of an earlier crawl, and returns the
+// URLs of the pages it fetched successfully, in order, without duplicates,
+// for WithSeeds. It reads any of the forms mcrawl writes: a JSON array of
+// results, one result per line as streamed, or a CrawlReport.
+func SeedsFromResults(r io.Reader) ([]string, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var seeds []string
+	seen := make(map[string]bool)
+	add := func(results ...Result) {
+		for _, r := range results {
+			if r.Err != nil || ClassifyStatus(r.StatusCode) != ClassOK || seen[r.URL] {
+				continue
+			}
+			seen[r.URL] = true
+			seeds = append(seeds, r.URL)
+		}
+	}
+	for {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err == io.EOF {
+			return seeds, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("SeedsFromResults: %w", err)
+		}
+		results, err := decodeResults(v)
+		if err != nil {
+			return nil, fmt.Errorf("SeedsFromResults: %w", err)
+		}
+		add(results...)
+	}
+}
+
+// decodeResults decodes a JSON value holding results: an array of them, a
+// CrawlReport, or a single Result.
+func decodeResults(v json.RawMessage) ([]Result, error) {
+	var results []Result
+	if len(v) > 0 && v[0] == '[' {
+		err := json.Unmarshal(v, &results)
+		return results, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(v, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["results"]; ok {
+		var report CrawlReport
+		err := json.Unmarshal(v, &report)
+		return report.Results, err
+	}
+	var r Result
+	if err := json.Unmarshal(v, &r); err != nil {
+		return nil, err
+	}
+	return []Result{r}, nil
+}
+
+// queueSeeds adds the seeds set with WithSeeds to the work queue, at depth
+// 0, marking them visited. Seeds are filtered as links on the starting page
+// would be, and those filtered out are counted by the step that did, for
+// Stats.SkippedSeeds.
+func (c Crawler) queueSeeds(root *url.URL, f *frontier, visited map[string]bool, discovered map[string]int) {
+	var skipped map[string]int64
+	for _, seed := range c.seeds {
+		st := linkState{root: root, base: root, href: seed}
+		if d, ok := c.filterLink(&st, nil); !ok {
+			if skipped == nil {
+				skipped = make(map[string]int64)
+			}
+			skipped[d.Step]++
+			continue
+		}
+		link := st.link
+		key := c.visitKey(link)
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+		if c.canonicalHost && c.siteOf(link.Host) == c.siteOf(root.Host) {
+			link.Host = root.Host
+		}
+		discovered[link.String()] = len(discovered)
+		f.push(queuedURL{url: link.String(), host: link.Host, key: key, scope: root.Host})
+	}
+	c.counters.skippedSeeds.Store(skipped)
+}
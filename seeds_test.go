@@ -0,0 +1,115 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"crawl/crawltest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSeedsFromResults(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/", StatusCode: 200},
+		{URL: "https://monzo.com/a", StatusCode: 200},
+		{URL: "https://monzo.com/missing", StatusCode: 404, Err: errors.New("404 Not Found")},
+		{URL: "https://monzo.com/down", Err: errors.New("connection refused")},
+		{URL: "https://monzo.com/a", StatusCode: 200},
+	}
+	want := []string{"https://monzo.com/", "https://monzo.com/a"}
+
+	array, _ := json.Marshal(results)
+	report, _ := json.Marshal(CrawlReport{Seed: "https://monzo.com/", Results: results})
+	var lines []string
+	for _, r := range results {
+		b, _ := json.Marshal(r)
+		lines = append(lines, string(b))
+	}
+	for name, in := range map[string]string{
+		"array":  string(array),
+		"report": string(report),
+		"lines":  strings.Join(lines, "\n") + "\n",
+	} {
+		got, err := SeedsFromResults(strings.NewReader(in))
+		if err != nil {
+			t.Errorf("SeedsFromResults(%s) erred when not expected: %v", name, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("SeedsFromResults(%s) mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+
+	if _, err := SeedsFromResults(strings.NewReader(`[{"URL": `)); err == nil {
+		t.Errorf("SeedsFromResults of truncated JSON didn't err")
+	}
+}
+
+func TestWithSeeds(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com/", "/a")
+	site.Page("https://monzo.com/a")
+	site.Page("https://monzo.com/orphan", "/orphan/child")
+	site.Page("https://monzo.com/orphan/child")
+
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap), WithSafeExclusions(true), WithSeeds(
+		"https://monzo.com/orphan",
+		"https://monzo.com/a",
+		"https://monzo.com/logout",
+		"https://example.com/",
+		"https://monzo.com/orphan",
+	))
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	depths := make(map[string]int)
+	for _, r := range results {
+		depths[r.URL] = r.Depth
+	}
+	// Seeds are crawled from depth 0, and only once each.
+	want := map[string]int{
+		"https://monzo.com/":             0,
+		"https://monzo.com/a":            0,
+		"https://monzo.com/orphan":       0,
+		"https://monzo.com/orphan/child": 1,
+	}
+	if diff := cmp.Diff(want, depths); diff != "" {
+		t.Errorf("depths mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int64{"exclude": 1, "scope": 1}, c.Stats().SkippedSeeds); diff != "" {
+		t.Errorf("Stats().SkippedSeeds mismatch (-want +got):\n%s", diff)
+	}
+	if n := c.Config().Seeds; n != 5 {
+		t.Errorf("Config().Seeds = %d, want 5", n)
+	}
+}
+
+func TestSeedsAfterRedirect(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Handle("http://monzo.com", crawltest.Response{Status: http.StatusMovedPermanently, Header: http.Header{"Location": {"https://www.monzo.com/"}}})
+	site.Page("https://www.monzo.com/")
+	site.Page("https://www.monzo.com/orphan")
+
+	// The seed is on the site the starting URL redirects to, so is only in
+	// scope once it has been fetched.
+	c := NewCrawler(1, WithTransportMiddleware(site.Wrap), WithSeeds("https://www.monzo.com/orphan"))
+	results, err := c.Crawl("http://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	var crawled []string
+	for _, r := range results {
+		crawled = append(crawled, r.URL)
+	}
+	want := []string{"http://monzo.com/", "https://www.monzo.com/orphan"}
+	if diff := cmp.Diff(want, crawled); diff != "" {
+		t.Errorf("crawled URLs mismatch (-want +got):\n%s", diff)
+	}
+	if skipped := c.Stats().SkippedSeeds; len(skipped) != 0 {
+		t.Errorf("Stats().SkippedSeeds = %v, want none", skipped)
+	}
+}
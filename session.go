@@ -0,0 +1,247 @@
+package crawl
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SessionThresholds tune how conservatively session IDs embedded in URLs are
+// detected, as enabled with WithSessionDetection.
+type SessionThresholds struct {
+	// MinSamples is the number of distinct tokens that must be seen in the
+	// same place, all serving identical content, before a rule collapsing
+	// them is inferred.
+	MinSamples int
+	// MinLength is the length of the shortest path segment considered a
+	// token.
+	MinLength int
+	// MinEntropy is the least Shannon entropy, in bits per character, of
+	// a token. Long random hex has about 3.7; slugs of words and numbers
+	// can exceed 3, so it's the identical content that counts most.
+	MinEntropy float64
+}
+
+// DefaultSessionThresholds are conservative thresholds, which only catch
+// long, random tokens repeated across many URLs.
+var DefaultSessionThresholds = SessionThresholds{
+	MinSamples: 5,
+	MinLength:  12,
+	MinEntropy: 3.5,
+}
+
+// SessionRule collapses a volatile token, such as a session ID, in the paths
+// of a site's URLs, so URLs differing only in that token are crawled once.
+// Tokens in the query need no rule, as links are crawled without their
+// query.
+type SessionRule struct {
+	Host string
+	// Path is the path of the URLs the rule applies to, with * for the
+	// segment holding the token, e.g. /browse/*/shoes.
+	Path string
+	// Samples is the number of distinct tokens seen serving identical
+	// content when the rule was inferred, or 0 if it was given with
+	// WithSessionRules.
+	Samples int `json:",omitempty"`
+}
+
+// String returns the rule in the form ParseSessionRule accepts, e.g.
+// monzo.com/browse/*/shoes.
+func (r SessionRule) String() string {
+	return r.Host + r.Path
+}
+
+// ParseSessionRule parses a rule in the form returned by SessionRule.String.
+func ParseSessionRule(s string) (SessionRule, error) {
+	i := strings.Index(s, "/")
+	if i <= 0 {
+		return SessionRule{}, fmt.Errorf("session rule %q has no host and path", s)
+	}
+	r := SessionRule{Host: strings.ToLower(s[:i]), Path: s[i:]}
+	for _, seg := range strings.Split(r.Path, "/") {
+		if seg == "*" {
+			return r, nil
+		}
+	}
+	return SessionRule{}, fmt.Errorf("session rule %q has no * path segment", s)
+}
+
+// collapse replaces the rule's token in u with *, if the rule applies to it,
+// and reports whether it did. The host is compared as given, so callers must
+// normalize it first.
+func (r SessionRule) collapse(u *url.URL) bool {
+	if u.Host != r.Host {
+		return false
+	}
+	segs, pattern := strings.Split(u.Path, "/"), strings.Split(r.Path, "/")
+	if len(segs) != len(pattern) {
+		return false
+	}
+	for i := range segs {
+		if pattern[i] != "*" && pattern[i] != segs[i] {
+			return false
+		}
+	}
+	for i := range segs {
+		if pattern[i] == "*" {
+			segs[i] = "*"
+		}
+	}
+	u.Path, u.RawPath = strings.Join(segs, "/"), ""
+	return true
+}
+
+// isSessionToken reports whether a path segment looks like a random token: long, mixing
+// letters and digits, and with high entropy.
+func isSessionToken(s string, t SessionThresholds) bool {
+	if len(s) < t.MinLength {
+		return false
+	}
+	var letter, digit bool
+	counts := make(map[rune]int)
+	for _, r := range s {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+		counts[r]++
+	}
+	if !letter || !digit {
+		return false
+	}
+	var entropy float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= t.MinEntropy
+}
+
+// sessionCandidate is the evidence for a rule that hasn't been inferred yet.
+type sessionCandidate struct {
+	tokens map[string]bool
+	hash   uint64
+	// mixed is set once tokens are seen serving different content, which
+	// rules out the candidate for the rest of the crawl.
+	mixed bool
+}
+
+// sessionDetector infers session rules from the pages fetched, and applies
+// them, along with any pinned rules. Fetchers feed it pages while the Crawl
+// loop computes visit keys, so all access is under mu.
+type sessionDetector struct {
+	mu         sync.Mutex
+	enabled    bool
+	thresholds SessionThresholds
+	pinned     []SessionRule
+	inferred   []SessionRule
+	candidates map[SessionRule]*sessionCandidate
+}
+
+func (d *sessionDetector) reset() {
+	d.mu.Lock()
+	d.inferred = nil
+	d.candidates = make(map[SessionRule]*sessionCandidate)
+	d.mu.Unlock()
+}
+
+// rules returns the pinned rules, then those inferred so far.
+func (d *sessionDetector) rules() []SessionRule {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var rules []SessionRule
+	rules = append(rules, d.pinned...)
+	return append(rules, d.inferred...)
+}
+
+// collapse applies every matching rule to u, whose host must already be
+// normalized to its site.
+func (d *sessionDetector) collapse(u *url.URL) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range d.pinned {
+		r.collapse(u)
+	}
+	for _, r := range d.inferred {
+		r.collapse(u)
+	}
+}
+
+// observe records the content served at u, a URL on site, looking for tokens
+// that don't change it.
+func (d *sessionDetector) observe(site string, u *url.URL, body []byte) {
+	if d == nil || !d.enabled {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	segs := strings.Split(u.Path, "/")
+	for i, seg := range segs {
+		if !isSessionToken(seg, d.thresholds) {
+			continue
+		}
+		pattern := append([]string(nil), segs...)
+		pattern[i] = "*"
+		d.observeToken(SessionRule{Host: site, Path: strings.Join(pattern, "/")}, seg, body)
+	}
+}
+
+// observeToken adds a sighting of token to the evidence for rule, inferring
+// the rule once there is enough. The token is removed from the body before
+// comparing content, as pages usually repeat their session ID in links.
+func (d *sessionDetector) observeToken(rule SessionRule, token string, body []byte) {
+	for _, r := range d.inferred {
+		if r.Host == rule.Host && r.Path == rule.Path {
+			return
+		}
+	}
+	h := fnv.New64a()
+	h.Write(bytes.ReplaceAll(body, []byte(token), nil))
+	sum := h.Sum64()
+
+	cand, ok := d.candidates[rule]
+	if !ok {
+		cand = &sessionCandidate{tokens: make(map[string]bool), hash: sum}
+		d.candidates[rule] = cand
+	}
+	if cand.mixed || cand.hash != sum {
+		cand.mixed = true
+		return
+	}
+	cand.tokens[token] = true
+	if len(cand.tokens) >= d.thresholds.MinSamples {
+		rule.Samples = len(cand.tokens)
+		d.inferred = append(d.inferred, rule)
+		delete(d.candidates, rule)
+	}
+}
+
+// SessionRules returns the rules collapsing session IDs in URLs used by the
+// crawl currently being run by this Crawler, or the last one if it has
+// finished: those given with WithSessionRules, then those inferred with
+// WithSessionDetection, in the order they were inferred. Inferred rules are
+// guesses, which should be checked and, if right, pinned for future crawls.
+func (c Crawler) SessionRules() []SessionRule {
+	return c.sessions.rules()
+}
+
+// observeSession feeds a fetched page to the session detector.
+func (c Crawler) observeSession(addr string, body []byte) {
+	if c.sessions == nil || !c.sessions.enabled {
+		return
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return
+	}
+	c.sessions.observe(c.siteOf(u.Host), u, body)
+}
@@ -0,0 +1,104 @@
+package crawl
+
+import (
+	"crawl/crawltest"
+	"crypto/md5"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSessionDetection(t *testing.T) {
+	token := func(i int) string {
+		return fmt.Sprintf("SID-%x", md5.Sum([]byte{byte(i)}))
+	}
+	// Each entry page links to the shoes page with a new session ID, and
+	// the next entry page, so session IDs are found one at a time.
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/entry/1")
+	for i := 1; i <= 8; i++ {
+		shoes := fmt.Sprintf("/browse/%s/shoes", token(i))
+		site.Page(fmt.Sprintf("https://monzo.com/entry/%d", i), shoes, fmt.Sprintf("/entry/%d", i+1), fmt.Sprintf("/product/v2-release-%d", i))
+		// The page repeats its session ID, but is otherwise the same.
+		site.Handle("https://monzo.com"+shoes, crawltest.Response{Body: `<a href="/browse/` + token(i) + `/shoes/red">red</a>`})
+	}
+
+	c := NewCrawler(1,
+		WithSessionDetection(SessionThresholds{MinSamples: 3, MinLength: 12, MinEntropy: 3.5}),
+		WithTransportMiddleware(site.Wrap),
+	)
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	want := []SessionRule{{Host: "monzo.com", Path: "/browse/*/shoes", Samples: 3}}
+	if diff := cmp.Diff(want, c.SessionRules()); diff != "" {
+		t.Errorf("SessionRules() mismatch (-want +got):\n%s", diff)
+	}
+	// Once the rule is inferred, only one more session ID is crawled.
+	for i := 1; i <= 8; i++ {
+		shoes := fmt.Sprintf("https://monzo.com/browse/%s/shoes", token(i))
+		wantCalls := 0
+		if i <= 4 {
+			wantCalls = 1
+		}
+		if n := site.Calls(shoes); n != wantCalls {
+			t.Errorf("%s fetched %d times, want %d", shoes, n, wantCalls)
+		}
+	}
+
+	// Pinned rules apply from the start, to every crawl.
+	site = crawltest.NewFake()
+	site.Page("https://monzo.com", "/browse/"+token(1)+"/shoes", "/browse/"+token(2)+"/shoes")
+	c = NewCrawler(1, WithSessionRules(want...), WithTransportMiddleware(site.Wrap))
+	got, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Crawl() with pinned rule fetched %d pages, want 2", len(got))
+	}
+	want[0].Samples = 0
+	if diff := cmp.Diff(want, c.SessionRules()); diff != "" {
+		t.Errorf("SessionRules() with pinned rule mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIsSessionToken(t *testing.T) {
+	tests := []struct {
+		seg  string
+		want bool
+	}{
+		{"SID-a83f19c0d2e47b65", true},
+		{"0f8fad5bd9cb469fa16570867728950e", true},
+		{"a83f19c0", false},
+		{"spring-collection", false},
+		{"v2-release-2020", false},
+		{"summer-sale-2021", false},
+		{"1234567890123456", false},
+	}
+	for _, tt := range tests {
+		if got := isSessionToken(tt.seg, DefaultSessionThresholds); got != tt.want {
+			t.Errorf("isSessionToken(%q) = %v, want %v", tt.seg, got, tt.want)
+		}
+	}
+}
+
+func TestParseSessionRule(t *testing.T) {
+	r, err := ParseSessionRule("Monzo.com/browse/*/shoes")
+	if err != nil {
+		t.Fatalf("ParseSessionRule erred when not expected: %v", err)
+	}
+	if want := (SessionRule{Host: "monzo.com", Path: "/browse/*/shoes"}); r != want {
+		t.Errorf("ParseSessionRule() = %+v, want %+v", r, want)
+	}
+	if s := r.String(); s != "monzo.com/browse/*/shoes" {
+		t.Errorf("String() = %q, want monzo.com/browse/*/shoes", s)
+	}
+	for _, s := range []string{"/browse/*/shoes", "monzo.com/browse/shoes", "monzo.com"} {
+		if _, err := ParseSessionRule(s); err == nil {
+			t.Errorf("ParseSessionRule(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package crawl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Snapshot is a view of a crawl's frontier: what it is fetching and what it
+// will fetch next.
+type Snapshot struct {
+	// Pending are the next URLs waiting to be fetched, in the order they
+	// will be fetched. It is bounded by the limit given to
+	// Crawler.Snapshot; Queued is the full length of the queue.
+	Pending []PendingURL
+	Queued  int
+	// InFlight are the URLs being fetched, longest running first.
+	InFlight []InFlightURL
+	// HostQueues is the number of queued URLs for each host.
+	HostQueues map[string]int
+}
+
+// PendingURL is a URL waiting to be fetched.
+type PendingURL struct {
+	URL string
+	// Depth is the number of links followed from the starting URL.
+	Depth int
+}
+
+// InFlightURL is a URL being fetched.
+type InFlightURL struct {
+	URL   string
+	Depth int
+	// Elapsed is the time since the URL was handed to a fetcher.
+	Elapsed time.Duration
+}
+
+// queuedURL is an entry in the work queue.
+type queuedURL struct {
+	url  string
+	host string
+	// key is the URL's visit key.
+	key   string
+	depth int
+	// scope is the host of the crawl's root, which redirects are kept to
+	// the site of, or "" for the starting URL, which may redirect
+	// anywhere.
+	scope string
+}
+
+// inFlight is a URL handed to a fetcher.
+type inFlight struct {
+	key   string
+	depth int
+	start time.Time
+}
+
+// assertInvariants makes the frontier panic if the same visit key is ever in
+// flight twice at once. It is set by tests.
+var assertInvariants = false
+
+// frontier holds the Crawl loop's queue and in-flight URLs. Only the loop
+// changes the queue, so it needn't lock to read it, but it must hold mu while
+// making changes so Snapshot can copy it from other goroutines. Fetchers
+// mark URLs in flight as soon as they receive them, and the loop removes
+// them once their results are in.
+type frontier struct {
+	mu         sync.Mutex
+	work       []queuedURL
+	inFlight   map[string]inFlight
+	hostQueues map[string]int
+	// inFlightKeys counts the in-flight URLs by visit key, for
+	// assertInvariants.
+	inFlightKeys map[string]int
+}
+
+func (f *frontier) reset() {
+	f.mu.Lock()
+	f.work = nil
+	f.inFlight = make(map[string]inFlight)
+	f.hostQueues = make(map[string]int)
+	f.inFlightKeys = make(map[string]int)
+	f.mu.Unlock()
+}
+
+func (f *frontier) push(q queuedURL) {
+	f.mu.Lock()
+	f.work = append(f.work, q)
+	f.hostQueues[q.host]++
+	f.mu.Unlock()
+}
+
+// dispatch removes the URL at the head of the queue, once it has been sent
+// to a fetcher.
+func (f *frontier) dispatch() {
+	f.mu.Lock()
+	q := f.work[0]
+	f.work = f.work[1:]
+	if f.hostQueues[q.host]--; f.hostQueues[q.host] == 0 {
+		delete(f.hostQueues, q.host)
+	}
+	f.mu.Unlock()
+}
+
+// start marks a URL received by a fetcher at the given time as in flight.
+func (f *frontier) start(q queuedURL, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if assertInvariants && f.inFlightKeys[q.key] > 0 {
+		panic(fmt.Sprintf("crawl: %s dispatched with key %s already in flight", q.url, q.key))
+	}
+	f.inFlight[q.url] = inFlight{key: q.key, depth: q.depth, start: now}
+	f.inFlightKeys[q.key]++
+}
+
+// done removes a fetched URL from in flight, returning its depth.
+func (f *frontier) done(u string) int {
+	f.mu.Lock()
+	in, ok := f.inFlight[u]
+	delete(f.inFlight, u)
+	if ok {
+		if f.inFlightKeys[in.key]--; f.inFlightKeys[in.key] <= 0 {
+			delete(f.inFlightKeys, in.key)
+		}
+	}
+	f.mu.Unlock()
+	return in.depth
+}
+
+// Snapshot returns a view of the frontier of the crawl currently being run
+// by this Crawler, with up to n pending URLs. As with Stats, it is safe to
+// call concurrently with Crawl, and after a crawl has finished describes its
+// (empty) frontier. The crawl is only held up for as long as it takes to
+// copy n URLs, the in-flight URLs and the per-host counts. The queue is
+// first in, first out, so a pending URL's position is its priority.
+func (c Crawler) Snapshot(n int) Snapshot {
+	f := c.frontier
+	now := c.clock.Now()
+
+	f.mu.Lock()
+	work := f.work
+	s := Snapshot{
+		InFlight:   make([]InFlightURL, 0, len(f.inFlight)),
+		HostQueues: make(map[string]int, len(f.hostQueues)),
+	}
+	for h, l := range f.hostQueues {
+		s.HostQueues[h] = l
+	}
+	// The head of the queue may have been received by a fetcher before
+	// the loop has removed it.
+	if len(work) > 0 {
+		if _, ok := f.inFlight[work[0].url]; ok {
+			if s.HostQueues[work[0].host]--; s.HostQueues[work[0].host] == 0 {
+				delete(s.HostQueues, work[0].host)
+			}
+			work = work[1:]
+		}
+	}
+	if n > len(work) {
+		n = len(work)
+	}
+	s.Queued = len(work)
+	s.Pending = make([]PendingURL, 0, n)
+	for _, q := range work[:n] {
+		s.Pending = append(s.Pending, PendingURL{URL: q.url, Depth: q.depth})
+	}
+	for u, in := range f.inFlight {
+		s.InFlight = append(s.InFlight, InFlightURL{URL: u, Depth: in.depth, Elapsed: now.Sub(in.start)})
+	}
+	f.mu.Unlock()
+
+	sort.Slice(s.InFlight, func(i, j int) bool {
+		if s.InFlight[i].Elapsed != s.InFlight[j].Elapsed {
+			return s.InFlight[i].Elapsed > s.InFlight[j].Elapsed
+		}
+		return s.InFlight[i].URL < s.InFlight[j].URL
+	})
+	return s
+}
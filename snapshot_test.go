@@ -0,0 +1,64 @@
+package crawl
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSnapshot(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":     {"/a", "/b", "https://monzo.co.uk/c"},
+		"https://monzo.com/a":   {"/d"},
+		"https://monzo.com/b":   {},
+		"https://monzo.co.uk/c": {},
+		"https://monzo.com/d":   {},
+	}
+
+	c := NewCrawler(1, WithAllowedHosts("monzo.co.uk"))
+	fetch := fetchSite(site)
+	var mu sync.Mutex
+	snapshots := make(map[string]Snapshot)
+	c.fetch = func(ctx context.Context, addr string) (Result, error) {
+		mu.Lock()
+		snapshots[addr] = c.Snapshot(1)
+		mu.Unlock()
+		return fetch(ctx, addr)
+	}
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+
+	ignoreElapsed := cmpopts.IgnoreFields(InFlightURL{}, "Elapsed")
+	want := map[string]Snapshot{
+		"https://monzo.com/": {
+			Pending:    []PendingURL{},
+			InFlight:   []InFlightURL{{URL: "https://monzo.com/"}},
+			HostQueues: map[string]int{},
+		},
+		"https://monzo.com/a": {
+			Pending:    []PendingURL{{URL: "https://monzo.com/b", Depth: 1}},
+			Queued:     2,
+			InFlight:   []InFlightURL{{URL: "https://monzo.com/a", Depth: 1}},
+			HostQueues: map[string]int{"monzo.com": 1, "monzo.co.uk": 1},
+		},
+		"https://monzo.com/d": {
+			Pending:    []PendingURL{},
+			InFlight:   []InFlightURL{{URL: "https://monzo.com/d", Depth: 2}},
+			HostQueues: map[string]int{},
+		},
+	}
+	for u, w := range want {
+		if diff := cmp.Diff(w, snapshots[u], ignoreElapsed); diff != "" {
+			t.Errorf("Snapshot(1) while fetching %s mismatch (-want +got):\n%s", u, diff)
+		}
+	}
+
+	after := c.Snapshot(10)
+	if after.Queued != 0 || len(after.InFlight) != 0 {
+		t.Errorf("Snapshot(10) after crawl = %+v, want empty frontier", after)
+	}
+}
@@ -0,0 +1,41 @@
+package crawl
+
+import "sort"
+
+// Each of these sorts results in place, stably, breaking ties by URL. As a
+// crawl never returns two results for the same URL, the order of its results
+// is fully determined.
+
+// SortByURL sorts results by URL. This is Crawl's default order.
+func SortByURL(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].URL < results[j].URL
+	})
+}
+
+// SortByDepth sorts results by Depth, shallowest first.
+func SortByDepth(results []Result) {
+	sortBy(results, func(r Result) int { return r.Depth })
+}
+
+// SortByStatus sorts results by StatusCode, lowest first, so failures
+// without a response come first.
+func SortByStatus(results []Result) {
+	sortBy(results, func(r Result) int { return r.StatusCode })
+}
+
+// SortByDiscovery sorts results in the order their URLs were discovered by
+// the crawl, which is the order they were queued to be fetched.
+func SortByDiscovery(results []Result) {
+	sortBy(results, func(r Result) int { return r.Discovered })
+}
+
+// sortBy sorts results by key, then URL.
+func sortBy(results []Result, key func(Result) int) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if ki, kj := key(results[i]), key(results[j]); ki != kj {
+			return ki < kj
+		}
+		return results[i].URL < results[j].URL
+	})
+}
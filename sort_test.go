@@ -0,0 +1,38 @@
+package crawl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSortResults(t *testing.T) {
+	results := []Result{
+		{URL: "https://monzo.com/c", Depth: 1, StatusCode: 200, Discovered: 3},
+		{URL: "https://monzo.com/", Depth: 0, StatusCode: 200, Discovered: 0},
+		{URL: "https://monzo.com/b", Depth: 2, StatusCode: 404, Discovered: 4},
+		{URL: "https://monzo.com/a", Depth: 1, StatusCode: 0, Discovered: 2},
+		{URL: "https://monzo.com/d", Depth: 1, StatusCode: 200, Discovered: 1},
+	}
+	tests := []struct {
+		name string
+		sort func([]Result)
+		want []string
+	}{
+		{"SortByURL", SortByURL, []string{"/", "/a", "/b", "/c", "/d"}},
+		{"SortByDepth", SortByDepth, []string{"/", "/a", "/c", "/d", "/b"}},
+		{"SortByStatus", SortByStatus, []string{"/a", "/", "/c", "/d", "/b"}},
+		{"SortByDiscovery", SortByDiscovery, []string{"/", "/d", "/a", "/c", "/b"}},
+	}
+	for _, tt := range tests {
+		rs := append([]Result(nil), results...)
+		tt.sort(rs)
+		var got []string
+		for _, r := range rs {
+			got = append(got, r.URL[len("https://monzo.com"):])
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%s() mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
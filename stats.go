@@ -0,0 +1,576 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the progress of a crawl.
+type Stats struct {
+	// Root is the URL the crawl is scoped to: the starting URL, or the
+	// URL it redirected to on another site, unless WithLiteralScope is
+	// set.
+	Root string `json:",omitempty"`
+	// Fetched is the number of pages fetched so far, including failures.
+	Fetched int64
+	// Errors is the number of fetched pages that failed.
+	Errors int64
+	// Gone and LegalBlocks are the number of those failures that were 410
+	// and 451 responses: pages removed, or withheld, deliberately.
+	Gone        int64 `json:",omitempty"`
+	LegalBlocks int64 `json:",omitempty"`
+	// Disallowed is the number of pages not fetched because robots.txt
+	// disallows them, unless ignored with WithIgnoreRobots. Their results
+	// have an Err wrapping ErrDisallowed.
+	Disallowed int64 `json:",omitempty"`
+	// Filtered is the number of results dropped by WithResultFilter. Their
+	// pages are still counted in the other fields.
+	Filtered int64 `json:",omitempty"`
+	// Coalesced is the number of fetches that shared the result of an
+	// identical fetch already in progress, rather than make a request.
+	Coalesced int64 `json:",omitempty"`
+	// Queued is the number of in-scope URLs waiting to be fetched, and
+	// InFlight the number being fetched.
+	Queued   int64
+	InFlight int64
+	// Discovered is the number of distinct in-scope URLs found so far:
+	// those fetched, being fetched and queued. Discovery continues until
+	// the crawl is finished, so this is only a lower bound on the number
+	// of pages the crawl will fetch.
+	Discovered int64
+	// InvalidLinks is the number of links found that could not be parsed,
+	// including those repaired.
+	InvalidLinks int64
+	// Panics is the number of pages whose fetching or scraping panicked,
+	// and was recovered. They are counted in Errors too.
+	Panics int64 `json:",omitempty"`
+	// AccessControlled is the number of pages whose status was accepted
+	// with WithAcceptableStatuses. They aren't counted in Errors.
+	AccessControlled int64 `json:",omitempty"`
+	// Excluded counts the links not crawled by each exclusion rule, such
+	// as those of WithSafeExclusions, or pattern set with
+	// WithExcludePatterns, and MutatingLinks the links found
+	// that look like they change state when fetched, such as logging out,
+	// by rule, whether or not they were excluded. Links are counted each
+	// time they are found.
+	Excluded      map[string]int64 `json:",omitempty"`
+	MutatingLinks map[string]int64 `json:",omitempty"`
+	// SkippedSeeds counts the seeds set with WithSeeds that weren't
+	// queued, by the link filter step that skipped them, e.g. "scope".
+	SkippedSeeds map[string]int64 `json:",omitempty"`
+	// Redirects is the number of redirects followed, across all requests.
+	// Each is another request to a server, on top of those counted in
+	// Requests.
+	Redirects int64
+	// OverRedirectBudget is set once Redirects exceeds the budget set with
+	// WithRedirectBudget.
+	OverRedirectBudget bool `json:",omitempty"`
+	// Truncated is set once the crawl has stopped at the limit set with
+	// WithMaxPages, with URLs still queued.
+	Truncated bool `json:",omitempty"`
+	// Aborted is set if the crawl was aborted for failing too many pages,
+	// as configured with WithErrorRateAbort.
+	Aborted bool `json:",omitempty"`
+	// Workers breaks down the time the fetchers have spent.
+	Workers WorkerStats
+	// Elapsed is the time since the crawl started.
+	Elapsed time.Duration
+	// Paused is the time the crawl has spent waiting for its crawl window
+	// to open, as set with WithCrawlWindow, including any current wait.
+	Paused time.Duration `json:",omitempty"`
+	// Requests breaks down the HTTP requests made by the crawl by their
+	// purpose (e.g. "page" or "robots"). Only purposes with requests are
+	// included. The other fields only count pages.
+	Requests map[string]RequestStats `json:",omitempty"`
+	// NewHosts times the first request to each host, to its first byte,
+	// with WithDNSPrefetch: "prefetched" for those whose DNS was looked up
+	// ahead of time, and "cold" for the rest.
+	NewHosts map[string]RequestStats `json:",omitempty"`
+	// Transfer totals the sizes of the bodies of the pages fetched, by
+	// content type.
+	Transfer map[string]TransferStats `json:",omitempty"`
+}
+
+// TransferStats total the sizes of the bodies of pages of one content type.
+type TransferStats struct {
+	Pages        int64
+	BytesOnWire  int64
+	BytesDecoded int64
+}
+
+// CompressionRatio returns how many times larger the bodies were once
+// decompressed than as transferred, e.g. 1 if none were compressed, or 0 if
+// nothing was transferred.
+func (t TransferStats) CompressionRatio() float64 {
+	if t.BytesOnWire == 0 {
+		return 0
+	}
+	return float64(t.BytesDecoded) / float64(t.BytesOnWire)
+}
+
+// transferCounters hold the live values behind Stats.Transfer. Being a map,
+// they are guarded by a mutex rather than accessed atomically.
+type transferCounters struct {
+	mu     sync.Mutex
+	byType map[string]TransferStats
+}
+
+func (t *transferCounters) reset() {
+	t.mu.Lock()
+	t.byType = nil
+	t.mu.Unlock()
+}
+
+// record adds the size of a page's body, if it was read.
+func (t *transferCounters) record(r Result) {
+	if r.BytesOnWire == 0 && r.BytesDecoded == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.byType == nil {
+		t.byType = make(map[string]TransferStats)
+	}
+	ts := t.byType[r.ContentType]
+	ts.Pages++
+	ts.BytesOnWire += r.BytesOnWire
+	ts.BytesDecoded += r.BytesDecoded
+	t.byType[r.ContentType] = ts
+}
+
+// stats returns a copy of the totals, or nil if there are none.
+func (t *transferCounters) stats() map[string]TransferStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.byType) == 0 {
+		return nil
+	}
+	m := make(map[string]TransferStats, len(t.byType))
+	for ct, ts := range t.byType {
+		m[ct] = ts
+	}
+	return m
+}
+
+// WorkerStats total the time the fetchers have spent in each phase of their
+// work, across all of them: fetching pages, idle waiting for a page to
+// fetch, and blocked waiting for the crawl to take the page fetched. Each
+// phase is counted once it ends.
+type WorkerStats struct {
+	Fetching time.Duration
+	Idle     time.Duration
+	Blocked  time.Duration
+}
+
+// total returns the time accounted for.
+func (w WorkerStats) total() time.Duration {
+	return w.Fetching + w.Idle + w.Blocked
+}
+
+// Utilization returns the fraction of the fetchers' time spent fetching,
+// or 0 if none has been accounted for. Low utilization means there are
+// more fetchers than the crawl can keep busy; high, that more may help.
+func (w WorkerStats) Utilization() float64 {
+	if w.total() == 0 {
+		return 0
+	}
+	return float64(w.Fetching) / float64(w.total())
+}
+
+// IdleFraction and BlockedFraction return the fractions of the fetchers'
+// time spent idle and blocked, or 0 if none has been accounted for.
+func (w WorkerStats) IdleFraction() float64 {
+	if w.total() == 0 {
+		return 0
+	}
+	return float64(w.Idle) / float64(w.total())
+}
+
+func (w WorkerStats) BlockedFraction() float64 {
+	if w.total() == 0 {
+		return 0
+	}
+	return float64(w.Blocked) / float64(w.total())
+}
+
+// workerCounters hold the live values behind WorkerStats, in nanoseconds.
+type workerCounters struct {
+	fetching int64
+	idle     int64
+	blocked  int64
+}
+
+func (w *workerCounters) reset() {
+	atomic.StoreInt64(&w.fetching, 0)
+	atomic.StoreInt64(&w.idle, 0)
+	atomic.StoreInt64(&w.blocked, 0)
+}
+
+// record adds the time from since to now to a phase's counter, returning
+// now, the start of the next phase.
+func (w *workerCounters) record(phase *int64, since, now time.Time) time.Time {
+	atomic.AddInt64(phase, int64(now.Sub(since)))
+	return now
+}
+
+func (w *workerCounters) stats() WorkerStats {
+	return WorkerStats{
+		Fetching: time.Duration(atomic.LoadInt64(&w.fetching)),
+		Idle:     time.Duration(atomic.LoadInt64(&w.idle)),
+		Blocked:  time.Duration(atomic.LoadInt64(&w.blocked)),
+	}
+}
+
+// PrefetchSaving returns how much sooner, on average, the first byte of the
+// first request to a host arrived with its DNS prefetched than without, or
+// 0 if either is unknown.
+func (s Stats) PrefetchSaving() time.Duration {
+	cold, prefetched := s.NewHosts["cold"], s.NewHosts["prefetched"]
+	if cold.Requests == 0 || prefetched.Requests == 0 {
+		return 0
+	}
+	return cold.MeanDuration() - prefetched.MeanDuration()
+}
+
+// Rate returns the average number of pages fetched per second.
+func (s Stats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Fetched) / s.Elapsed.Seconds()
+}
+
+// Progress returns the fraction of discovered pages that have been fetched.
+// As Discovered is a lower bound, so is the denominator: the fraction can
+// fall as the crawl finds more pages, and only reaches 1 when it finishes.
+func (s Stats) Progress() float64 {
+	if s.Discovered == 0 {
+		return 0
+	}
+	return float64(s.Fetched) / float64(s.Discovered)
+}
+
+// Purpose is the reason a request was made. Requests for pages are counted
+// separately from auxiliary requests, such as for robots.txt, so the latter
+// don't skew the crawl's page rate and error rate.
+type Purpose int
+
+const (
+	PurposePage Purpose = iota
+	PurposeRobots
+	PurposeSitemap
+	PurposeProbe
+	PurposeExternalCheck
+	PurposeRetry
+	numPurposes
+)
+
+var purposeNames = [numPurposes]string{"page", "robots", "sitemap", "probe", "external-check", "retry"}
+
+func (p Purpose) String() string {
+	if p < 0 || p >= numPurposes {
+		return fmt.Sprintf("Purpose(%d)", int(p))
+	}
+	return purposeNames[p]
+}
+
+type purposeKey struct{}
+
+// withPurpose tags requests made with the returned context with a purpose.
+func withPurpose(ctx context.Context, p Purpose) context.Context {
+	return context.WithValue(ctx, purposeKey{}, p)
+}
+
+// purposeOf returns the purpose requests made with ctx are for, which is
+// PurposePage unless tagged otherwise.
+func purposeOf(ctx context.Context) Purpose {
+	p, _ := ctx.Value(purposeKey{}).(Purpose)
+	return p
+}
+
+var latencyBuckets = [...]time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBuckets returns the upper bounds of the buckets RequestStats.Latency
+// counts requests in.
+func LatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), latencyBuckets[:]...)
+}
+
+// RequestStats count the HTTP requests made for one purpose.
+type RequestStats struct {
+	Requests int64
+	// Redirects counts the redirects followed by those requests.
+	Redirects int64
+	// Errors counts failed requests, including those with non-200
+	// responses.
+	Errors int64
+	// Duration is the total time spent on requests, including reading
+	// their bodies.
+	Duration time.Duration
+	// Latency is a histogram of request durations: Latency[i] counts those
+	// taking up to LatencyBuckets()[i], and the final entry those taking
+	// longer.
+	Latency []int64
+	// P50, P90 and P99 are percentiles of the request durations, estimated
+	// to within 2%.
+	P50 time.Duration `json:",omitempty"`
+	P90 time.Duration `json:",omitempty"`
+	P99 time.Duration `json:",omitempty"`
+}
+
+// MeanDuration returns the average time spent on a request.
+func (r RequestStats) MeanDuration() time.Duration {
+	if r.Requests == 0 {
+		return 0
+	}
+	return r.Duration / time.Duration(r.Requests)
+}
+
+// requestCounters hold the live values behind a RequestStats.
+type requestCounters struct {
+	requests  int64
+	redirects int64
+	errors    int64
+	duration  int64
+	latency   [len(latencyBuckets) + 1]int64
+	durations histogram
+}
+
+func (r *requestCounters) reset() {
+	atomic.StoreInt64(&r.requests, 0)
+	atomic.StoreInt64(&r.redirects, 0)
+	atomic.StoreInt64(&r.errors, 0)
+	atomic.StoreInt64(&r.duration, 0)
+	for j := range r.latency {
+		atomic.StoreInt64(&r.latency[j], 0)
+	}
+	r.durations.reset()
+}
+
+// record counts a request taking d.
+func (r *requestCounters) record(d time.Duration, failed bool) {
+	atomic.AddInt64(&r.requests, 1)
+	if failed {
+		atomic.AddInt64(&r.errors, 1)
+	}
+	atomic.AddInt64(&r.duration, int64(d))
+	b := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	atomic.AddInt64(&r.latency[b], 1)
+	r.durations.record(int64(d))
+}
+
+// stats returns a snapshot of the counters.
+func (r *requestCounters) stats() RequestStats {
+	rs := RequestStats{
+		Requests:  atomic.LoadInt64(&r.requests),
+		Redirects: atomic.LoadInt64(&r.redirects),
+		Errors:    atomic.LoadInt64(&r.errors),
+		Duration:  time.Duration(atomic.LoadInt64(&r.duration)),
+		Latency:   make([]int64, len(r.latency)),
+		P50:       time.Duration(r.durations.quantile(0.5)),
+		P90:       time.Duration(r.durations.quantile(0.9)),
+		P99:       time.Duration(r.durations.quantile(0.99)),
+	}
+	for i := range r.latency {
+		rs.Latency[i] = atomic.LoadInt64(&r.latency[i])
+	}
+	return rs
+}
+
+// counters hold the live values behind Stats. They are only written by the
+// Crawl loop, but may be read from any goroutine, so all access must be
+// atomic.
+type counters struct {
+	start            int64 // UnixNano
+	fetched          int64
+	errors           int64
+	gone             int64
+	legalBlocks      int64
+	disallowed       int64
+	filtered         int64
+	queued           int64
+	inFlight         int64
+	discovered       int64
+	invalidLinks     int64
+	panics           int64
+	accessControlled int64
+	truncated        int64 // 1 if truncated
+	aborted          int64 // 1 if aborted
+	paused           int64 // nanoseconds, excluding any current pause
+	pausedSince      int64 // UnixNano, or 0 if not paused
+	requests         [numPurposes]requestCounters
+	// coldHosts and prefetchedHosts time the first requests to each host,
+	// with WithDNSPrefetch.
+	coldHosts       requestCounters
+	prefetchedHosts requestCounters
+	transfer        transferCounters
+	exclusions      exclusionCounters
+	links           linkChecks
+	workers         workerCounters
+	root            atomic.Value // string
+	skippedSeeds    atomic.Value // map[string]int64
+}
+
+func (c *counters) reset(now time.Time) {
+	atomic.StoreInt64(&c.start, now.UnixNano())
+	atomic.StoreInt64(&c.fetched, 0)
+	atomic.StoreInt64(&c.errors, 0)
+	atomic.StoreInt64(&c.gone, 0)
+	atomic.StoreInt64(&c.legalBlocks, 0)
+	atomic.StoreInt64(&c.disallowed, 0)
+	atomic.StoreInt64(&c.filtered, 0)
+	atomic.StoreInt64(&c.queued, 0)
+	atomic.StoreInt64(&c.inFlight, 0)
+	atomic.StoreInt64(&c.discovered, 0)
+	atomic.StoreInt64(&c.invalidLinks, 0)
+	atomic.StoreInt64(&c.panics, 0)
+	atomic.StoreInt64(&c.accessControlled, 0)
+	atomic.StoreInt64(&c.truncated, 0)
+	atomic.StoreInt64(&c.aborted, 0)
+	atomic.StoreInt64(&c.paused, 0)
+	atomic.StoreInt64(&c.pausedSince, 0)
+	for i := range c.requests {
+		c.requests[i].reset()
+	}
+	c.coldHosts.reset()
+	c.prefetchedHosts.reset()
+	c.transfer.reset()
+	c.exclusions.reset()
+	c.links.reset()
+	c.workers.reset()
+	c.skippedSeeds.Store(map[string]int64(nil))
+}
+
+// setRoot records the crawl's scope root.
+func (c *counters) setRoot(root string) {
+	c.root.Store(root)
+}
+
+// pause records that the crawl is paused, if it isn't already.
+func (c *counters) pause(now time.Time) {
+	atomic.CompareAndSwapInt64(&c.pausedSince, 0, now.UnixNano())
+}
+
+// resume records that the crawl is no longer paused, if it was.
+func (c *counters) resume(now time.Time) {
+	if since := atomic.SwapInt64(&c.pausedSince, 0); since != 0 {
+		atomic.AddInt64(&c.paused, now.UnixNano()-since)
+	}
+}
+
+// recordRedirect counts a redirect followed by a request made for purpose p.
+func (c *counters) recordRedirect(p Purpose) {
+	if p < 0 || p >= numPurposes {
+		return
+	}
+	atomic.AddInt64(&c.requests[p].redirects, 1)
+}
+
+// recordRequest counts a request made for purpose p.
+func (c *counters) recordRequest(p Purpose, d time.Duration, failed bool) {
+	if p < 0 || p >= numPurposes {
+		return
+	}
+	c.requests[p].record(d, failed)
+}
+
+// recordNewHost counts the time to the first byte of the first request to a
+// host, by whether its DNS was prefetched.
+func (c *counters) recordNewHost(prefetched bool, d time.Duration) {
+	if prefetched {
+		c.prefetchedHosts.record(d, false)
+	} else {
+		c.coldHosts.record(d, false)
+	}
+}
+
+// Stats returns a snapshot of the progress of the crawl currently being run
+// by this Crawler, or of the last one if it has finished. It is safe to call
+// concurrently with Crawl. If the same Crawler is running multiple crawls at
+// once, the Stats of each are mixed together.
+func (c Crawler) Stats() Stats {
+	s := Stats{
+		Fetched:          atomic.LoadInt64(&c.counters.fetched),
+		Errors:           atomic.LoadInt64(&c.counters.errors),
+		Gone:             atomic.LoadInt64(&c.counters.gone),
+		LegalBlocks:      atomic.LoadInt64(&c.counters.legalBlocks),
+		Disallowed:       atomic.LoadInt64(&c.counters.disallowed),
+		Filtered:         atomic.LoadInt64(&c.counters.filtered),
+		Coalesced:        atomic.LoadInt64(&c.flights.coalesced),
+		Queued:           atomic.LoadInt64(&c.counters.queued),
+		InFlight:         atomic.LoadInt64(&c.counters.inFlight),
+		Discovered:       atomic.LoadInt64(&c.counters.discovered),
+		InvalidLinks:     atomic.LoadInt64(&c.counters.invalidLinks),
+		Panics:           atomic.LoadInt64(&c.counters.panics),
+		AccessControlled: atomic.LoadInt64(&c.counters.accessControlled),
+		Truncated:        atomic.LoadInt64(&c.counters.truncated) == 1,
+		Aborted:          atomic.LoadInt64(&c.counters.aborted) == 1,
+	}
+	s.Root, _ = c.counters.root.Load().(string)
+	if start := atomic.LoadInt64(&c.counters.start); start != 0 {
+		s.Elapsed = c.since(time.Unix(0, start))
+	}
+	s.Paused = time.Duration(atomic.LoadInt64(&c.counters.paused))
+	if since := atomic.LoadInt64(&c.counters.pausedSince); since != 0 {
+		s.Paused += c.since(time.Unix(0, since))
+	}
+	for p := range c.counters.requests {
+		rs := c.counters.requests[p].stats()
+		if rs.Requests == 0 {
+			continue
+		}
+		if s.Requests == nil {
+			s.Requests = make(map[string]RequestStats)
+		}
+		s.Requests[Purpose(p).String()] = rs
+		s.Redirects += rs.Redirects
+	}
+	for name, r := range map[string]*requestCounters{"cold": &c.counters.coldHosts, "prefetched": &c.counters.prefetchedHosts} {
+		if rs := r.stats(); rs.Requests > 0 {
+			if s.NewHosts == nil {
+				s.NewHosts = make(map[string]RequestStats)
+			}
+			s.NewHosts[name] = rs
+		}
+	}
+	s.Transfer = c.counters.transfer.stats()
+	s.Excluded, s.MutatingLinks = c.counters.exclusions.stats()
+	s.Workers = c.counters.workers.stats()
+	skipped, _ := c.counters.skippedSeeds.Load().(map[string]int64)
+	s.SkippedSeeds = copyCounts(skipped)
+	s.OverRedirectBudget = c.redirectBudget > 0 && s.Redirects > c.redirectBudget
+	return s
+}
+
+// ErrorRateError is returned by Crawl when it is aborted for failing too
+// many pages, as configured with WithErrorRateAbort.
+type ErrorRateError struct {
+	// Stats are those of the crawl when it was aborted.
+	Stats     Stats
+	Threshold float64
+}
+
+func (e *ErrorRateError) Error() string {
+	return fmt.Sprintf("crawl aborted: %d of %d pages failed, more than the %.0f%% allowed",
+		e.Stats.Errors, e.Stats.Fetched, e.Threshold*100)
+}
+
+// ErrorRate returns the fraction of fetched pages that failed.
+func (s Stats) ErrorRate() float64 {
+	if s.Fetched == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Fetched)
+}
@@ -0,0 +1,136 @@
+package crawl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// StatusClass is a category of response status with a distinct meaning for
+// a crawl, e.g. whether it's worth retrying.
+type StatusClass string
+
+// The status classes, in the order StatusSummary lists them.
+const (
+	// ClassNoResponse is for requests that failed without a response.
+	ClassNoResponse StatusClass = "no response"
+	ClassOK         StatusClass = "ok"
+	ClassRedirect   StatusClass = "redirect"
+	// ClassAccessControlled is for pages whose status was accepted with
+	// WithAcceptableStatuses, e.g. 401s for pages behind a login: they
+	// are reachable, but not by the crawler.
+	ClassAccessControlled StatusClass = "access controlled"
+	ClassNotFound         StatusClass = "not found"
+	// ClassGone is for 410s: pages intentionally removed, which links
+	// should be removed to.
+	ClassGone StatusClass = "gone"
+	// ClassLegalBlock is for 451s: pages withheld for legal reasons.
+	ClassLegalBlock  StatusClass = "legal block"
+	ClassRateLimited StatusClass = "rate limited"
+	ClassClientError StatusClass = "client error"
+	ClassServerError StatusClass = "server error"
+)
+
+// statusClasses are the classes in order.
+var statusClasses = []StatusClass{
+	ClassNoResponse, ClassOK, ClassRedirect, ClassAccessControlled,
+	ClassNotFound, ClassGone, ClassLegalBlock, ClassRateLimited,
+	ClassClientError, ClassServerError,
+}
+
+// statusClassOf classifies the statuses with meanings of their own. Others
+// are classified by their range.
+var statusClassOf = map[int]StatusClass{
+	404: ClassNotFound,
+	410: ClassGone,
+	429: ClassRateLimited,
+	451: ClassLegalBlock,
+}
+
+// retryable are the classes of failure that may succeed if tried again.
+// The rest are permanent: 404s, 410s and 451s in particular mean what they
+// say.
+var retryable = map[StatusClass]bool{
+	ClassNoResponse:  true,
+	ClassRateLimited: true,
+	ClassServerError: true,
+}
+
+// ClassifyStatus returns the class of a response status, or ClassNoResponse
+// for 0.
+func ClassifyStatus(code int) StatusClass {
+	if c, ok := statusClassOf[code]; ok {
+		return c
+	}
+	switch {
+	case code == 0:
+		return ClassNoResponse
+	case code < 300:
+		return ClassOK
+	case code < 400:
+		return ClassRedirect
+	case code < 500:
+		return ClassClientError
+	}
+	return ClassServerError
+}
+
+// StatusClass returns the class of the result's status: ClassAccessControlled
+// if it was accepted with WithAcceptableStatuses, or else as ClassifyStatus
+// classifies it.
+func (r Result) StatusClass() StatusClass {
+	if r.AccessControlled {
+		return ClassAccessControlled
+	}
+	return ClassifyStatus(r.StatusCode)
+}
+
+// AcceptStatusesUnder returns a func, for WithAcceptableStatuses, accepting
+// the given statuses for the pages whose paths start with prefix, e.g. 401
+// under /account/.
+func AcceptStatusesUnder(prefix string, statuses ...int) func(int, *url.URL) bool {
+	set := make(map[int]bool, len(statuses))
+	for _, s := range statuses {
+		set[s] = true
+	}
+	return func(status int, u *url.URL) bool {
+		return set[status] && strings.HasPrefix(u.Path, prefix)
+	}
+}
+
+// acceptsStatus reports whether err is a response with a status accepted
+// for addr with WithAcceptableStatuses.
+func (c Crawler) acceptsStatus(addr string, err error) bool {
+	var he *HTTPError
+	if len(c.acceptStatuses) == 0 || !errors.As(err, &he) {
+		return false
+	}
+	u, perr := url.Parse(addr)
+	if perr != nil {
+		return false
+	}
+	for _, accept := range c.acceptStatuses {
+		if accept(he.StatusCode, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retryable reports whether a failure of this class may succeed if the
+// request is tried again.
+func (c StatusClass) Retryable() bool {
+	return retryable[c]
+}
+
+// StatusCount is the number of pages served with a class of status.
+type StatusCount struct {
+	Class StatusClass
+	Pages int
+}
+
+// StatusSummary counts the results of a crawl by class of status. Every
+// class is listed, in a fixed order, even if no pages had it.
+func StatusSummary(results []Result) []StatusCount {
+	return summarize(results).Statuses
+}
@@ -0,0 +1,119 @@
+package crawl
+
+import (
+	"context"
+	"crawl/crawltest"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		code      int
+		want      StatusClass
+		retryable bool
+	}{
+		{0, ClassNoResponse, true},
+		{200, ClassOK, false},
+		{301, ClassRedirect, false},
+		{403, ClassClientError, false},
+		{404, ClassNotFound, false},
+		{410, ClassGone, false},
+		{429, ClassRateLimited, true},
+		{451, ClassLegalBlock, false},
+		{500, ClassServerError, true},
+		{503, ClassServerError, true},
+	}
+	for _, tt := range tests {
+		got := ClassifyStatus(tt.code)
+		if got != tt.want || got.Retryable() != tt.retryable {
+			t.Errorf("ClassifyStatus(%d) = %q, retryable %v, want %q, retryable %v", tt.code, got, got.Retryable(), tt.want, tt.retryable)
+		}
+	}
+}
+
+func TestStatusSummary(t *testing.T) {
+	results := []Result{{StatusCode: 200}, {StatusCode: 200}, {StatusCode: 410}, {StatusCode: 451}, {StatusCode: 0}, {StatusCode: 401, AccessControlled: true}}
+	want := []StatusCount{
+		{ClassNoResponse, 1}, {ClassOK, 2}, {ClassRedirect, 0}, {ClassAccessControlled, 1}, {ClassNotFound, 0}, {ClassGone, 1},
+		{ClassLegalBlock, 1}, {ClassRateLimited, 0}, {ClassClientError, 0}, {ClassServerError, 0},
+	}
+	if diff := cmp.Diff(want, StatusSummary(results)); diff != "" {
+		t.Errorf("StatusSummary() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatsGoneAndLegalBlocks(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/gone", "/blocked", "/missing")
+	site.Handle("https://monzo.com/gone", crawltest.Response{Status: http.StatusGone})
+	site.Handle("https://monzo.com/blocked", crawltest.Response{Status: http.StatusUnavailableForLegalReasons})
+
+	c := NewCrawler(2, WithTransportMiddleware(site.Wrap))
+	if _, err := c.Crawl("https://monzo.com"); err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if s := c.Stats(); s.Errors != 3 || s.Gone != 1 || s.LegalBlocks != 1 {
+		t.Errorf("Stats() Errors, Gone, LegalBlocks = %d, %d, %d, want 3, 1, 1", s.Errors, s.Gone, s.LegalBlocks)
+	}
+}
+
+func TestAcceptableStatuses(t *testing.T) {
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/account/settings", "/admin/", "/admin-login", "/private")
+	site.Handle("https://monzo.com/account/settings", crawltest.Response{Status: http.StatusUnauthorized})
+	site.Handle("https://monzo.com/admin/", crawltest.Response{Status: http.StatusForbidden})
+	site.Handle("https://monzo.com/admin-login", crawltest.Response{Status: http.StatusUnauthorized})
+	site.Handle("https://monzo.com/private", crawltest.Response{Status: http.StatusForbidden})
+
+	c := NewCrawler(2, WithTransportMiddleware(site.Wrap),
+		WithAcceptableStatuses(AcceptStatusesUnder("/account/", http.StatusUnauthorized)),
+		WithAcceptableStatuses(AcceptStatusesUnder("/admin/", http.StatusForbidden)))
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	type outcome struct {
+		Status int
+		Class  StatusClass
+		Err    bool
+	}
+	got := make(map[string]outcome)
+	for _, r := range results {
+		got[r.URL] = outcome{r.StatusCode, r.StatusClass(), r.Err != nil}
+	}
+	// Only the statuses accepted under each prefix are access controlled;
+	// the rest are still broken.
+	want := map[string]outcome{
+		"https://monzo.com/":                 {200, ClassOK, false},
+		"https://monzo.com/account/settings": {401, ClassAccessControlled, false},
+		"https://monzo.com/admin/":           {403, ClassAccessControlled, false},
+		"https://monzo.com/admin-login":      {401, ClassClientError, true},
+		"https://monzo.com/private":          {403, ClassClientError, true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if s := c.Stats(); s.Errors != 2 || s.AccessControlled != 2 {
+		t.Errorf("Stats() Errors, AccessControlled = %d, %d, want 2, 2", s.Errors, s.AccessControlled)
+	}
+
+	// Links checked by CheckPages are accepted the same way.
+	report, err := c.CheckPages(context.Background(), []string{"https://monzo.com/"})
+	if err != nil {
+		t.Fatalf("CheckPages erred when not expected: %v", err)
+	}
+	var broken []string
+	for _, l := range report.Broken() {
+		broken = append(broken, l.URL)
+	}
+	if diff := cmp.Diff([]string{"https://monzo.com/admin-login", "https://monzo.com/private"}, broken); diff != "" {
+		t.Errorf("CheckPages broken links mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := NewCrawler(1, WithAcceptableStatuses(nil)).err; err == nil {
+		t.Errorf("WithAcceptableStatuses(nil) accepted, want an error")
+	}
+}
@@ -0,0 +1,305 @@
+package crawl
+
+import (
+	"container/heap"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSummaryTop is the number of pages a Crawler's Summary lists in each
+// of its top lists.
+const DefaultSummaryTop = 10
+
+// Summary aggregates the results of a crawl: counts by status, host and
+// encoding, the distributions of page sizes and links, and the largest
+// pages. Unlike the reports made from a slice of results, it is built as
+// the results are produced, in memory bounded by the number of hosts rather
+// than pages, so is available for crawls streamed with CrawlStream.
+type Summary struct {
+	Pages  int64
+	Errors int64
+	// Statuses counts the pages by class of status, as StatusSummary does.
+	Statuses []StatusCount
+	// Hosts counts the pages and errors on each host, as HostSummaries
+	// does.
+	Hosts []HostSummary
+	// Encodings counts the pages by HTTP version and content encoding, as
+	// EncodingSummary does.
+	Encodings []Encoding `json:",omitempty"`
+	// Depths counts the pages at each depth: Depths[d] those d links from
+	// the starting URL.
+	Depths []int64
+	// Size and WireSize are the distributions of the sizes of the pages'
+	// bodies, decoded and as transferred, and Links of the number of links
+	// on each page. Pages whose bodies weren't read aren't included in the
+	// sizes.
+	Size     Distribution
+	WireSize Distribution
+	Links    Distribution
+	// Latency is the distribution of the Durations of the pages fetched,
+	// in nanoseconds, so its Sum is the time spent fetching them, and
+	// Size's Sum the bytes read. Stats.Elapsed is the crawl's wall time.
+	Latency Distribution
+	// Slowest are the pages that took the longest to fetch, slowest
+	// first.
+	Slowest []PageDuration `json:",omitempty"`
+	// Largest are the largest pages by decoded size, largest first.
+	Largest []PageSize `json:",omitempty"`
+	// Uncompressed are the largest pages served uncompressed with more
+	// than DefaultCompressionThreshold bytes, as UncompressedPages finds.
+	Uncompressed []UncompressedPage `json:",omitempty"`
+	// PageGroups aggregate the pages by group, if enabled with
+	// WithURLTemplates, largest first. Past the first 1000 groups, pages
+	// are counted in a group named "(other)".
+	PageGroups []PageGroupSummary `json:",omitempty"`
+}
+
+// PageSize is the size of a page's body, decoded.
+type PageSize struct {
+	URL   string
+	Bytes int64
+}
+
+// PageDuration is the time taken to fetch a page.
+type PageDuration struct {
+	URL      string
+	Duration time.Duration
+}
+
+// Collector builds a Summary of results as they are added. It keeps only
+// counters, histograms and its top lists, never the results themselves. It
+// is safe for concurrent use.
+type Collector struct {
+	top int
+
+	mu        sync.Mutex
+	pages     int64
+	errors    int64
+	statuses  map[StatusClass]int
+	hosts     map[string]*HostSummary
+	encodings map[Encoding]int
+	depths    []int64
+	size      histogram
+	wireSize  histogram
+	links     histogram
+	latency   histogram
+	largest   topPages
+	slowest   topPages
+	uncomp    topPages
+	groups    map[string]*pageGroupCounts
+}
+
+// NewCollector returns a Collector keeping the top pages in each list of
+// its Summary.
+func NewCollector(top int) *Collector {
+	c := &Collector{top: top}
+	c.reset()
+	return c
+}
+
+func (c *Collector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages, c.errors, c.depths = 0, 0, nil
+	c.statuses = make(map[StatusClass]int)
+	c.hosts = make(map[string]*HostSummary)
+	c.encodings = make(map[Encoding]int)
+	c.groups = make(map[string]*pageGroupCounts)
+	c.size.reset()
+	c.wireSize.reset()
+	c.links.reset()
+	c.latency.reset()
+	c.largest, c.uncomp, c.slowest = nil, nil, nil
+}
+
+// Add adds a result to the summary.
+func (c *Collector) Add(r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages++
+	if r.Err != nil {
+		c.errors++
+	}
+	c.statuses[r.StatusClass()]++
+
+	host := ""
+	if u, err := url.Parse(r.URL); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+	h := c.hosts[host]
+	if h == nil {
+		h = &HostSummary{Host: host}
+		c.hosts[host] = h
+	}
+	h.Pages++
+	if r.Err != nil {
+		h.Errors++
+	}
+
+	if r.Proto != "" {
+		e := Encoding{Proto: r.Proto, ContentEncoding: r.ContentEncoding}
+		if e.ContentEncoding == "" {
+			e.ContentEncoding = "identity"
+		}
+		c.encodings[e]++
+	}
+
+	if r.Depth >= 0 {
+		for len(c.depths) <= r.Depth {
+			c.depths = append(c.depths, 0)
+		}
+		c.depths[r.Depth]++
+	}
+
+	links := len(r.Links)
+	if r.LinksSpilled {
+		links = r.LinkCount
+	}
+	c.links.record(int64(links))
+	if r.BytesOnWire > 0 || r.BytesDecoded > 0 {
+		c.size.record(r.BytesDecoded)
+		c.wireSize.record(r.BytesOnWire)
+		c.largest.offer(c.top, PageSize{URL: r.URL, Bytes: r.BytesDecoded}, "")
+	}
+	if r.Duration > 0 {
+		c.latency.record(int64(r.Duration))
+		// The top list is kept by size, so keeps the duration as one.
+		c.slowest.offer(c.top, PageSize{URL: r.URL, Bytes: int64(r.Duration)}, "")
+	}
+	if r.ContentEncoding == "" && r.BytesOnWire > DefaultCompressionThreshold {
+		c.uncomp.offer(c.top, PageSize{URL: r.URL, Bytes: r.BytesOnWire}, r.ContentType)
+	}
+	if r.PageGroup != "" {
+		c.addPageGroup(r)
+	}
+}
+
+// Summary returns the summary of the results added so far.
+func (c *Collector) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Summary{
+		Pages:     c.pages,
+		Errors:    c.errors,
+		Statuses:  make([]StatusCount, len(statusClasses)),
+		Hosts:     make([]HostSummary, 0, len(c.hosts)),
+		Encodings: make([]Encoding, 0, len(c.encodings)),
+		Depths:    append([]int64(nil), c.depths...),
+		Size:      c.size.distribution(),
+		WireSize:  c.wireSize.distribution(),
+		Links:     c.links.distribution(),
+		Latency:   c.latency.distribution(),
+	}
+	for i, class := range statusClasses {
+		s.Statuses[i] = StatusCount{class, c.statuses[class]}
+	}
+
+	for _, h := range c.hosts {
+		s.Hosts = append(s.Hosts, *h)
+	}
+	sort.Slice(s.Hosts, func(i, j int) bool {
+		if s.Hosts[i].Pages != s.Hosts[j].Pages {
+			return s.Hosts[i].Pages > s.Hosts[j].Pages
+		}
+		return s.Hosts[i].Host < s.Hosts[j].Host
+	})
+
+	for e, n := range c.encodings {
+		e.Pages = n
+		s.Encodings = append(s.Encodings, e)
+	}
+	sort.Slice(s.Encodings, func(i, j int) bool {
+		a, b := s.Encodings[i], s.Encodings[j]
+		if a.Pages != b.Pages {
+			return a.Pages > b.Pages
+		}
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		return a.ContentEncoding < b.ContentEncoding
+	})
+
+	for _, p := range c.largest.sorted() {
+		s.Largest = append(s.Largest, p.PageSize)
+	}
+	for _, p := range c.slowest.sorted() {
+		s.Slowest = append(s.Slowest, PageDuration{URL: p.URL, Duration: time.Duration(p.Bytes)})
+	}
+	for _, p := range c.uncomp.sorted() {
+		s.Uncompressed = append(s.Uncompressed, UncompressedPage{URL: p.URL, ContentType: p.contentType, Bytes: p.Bytes})
+	}
+	s.PageGroups = c.pageGroups()
+	return s
+}
+
+// topPage is an entry in a topPages list.
+type topPage struct {
+	PageSize
+	contentType string
+}
+
+// less orders pages smallest first, then by URL descending, so the root of
+// a topPages heap is the first to be dropped.
+func (p topPage) less(q topPage) bool {
+	if p.Bytes != q.Bytes {
+		return p.Bytes < q.Bytes
+	}
+	return p.URL > q.URL
+}
+
+// topPages keeps the largest pages offered to it, as a min-heap, so each
+// offer is O(log n) in the number kept.
+type topPages []topPage
+
+func (t topPages) Len() int            { return len(t) }
+func (t topPages) Less(i, j int) bool  { return t[i].less(t[j]) }
+func (t topPages) Swap(i, j int)       { t[i], t[j] = t[j], t[i] }
+func (t *topPages) Push(x interface{}) { *t = append(*t, x.(topPage)) }
+func (t *topPages) Pop() interface{} {
+	old := *t
+	p := old[len(old)-1]
+	*t = old[:len(old)-1]
+	return p
+}
+
+// offer adds a page, if it is among the n largest so far.
+func (t *topPages) offer(n int, p PageSize, contentType string) {
+	if n <= 0 {
+		return
+	}
+	tp := topPage{p, contentType}
+	if len(*t) < n {
+		heap.Push(t, tp)
+		return
+	}
+	if (*t)[0].less(tp) {
+		(*t)[0] = tp
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the pages kept, largest first.
+func (t topPages) sorted() []topPage {
+	s := append([]topPage(nil), t...)
+	sort.Slice(s, func(i, j int) bool { return s[j].less(s[i]) })
+	return s
+}
+
+// summarize returns the Summary of results.
+func summarize(results []Result) Summary {
+	c := NewCollector(0)
+	for _, r := range results {
+		c.Add(r)
+	}
+	return c.Summary()
+}
+
+// Summary returns the Summary of the results of the crawl currently being
+// run by this Crawler, or of the last one if it has finished. Like Stats, it
+// is safe to call concurrently with Crawl.
+func (c Crawler) Summary() Summary {
+	return c.collector.Summary()
+}
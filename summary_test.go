@@ -0,0 +1,206 @@
+package crawl
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// summaryFixture returns a moderate crawl's worth of results, with sizes
+// spread over several orders of magnitude.
+func summaryFixture() []Result {
+	rnd := rand.New(rand.NewSource(1))
+	statuses := []int{200, 200, 200, 200, 301, 404, 410, 500, 0}
+	results := make([]Result, 5000)
+	for i := range results {
+		r := Result{
+			URL:        fmt.Sprintf("https://host%d.monzo.com/page/%d", rnd.Intn(7), i),
+			StatusCode: statuses[rnd.Intn(len(statuses))],
+			Depth:      rnd.Intn(6),
+			Links:      make([]string, rnd.Intn(50)),
+		}
+		if r.StatusCode != 200 {
+			r.Err = fmt.Errorf("status %d", r.StatusCode)
+		}
+		if r.StatusCode != 0 {
+			r.Proto = "HTTP/1.1"
+			r.BytesDecoded = int64(math.Exp(rnd.Float64()*12)) + 1
+			r.BytesOnWire = r.BytesDecoded
+			r.Duration = time.Duration(math.Exp(rnd.Float64()*10)) * time.Millisecond
+			if rnd.Intn(2) == 0 {
+				r.ContentEncoding = "gzip"
+				r.BytesOnWire /= 4
+			}
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// exactQuantile returns the value below which a fraction q of the sorted
+// values fall, by the same definition of rank as histogram.quantile.
+func exactQuantile(sorted []int64, q float64) int64 {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func checkDistribution(t *testing.T, name string, got Distribution, values []int64) {
+	t.Helper()
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	n := len(values)
+	if got.Count != int64(n) || got.Sum != sum || got.Min != values[0] || got.Max != values[n-1] {
+		t.Errorf("%s: count %d, sum %d, min %d, max %d, want %d, %d, %d, %d", name, got.Count, got.Sum, got.Min, got.Max, n, sum, values[0], values[n-1])
+	}
+	for _, p := range []struct {
+		q   float64
+		got int64
+	}{{0.5, got.P50}, {0.9, got.P90}, {0.99, got.P99}} {
+		want := exactQuantile(values, p.q)
+		if diff := math.Abs(float64(p.got - want)); diff > 0.02*float64(want) {
+			t.Errorf("%s: p%.0f = %d, want %d within 2%%", name, p.q*100, p.got, want)
+		}
+	}
+}
+
+func TestSummaryAccuracy(t *testing.T) {
+	results := summaryFixture()
+	c := NewCollector(5)
+	for _, r := range results {
+		c.Add(r)
+	}
+	got := c.Summary()
+
+	var sizes, wire, links, latencies []int64
+	hosts := make(map[string]int)
+	depths := make([]int64, 6)
+	var errors int64
+	for _, r := range results {
+		if r.BytesDecoded > 0 {
+			sizes = append(sizes, r.BytesDecoded)
+			wire = append(wire, r.BytesOnWire)
+		}
+		links = append(links, int64(len(r.Links)))
+		if r.Duration > 0 {
+			latencies = append(latencies, int64(r.Duration))
+		}
+		hosts[r.URL[len("https://"):len("https://hostN.monzo.com")]]++
+		depths[r.Depth]++
+		if r.Err != nil {
+			errors++
+		}
+	}
+	if got.Pages != int64(len(results)) || got.Errors != errors {
+		t.Errorf("Summary counted %d pages and %d errors, want %d and %d", got.Pages, got.Errors, len(results), errors)
+	}
+	checkDistribution(t, "Size", got.Size, sizes)
+	checkDistribution(t, "WireSize", got.WireSize, wire)
+	checkDistribution(t, "Links", got.Links, links)
+	checkDistribution(t, "Latency", got.Latency, latencies)
+	if diff := cmp.Diff(depths, got.Depths); diff != "" {
+		t.Errorf("Depths mismatch (-want +got):\n%s", diff)
+	}
+	for _, h := range got.Hosts {
+		if h.Pages != hosts[h.Host] {
+			t.Errorf("host %s has %d pages, want %d", h.Host, h.Pages, hosts[h.Host])
+		}
+	}
+	if len(got.Hosts) != len(hosts) {
+		t.Errorf("Summary has %d hosts, want %d", len(got.Hosts), len(hosts))
+	}
+
+	// The top lists are exact.
+	var largest []PageSize
+	for _, r := range results {
+		if r.BytesDecoded > 0 {
+			largest = append(largest, PageSize{r.URL, r.BytesDecoded})
+		}
+	}
+	sort.Slice(largest, func(i, j int) bool {
+		if largest[i].Bytes != largest[j].Bytes {
+			return largest[i].Bytes > largest[j].Bytes
+		}
+		return largest[i].URL < largest[j].URL
+	})
+	if diff := cmp.Diff(largest[:5], got.Largest); diff != "" {
+		t.Errorf("Largest mismatch (-want +got):\n%s", diff)
+	}
+	var slowest []PageDuration
+	for _, r := range results {
+		if r.Duration > 0 {
+			slowest = append(slowest, PageDuration{r.URL, r.Duration})
+		}
+	}
+	sort.Slice(slowest, func(i, j int) bool {
+		if slowest[i].Duration != slowest[j].Duration {
+			return slowest[i].Duration > slowest[j].Duration
+		}
+		return slowest[i].URL < slowest[j].URL
+	})
+	if diff := cmp.Diff(slowest[:5], got.Slowest); diff != "" {
+		t.Errorf("Slowest mismatch (-want +got):\n%s", diff)
+	}
+	uncompressed := UncompressedPages(results, DefaultCompressionThreshold)
+	if diff := cmp.Diff(uncompressed[:5], got.Uncompressed); diff != "" {
+		t.Errorf("Uncompressed mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	if d := h.distribution(); d != (Distribution{}) {
+		t.Errorf("empty histogram's distribution = %+v, want zero", d)
+	}
+
+	// Request durations, from microseconds to a minute.
+	rnd := rand.New(rand.NewSource(2))
+	var values []int64
+	for i := 0; i < 10000; i++ {
+		v := int64(math.Exp(rnd.Float64()*math.Log(float64(time.Minute/time.Microsecond)))) * int64(time.Microsecond)
+		values = append(values, v)
+		h.record(v)
+	}
+	checkDistribution(t, "durations", h.distribution(), values)
+
+	// Every bucket's midpoint is in the bucket.
+	for i := 0; i < histBuckets; i++ {
+		if b := histBucket(histBucketMid(i)); b != i {
+			t.Fatalf("midpoint %d of bucket %d is in bucket %d", histBucketMid(i), i, b)
+		}
+	}
+	if b := histBucket(math.MaxInt64); b != histBuckets-1 {
+		t.Errorf("largest value is in bucket %d, want the last, %d", b, histBuckets-1)
+	}
+}
+
+func TestCrawlerSummary(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":   {"/a", "/b"},
+		"https://monzo.com/a": {"/a"},
+	}
+	c := NewCrawler(2)
+	c.fetch = fetchSite(site)
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	s := c.Summary()
+	want := summarize(results)
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Errorf("Crawler.Summary differs from the summary of its results (-want +got):\n%s", diff)
+	}
+	if s.Pages != 3 || s.Errors != 1 {
+		t.Errorf("Summary counted %d pages and %d errors, want 3 and 1", s.Pages, s.Errors)
+	}
+}
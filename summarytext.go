@@ -0,0 +1,114 @@
+package crawl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxSummaryText is the most bytes SummaryText returns, so its
+// summaries fit in a chat message.
+const MaxSummaryText = 500
+
+// summaryTextSlowest is the number of the slowest pages SummaryText lists.
+const summaryTextSlowest = 3
+
+// SummaryText returns a short, plain text summary of a crawl, of a few
+// lines, for posting to a chat channel: the pages crawled, the errors by
+// class of status, the number of links to pages that failed, and the
+// slowest pages, from the report's Summary, or its Results without. If
+// previous, the report of an earlier crawl, is given, the pages found or
+// gone since are counted too. Its format is stable, so it can be compared
+// from crawl to crawl.
+func SummaryText(report CrawlReport, previous *CrawlReport) string {
+	root := report.Root
+	if root == "" {
+		root = report.Seed
+	}
+	var errs, broken int
+	classes := make(map[StatusClass]int)
+	for _, r := range report.Results {
+		if r.Err == nil || errors.Is(r.Err, ErrDisallowed) {
+			continue
+		}
+		errs++
+		classes[ClassifyStatus(r.StatusCode)]++
+		broken += r.Inbound
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crawled %s: %d pages, %d errors\n", root, len(report.Results), errs)
+	if errs > 0 {
+		var counts []string
+		for _, class := range statusClasses {
+			if n := classes[class]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", n, class))
+			}
+		}
+		fmt.Fprintf(&b, "Errors: %s\n", strings.Join(counts, ", "))
+		fmt.Fprintf(&b, "Broken links: %d\n", broken)
+	}
+	if slowest := slowestPages(report); len(slowest) > 0 {
+		pages := make([]string, len(slowest))
+		for i, p := range slowest {
+			d := p.Duration.Round(time.Millisecond)
+			if d == 0 {
+				d = p.Duration.Round(time.Microsecond)
+			}
+			pages[i] = fmt.Sprintf("%s (%v)", p.URL, d)
+		}
+		fmt.Fprintf(&b, "Slowest: %s\n", strings.Join(pages, ", "))
+	}
+	if previous != nil {
+		added, removed := comparePages(report.Results, previous.Results)
+		fmt.Fprintf(&b, "Since the last crawl: %d new pages, %d removed\n", added, removed)
+	}
+
+	s := b.String()
+	if len(s) > MaxSummaryText {
+		cut := MaxSummaryText - len("...\n")
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "...\n"
+	}
+	return s
+}
+
+// slowestPages returns up to summaryTextSlowest of the slowest pages of
+// report, slowest first.
+func slowestPages(report CrawlReport) []PageDuration {
+	var slowest []PageDuration
+	if report.Summary != nil {
+		slowest = report.Summary.Slowest
+	} else {
+		c := NewCollector(summaryTextSlowest)
+		for _, r := range report.Results {
+			c.Add(r)
+		}
+		slowest = c.Summary().Slowest
+	}
+	if len(slowest) > summaryTextSlowest {
+		slowest = slowest[:summaryTextSlowest]
+	}
+	return slowest
+}
+
+// comparePages counts the URLs in results that aren't in previous, and
+// those in previous that aren't in results.
+func comparePages(results, previous []Result) (added, removed int) {
+	before := make(map[string]bool, len(previous))
+	for _, r := range previous {
+		before[r.URL] = true
+	}
+	for _, r := range results {
+		if before[r.URL] {
+			delete(before, r.URL)
+		} else {
+			added++
+		}
+	}
+	return added, len(before)
+}
@@ -0,0 +1,66 @@
+package crawl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummaryText(t *testing.T) {
+	report := CrawlReport{
+		Seed: "https://monzo.com",
+		Root: "https://monzo.com/",
+		Results: []Result{
+			{URL: "https://monzo.com/", StatusCode: 200, Duration: 120 * time.Millisecond},
+			{URL: "https://monzo.com/a", StatusCode: 200, Inbound: 4, Duration: 1500 * time.Millisecond},
+			{URL: "https://monzo.com/gone", StatusCode: 404, Inbound: 3, Err: &HTTPError{404, "404 Not Found"}},
+			{URL: "https://monzo.com/old", StatusCode: 404, Inbound: 1, Err: &HTTPError{404, "404 Not Found"}},
+			{URL: "https://monzo.com/slow", Inbound: 2, Err: &NetworkError{fmt.Errorf("timeout")}, Duration: 30 * time.Second},
+			{URL: "https://monzo.com/broken", StatusCode: 502, Inbound: 1, Err: &HTTPError{502, "502 Bad Gateway"}, Duration: 80 * time.Millisecond},
+			{URL: "https://monzo.com/private", Inbound: 5, Err: fmt.Errorf("checking robots.txt: %w", ErrDisallowed)},
+		},
+	}
+	previous := CrawlReport{Results: []Result{
+		{URL: "https://monzo.com/"},
+		{URL: "https://monzo.com/a"},
+		{URL: "https://monzo.com/gone"},
+		{URL: "https://monzo.com/removed"},
+	}}
+	for _, tc := range []struct {
+		golden   string
+		report   CrawlReport
+		previous *CrawlReport
+	}{
+		{"summary.golden.txt", report, nil},
+		{"summary_previous.golden.txt", report, &previous},
+		{"summary_ok.golden.txt", CrawlReport{Seed: "https://monzo.com", Results: report.Results[:2]}, nil},
+		// The slowest pages are taken from the Summary, if there is one.
+		{"summary_summary.golden.txt", CrawlReport{Seed: "https://monzo.com", Summary: &Summary{Pages: 2, Slowest: []PageDuration{{"https://monzo.com/a", 2 * time.Second}}}, Results: report.Results[:2]}, nil},
+	} {
+		got := SummaryText(tc.report, tc.previous)
+		golden := filepath.Join("testdata", tc.golden)
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatalf("failed to update golden file: %v", err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("failed to read golden file: %v", err)
+		}
+		if diff := cmp.Diff(string(want), got); diff != "" {
+			t.Errorf("SummaryText mismatch with %s (-want +got):\n%s", golden, diff)
+		}
+	}
+
+	// Summaries are capped, however long the root.
+	long := CrawlReport{Root: "https://monzo.com/" + strings.Repeat("é", MaxSummaryText)}
+	if got := SummaryText(long, nil); len(got) > MaxSummaryText || !strings.HasSuffix(got, "...\n") {
+		t.Errorf("SummaryText with a long root = %d characters, %q, want at most %d, ending ...", len(got), got, MaxSummaryText)
+	}
+}
@@ -0,0 +1,79 @@
+package crawl
+
+import (
+	"errors"
+	"net/url"
+)
+
+// LinkState is what became of the target of an internal link.
+type LinkState string
+
+const (
+	// LinkFetched targets were fetched, successfully or not.
+	LinkFetched LinkState = "fetched"
+	// LinkSkipped targets were deliberately not fetched, e.g. because
+	// robots.txt disallows them, they match an exclusion rule, or they are
+	// beyond the maximum depth.
+	LinkSkipped LinkState = "skipped"
+	// LinkNotFetched targets weren't fetched because the crawl ended
+	// first, e.g. on reaching its page limit or being cancelled.
+	LinkNotFetched LinkState = "not fetched"
+)
+
+// LinkTarget is the outcome of fetching the target of one of a page's
+// internal links, recorded if enabled with WithLinkTargets.
+type LinkTarget struct {
+	// Link is the index of the link in the page's Links.
+	Link int
+	// Result is the index of the target's Result among those returned by
+	// the crawl, or -1 if it has none.
+	Result int
+	State  LinkState
+	// StatusCode is the HTTP status of the target, if it was fetched and
+	// there was a response.
+	StatusCode int `json:",omitempty"`
+	// Reason is why the target was skipped, or couldn't be fetched.
+	Reason string `json:",omitempty"`
+}
+
+// Broken reports whether the link's target was fetched, and failed.
+func (t LinkTarget) Broken() bool {
+	return t.State == LinkFetched && t.Reason != ""
+}
+
+// annotateLinks fills in the LinkTargets of the results, joining each
+// internal link against the results by the key the crawl deduplicated it
+// with. It must be done once the results are in their final order.
+func (c Crawler) annotateLinks(root *url.URL, results []Result) {
+	pages := c.resultKeys(results)
+	for i := range results {
+		r := &results[i]
+		base, err := url.Parse(r.base())
+		if err != nil {
+			continue
+		}
+		for li, l := range r.Links {
+			st := linkState{root: root, base: base, page: r.URL, href: l}
+			if d, ok := c.filterLink(&st, nil); !ok {
+				if d.Step == stepExclude || d.Step == stepInclude {
+					r.LinkTargets = append(r.LinkTargets, LinkTarget{Link: li, Result: -1, State: LinkSkipped, Reason: d.Detail})
+				}
+				continue
+			}
+			t := LinkTarget{Link: li, Result: -1, State: LinkNotFetched}
+			if j, ok := pages[c.visitKey(st.link)]; ok {
+				target := results[j]
+				t.Result, t.State, t.StatusCode = j, LinkFetched, target.StatusCode
+				if target.Err != nil {
+					t.Reason = target.Err.Error()
+					if errors.Is(target.Err, ErrDisallowed) {
+						t.State = LinkSkipped
+					}
+				}
+			} else if c.maxDepth >= 0 && r.Depth+1 > c.maxDepth {
+				t.State, t.Reason = LinkSkipped, "beyond maximum depth"
+			}
+			r.LinkTargets = append(r.LinkTargets, t)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkTargets(t *testing.T) {
+	site := map[string][]string{
+		"https://monzo.com":        {"/a", "/gone", "/private", "https://example.com/"},
+		"https://monzo.com/a":      {"/a", "/a/deep"},
+		"https://monzo.com/a/deep": {},
+	}
+	fetch := func(ctx context.Context, addr string) (Result, error) {
+		switch addr {
+		case "https://monzo.com/gone":
+			return Result{StatusCode: 410}, fmt.Errorf("got bad HTTP reponse code (410)")
+		case "https://monzo.com/private":
+			return Result{}, fmt.Errorf("checking robots.txt: %w", ErrDisallowed)
+		}
+		r, err := fetchSite(site)(ctx, addr)
+		r.StatusCode = 200
+		return r, err
+	}
+
+	c := NewCrawler(1, WithLinkTargets(true), WithMaxDepth(1))
+	c.fetch = fetch
+	results, err := c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	got := make(map[string][]LinkTarget)
+	for _, r := range results {
+		got[r.URL] = r.LinkTargets
+	}
+	// Results are sorted by URL: /, /a, /gone, /private.
+	want := map[string][]LinkTarget{
+		"https://monzo.com/": {
+			{Link: 0, Result: 1, State: LinkFetched, StatusCode: 200},
+			{Link: 1, Result: 2, State: LinkFetched, StatusCode: 410, Reason: "got bad HTTP reponse code (410)"},
+			{Link: 2, Result: 3, State: LinkSkipped, Reason: "checking robots.txt: disallowed by robots.txt"},
+		},
+		"https://monzo.com/a": {
+			{Link: 0, Result: 1, State: LinkFetched, StatusCode: 200},
+			{Link: 1, Result: -1, State: LinkSkipped, Reason: "beyond maximum depth"},
+		},
+		"https://monzo.com/gone":    nil,
+		"https://monzo.com/private": nil,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LinkTargets mismatch (-want +got):\n%s", diff)
+	}
+	if !got["https://monzo.com/"][1].Broken() || got["https://monzo.com/"][2].Broken() {
+		t.Error("only the link to /gone should be broken")
+	}
+
+	// Links not fetched before the crawl ended are pending.
+	c = NewCrawler(1, WithLinkTargets(true), WithMaxPages(1))
+	c.fetch = fetch
+	results, err = c.Crawl("https://monzo.com")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	for _, target := range results[0].LinkTargets {
+		if target.State != LinkNotFetched || target.Result != -1 {
+			t.Errorf("with a page limit of 1, link target = %+v, want not fetched", target)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package crawl
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TLSInfo describes the TLS connection a page was fetched over.
+type TLSInfo struct {
+	// Version is the negotiated protocol version, e.g. "TLS 1.3".
+	Version string
+	// CipherSuite is the standard name of the negotiated cipher suite.
+	CipherSuite string
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// tlsVersionName returns the name of a TLS protocol version.
+func tlsVersionName(v uint16) string {
+	if name, ok := tlsVersions[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// tlsVersion returns the protocol version with the given name.
+func tlsVersion(name string) (uint16, bool) {
+	for v, n := range tlsVersions {
+		if n == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func newTLSInfo(cs *tls.ConnectionState) *TLSInfo {
+	if cs == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:     tlsVersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+	}
+}
+
+// weakCipherSuite returns whether the named cipher suite is one known to
+// have security problems.
+func weakCipherSuite(name string) bool {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HostTLS summarizes the TLS connections made to a single host.
+type HostTLS struct {
+	Host string
+	// Versions and CipherSuites are those negotiated, across all of the
+	// host's pages.
+	Versions     []string
+	CipherSuites []string
+	// Problems are the reasons the host was flagged, if any.
+	Problems []string
+}
+
+// TLSReport summarizes, per host, the TLS versions and cipher suites
+// negotiated by a crawl. Hosts that negotiated a version below minVersion
+// (e.g. tls.VersionTLS12), or a known weak cipher suite, are flagged with
+// their problems and sorted first. Pages fetched without TLS are ignored.
+func TLSReport(results []Result, minVersion uint16) []HostTLS {
+	type host struct {
+		versions, suites map[string]bool
+	}
+	hosts := make(map[string]*host)
+	for _, r := range results {
+		if r.TLS == nil {
+			continue
+		}
+		name := ""
+		if u, err := url.Parse(r.URL); err == nil {
+			name = strings.ToLower(u.Host)
+		}
+		h := hosts[name]
+		if h == nil {
+			h = &host{versions: make(map[string]bool), suites: make(map[string]bool)}
+			hosts[name] = h
+		}
+		h.versions[r.TLS.Version] = true
+		h.suites[r.TLS.CipherSuite] = true
+	}
+
+	report := make([]HostTLS, 0, len(hosts))
+	for name, h := range hosts {
+		ht := HostTLS{Host: name}
+		for v := range h.versions {
+			ht.Versions = append(ht.Versions, v)
+			if n, ok := tlsVersion(v); !ok || n < minVersion {
+				ht.Problems = append(ht.Problems, fmt.Sprintf("negotiated %s, below minimum %s", v, tlsVersionName(minVersion)))
+			}
+		}
+		for s := range h.suites {
+			ht.CipherSuites = append(ht.CipherSuites, s)
+			if weakCipherSuite(s) {
+				ht.Problems = append(ht.Problems, "negotiated weak cipher suite "+s)
+			}
+		}
+		sort.Strings(ht.Versions)
+		sort.Strings(ht.CipherSuites)
+		sort.Strings(ht.Problems)
+		report = append(report, ht)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if (len(report[i].Problems) > 0) != (len(report[j].Problems) > 0) {
+			return len(report[i].Problems) > 0
+		}
+		return report[i].Host < report[j].Host
+	})
+	return report
+}
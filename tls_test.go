@@ -0,0 +1,67 @@
+package crawl
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTLSReport(t *testing.T) {
+	modern := &TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256"}
+	results := []Result{
+		{URL: "https://monzo.com/", TLS: modern},
+		{URL: "https://monzo.com/about", TLS: modern},
+		{URL: "https://old.monzo.com/", TLS: &TLSInfo{Version: "TLS 1.0", CipherSuite: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"}},
+		{URL: "https://rc4.monzo.com/", TLS: &TLSInfo{Version: "TLS 1.2", CipherSuite: "TLS_RSA_WITH_RC4_128_SHA"}},
+		{URL: "http://plain.monzo.com/"},
+	}
+
+	want := []HostTLS{
+		{
+			Host:         "old.monzo.com",
+			Versions:     []string{"TLS 1.0"},
+			CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"},
+			Problems:     []string{"negotiated TLS 1.0, below minimum TLS 1.2"},
+		},
+		{
+			Host:         "rc4.monzo.com",
+			Versions:     []string{"TLS 1.2"},
+			CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			Problems:     []string{"negotiated weak cipher suite TLS_RSA_WITH_RC4_128_SHA"},
+		},
+		{
+			Host:         "monzo.com",
+			Versions:     []string{"TLS 1.3"},
+			CipherSuites: []string{"TLS_AES_128_GCM_SHA256"},
+		},
+	}
+	if diff := cmp.Diff(want, TLSReport(results, tls.VersionTLS12)); diff != "" {
+		t.Errorf("TLSReport mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCrawlRecordsTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/foo">foo</a>`))
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1)
+	c.client = ts.Client()
+	c.fetch = c.fetchHTTP
+	results, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Crawl returned %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.TLS == nil || r.TLS.Version == "" || r.TLS.CipherSuite == "" {
+			t.Errorf("%s: TLS = %+v, want version and cipher suite", r.URL, r.TLS)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultMaxIdleConns is the number of idle (keep-alive) connections the
+// crawler's transport will keep open, across all hosts.
+const defaultMaxIdleConns = 100
+
+// reservedFiles is the number of file descriptors we leave for everything
+// other than sockets: stdio, output files, DNS lookups and the like.
+const reservedFiles = 32
+
+// ErrFileLimit is wrapped by the Err of results for pages that could not be
+// fetched because the process had run out of file descriptors. These
+// failures say nothing about the site being crawled, only that the crawl's
+// concurrency is too high for the environment it is running in.
+var ErrFileLimit = errors.New("out of file descriptors")
+
+// fileLimitError marks an error as having been caused by file descriptor
+// exhaustion, while keeping the original error in the chain.
+type fileLimitError struct {
+	error
+}
+
+func (e fileLimitError) Is(target error) bool { return target == ErrFileLimit }
+func (e fileLimitError) Unwrap() error        { return e.error }
+
+// classifyNetError marks errors caused by file descriptor exhaustion, so
+// callers can distinguish them using errors.Is(err, ErrFileLimit).
+func classifyNetError(err error) error {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return fileLimitError{err}
+	}
+	return err
+}
+
+// fitFileLimit returns the number of fetchers, idle connections and sockets
+// that fit within the given limit on open files. A maxSockets of 0 means
+// sockets are uncapped. If the settings already fit, or the limit is
+// unknown (0), they are returned unchanged.
+func fitFileLimit(limit uint64, numFetchers, maxIdleConns, maxSockets int) (int, int, int, bool) {
+	if limit == 0 {
+		return numFetchers, maxIdleConns, maxSockets, true
+	}
+	available := 1
+	if limit > reservedFiles+1 {
+		available = int(limit - reservedFiles)
+	}
+
+	if maxSockets > 0 {
+		// All of our sockets, busy or idle, are counted by the cap.
+		if maxSockets <= available {
+			return numFetchers, maxIdleConns, maxSockets, true
+		}
+		return numFetchers, maxIdleConns, available, false
+	}
+
+	if numFetchers+maxIdleConns <= available {
+		return numFetchers, maxIdleConns, maxSockets, true
+	}
+	if maxIdleConns > available/4 {
+		maxIdleConns = available / 4
+	}
+	if numFetchers > available-maxIdleConns {
+		numFetchers = available - maxIdleConns
+	}
+	if numFetchers < 1 {
+		numFetchers = 1
+	}
+	return numFetchers, maxIdleConns, maxSockets, false
+}
+
+// checkFileLimit warns if the crawler's settings could exhaust the
+// process's file descriptors, and adjusts them to fit if configured to.
+func (c *Crawler) checkFileLimit() {
+	limit := fileLimit()
+	numFetchers, maxIdleConns, maxSockets, ok := fitFileLimit(limit, c.numFetchers, c.maxIdleConns, c.maxSockets)
+	if ok {
+		return
+	}
+	if !c.clampToFileLimit {
+		log.Printf("warning: %d fetchers with up to %d idle connections may exceed the open file limit (%d)", c.numFetchers, c.maxIdleConns, limit)
+		return
+	}
+	log.Printf("open file limit is %d: reducing fetchers from %d to %d, idle connections from %d to %d",
+		limit, c.numFetchers, numFetchers, c.maxIdleConns, maxIdleConns)
+	if maxSockets != c.maxSockets {
+		log.Printf("open file limit is %d: reducing max sockets from %d to %d", limit, c.maxSockets, maxSockets)
+	}
+	c.numFetchers, c.maxIdleConns, c.maxSockets = numFetchers, maxIdleConns, maxSockets
+}
+
+// defaultTimeout is the time limit on each request made with the default
+// client, including redirects and reading the body, so a hanging server
+// can't hold up a fetcher forever. It is applied with the request's
+// context, rather than as the client's Timeout, so that longer timeouts set
+// with WithRequestTimeout or WithTimeoutOverride aren't cut short.
+const defaultTimeout = 30 * time.Second
+
+// newClient creates the HTTP client used for the crawler's requests. A client
+// given with WithHTTPClient is copied, with its transport wrapped in any
+// middleware, and the crawler's redirect policy if it has none of its own.
+func (c *Crawler) newClient() *http.Client {
+	if c.httpClient != nil {
+		client := *c.httpClient
+		rt := client.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		for _, wrap := range c.transportWrappers {
+			rt = wrap(rt)
+		}
+		client.Transport = rt
+		if client.CheckRedirect == nil {
+			client.CheckRedirect = c.checkRedirect
+		} else if len(c.hostHeaders) > 0 {
+			// Host headers must be kept to their hosts whatever the
+			// client's redirect policy.
+			check := client.CheckRedirect
+			client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+				c.decorate(req)
+				return check(req, via)
+			}
+		}
+		return &client
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = c.maxIdleConns
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialFunc(d.DialContext)
+	if c.dns.enabled {
+		dial = c.dns.dialer(dial)
+		t.DialContext = dial
+	}
+	if c.maxSockets > 0 {
+		t.DialContext = newSocketLimiter(c.maxSockets, dial, t.CloseIdleConnections).dial
+	}
+	var rt http.RoundTripper = t
+	for _, wrap := range c.transportWrappers {
+		rt = wrap(rt)
+	}
+	return &http.Client{Transport: rt, CheckRedirect: c.checkRedirect}
+}
+
+// defaultMaxRedirects is the number of redirects followed per request, as
+// by the default http.Client.
+const defaultMaxRedirects = 10
+
+// checkRedirect is the client's redirect policy: it stops after
+// maxRedirects, or at a redirect off the site of a request made with
+// withRedirectScope, and counts each redirect followed, as they are requests
+// too. Redirects are followed no sooner than WithDelay allows.
+// The headers of each redirect are set for its host. With WithFollowRedirects
+// (false), redirects of requests for pages aren't followed at all, though
+// those for robots.txt and sitemaps still are.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.noFollow && auditsRedirects(purposeOf(req.Context())) {
+		return http.ErrUseLastResponse
+	}
+	if root := redirectScopeOf(req.Context()); root != "" && auditsRedirects(purposeOf(req.Context())) {
+		if ok, _ := c.inScope(root, req.URL.Host); !ok {
+			return http.ErrUseLastResponse
+		}
+	}
+	if len(via) > c.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", c.maxRedirects)
+	}
+	// Each hop is another request to its host, so waits its turn too.
+	if err := c.delays.wait(req.Context(), c.clock, req.URL.Hostname()); err != nil {
+		return fmt.Errorf("waiting to follow redirect to %s: %w", req.URL, err)
+	}
+	c.decorate(req)
+	c.counters.recordRedirect(purposeOf(req.Context()))
+	return nil
+}
+
+type redirectScopeKey struct{}
+
+// withRedirectScope keeps the redirects of page requests made with the
+// returned context within the crawl of root's site: a redirect elsewhere
+// isn't followed, but returned, as with WithFollowRedirects(false).
+func withRedirectScope(ctx context.Context, root string) context.Context {
+	return context.WithValue(ctx, redirectScopeKey{}, root)
+}
+
+// redirectScopeOf returns the root host redirects of requests made with ctx
+// are kept to the site of, or "" if they aren't.
+func redirectScopeOf(ctx context.Context) string {
+	root, _ := ctx.Value(redirectScopeKey{}).(string)
+	return root
+}
+
+// auditsRedirects reports whether redirects of requests made for purpose p
+// are left unfollowed with WithFollowRedirects(false), to be reported.
+func auditsRedirects(p Purpose) bool {
+	return p == PurposePage || p == PurposeRetry || p == PurposeExternalCheck
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// socketLimiter caps the number of simultaneously open connections made by
+// a dialer.
+type socketLimiter struct {
+	sem       chan struct{}
+	next      dialFunc
+	closeIdle func()
+}
+
+func newSocketLimiter(n int, dial dialFunc, closeIdle func()) *socketLimiter {
+	return &socketLimiter{
+		sem:       make(chan struct{}, n),
+		next:      dial,
+		closeIdle: closeIdle,
+	}
+}
+
+// dial waits until there is a free socket, then dials. If all sockets are in
+// use, idle keep-alive connections are closed first, as otherwise they could
+// hold on to the sockets forever.
+func (l *socketLimiter) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	default:
+		l.closeIdle()
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	conn, err := l.next(ctx, network, addr)
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// limitedConn releases its socket when closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,201 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFitFileLimit(t *testing.T) {
+	cases := []struct {
+		name                              string
+		limit                             uint64
+		fetchers, idle, sockets           int
+		wantFetchers, wantIdle, wantSocks int
+		wantOK                            bool
+	}{
+		{"unknown limit", 0, 500, 100, 0, 500, 100, 0, true},
+		{"fits", 1024, 25, 100, 0, 25, 100, 0, true},
+		{"too many fetchers", 1024, 1000, 100, 0, 892, 100, 0, false},
+		{"too many idle", 256, 25, 500, 0, 25, 56, 0, false},
+		{"tiny limit", 16, 25, 100, 0, 1, 0, 0, false},
+		{"sockets fit", 1024, 1000, 100, 500, 1000, 100, 500, true},
+		{"too many sockets", 1024, 1000, 100, 2000, 1000, 100, 992, false},
+	}
+
+	for _, c := range cases {
+		f, i, s, ok := fitFileLimit(c.limit, c.fetchers, c.idle, c.sockets)
+		if f != c.wantFetchers || i != c.wantIdle || s != c.wantSocks || ok != c.wantOK {
+			t.Errorf("%s: fitFileLimit() = %d, %d, %d, %v, want %d, %d, %d, %v",
+				c.name, f, i, s, ok, c.wantFetchers, c.wantIdle, c.wantSocks, c.wantOK)
+		}
+	}
+}
+
+func TestClassifyNetError(t *testing.T) {
+	emfile := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)}
+	err := fmt.Errorf("fetch: %w", classifyNetError(emfile))
+	if !errors.Is(err, ErrFileLimit) {
+		t.Errorf("errors.Is(%v, ErrFileLimit) = false, want true", err)
+	}
+	if !errors.Is(err, syscall.EMFILE) {
+		t.Errorf("errors.Is(%v, syscall.EMFILE) = false, want true", err)
+	}
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	if err := classifyNetError(refused); errors.Is(err, ErrFileLimit) {
+		t.Errorf("errors.Is(%v, ErrFileLimit) = true, want false", err)
+	}
+}
+
+func TestMaxSockets(t *testing.T) {
+	const pages = 20
+	const maxSockets = 2
+
+	var mu sync.Mutex
+	var active, peak int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		if r.URL.Path == "/" {
+			for i := 0; i < pages; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	results, err := NewCrawler(10, WithMaxSockets(maxSockets)).Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(results) != pages+1 {
+		t.Errorf("Crawl returned %d results, want %d", len(results), pages+1)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: unexpected error: %v", r.URL, r.Err)
+		}
+	}
+	if peak > maxSockets {
+		t.Errorf("%d requests were in progress at once, want at most %d", peak, maxSockets)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	// The default timeout is applied per request, so longer ones aren't
+	// cut short by the client's.
+	if c := NewCrawler(1); c.client.Timeout != 0 || c.timeoutFor(ts.URL) != defaultTimeout {
+		t.Errorf("default client timeout = %v, request timeout %v, want none and %v", c.client.Timeout, c.timeoutFor(ts.URL), defaultTimeout)
+	}
+	if c := NewCrawler(1, WithRequestTimeout(time.Minute)); c.client.Timeout != 0 || c.timeoutFor(ts.URL) != time.Minute {
+		t.Errorf("client timeout with a 1m request timeout = %v, request timeout %v, want none and 1m", c.client.Timeout, c.timeoutFor(ts.URL))
+	}
+
+	var wrapped bool
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	_, err := Fetch(context.Background(), ts.URL, WithHTTPClient(client), WithTransportMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		wrapped = true
+		return next
+	}))
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Fetch from a hanging server = %v, want a timeout", err)
+	}
+	if !wrapped {
+		t.Errorf("transport middleware wasn't applied to the custom client")
+	}
+	if client.Transport != nil || client.CheckRedirect != nil {
+		t.Errorf("WithHTTPClient modified the client given")
+	}
+
+	if err := NewCrawler(1, WithHTTPClient(nil)).err; err == nil {
+		t.Errorf("WithHTTPClient(nil) accepted, want an error")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	uas := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uas <- r.UserAgent()
+	}))
+	defer ts.Close()
+
+	Fetch(context.Background(), ts.URL)
+	if ua := <-uas; ua != DefaultUserAgent {
+		t.Errorf("default User-Agent = %q, want %q", ua, DefaultUserAgent)
+	}
+	Fetch(context.Background(), ts.URL, WithUserAgent("examplebot/2.0"))
+	if ua := <-uas; ua != "examplebot/2.0" {
+		t.Errorf("User-Agent = %q, want examplebot/2.0", ua)
+	}
+	if agent := NewCrawler(1, WithUserAgent("examplebot/2.0")).robotsAgent("monzo.com"); agent != "examplebot" {
+		t.Errorf("robotsAgent() = %q, want examplebot", agent)
+	}
+	if err := NewCrawler(1, WithUserAgent(" ")).err; err == nil {
+		t.Errorf("WithUserAgent(\" \") accepted, want an error")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/slow">slow</a><a href="/fast">fast</a>`))
+		case "/slow":
+			select {
+			case <-release:
+			case <-time.After(time.Second):
+			}
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c := NewCrawler(2, WithRequestTimeout(50*time.Millisecond))
+	got, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Crawl() = %+v, want 3 results", got)
+	}
+	if r := got[2]; r.URL != ts.URL+"/slow" || !errors.Is(r.Err, context.DeadlineExceeded) || r.Timeout != 50*time.Millisecond {
+		t.Errorf("result for /slow = %+v, want it timed out after 50ms", r)
+	}
+	if r := got[1]; r.Err != nil {
+		t.Errorf("result for /fast erred: %v", r.Err)
+	}
+
+	if err := NewCrawler(1, WithRequestTimeout(0)).err; err == nil {
+		t.Errorf("WithRequestTimeout(0) accepted, want an error")
+	}
+}
@@ -0,0 +1,53 @@
+package crawl
+
+import (
+	"fmt"
+	"time"
+)
+
+// crawlWindow is the time of day crawling is allowed in, as set with
+// WithCrawlWindow.
+type crawlWindow struct {
+	// start and end are times of day, as the time since midnight.
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// wait returns how long from now until the window next opens, or 0 if it is
+// open now. A nil window is always open.
+func (w *crawlWindow) wait(now time.Time) time.Duration {
+	if w == nil {
+		return 0
+	}
+	now = now.In(w.loc)
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, w.loc)
+	tod := now.Sub(midnight)
+	var open bool
+	if w.start < w.end {
+		open = tod >= w.start && tod < w.end
+	} else {
+		// The window spans midnight.
+		open = tod >= w.start || tod < w.end
+	}
+	if open {
+		return 0
+	}
+	start := midnight.Add(w.start)
+	if !start.After(now) {
+		start = time.Date(y, m, d+1, 0, 0, 0, 0, w.loc).Add(w.start)
+	}
+	return start.Sub(now)
+}
+
+// String returns the window as mcrawl's -window flag takes it, e.g.
+// "22:00-06:00 Europe/London".
+func (w *crawlWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return fmt.Sprintf("%s-%s %s", clock(w.start), clock(w.end), w.loc)
+}
@@ -0,0 +1,76 @@
+package crawl
+
+import (
+	"crawl/crawltest"
+	"testing"
+	"time"
+)
+
+func TestCrawlWindowWait(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	overnight := &crawlWindow{22 * time.Hour, 6 * time.Hour, london}
+	daytime := &crawlWindow{9 * time.Hour, 17*time.Hour + 30*time.Minute, time.UTC}
+	tests := []struct {
+		w    *crawlWindow
+		now  time.Time
+		want time.Duration
+	}{
+		{overnight, time.Date(2020, 11, 1, 23, 0, 0, 0, london), 0},
+		{overnight, time.Date(2020, 11, 1, 5, 59, 0, 0, london), 0},
+		{overnight, time.Date(2020, 11, 1, 6, 0, 0, 0, london), 16 * time.Hour},
+		{overnight, time.Date(2020, 11, 1, 21, 30, 0, 0, london), 30 * time.Minute},
+		// In UTC, but an hour ahead in London during summer time.
+		{overnight, time.Date(2020, 7, 1, 20, 30, 0, 0, time.UTC), 30 * time.Minute},
+		{daytime, time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC), 0},
+		{daytime, time.Date(2020, 11, 1, 8, 0, 0, 0, time.UTC), time.Hour},
+		{daytime, time.Date(2020, 11, 1, 17, 30, 0, 0, time.UTC), 15*time.Hour + 30*time.Minute},
+		{nil, time.Date(2020, 11, 1, 3, 0, 0, 0, time.UTC), 0},
+	}
+	for _, tt := range tests {
+		if got := tt.w.wait(tt.now); got != tt.want {
+			t.Errorf("%v wait(%v) = %v, want %v", tt.w, tt.now, got, tt.want)
+		}
+	}
+	if s := overnight.String(); s != "22:00-06:00 Europe/London" {
+		t.Errorf("String() = %q, want 22:00-06:00 Europe/London", s)
+	}
+}
+
+func TestCrawlWindow(t *testing.T) {
+	clk := crawltest.NewClock(time.Date(2020, 11, 1, 21, 0, 0, 0, time.UTC))
+	site := crawltest.NewFake()
+	site.Page("https://monzo.com", "/foo")
+	site.Page("https://monzo.com/foo")
+
+	c := NewCrawler(1, WithClock(clk), WithCrawlWindow(22*time.Hour, 6*time.Hour, time.UTC), WithTransportMiddleware(site.Wrap))
+	done := make(chan error)
+	go func() {
+		_, err := c.Crawl("https://monzo.com")
+		done <- err
+	}()
+	clk.WaitForTimers(1)
+	if n := len(site.Requests()); n != 0 {
+		t.Errorf("%d requests made before the window opened, want 0", n)
+	}
+	if s := c.Stats(); s.Paused != 0 {
+		t.Errorf("Stats().Paused = %v at the start of the pause, want 0", s.Paused)
+	}
+	clk.Advance(30 * time.Minute)
+	if s := c.Stats(); s.Paused != 30*time.Minute {
+		t.Errorf("Stats().Paused = %v during the pause, want 30m", s.Paused)
+	}
+	clk.Advance(30 * time.Minute)
+	if err := <-done; err != nil {
+		t.Fatalf("Crawl erred when not expected: %v", err)
+	}
+	// The pages, and robots.txt.
+	if n := len(site.Requests()); n != 3 {
+		t.Errorf("%d requests made, want 3", n)
+	}
+	if s := c.Stats(); s.Paused != time.Hour {
+		t.Errorf("Stats().Paused = %v, want 1h", s.Paused)
+	}
+}